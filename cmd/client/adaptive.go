@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// targetChunkRTT — желаемое время отправки одного чанка.
+	// Быстрее — чанк увеличивается, заметно медленнее — уменьшается.
+	targetChunkRTT = 2 * time.Second
+	// maxChunkAttempts — число попыток отправки одного чанка.
+	maxChunkAttempts = 5
+)
+
+// adaptiveController подбирает размер чанка и число параллельных запросов
+// по измеренному времени отправки чанков и ошибкам.
+type adaptiveController struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	chunkSize, minChunk, maxChunk int64
+	workers, maxWorkers, inFlight int
+
+	// Окно измерения пропускной способности
+	windowStart    time.Time
+	windowBytes    int64
+	windowChunks   int
+	lastThroughput float64
+}
+
+func newAdaptiveController(chunkSize, minChunk, maxChunk int64, maxWorkers int) *adaptiveController {
+	if minChunk <= 0 || minChunk > chunkSize {
+		minChunk = chunkSize
+	}
+	if maxChunk < chunkSize {
+		maxChunk = chunkSize
+	}
+	c := &adaptiveController{
+		chunkSize:   chunkSize,
+		minChunk:    minChunk,
+		maxChunk:    maxChunk,
+		workers:     min(2, maxWorkers),
+		maxWorkers:  maxWorkers,
+		windowStart: time.Now(),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// acquire ждёт свободный слот и возвращает размер следующего чанка.
+func (c *adaptiveController) acquire() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.inFlight >= c.workers {
+		c.cond.Wait()
+	}
+	c.inFlight++
+	return c.chunkSize
+}
+
+// release освобождает слот.
+func (c *adaptiveController) release() {
+	c.mu.Lock()
+	c.inFlight--
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+// record учитывает результат одной попытки отправки чанка.
+func (c *adaptiveController) record(size int64, rtt time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		// Ошибка: уменьшаем и чанк, и параллелизм
+		c.chunkSize = max(c.minChunk, c.chunkSize/2)
+		c.workers = max(1, c.workers-1)
+		c.resetWindow()
+		log.Printf("Adaptive: error, chunk size %d, workers %d", c.chunkSize, c.workers)
+		return
+	}
+
+	switch {
+	case rtt < targetChunkRTT/2 && c.chunkSize < c.maxChunk:
+		c.chunkSize = min(c.maxChunk, c.chunkSize*2)
+	case rtt > targetChunkRTT*2 && c.chunkSize > c.minChunk:
+		c.chunkSize = max(c.minChunk, c.chunkSize/2)
+	}
+
+	c.windowBytes += size
+	c.windowChunks++
+	if c.windowChunks < 2*c.workers {
+		return
+	}
+
+	// Окно заполнено: добавляем воркер, пока это заметно увеличивает пропускную способность
+	throughput := float64(c.windowBytes) / time.Since(c.windowStart).Seconds()
+	switch {
+	case throughput > c.lastThroughput*1.1 && c.workers < c.maxWorkers:
+		c.workers++
+		c.cond.Broadcast()
+	case throughput < c.lastThroughput*0.8 && c.workers > 1:
+		c.workers--
+	}
+	log.Printf("Adaptive: %.0f B/s, chunk size %d, workers %d", throughput, c.chunkSize, c.workers)
+	c.lastThroughput = throughput
+	c.resetWindow()
+}
+
+func (c *adaptiveController) resetWindow() {
+	c.windowStart = time.Now()
+	c.windowBytes = 0
+	c.windowChunks = 0
+}
+
+// uploadAdaptive читает r чанками переменного размера и отправляет их по смещению.
+func uploadAdaptive(serverURL, sessionID string, r io.Reader, ctrl *adaptiveController) (int64, error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var sendErr error
+
+	var offset int64
+	for {
+		size := ctrl.acquire()
+		mu.Lock()
+		failed := sendErr != nil
+		mu.Unlock()
+		if failed {
+			ctrl.release()
+			break
+		}
+
+		buf := make([]byte, size)
+		n, err := io.ReadFull(r, buf)
+		if n == 0 {
+			ctrl.release()
+			if err != nil && err != io.EOF {
+				wg.Wait()
+				return offset, fmt.Errorf("error reading input: %w", err)
+			}
+			break
+		}
+
+		wg.Add(1)
+		go func(offset int64, data []byte) {
+			defer wg.Done()
+			defer ctrl.release()
+			if err := sendChunkAt(serverURL, sessionID, offset, data, ctrl); err != nil {
+				mu.Lock()
+				if sendErr == nil {
+					sendErr = fmt.Errorf("chunk at offset %d: %w", offset, err)
+				}
+				mu.Unlock()
+			}
+		}(offset, buf[:n])
+		offset += int64(n)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			wg.Wait()
+			return offset, fmt.Errorf("error reading input: %w", err)
+		}
+	}
+
+	wg.Wait()
+	return offset, sendErr
+}
+
+// sendChunkAt отправляет чанк по смещению с повторами и экспоненциальной паузой.
+func sendChunkAt(serverURL, sessionID string, offset int64, data []byte, ctrl *adaptiveController) error {
+	backoff := 500 * time.Millisecond
+	var err error
+	for attempt := 1; attempt <= maxChunkAttempts; attempt++ {
+		begin := time.Now()
+		err = postChunk(serverURL, sessionID, data, "offset", strconv.FormatInt(offset, 10))
+
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict && apiErr.Message == "Chunk already uploaded." {
+			// Предыдущая попытка дошла до сервера, но ответ потерялся
+			err = nil
+		}
+		ctrl.record(int64(len(data)), time.Since(begin), err)
+		if err == nil {
+			log.Printf("Chunk at offset %d (%d bytes) sent successfully", offset, len(data))
+			return nil
+		}
+		if !isRetryable(err) {
+			return err
+		}
+		log.Printf("Error sending chunk at offset %d (attempt %d): %v", offset, attempt, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return err
+}
+
+// isRetryable сообщает, имеет ли смысл повторить запрос: сетевые ошибки, 5xx и 408/429.
+func isRetryable(err error) bool {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusRequestTimeout || apiErr.StatusCode == http.StatusTooManyRequests
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// apiError — ответ сервера с кодом, отличным от 2xx.
+type apiError struct {
+	StatusCode int
+	Message    string
+	Details    interface{}
+}
+
+func (e *apiError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("server returned status %d", e.StatusCode)
+	}
+	if e.Details != nil {
+		return fmt.Sprintf("server returned status %d: %s (%v)", e.StatusCode, e.Message, e.Details)
+	}
+	return fmt.Sprintf("server returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// readAPIError разбирает тело ответа с ошибкой в формате sendErrorResponse.
+func readAPIError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	apiErr := &apiError{StatusCode: resp.StatusCode}
+	var payload struct {
+		Message string      `json:"message"`
+		Details interface{} `json:"details"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		apiErr.Message = payload.Message
+		apiErr.Details = payload.Details
+	} else {
+		apiErr.Message = string(bytes.TrimSpace(body))
+	}
+	return apiErr
+}
+
+// adminToken передаётся в заголовке Authorization, если задан флагом -admin-token.
+var adminToken string
+
+// doJSON выполняет запрос с JSON-телом и декодирует JSON-ответ в out.
+func doJSON(method, url string, payload interface{}, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		requestBody, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to create request body: %v", err)
+		}
+		body = bytes.NewReader(requestBody)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if adminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return readAPIError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// batchFile и batchInfo — пакет загрузок в ответах /batches.
+type batchFile struct {
+	SessionID    string `json:"session_id"`
+	FileName     string `json:"file_name"`
+	FileSize     int64  `json:"file_size"`
+	ChunkSize    int64  `json:"chunk_size"`
+	Instant      bool   `json:"instant"`
+	UploadedSize int64  `json:"uploaded_size"`
+	Completed    bool   `json:"completed"`
+	StoredName   string `json:"stored_name"`
+	Version      int    `json:"version"`
+	Status       string `json:"status"`
+}
+
+type batchInfo struct {
+	ID     string      `json:"batch_id"`
+	Status string      `json:"status"`
+	Files  []batchFile `json:"files"`
+	Error  string      `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Batch batchInfo `json:"batch"`
+}
+
+func runBatch(args []string) int {
+	fs, common := newFlagSet("batch")
+	namespaceFlag := fs.String("namespace", "", "Server namespace (bucket) to store the files in")
+	ownerFlag := fs.String("owner", "", "Owner recorded with the upload sessions")
+	statusFlag := fs.String("status", "", "Show the status of this batch instead of uploading")
+	abortFlag := fs.String("abort", "", "Abort this batch instead of uploading")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *statusFlag != "" && *abortFlag != "" {
+		fmt.Fprintln(os.Stderr, "batch: -status cannot be combined with -abort")
+		return exitUsage
+	}
+	if *statusFlag == "" && *abortFlag == "" && fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "batch: at least one file is required (batch FILE...)")
+		fs.Usage()
+		return exitUsage
+	}
+
+	serverURL, err := common.serverURL()
+	if err != nil {
+		return common.fail(err)
+	}
+
+	var batch *batchInfo
+	switch {
+	case *statusFlag != "":
+		var response batchResponse
+		err = doJSON("GET", fmt.Sprintf("%s/batches/%s", serverURL, *statusFlag), nil, &response)
+		batch = &response.Batch
+	case *abortFlag != "":
+		var response batchResponse
+		err = doJSON("DELETE", fmt.Sprintf("%s/batches/%s", serverURL, *abortFlag), nil, &response)
+		batch = &response.Batch
+	default:
+		batch, err = uploadBatch(serverURL, fs.Args(), uploadOptions{owner: *ownerFlag, namespace: *namespaceFlag})
+	}
+	if err != nil {
+		return common.fail(err)
+	}
+
+	common.printResult(map[string]interface{}{"status": "success", "batch": batch}, func() {
+		fmt.Printf("Batch %s: %s\n", batch.ID, batch.Status)
+		if batch.Error != "" {
+			fmt.Printf("Error: %s\n", batch.Error)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tSIZE\tUPLOADED\tVERSION\tSTATUS")
+		for _, file := range batch.Files {
+			name := file.FileName
+			if file.StoredName != "" {
+				name = file.StoredName
+			}
+			uploaded := fmt.Sprintf("%d", file.UploadedSize)
+			if file.Instant {
+				uploaded = "instant"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%s\n", name, file.FileSize, uploaded, file.Version, file.Status)
+		}
+		w.Flush()
+	})
+	return exitOK
+}
+
+// uploadBatch загружает файлы одним пакетом: либо на сервере появятся все, либо ни один.
+// При ошибке загрузки пакет отменяется.
+func uploadBatch(serverURL string, paths []string, opts uploadOptions) (*batchInfo, error) {
+	manifest := []map[string]interface{}{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("error getting file info: %v", err)
+		}
+		hash, err := CalculateFileHash(path)
+		if err != nil {
+			return nil, fmt.Errorf("error calculating hash of %s: %v", path, err)
+		}
+		manifest = append(manifest, map[string]interface{}{
+			"file_name": storageKey(path),
+			"file_size": info.Size(),
+			"file_hash": hash,
+		})
+	}
+
+	var created batchResponse
+	request := map[string]interface{}{"files": manifest, "owner": opts.owner, "namespace": opts.namespace}
+	if err := doJSON("POST", serverURL+"/batches", request, &created); err != nil {
+		return nil, fmt.Errorf("error creating batch: %w", err)
+	}
+	batchURL := fmt.Sprintf("%s/batches/%s", serverURL, created.Batch.ID)
+	log.Printf("Batch ID: %s, %d files", created.Batch.ID, len(created.Batch.Files))
+
+	for i, file := range created.Batch.Files {
+		if file.Instant {
+			log.Printf("Server already stores the content of %s; upload skipped", file.FileName)
+			continue
+		}
+		if err := uploadBatchFile(serverURL, paths[i], file); err != nil {
+			if abortErr := doJSON("DELETE", batchURL, nil, nil); abortErr != nil {
+				log.Printf("Failed to abort batch %s: %v", created.Batch.ID, abortErr)
+			}
+			return nil, fmt.Errorf("error uploading %s: %w", paths[i], err)
+		}
+	}
+
+	var committed batchResponse
+	if err := doJSON("POST", batchURL+"/commit", nil, &committed); err != nil {
+		return nil, fmt.Errorf("error committing batch: %w", err)
+	}
+	// Сервер с конвейером обработки отвечает 202: ждём, пока пакет будет обработан
+	for committed.Batch.Status == "processing" {
+		time.Sleep(processingPollInterval)
+		if err := doJSON("GET", batchURL, nil, &committed); err != nil {
+			return nil, err
+		}
+	}
+	if committed.Batch.Status != "committed" {
+		return nil, fmt.Errorf("batch %s %s: %s", committed.Batch.ID, committed.Batch.Status, committed.Batch.Error)
+	}
+	return &committed.Batch, nil
+}
+
+func uploadBatchFile(serverURL, path string, file batchFile) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
+	}
+	defer f.Close()
+	_, err = uploadChunks(serverURL, file.SessionID, f, file.ChunkSize)
+	return err
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Параметры content-defined chunking. Границы чанков зависят только от содержимого,
+// поэтому вставка или удаление байт сдвигает лишь соседние чанки, а остальные
+// совпадают с уже загруженными. Параметры должны быть одинаковыми у всех клиентов.
+const (
+	cdcMinSize = 256 * 1024
+	cdcAvgSize = 1024 * 1024
+	cdcMaxSize = 4 * 1024 * 1024
+
+	// Нормализованное разбиение (FastCDC): до среднего размера граница ищется по более
+	// строгой маске, после — по более мягкой, что сужает разброс размеров чанков.
+	cdcMaskStrict = uint64(1<<22-1) << (64 - 22)
+	cdcMaskLoose  = uint64(1<<18-1) << (64 - 18)
+
+	// dedupBatchSize — число хешей в одном запросе lookup/refs.
+	dedupBatchSize = 10000
+)
+
+// gearTable — таблица случайных значений для rolling hash; генерируется детерминированно.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x9E3779B97F4A7C15)
+	for i := range table {
+		// splitmix64
+		state += 0x9E3779B97F4A7C15
+		z := state
+		z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+		z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// cdcCut возвращает длину первого чанка в data.
+func cdcCut(data []byte) int {
+	n := len(data)
+	if n <= cdcMinSize {
+		return n
+	}
+	if n > cdcMaxSize {
+		n = cdcMaxSize
+	}
+	normal := min(n, cdcAvgSize)
+
+	var fp uint64
+	i := cdcMinSize
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+		if fp&cdcMaskStrict == 0 {
+			return i
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+		if fp&cdcMaskLoose == 0 {
+			return i
+		}
+	}
+	return n
+}
+
+// cdcChunk — чанк файла, найденный content-defined chunking.
+type cdcChunk struct {
+	Offset int64
+	Length int64
+	Hash   string
+}
+
+// splitContentDefined разбивает r на чанки и одновременно считает SHA-256 всего потока.
+func splitContentDefined(r io.Reader) ([]cdcChunk, string, int64, error) {
+	fileHash := sha256.New()
+	buf := make([]byte, 0, 2*cdcMaxSize)
+	chunks := []cdcChunk{}
+	var offset int64
+	eof := false
+
+	for {
+		// Держим в буфере не меньше cdcMaxSize байт, пока поток не кончился
+		for !eof && len(buf) < cdcMaxSize {
+			n, err := r.Read(buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+n]
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return nil, "", 0, fmt.Errorf("error reading input: %w", err)
+			}
+		}
+		if len(buf) == 0 {
+			break
+		}
+
+		cut := cdcCut(buf)
+		chunkHash := sha256.Sum256(buf[:cut])
+		fileHash.Write(buf[:cut])
+		chunks = append(chunks, cdcChunk{Offset: offset, Length: int64(cut), Hash: hex.EncodeToString(chunkHash[:])})
+		offset += int64(cut)
+		buf = buf[:copy(buf, buf[cut:])]
+	}
+	return chunks, hex.EncodeToString(fileHash.Sum(nil)), offset, nil
+}
+
+// uploadDedup загружает файл с дедупликацией: на сервер отправляются только чанки,
+// которых ещё нет в его хранилище, остальные подставляются в сессию по хешу.
+func uploadDedup(serverURL, filePath, fileName string, opts uploadOptions) (*uploadResult, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	begin := time.Now()
+	chunks, fileHash, fileSize, err := splitContentDefined(file)
+	if err != nil {
+		return nil, err
+	}
+	if fileSize == 0 {
+		return nil, errors.New("cannot upload an empty file")
+	}
+	log.Printf("Split %s into %d content-defined chunks", filePath, len(chunks))
+
+	opts.adaptive = true // запрашиваем режим offset
+	session, err := createSession(serverURL, fileName, fileSize, fileHash, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error creating session: %w", err)
+	}
+	result := &uploadResult{
+		Status:    "success",
+		SessionID: session.SessionID,
+		FileName:  fileName,
+		FileSize:  fileSize,
+		FileHash:  fileHash,
+	}
+	if session.Status == "already_present" {
+		result.Status = session.Status
+		result.FileName = session.FileName
+		result.Duration = "0s"
+		return result, nil
+	}
+	if session.ChunkMode != "offset" {
+		return nil, fmt.Errorf("session %s uses fixed-size chunks; delete it or upload without -dedup", session.SessionID)
+	}
+	if session.MinChunkSize > cdcMinSize || (session.MaxChunkSize > 0 && session.MaxChunkSize < cdcMaxSize) {
+		return nil, fmt.Errorf("server chunk limits [%d, %d] do not allow deduplicated upload", session.MinChunkSize, session.MaxChunkSize)
+	}
+
+	// Какие чанки сервер уже хранит
+	unique := []cdcChunk{}
+	seen := map[string]bool{}
+	for _, chunk := range chunks {
+		if !seen[chunk.Hash] {
+			seen[chunk.Hash] = true
+			unique = append(unique, chunk)
+		}
+	}
+	missing := map[string]bool{}
+	for start := 0; start < len(unique); start += dedupBatchSize {
+		batch := unique[start:min(start+dedupBatchSize, len(unique))]
+		hashes := make([]string, len(batch))
+		for i, chunk := range batch {
+			hashes[i] = chunk.Hash
+		}
+		var lookup struct {
+			Missing []string `json:"missing"`
+		}
+		if err := doJSON("POST", serverURL+"/chunks/lookup", map[string]interface{}{"hashes": hashes}, &lookup); err != nil {
+			return nil, fmt.Errorf("error looking up chunks: %w", err)
+		}
+		for _, hash := range lookup.Missing {
+			missing[hash] = true
+		}
+	}
+
+	// Загружаем недостающие чанки в хранилище сервера
+	toStore := []cdcChunk{}
+	var storedBytes int64
+	for _, chunk := range unique {
+		if missing[chunk.Hash] {
+			toStore = append(toStore, chunk)
+			storedBytes += chunk.Length
+		}
+	}
+	log.Printf("%d of %d unique chunks (%d of %d bytes) must be uploaded", len(toStore), len(unique), storedBytes, fileSize)
+	if err := storeChunks(serverURL, file, toStore, opts.maxWorkers); err != nil {
+		return nil, fmt.Errorf("error uploading chunks: %w", err)
+	}
+
+	// Собираем сессию из чанков хранилища
+	for start := 0; start < len(chunks); start += dedupBatchSize {
+		batch := chunks[start:min(start+dedupBatchSize, len(chunks))]
+		refs := make([]map[string]interface{}, len(batch))
+		for i, chunk := range batch {
+			refs[i] = map[string]interface{}{"offset": chunk.Offset, "hash": chunk.Hash}
+		}
+		var linked struct {
+			Missing []struct {
+				Offset int64 `json:"offset"`
+			} `json:"missing"`
+		}
+		url := fmt.Sprintf("%s/upload/%s/refs", serverURL, session.SessionID)
+		if err := doJSON("POST", url, map[string]interface{}{"chunks": refs}, &linked); err != nil {
+			return nil, fmt.Errorf("error linking chunks: %w", err)
+		}
+		if len(linked.Missing) > 0 {
+			return nil, fmt.Errorf("server lost %d chunks during upload, starting at offset %d", len(linked.Missing), linked.Missing[0].Offset)
+		}
+	}
+
+	if err := completeUpload(serverURL, session.SessionID, nil); err != nil {
+		return nil, fmt.Errorf("error completing upload: %w", err)
+	}
+	result.ChunkSize = session.ChunkSize
+	result.Duration = time.Since(begin).Round(time.Millisecond).String()
+	return result, nil
+}
+
+// storeChunks параллельно загружает чанки файла в хранилище чанков сервера.
+func storeChunks(serverURL string, file *os.File, chunks []cdcChunk, workers int) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var sendErr error
+	queue := make(chan cdcChunk)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range queue {
+				data := make([]byte, chunk.Length)
+				_, err := file.ReadAt(data, chunk.Offset)
+				if err == nil {
+					err = storeChunk(serverURL, data)
+				}
+				if err != nil {
+					mu.Lock()
+					if sendErr == nil {
+						sendErr = fmt.Errorf("chunk at offset %d: %w", chunk.Offset, err)
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, chunk := range chunks {
+		mu.Lock()
+		failed := sendErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		queue <- chunk
+	}
+	close(queue)
+	wg.Wait()
+	return sendErr
+}
+
+// storeChunk отправляет чанк в хранилище с повторами и экспоненциальной паузой.
+func storeChunk(serverURL string, data []byte) error {
+	backoff := 500 * time.Millisecond
+	var err error
+	for attempt := 1; attempt <= maxChunkAttempts; attempt++ {
+		if err = postChunkData(serverURL+"/chunks", data, nil); err == nil || !isRetryable(err) {
+			return err
+		}
+		log.Printf("Error storing chunk (attempt %d): %v", attempt, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return err
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"BASProject/internal/utils"
+)
+
+// flagOrArg берёт значение из флага или единственного позиционного аргумента.
+func flagOrArg(fs *flag.FlagSet, value string) string {
+	if value != "" {
+		return value
+	}
+	if fs.NArg() == 1 {
+		return fs.Arg(0)
+	}
+	return ""
+}
+
+// statusResponse — ответ /upload/status/{session_id}.
+type statusResponse struct {
+	Status         string             `json:"status"`
+	SessionID      string             `json:"session_id"`
+	FileName       string             `json:"file_name"`
+	FileSize       int64              `json:"file_size"`
+	UploadedSize   int64              `json:"uploaded_size"`
+	SessionStatus  string             `json:"session_status"`
+	UploadedChunks []int              `json:"uploaded_chunks"`
+	PendingChunks  []int              `json:"pending_chunks"`
+	TotalChunks    int                `json:"total_chunks"`
+	Message        string             `json:"message"`
+	StoredName     string             `json:"stored_name,omitempty"`
+	FileStatus     string             `json:"file_status,omitempty"`
+	Processing     []processorOutcome `json:"processing,omitempty"`
+	Extract        bool               `json:"extract,omitempty"`
+	Extraction     *extractionResult  `json:"extraction,omitempty"`
+}
+
+// processorOutcome — результат обработчика конвейера на сервере.
+type processorOutcome struct {
+	Processor string `json:"processor"`
+	Status    string `json:"status"`
+	Message   string `json:"message,omitempty"`
+	Duration  string `json:"duration"`
+}
+
+func runStatus(args []string) int {
+	fs, common := newFlagSet("status")
+	idFlag := fs.String("id", "", "Upload session ID")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	sessionID := flagOrArg(fs, *idFlag)
+	if sessionID == "" {
+		fmt.Fprintln(os.Stderr, "status: session ID is required (-id ID)")
+		fs.Usage()
+		return exitUsage
+	}
+
+	serverURL, err := common.serverURL()
+	if err != nil {
+		return common.fail(err)
+	}
+
+	var status statusResponse
+	if err := doJSON("GET", serverURL+"/upload/status/"+url.PathEscape(sessionID), nil, &status); err != nil {
+		return common.fail(err)
+	}
+
+	common.printResult(status, func() {
+		fmt.Printf("Session:  %s\n", status.SessionID)
+		fmt.Printf("File:     %s\n", status.FileName)
+		fmt.Printf("State:    %s\n", status.SessionStatus)
+		fmt.Printf("Uploaded: %d / %d bytes\n", status.UploadedSize, status.FileSize)
+		fmt.Printf("Chunks:   %d of %d uploaded, %d pending\n", len(status.UploadedChunks), status.TotalChunks, len(status.PendingChunks))
+		if status.FileStatus != "" {
+			fmt.Printf("Stored:   %s (%s)\n", status.StoredName, status.FileStatus)
+			for _, outcome := range status.Processing {
+				fmt.Printf("  %-20s %-7s %s %s\n", outcome.Processor, outcome.Status, outcome.Duration, outcome.Message)
+			}
+		}
+		fmt.Println(status.Message)
+	})
+	return exitOK
+}
+
+// sessionSummary и storedFile повторяют элементы ответов /upload/sessions и /files.
+type sessionSummary struct {
+	SessionID    string `json:"session_id"`
+	FileName     string `json:"file_name"`
+	FileSize     int64  `json:"file_size"`
+	UploadedSize int64  `json:"uploaded_size"`
+	ChunkSize    int64  `json:"chunk_size"`
+	Status       string `json:"status"`
+	Deferred     bool   `json:"deferred"`
+}
+
+type storedFile struct {
+	Name          string            `json:"name"`
+	Size          int64             `json:"size"`
+	ModTime       time.Time         `json:"mod_time"`
+	ContentType   string            `json:"content_type,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	Status        string            `json:"status,omitempty"`
+	ExtractedFrom string            `json:"extracted_from,omitempty"`
+	Version       int               `json:"version"`
+	Thumbnails    []struct {
+		Size        int    `json:"size"`
+		Width       int    `json:"width"`
+		Height      int    `json:"height"`
+		ContentType string `json:"content_type"`
+	} `json:"thumbnails,omitempty"`
+}
+
+func runList(args []string) int {
+	fs, common := newFlagSet("list")
+	sessionsOnly := fs.Bool("sessions", false, "List only upload sessions")
+	filesOnly := fs.Bool("files", false, "List only stored files")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "list: unexpected arguments")
+		fs.Usage()
+		return exitUsage
+	}
+	showSessions := *sessionsOnly || !*filesOnly
+	showFiles := *filesOnly || !*sessionsOnly
+
+	serverURL, err := common.serverURL()
+	if err != nil {
+		return common.fail(err)
+	}
+
+	result := map[string]interface{}{"status": "success"}
+	var sessions struct {
+		Sessions []sessionSummary `json:"sessions"`
+	}
+	var files struct {
+		Files []storedFile `json:"files"`
+	}
+	if showSessions {
+		if err := doJSON("GET", serverURL+"/upload/sessions", nil, &sessions); err != nil {
+			return common.fail(err)
+		}
+		result["sessions"] = sessions.Sessions
+	}
+	if showFiles {
+		if err := doJSON("GET", serverURL+"/files", nil, &files); err != nil {
+			return common.fail(err)
+		}
+		result["files"] = files.Files
+	}
+
+	common.printResult(result, func() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		if showSessions {
+			fmt.Fprintln(w, "SESSION\tSTATUS\tUPLOADED\tSIZE\tFILE")
+			for _, s := range sessions.Sessions {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", s.SessionID, s.Status, s.UploadedSize, s.FileSize, s.FileName)
+			}
+		}
+		if showSessions && showFiles {
+			fmt.Fprintln(w)
+		}
+		if showFiles {
+			fmt.Fprintln(w, "FILE\tSIZE\tVERSION\tMODIFIED")
+			for _, f := range files.Files {
+				fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", f.Name, f.Size, f.Version, f.ModTime.Format(time.RFC3339))
+			}
+		}
+		w.Flush()
+	})
+	return exitOK
+}
+
+func runDelete(args []string) int {
+	fs, common := newFlagSet("delete")
+	idFlag := fs.String("id", "", "Upload session ID")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	sessionID := flagOrArg(fs, *idFlag)
+	if sessionID == "" {
+		fmt.Fprintln(os.Stderr, "delete: session ID is required (-id ID)")
+		fs.Usage()
+		return exitUsage
+	}
+
+	serverURL, err := common.serverURL()
+	if err != nil {
+		return common.fail(err)
+	}
+
+	var result map[string]interface{}
+	if err := doJSON("DELETE", serverURL+"/upload/"+url.PathEscape(sessionID), nil, &result); err != nil {
+		return common.fail(err)
+	}
+
+	common.printResult(result, func() {
+		fmt.Printf("Session %s deleted.\n", sessionID)
+	})
+	return exitOK
+}
+
+// filesURL возвращает адрес файла name; каждый сегмент пути экранируется отдельно,
+// чтобы сохранить вложенные каталоги.
+func filesURL(serverURL, name string) string {
+	return storedURL(serverURL, "files", name)
+}
+
+// storedURL возвращает адрес ресурса файла name под префиксом prefix (files, versions).
+func storedURL(serverURL, prefix, name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return serverURL + "/" + prefix + "/" + strings.Join(segments, "/")
+}
+
+func runDownload(args []string) int {
+	fs, common := newFlagSet("download")
+	nameFlag := fs.String("name", "", "Name of the stored file (as shown by 'list -files')")
+	outFlag := fs.String("o", "", "Output path, or - for stdout (default: base name of the file)")
+	versionFlag := fs.Int("version", 0, "Download this version instead of the current one (see 'versions')")
+	e2eKeyFlag := fs.String("e2e-key", "", "Decrypt a file uploaded with -e2e-key using the key from this file")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	name := flagOrArg(fs, *nameFlag)
+	if name == "" {
+		fmt.Fprintln(os.Stderr, "download: file name is required (-name NAME)")
+		fs.Usage()
+		return exitUsage
+	}
+	if *outFlag == "-" && *common.json {
+		fmt.Fprintln(os.Stderr, "download: -json cannot be combined with -o -")
+		return exitUsage
+	}
+
+	var e2eKey []byte
+	if *e2eKeyFlag != "" {
+		key, err := utils.LoadKeyFile(*e2eKeyFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "download: %v\n", err)
+			return exitUsage
+		}
+		e2eKey = key
+	}
+
+	serverURL, err := common.serverURL()
+	if err != nil {
+		return common.fail(err)
+	}
+
+	fileURL := filesURL(serverURL, name)
+	if *versionFlag > 0 {
+		fileURL += "?version=" + strconv.Itoa(*versionFlag)
+	}
+	resp, err := http.Get(fileURL)
+	if err != nil {
+		return common.fail(fmt.Errorf("failed to download file: %v", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return common.fail(readAPIError(resp))
+	}
+
+	outPath := *outFlag
+	if outPath == "" {
+		outPath = path.Base(name)
+	}
+	var out io.Writer = os.Stdout
+	if outPath != "-" {
+		file, err := os.Create(outPath)
+		if err != nil {
+			return common.fail(fmt.Errorf("failed to create output file: %v", err))
+		}
+		defer file.Close()
+		out = file
+	}
+
+	var written int64
+	if e2eKey != nil {
+		written, err = decryptStream(e2eKey, resp.Body, out)
+	} else {
+		written, err = io.Copy(out, resp.Body)
+	}
+	if err != nil {
+		return common.fail(fmt.Errorf("failed to write output: %v", err))
+	}
+
+	if outPath != "-" {
+		common.printResult(map[string]interface{}{
+			"status": "success",
+			"name":   name,
+			"path":   outPath,
+			"size":   written,
+		}, func() {
+			fmt.Printf("Downloaded %s to %s (%d bytes)\n", name, outPath, written)
+		})
+	}
+	return exitOK
+}
+
+// rewrapProgress повторяет ответ /admin/keys/rewrap.
+// fileVersion — версия файла из /versions/{name}.
+type fileVersion struct {
+	Version   int       `json:"version"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	Current   bool      `json:"current"`
+	FileHash  string    `json:"file_hash,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	Status    string    `json:"status,omitempty"`
+}
+
+func runVersions(args []string) int {
+	fs, common := newFlagSet("versions")
+	nameFlag := fs.String("name", "", "Name of the stored file (as shown by 'list -files')")
+	promote := fs.Int("promote", 0, "Make this version current")
+	remove := fs.Int("delete", 0, "Delete this version; deleting the current one promotes the newest previous version")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	name := flagOrArg(fs, *nameFlag)
+	if name == "" {
+		fmt.Fprintln(os.Stderr, "versions: file name is required (-name NAME)")
+		fs.Usage()
+		return exitUsage
+	}
+	if *promote > 0 && *remove > 0 {
+		fmt.Fprintln(os.Stderr, "versions: -promote cannot be combined with -delete")
+		return exitUsage
+	}
+
+	serverURL, err := common.serverURL()
+	if err != nil {
+		return common.fail(err)
+	}
+	versionsURL := storedURL(serverURL, "versions", name)
+
+	switch {
+	case *promote > 0:
+		var result map[string]interface{}
+		if err := doJSON("POST", fmt.Sprintf("%s/%d/promote", versionsURL, *promote), nil, &result); err != nil {
+			return common.fail(err)
+		}
+		common.printResult(result, func() {
+			fmt.Printf("Version %d of %s is now current.\n", *promote, name)
+		})
+		return exitOK
+	case *remove > 0:
+		var result map[string]interface{}
+		if err := doJSON("DELETE", fmt.Sprintf("%s/%d", versionsURL, *remove), nil, &result); err != nil {
+			return common.fail(err)
+		}
+		common.printResult(result, func() {
+			fmt.Printf("Version %d of %s deleted.\n", *remove, name)
+		})
+		return exitOK
+	}
+
+	var response struct {
+		Versions []fileVersion `json:"versions"`
+	}
+	if err := doJSON("GET", versionsURL, nil, &response); err != nil {
+		return common.fail(err)
+	}
+	common.printResult(map[string]interface{}{"status": "success", "name": name, "versions": response.Versions}, func() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tSIZE\tMODIFIED\tSTATUS\tHASH")
+		for _, v := range response.Versions {
+			version := strconv.Itoa(v.Version)
+			if v.Current {
+				version += " (current)"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", version, v.Size, v.ModTime.Format(time.RFC3339), v.Status, v.FileHash)
+		}
+		w.Flush()
+	})
+	return exitOK
+}
+
+type rewrapProgress struct {
+	State     string   `json:"state"`
+	ActiveKey string   `json:"active_key"`
+	Total     int      `json:"total"`
+	Processed int      `json:"processed"`
+	Rewrapped int      `json:"rewrapped"`
+	Skipped   int      `json:"skipped"`
+	Failed    int      `json:"failed"`
+	Errors    []string `json:"errors"`
+}
+
+func runRewrap(args []string) int {
+	fs, common := newFlagSet("rewrap")
+	statusOnly := fs.Bool("status", false, "Only show the progress of the last rewrap")
+	wait := fs.Bool("wait", true, "Wait until the rewrap finishes")
+	interval := fs.Duration("interval", 2*time.Second, "Progress polling interval")
+	tokenFlag := fs.String("admin-token", os.Getenv("BAS_ADMIN_TOKEN"), "Admin API token (default $BAS_ADMIN_TOKEN)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	adminToken = *tokenFlag
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "rewrap: unexpected arguments")
+		fs.Usage()
+		return exitUsage
+	}
+
+	serverURL, err := common.serverURL()
+	if err != nil {
+		return common.fail(err)
+	}
+
+	var response struct {
+		Progress rewrapProgress `json:"progress"`
+	}
+	if !*statusOnly {
+		if err := doJSON("POST", serverURL+"/admin/keys/rewrap", nil, &response); err != nil {
+			return common.fail(err)
+		}
+	}
+	for {
+		if err := doJSON("GET", serverURL+"/admin/keys/rewrap", nil, &response); err != nil {
+			return common.fail(err)
+		}
+		if *statusOnly || !*wait || response.Progress.State != "running" {
+			break
+		}
+		if !*common.json {
+			fmt.Fprintf(os.Stderr, "\rRewrapping: %d / %d files", response.Progress.Processed, response.Progress.Total)
+		}
+		time.Sleep(*interval)
+	}
+
+	progress := response.Progress
+	common.printResult(progress, func() {
+		if *wait && !*statusOnly {
+			fmt.Fprintln(os.Stderr)
+		}
+		fmt.Printf("State:      %s\n", progress.State)
+		fmt.Printf("Active key: %s\n", progress.ActiveKey)
+		fmt.Printf("Files:      %d / %d processed, %d rewrapped, %d skipped, %d failed\n",
+			progress.Processed, progress.Total, progress.Rewrapped, progress.Skipped, progress.Failed)
+		for _, e := range progress.Errors {
+			fmt.Printf("  %s\n", e)
+		}
+	})
+	if progress.State == "failed" {
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// compressSampleSize — объём начала чанка, по которому оценивается сжимаемость.
+	compressSampleSize = 64 * 1024
+	// minCompressionGain — сжатие используется, только если экономит не меньше 10%.
+	minCompressionGain = 0.9
+)
+
+// chunkCompression — Content-Encoding для отправки чанков, задаётся флагом -compress.
+var chunkCompression string
+
+// compressBody сжимает тело запроса с чанком data, если включено сжатие и оно выгодно.
+// Возвращает тело для отправки и значение Content-Encoding (пустое — без сжатия).
+func compressBody(body, data []byte) ([]byte, string) {
+	if chunkCompression == "" {
+		return body, ""
+	}
+	// Уже сжатые данные (архивы, видео) отсеиваем по образцу, не сжимая весь чанк
+	sample := data[:min(len(data), compressSampleSize)]
+	if compressed := compressBytes(sample); float64(len(compressed)) > float64(len(sample))*minCompressionGain {
+		return body, ""
+	}
+	compressed := compressBytes(body)
+	if float64(len(compressed)) > float64(len(body))*minCompressionGain {
+		return body, ""
+	}
+	return compressed, chunkCompression
+}
+
+func compressBytes(data []byte) []byte {
+	if chunkCompression == "zstd" {
+		encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		defer encoder.Close()
+		return encoder.EncodeAll(data, nil)
+	}
+	var buf bytes.Buffer
+	writer, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	writer.Write(data)
+	writer.Close()
+	return buf.Bytes()
+}
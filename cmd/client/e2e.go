@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"BASProject/internal/utils"
+)
+
+// Формат файла со сквозным шифрованием (сервер хранит только шифротекст):
+//
+//	magic (8) | длина ID ключа (1) | ID ключа пользователя | соль (32) | размер чанка (4) | сегменты
+//
+// Каждый чанк загрузки — один сегмент AES-256-GCM, первый чанк дополнительно несёт заголовок,
+// поэтому все чанки, кроме последнего, занимают ровно размер чанка сессии.
+// Ключ файла выводится из ключа пользователя и случайной соли (HMAC-SHA256); nonce сегмента —
+// номер чанка и флаг последнего сегмента, заголовок аутентифицируется как дополнительные данные.
+const (
+	e2eMagic    = "BASE2E01"
+	e2eSaltSize = 32
+)
+
+var errE2ECorrupted = errors.New("encrypted file is corrupted, truncated or was encrypted with another key")
+
+// e2eCipher шифрует или расшифровывает один файл.
+type e2eCipher struct {
+	aead      cipher.AEAD
+	header    []byte
+	chunkSize int64
+}
+
+// segmentSize возвращает размер открытых данных сегмента index.
+func (c *e2eCipher) segmentSize(index uint32) int64 {
+	size := c.chunkSize - int64(c.aead.Overhead())
+	if index == 0 {
+		size -= int64(len(c.header))
+	}
+	return size
+}
+
+func (c *e2eCipher) nonce(index uint32, last bool) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	binary.BigEndian.PutUint32(nonce[len(nonce)-5:], index)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+func newE2ECipher(key, salt []byte, header []byte, chunkSize int64) (*e2eCipher, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	c := &e2eCipher{aead: aead, header: header, chunkSize: chunkSize}
+	if c.segmentSize(0) <= 0 {
+		return nil, fmt.Errorf("chunk size %d is too small for end-to-end encryption", chunkSize)
+	}
+	return c, nil
+}
+
+// newE2EEncrypter создаёт шифр для нового файла, загружаемого чанками по chunkSize байт.
+func newE2EEncrypter(key []byte, chunkSize int64) (*e2eCipher, error) {
+	if chunkSize > 1<<32-1 {
+		return nil, fmt.Errorf("chunk size %d is too large for end-to-end encryption", chunkSize)
+	}
+	salt := make([]byte, e2eSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	keyID := utils.KeyID(key)
+	header := make([]byte, 0, len(e2eMagic)+1+len(keyID)+e2eSaltSize+4)
+	header = append(header, e2eMagic...)
+	header = append(header, byte(len(keyID)))
+	header = append(header, keyID...)
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, uint32(chunkSize))
+	return newE2ECipher(key, salt, header, chunkSize)
+}
+
+// e2eReader отдаёт шифротекст файла: заголовок и сегменты по одному на чанк.
+type e2eReader struct {
+	cipher *e2eCipher
+	src    *bufio.Reader
+	index  uint32
+	buf    []byte
+	done   bool
+}
+
+// encryptStream оборачивает r шифрованием; чанки шифротекста по chunkSize байт совпадают с сегментами.
+func encryptStream(key []byte, r io.Reader, chunkSize int64) (io.Reader, error) {
+	c, err := newE2EEncrypter(key, chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	return &e2eReader{cipher: c, src: bufio.NewReader(r)}, nil
+}
+
+func (e *e2eReader) Read(p []byte) (int, error) {
+	for len(e.buf) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.seal(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.buf)
+	e.buf = e.buf[n:]
+	return n, nil
+}
+
+// seal читает и шифрует очередной сегмент; последний определяется по концу входного потока.
+func (e *e2eReader) seal() error {
+	plain := make([]byte, e.cipher.segmentSize(e.index))
+	n, err := io.ReadFull(e.src, plain)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("error reading input: %w", err)
+	}
+	last := err != nil
+	if !last {
+		if _, err := e.src.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return fmt.Errorf("error reading input: %w", err)
+		}
+	}
+
+	var out []byte
+	if e.index == 0 {
+		out = append(out, e.cipher.header...)
+	}
+	e.buf = e.cipher.aead.Seal(out, e.cipher.nonce(e.index, last), plain[:n], e.cipher.header)
+	e.index++
+	e.done = last
+	return nil
+}
+
+// decryptStream расшифровывает файл, загруженный со сквозным шифрованием, и пишет открытые данные в w.
+func decryptStream(key []byte, r io.Reader, w io.Writer) (int64, error) {
+	src := bufio.NewReader(r)
+	prefix := make([]byte, len(e2eMagic)+1)
+	if _, err := io.ReadFull(src, prefix); err != nil || !bytes.Equal(prefix[:len(e2eMagic)], []byte(e2eMagic)) {
+		return 0, errors.New("file is not end-to-end encrypted")
+	}
+	rest := make([]byte, int(prefix[len(e2eMagic)])+e2eSaltSize+4)
+	if _, err := io.ReadFull(src, rest); err != nil {
+		return 0, errE2ECorrupted
+	}
+	keyID := string(rest[:len(rest)-e2eSaltSize-4])
+	if keyID != utils.KeyID(key) {
+		return 0, fmt.Errorf("file was encrypted with key %s, not with the given key %s", keyID, utils.KeyID(key))
+	}
+	salt := rest[len(keyID) : len(keyID)+e2eSaltSize]
+	chunkSize := int64(binary.BigEndian.Uint32(rest[len(rest)-4:]))
+	c, err := newE2ECipher(key, salt, append(prefix, rest...), chunkSize)
+	if err != nil {
+		return 0, errE2ECorrupted
+	}
+
+	var written int64
+	for index := uint32(0); ; index++ {
+		sealed := make([]byte, c.segmentSize(index)+int64(c.aead.Overhead()))
+		n, err := io.ReadFull(src, sealed)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return written, err
+		}
+		last := err != nil
+		if !last {
+			if _, err := src.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return written, err
+			}
+		}
+		plain, err := c.aead.Open(sealed[:0], c.nonce(index, last), sealed[:n], c.header)
+		if err != nil {
+			return written, errE2ECorrupted
+		}
+		if _, err := w.Write(plain); err != nil {
+			return written, err
+		}
+		written += int64(len(plain))
+		if last {
+			return written, nil
+		}
+	}
+}
@@ -1,273 +1,148 @@
 package main
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
-	"mime/multipart"
-	"net/http"
 	"os"
-	"runtime"
-	"strconv"
-	"sync"
-	"time"
+	"strings"
 
 	"BASProject/config" // Импортируем пакет config
 )
 
-func main() {
-	// Пример данных для отправки
-	fileFlag := flag.String("file", "example.txt", "Path to the file")
-	flag.Parse()
-
-	filePath := *fileFlag
-
-	// Определяем флаги командной строки
-	portFlag := flag.Int("port", 0, "Port for the server (overrides config)")
-	storageFlag := flag.String("storage", "", "Path to storage (overrides config)")
-	flag.Parse()
-
-	// Загрузка конфигурации из файла
-	cfgPath := "config/config.yaml"
-	cfg, err := config.LoadConfig(cfgPath)
-	if err != nil {
-		log.Fatalf("Error loading config: %v", err)
-	}
-
-	// Если значение порта передано через командную строку, то используем его, иначе берем из конфига
-	port := cfg.Server.Port
-	if *portFlag != 0 {
-		port = *portFlag
-	}
-
-	// Если путь к хранилищу передан через командную строку, то используем его, иначе берем из конфига
-	storagePath := cfg.Storage.Path
-	if *storageFlag != "" {
-		storagePath = *storageFlag
-	}
-
-	// Используем обновленные значения порта и пути к хранилищу
-	serverURL := fmt.Sprintf("http://localhost:%d", port)
-	fmt.Printf("Server will start at %s\n", serverURL)
-	fmt.Printf("Storage path is set to %s\n", storagePath)
-
-	// Создание сессии
-	fileHash, err := CalculateFileHash(filePath)
-	if err != nil {
-		log.Fatalf("Error calculating file hash: %v", err)
-	}
-
-	chunkSize, err := createSession(serverURL, filePath, fileHash)
-	if err != nil {
-		log.Fatalf("Error creating session: %v", err)
-	}
-	fmt.Printf("Session ID: %s, Chunk Size: %d\n", fileHash, chunkSize)
-
-	// Открытие файла
-	file, err := os.Open(filePath)
-	if err != nil {
-		log.Fatalf("Error opening file: %v", err)
-	}
-	defer file.Close()
-
-	// Получение размера файла
-	fileInfo, err := file.Stat()
-	if err != nil {
-		log.Fatalf("Error getting file info: %v", err)
-	}
-	fileSize := fileInfo.Size()
-	totalChunks := int((fileSize + int64(chunkSize) - 1) / int64(chunkSize)) // Округление вверх
+// Коды завершения одинаковы для всех подкоманд.
+const (
+	exitOK       = 0 // команда выполнена
+	exitError    = 1 // ошибка сервера, сети или ввода-вывода
+	exitUsage    = 2 // неверные аргументы командной строки
+	exitNotFound = 3 // сессия или файл не найдены
+)
 
-	// Разделение на чанки и параллельная отправка
-	buf := make([]byte, chunkSize)
-	begin := time.Now()
+// command — подкоманда клиента со своим набором флагов.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
 
-	var wg sync.WaitGroup
-	chunkChan := make(chan chunkData)
+var commands = []command{
+	{"upload", "upload a file or stdin stream", runUpload},
+	{"batch", "upload several files that become visible together", runBatch},
+	{"status", "show the status of an upload session", runStatus},
+	{"list", "list upload sessions and stored files", runList},
+	{"delete", "delete an upload session", runDelete},
+	{"download", "download a stored file", runDownload},
+	{"versions", "list, promote or delete versions of a stored file", runVersions},
+	{"rewrap", "rewrap data keys with the active master key", runRewrap},
+}
 
-	// Запуск воркеров для отправки чанков
-	numWorkers := runtime.GOMAXPROCS(0)
-	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for chunk := range chunkChan {
-				err := sendChunk(serverURL, fileHash, chunk.data, chunk.chunkID)
-				if err != nil {
-					log.Printf("Error sending chunk %d: %v", chunk.chunkID, err)
-					continue
-				}
-			}
-		}()
-	}
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
 
-	// Чтение файла и отправка чанков в канал
-	for chunkID := 1; chunkID <= totalChunks; chunkID++ {
-		n, err := file.Read(buf)
-		if err != nil && err != io.EOF {
-			log.Fatalf("Error reading file: %v", err)
+func run(args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(os.Stderr)
+		if len(args) == 0 {
+			return exitUsage
 		}
-		if n == 0 {
-			break
+		return exitOK
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:])
 		}
-		chunk := make([]byte, n)
-		copy(chunk, buf[:n])
-		chunkChan <- chunkData{chunkID: chunkID, data: chunk}
 	}
-	close(chunkChan)
-
-	// Ожидание завершения всех воркеров
-	wg.Wait()
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+	usage(os.Stderr)
+	return exitUsage
+}
 
-	fmt.Printf("File uploaded in %v\n", time.Since(begin))
-	// Завершаем передачу
-	err = completeUpload(serverURL, fileHash)
-	if err != nil {
-		log.Fatalf("Error completing upload: %v", err)
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: client <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
 	}
-	fmt.Println("File transmission complete.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'client <command> -h' for command flags.")
 }
 
-type chunkData struct {
-	chunkID int
-	data    []byte
+// commonFlags — флаги, общие для всех подкоманд.
+type commonFlags struct {
+	server *string
+	port   *int
+	json   *bool
 }
 
-// createSession отправляет запрос на создание сессии и получает размер чанка
-func createSession(serverURL, filePath, fileHash string) (int64, error) {
-	fileInfo, err := os.Stat(filePath)
-	if err != nil {
-		log.Fatalf("Error getting file info: %v", err)
-		return 0, fmt.Errorf("error opening file: %v", err)
-	}
-	fileSize := fileInfo.Size()
-
-	// Формируем тело запроса
-	requestData := map[string]interface{}{
-		"file_name": filePath,
-		"file_size": fileSize,
-		"file_hash": fileHash, // Добавляем хэш
+func newFlagSet(name string) (*flag.FlagSet, *commonFlags) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	common := &commonFlags{
+		server: fs.String("server", "", "Server base URL, e.g. http://host:5454 (overrides -port)"),
+		port:   fs.Int("port", 0, "Port of the local server (overrides config)"),
+		json:   fs.Bool("json", false, "Print machine-readable JSON output"),
 	}
-	requestBody, err := json.Marshal(requestData)
-	if err != nil {
-		return 0, fmt.Errorf("failed to create request body: %v", err)
-	}
-
-	// Отправка запроса на старт сессии
-	url := fmt.Sprintf("%s/upload/start", serverURL)
-	resp, err := http.Post(url, "application/json", bytes.NewReader(requestBody))
-	if err != nil {
-		return 0, fmt.Errorf("failed to create session: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("server returned non-OK status: %s", resp.Status)
-	}
-
-	// Чтение ответа
-	var result map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse response: %v", err)
-	}
-
-	chunkSize := int64(result["chunk_size"].(float64))
-	fmt.Printf("Chunk size: %d bytes\n", chunkSize)
-
-	return chunkSize, nil
+	return fs, common
 }
 
-// sendChunk отправляет чанк на сервер
-func sendChunk(serverURL, fileHash string, data []byte, chunkID int) error {
-	url := fmt.Sprintf("%s/upload/%s/chunk", serverURL, fileHash)
-
-	// Вычисляем SHA-256 для данных чанка
-	hash := sha256.Sum256(data)
-	checksum := hex.EncodeToString(hash[:])
-
-	// Создаем multipart-запрос
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
-	writer.WriteField("chunk_id", strconv.Itoa(chunkID))
-	writer.WriteField("checksum", checksum)
-
-	// Добавляем данные чанка
-	part, err := writer.CreateFormFile("chunk_data", "chunk")
-	if err != nil {
-		return fmt.Errorf("failed to create form file: %v", err)
-	}
-	if _, err := part.Write(data); err != nil {
-		return fmt.Errorf("failed to write chunk data: %v", err)
-	}
-	writer.Close()
-
-	// Отправляем запрос
-	req, err := http.NewRequest("POST", url, &buf)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
-	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send chunk: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned non-OK status: %v", resp.Status)
+// parseFlags разбирает аргументы подкоманды; возвращает код выхода, если продолжать не нужно.
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitUsage, false
 	}
-
-	log.Printf("Chunk %d sent successfully", chunkID)
-	return nil
+	return exitOK, true
 }
 
-// completeUpload отправляет запрос на завершение загрузки
-func completeUpload(serverURL, fileHash string) error {
-	url := fmt.Sprintf("%s/upload/complete/%s", serverURL, fileHash)
-
-	// Отправляем запрос на завершение сессии
-	resp, err := http.Post(url, "application/json", nil)
-	if err != nil {
-		return fmt.Errorf("failed to complete upload: %v", err)
+// serverURL определяет адрес сервера: -server, затем -port, затем порт из конфига.
+func (c *commonFlags) serverURL() (string, error) {
+	if *c.server != "" {
+		return strings.TrimRight(*c.server, "/"), nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned non-OK status: %v", resp.Status)
+	port := *c.port
+	if port == 0 {
+		// Загрузка конфигурации из файла
+		cfg, err := config.LoadConfig("config/config.yaml")
+		if err != nil {
+			return "", fmt.Errorf("error loading config (use -server or -port): %w", err)
+		}
+		port = cfg.Server.Port
 	}
-
-	log.Println("Upload completed successfully.")
-	return nil
+	return fmt.Sprintf("http://localhost:%d", port), nil
 }
 
-// CalculateFileHash рассчитывает хэш файла поблочно с использованием SHA-256.
-func CalculateFileHash(filePath string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", err
-	}
-	defer file.Close()
-
-	hash := sha256.New()
-	buffer := make([]byte, 10*1024*1024) // 10 MB за раз
-	for {
-		n, err := file.Read(buffer)
-		if err != nil && err != io.EOF {
-			return "", err
-		}
-		if n == 0 {
-			break
-		}
-		hash.Write(buffer[:n])
+// printResult выводит результат в JSON или текстом через text.
+func (c *commonFlags) printResult(result interface{}, text func()) {
+	if *c.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(result)
+		return
 	}
+	text()
+}
 
-	return hex.EncodeToString(hash.Sum(nil)), nil
+// fail печатает ошибку и возвращает соответствующий код выхода.
+func (c *commonFlags) fail(err error) int {
+	code := exitError
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == 404 {
+		code = exitNotFound
+	}
+	if *c.json {
+		c.printResult(map[string]interface{}{
+			"status":  "error",
+			"message": err.Error(),
+			"code":    code,
+		}, nil)
+	} else {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	return code
 }
@@ -0,0 +1,688 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"BASProject/config"
+	"BASProject/internal/utils"
+)
+
+// processingPollInterval — как часто опрашивается статус файла, обрабатываемого на сервере.
+const processingPollInterval = time.Second
+
+// uploadResult — итог загрузки, который печатает подкоманда upload.
+type uploadResult struct {
+	Status    string `json:"status"`
+	SessionID string `json:"session_id"`
+	FileName  string `json:"file_name"`
+	FileSize  int64  `json:"file_size"`
+	FileHash  string `json:"file_hash"`
+	ChunkSize int64  `json:"chunk_size"`
+	Duration  string `json:"duration"`
+	// Encrypted — файл зашифрован на клиенте; размер и хеш относятся к открытым данным.
+	Encrypted bool `json:"encrypted,omitempty"`
+}
+
+// uploadOptions — параметры загрузки из флагов подкоманды upload.
+type uploadOptions struct {
+	preferredChunkSize int64
+	adaptive           bool
+	dedup              bool
+	maxWorkers         int
+	e2eKey             []byte
+	owner              string
+	contentType        string
+	metadata           metadataFlag
+	extract            bool
+	extractDir         string
+	namespace          string
+}
+
+// metadataFlag собирает повторяющиеся флаги -meta key=value.
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string {
+	pairs := make([]string, 0, len(m))
+	for key, value := range m {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m metadataFlag) Set(pair string) error {
+	key, value, ok := strings.Cut(pair, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", pair)
+	}
+	m[key] = value
+	return nil
+}
+
+func runUpload(args []string) int {
+	fs, common := newFlagSet("upload")
+	fileFlag := fs.String("file", "", "Path to the file, or - to read from stdin")
+	nameFlag := fs.String("name", "", "File name to store on the server (default: the relative file path or the base name, or stdin.bin for stdin)")
+	namespaceFlag := fs.String("namespace", "", "Server namespace (bucket) to store the file in")
+	chunkFlag := fs.String("chunk-size", "", "Preferred chunk size, e.g. 512KB or 64MB; the server clamps it to its limits")
+	adaptiveFlag := fs.Bool("adaptive", false, "Adjust chunk size and parallelism to measured throughput")
+	dedupFlag := fs.Bool("dedup", false, "Split the file by content and upload only chunks the server does not have")
+	compressFlag := fs.String("compress", "", "Compress chunk uploads: gzip or zstd (incompressible chunks are sent as is)")
+	workersFlag := fs.Int("max-workers", 8, "Upper bound on parallel requests in -adaptive and -dedup modes")
+	ownerFlag := fs.String("owner", "", "Owner recorded with the upload session")
+	e2eKeyFlag := fs.String("e2e-key", "", "Encrypt chunks locally with the 32-byte key from this file (raw, hex or base64); the server stores ciphertext only")
+	contentTypeFlag := fs.String("content-type", "", "Content type of the file, returned on download (e.g. application/pdf)")
+	metadata := metadataFlag{}
+	fs.Var(metadata, "meta", "Metadata key=value stored with the file (repeatable)")
+	extractFlag := fs.Bool("extract", false, "Extract a .zip, .tar or .tar.gz archive on the server after upload")
+	extractDirFlag := fs.String("extract-dir", "", "Storage directory to extract into (default: archive name without extension)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	opts := uploadOptions{adaptive: *adaptiveFlag, dedup: *dedupFlag, maxWorkers: *workersFlag, owner: *ownerFlag,
+		contentType: *contentTypeFlag, metadata: metadata, extract: *extractFlag, extractDir: *extractDirFlag, namespace: *namespaceFlag}
+	if *chunkFlag != "" {
+		size, err := config.ParseByteSize(*chunkFlag)
+		if err != nil || size == 0 {
+			fmt.Fprintf(os.Stderr, "upload: invalid -chunk-size %q\n", *chunkFlag)
+			return exitUsage
+		}
+		opts.preferredChunkSize = int64(size)
+	}
+	switch *compressFlag {
+	case "", "none":
+	case "gzip", "zstd":
+		chunkCompression = *compressFlag
+	default:
+		fmt.Fprintf(os.Stderr, "upload: unsupported -compress %q (supported: gzip, zstd)\n", *compressFlag)
+		return exitUsage
+	}
+	if opts.maxWorkers < 1 {
+		fmt.Fprintln(os.Stderr, "upload: -max-workers must be at least 1")
+		return exitUsage
+	}
+
+	filePath := *fileFlag
+	if filePath == "" && fs.NArg() == 1 {
+		filePath = fs.Arg(0)
+	}
+	if filePath == "" || fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "upload: exactly one file is required (-file PATH or -file -)")
+		fs.Usage()
+		return exitUsage
+	}
+	if opts.dedup && filePath == "-" {
+		fmt.Fprintln(os.Stderr, "upload: -dedup requires a file, not stdin")
+		return exitUsage
+	}
+	if *e2eKeyFlag != "" {
+		if opts.adaptive || opts.dedup {
+			fmt.Fprintln(os.Stderr, "upload: -e2e-key cannot be combined with -adaptive or -dedup")
+			return exitUsage
+		}
+		key, err := utils.LoadKeyFile(*e2eKeyFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "upload: %v\n", err)
+			return exitUsage
+		}
+		opts.e2eKey = key
+	}
+
+	serverURL, err := common.serverURL()
+	if err != nil {
+		return common.fail(err)
+	}
+
+	var result *uploadResult
+	if filePath == "-" {
+		// Загрузка из stdin: хеш и размер становятся известны только после чтения всего потока
+		name := *nameFlag
+		if name == "" {
+			name = "stdin.bin"
+		}
+		if opts.e2eKey != nil {
+			result, err = uploadEncrypted(serverURL, name, os.Stdin, opts)
+		} else {
+			result, err = uploadStream(serverURL, name, os.Stdin, opts)
+		}
+	} else {
+		name := *nameFlag
+		if name == "" {
+			name = storageKey(filePath)
+		}
+		if opts.e2eKey != nil {
+			result, err = uploadEncryptedFile(serverURL, filePath, name, opts)
+		} else if opts.dedup {
+			result, err = uploadDedup(serverURL, filePath, name, opts)
+		} else {
+			result, err = uploadFile(serverURL, filePath, name, opts)
+		}
+	}
+	if err != nil {
+		return common.fail(err)
+	}
+
+	common.printResult(result, func() {
+		if result.Status == "already_present" {
+			fmt.Printf("Already stored, saved as %s (%d bytes) without uploading\n", result.FileName, result.FileSize)
+		} else {
+			fmt.Printf("Uploaded %s (%d bytes) in %s\n", result.FileName, result.FileSize, result.Duration)
+		}
+		if result.Encrypted {
+			fmt.Println("Encrypted end-to-end; download with the same -e2e-key")
+		}
+		fmt.Printf("Session ID: %s\n", result.SessionID)
+		fmt.Printf("SHA-256:    %s\n", result.FileHash)
+	})
+	return exitOK
+}
+
+// uploadFile загружает файл с диска; хеш вычисляется заранее и служит идентификатором сессии.
+func uploadFile(serverURL, filePath, fileName string, opts uploadOptions) (*uploadResult, error) {
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error getting file info: %v", err)
+	}
+
+	fileHash, err := CalculateFileHash(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error calculating file hash: %v", err)
+	}
+
+	session, err := createSession(serverURL, fileName, fileInfo.Size(), fileHash, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error creating session: %w", err)
+	}
+	if session.Status == "already_present" {
+		return &uploadResult{
+			Status:    session.Status,
+			SessionID: session.SessionID,
+			FileName:  session.FileName,
+			FileSize:  fileInfo.Size(),
+			FileHash:  fileHash,
+			Duration:  "0s",
+		}, nil
+	}
+
+	// Открытие файла
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	// Разделение на чанки и параллельная отправка
+	begin := time.Now()
+	if _, err := sendSessionChunks(serverURL, session, file, opts); err != nil {
+		return nil, fmt.Errorf("error uploading chunks: %w", err)
+	}
+
+	// Завершаем передачу
+	if err := completeUpload(serverURL, session.SessionID, nil); err != nil {
+		return nil, fmt.Errorf("error completing upload: %w", err)
+	}
+
+	return &uploadResult{
+		Status:    "success",
+		SessionID: session.SessionID,
+		FileName:  fileName,
+		FileSize:  fileInfo.Size(),
+		FileHash:  fileHash,
+		ChunkSize: session.ChunkSize,
+		Duration:  time.Since(begin).Round(time.Millisecond).String(),
+	}, nil
+}
+
+type chunkData struct {
+	chunkID int
+	data    []byte
+}
+
+// uploadChunks читает r чанками по chunkSize и параллельно отправляет их на сервер.
+// Возвращает количество прочитанных байт; r не обязан поддерживать Seek.
+func uploadChunks(serverURL, sessionID string, r io.Reader, chunkSize int64) (int64, error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var sendErr error
+	chunkChan := make(chan chunkData)
+
+	// Запуск воркеров для отправки чанков
+	numWorkers := runtime.GOMAXPROCS(0)
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunkChan {
+				err := sendChunk(serverURL, sessionID, chunk.data, chunk.chunkID)
+				if err != nil {
+					log.Printf("Error sending chunk %d: %v", chunk.chunkID, err)
+					mu.Lock()
+					if sendErr == nil {
+						sendErr = fmt.Errorf("chunk %d: %w", chunk.chunkID, err)
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	// Чтение потока и отправка чанков в канал. io.ReadFull нужен для pipe:
+	// все чанки, кроме последнего, должны иметь ровно chunkSize байт.
+	var total int64
+	var readErr error
+	for chunkID := 1; ; chunkID++ {
+		buf := make([]byte, chunkSize)
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			total += int64(n)
+			chunkChan <- chunkData{chunkID: chunkID, data: buf[:n]}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			readErr = fmt.Errorf("error reading input: %w", err)
+			break
+		}
+	}
+	close(chunkChan)
+
+	// Ожидание завершения всех воркеров
+	wg.Wait()
+
+	if readErr != nil {
+		return total, readErr
+	}
+	return total, sendErr
+}
+
+// uploadStream загружает поток неизвестного размера (например, stdin).
+// Сессия создаётся в отложенном режиме: хеш и размер передаются при завершении.
+func uploadStream(serverURL, fileName string, r io.Reader, opts uploadOptions) (*uploadResult, error) {
+	session, err := createSession(serverURL, fileName, 0, "", opts)
+	if err != nil {
+		return nil, fmt.Errorf("error creating session: %w", err)
+	}
+
+	hash := sha256.New()
+	begin := time.Now()
+	size, err := sendSessionChunks(serverURL, session, io.TeeReader(r, hash), opts)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("input stream is empty")
+	}
+
+	fileHash := hex.EncodeToString(hash.Sum(nil))
+	err = completeUpload(serverURL, session.SessionID, map[string]interface{}{
+		"file_hash": fileHash,
+		"file_size": size,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error completing upload: %w", err)
+	}
+
+	return &uploadResult{
+		Status:    "success",
+		SessionID: session.SessionID,
+		FileName:  fileName,
+		FileSize:  size,
+		FileHash:  fileHash,
+		ChunkSize: session.ChunkSize,
+		Duration:  time.Since(begin).Round(time.Millisecond).String(),
+	}, nil
+}
+
+// uploadEncryptedFile загружает файл с диска со сквозным шифрованием.
+func uploadEncryptedFile(serverURL, filePath, fileName string, opts uploadOptions) (*uploadResult, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+	return uploadEncrypted(serverURL, fileName, file, opts)
+}
+
+// uploadEncrypted шифрует r на клиенте и загружает шифротекст в отложенной сессии:
+// сервер проверяет хеши и размер шифротекста и не видит открытых данных.
+func uploadEncrypted(serverURL, fileName string, r io.Reader, opts uploadOptions) (*uploadResult, error) {
+	session, err := createSession(serverURL, fileName, 0, "", opts)
+	if err != nil {
+		return nil, fmt.Errorf("error creating session: %w", err)
+	}
+
+	plainHash := sha256.New()
+	counter := &countingReader{r: io.TeeReader(r, plainHash)}
+	encrypted, err := encryptStream(opts.e2eKey, counter, session.ChunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	cipherHash := sha256.New()
+	begin := time.Now()
+	size, err := sendSessionChunks(serverURL, session, io.TeeReader(encrypted, cipherHash), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = completeUpload(serverURL, session.SessionID, map[string]interface{}{
+		"file_hash": hex.EncodeToString(cipherHash.Sum(nil)),
+		"file_size": size,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error completing upload: %w", err)
+	}
+
+	return &uploadResult{
+		Status:    "success",
+		SessionID: session.SessionID,
+		FileName:  fileName,
+		FileSize:  counter.n,
+		FileHash:  hex.EncodeToString(plainHash.Sum(nil)),
+		ChunkSize: session.ChunkSize,
+		Duration:  time.Since(begin).Round(time.Millisecond).String(),
+		Encrypted: true,
+	}, nil
+}
+
+// countingReader считает прочитанные байты.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// startResponse — ответ /upload/start.
+type startResponse struct {
+	SessionID    string `json:"session_id"`
+	Status       string `json:"status"`
+	FileName     string `json:"file_name"`
+	ChunkSize    int64  `json:"chunk_size"`
+	ChunkMode    string `json:"chunk_mode"`
+	MinChunkSize int64  `json:"min_chunk_size"`
+	MaxChunkSize int64  `json:"max_chunk_size"`
+	// Extraction — итог распаковки, если архив уже хранился на сервере.
+	Extraction *extractionResult `json:"extraction"`
+}
+
+// createSession отправляет запрос на создание сессии и получает размер чанка.
+// Если file_hash не передан, сессия создаётся в отложенном режиме.
+func createSession(serverURL, fileName string, fileSize int64, fileHash string, opts uploadOptions) (*startResponse, error) {
+	request := map[string]interface{}{
+		"file_name":            fileName,
+		"preferred_chunk_size": opts.preferredChunkSize,
+	}
+	if fileHash == "" {
+		request["deferred"] = true
+	} else {
+		request["file_size"] = fileSize
+		request["file_hash"] = fileHash
+	}
+	if opts.adaptive {
+		request["chunk_mode"] = "offset"
+	}
+	if opts.owner != "" {
+		request["owner"] = opts.owner
+	}
+	if opts.contentType != "" {
+		request["content_type"] = opts.contentType
+	}
+	if len(opts.metadata) > 0 {
+		request["metadata"] = opts.metadata
+	}
+	if opts.namespace != "" {
+		request["namespace"] = opts.namespace
+	}
+	if opts.extract {
+		request["extract"] = true
+		if opts.extractDir != "" {
+			request["extract_dir"] = opts.extractDir
+		}
+	}
+
+	var result startResponse
+	if err := doJSON("POST", serverURL+"/upload/start", request, &result); err != nil {
+		return nil, err
+	}
+	if result.Status == "already_present" {
+		log.Printf("Server already stores this content as %s; upload skipped", result.FileName)
+		logExtraction(result.Extraction)
+		return &result, nil
+	}
+	if result.ChunkSize <= 0 {
+		return nil, fmt.Errorf("server returned invalid chunk size: %d", result.ChunkSize)
+	}
+	if result.SessionID == "" {
+		if fileHash == "" {
+			return nil, fmt.Errorf("server returned no session ID")
+		}
+		// Старые версии сервера используют хеш файла как идентификатор сессии
+		result.SessionID = fileHash
+	}
+	if result.FileName != "" && result.FileName != fileName {
+		log.Printf("Server stores the file as %s", result.FileName)
+	}
+	log.Printf("Session ID: %s, Chunk Size: %d", result.SessionID, result.ChunkSize)
+	return &result, nil
+}
+
+// storageKey превращает локальный путь в имя на сервере: относительный путь внутри текущего
+// каталога сохраняет структуру каталогов, иначе (абсолютный путь, выход через "..") берётся имя файла.
+func storageKey(filePath string) string {
+	if filepath.IsLocal(filePath) {
+		return filepath.ToSlash(filepath.Clean(filePath))
+	}
+	return filepath.Base(filePath)
+}
+
+// sendSessionChunks выбирает способ отправки: адаптивный, если сервер принял режим offset.
+func sendSessionChunks(serverURL string, session *startResponse, r io.Reader, opts uploadOptions) (int64, error) {
+	if opts.adaptive && session.ChunkMode == "offset" {
+		ctrl := newAdaptiveController(session.ChunkSize, session.MinChunkSize, session.MaxChunkSize, opts.maxWorkers)
+		return uploadAdaptive(serverURL, session.SessionID, r, ctrl)
+	}
+	if opts.adaptive {
+		// Незавершённая сессия с тем же хешем была начата в режиме fixed
+		log.Printf("Server kept fixed-size chunks for session %s; adaptive sizing disabled", session.SessionID)
+	}
+	return uploadChunks(serverURL, session.SessionID, r, session.ChunkSize)
+}
+
+// sendChunk отправляет чанк на сервер
+func sendChunk(serverURL, sessionID string, data []byte, chunkID int) error {
+	if err := postChunk(serverURL, sessionID, data, "chunk_id", strconv.Itoa(chunkID)); err != nil {
+		return err
+	}
+	log.Printf("Chunk %d sent successfully", chunkID)
+	return nil
+}
+
+// postChunk отправляет данные чанка; addrField — chunk_id или offset.
+func postChunk(serverURL, sessionID string, data []byte, addrField, addrValue string) error {
+	url := fmt.Sprintf("%s/upload/%s/chunk", serverURL, sessionID)
+	return postChunkData(url, data, map[string]string{addrField: addrValue})
+}
+
+// postChunkData отправляет multipart-запрос с данными чанка, их SHA-256 и дополнительными полями.
+func postChunkData(url string, data []byte, fields map[string]string) error {
+	// Вычисляем SHA-256 для данных чанка
+	hash := sha256.Sum256(data)
+	checksum := hex.EncodeToString(hash[:])
+
+	// Создаем multipart-запрос
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	writer.WriteField("checksum", checksum)
+
+	// Добавляем данные чанка
+	part, err := writer.CreateFormFile("chunk_data", "chunk")
+	if err != nil {
+		return fmt.Errorf("failed to create form file: %v", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return fmt.Errorf("failed to write chunk data: %v", err)
+	}
+	writer.Close()
+
+	// Сжимаем тело, если это уменьшает объём передачи
+	body, encoding := compressBody(buf.Bytes(), data)
+
+	// Отправляем запрос
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send chunk: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return readAPIError(resp)
+	}
+	return nil
+}
+
+// completeUpload отправляет запрос на завершение загрузки.
+// payload передаётся только для отложенных сессий (file_hash и file_size).
+func completeUpload(serverURL, sessionID string, payload map[string]interface{}) error {
+	url := fmt.Sprintf("%s/upload/complete/%s", serverURL, sessionID)
+
+	// Отправляем запрос на завершение сессии
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	var result struct {
+		Status     string            `json:"status"`
+		FileName   string            `json:"file_name"`
+		Version    int               `json:"version"`
+		Extraction *extractionResult `json:"extraction"`
+	}
+	if err := doJSON("POST", url, payload, &result); err != nil {
+		return err
+	}
+	if result.Version > 1 {
+		log.Printf("Stored as version %d of %s; previous versions: versions -name %s", result.Version, result.FileName, result.FileName)
+	}
+
+	// Сервер с конвейером обработки отвечает 202: ждём его результата
+	if result.Status == "processing" {
+		log.Printf("File %s assembled; waiting for server-side processing...", result.FileName)
+		extraction, err := waitProcessing(serverURL, sessionID)
+		if err != nil {
+			return err
+		}
+		result.Extraction = extraction
+	}
+	logExtraction(result.Extraction)
+
+	log.Println("Upload completed successfully.")
+	return nil
+}
+
+// waitProcessing опрашивает статус сессии, пока сервер не закончит обработку собранного файла.
+// Если запрошена распаковка, дожидается и её итога.
+func waitProcessing(serverURL, sessionID string) (*extractionResult, error) {
+	for {
+		var status statusResponse
+		if err := doJSON("GET", fmt.Sprintf("%s/upload/status/%s", serverURL, sessionID), nil, &status); err != nil {
+			return nil, err
+		}
+		switch {
+		case status.FileStatus == "processing", status.FileStatus == "available" && status.Extract && status.Extraction == nil:
+			time.Sleep(processingPollInterval)
+			continue
+		case status.FileStatus == "", status.FileStatus == "available":
+			return status.Extraction, nil
+		}
+		for _, outcome := range status.Processing {
+			if outcome.Status == "failed" {
+				return nil, fmt.Errorf("file %s was %s by processor %s: %s", status.StoredName, status.FileStatus, outcome.Processor, outcome.Message)
+			}
+		}
+		return nil, fmt.Errorf("file %s was %s by server-side processing", status.StoredName, status.FileStatus)
+	}
+}
+
+// extractionResult — итог распаковки архива на сервере.
+type extractionResult struct {
+	Directory string `json:"directory"`
+	Status    string `json:"status"`
+	Error     string `json:"error"`
+	Extracted int    `json:"extracted"`
+	TotalSize int64  `json:"total_size"`
+	Skipped   []struct {
+		Name   string `json:"name"`
+		Reason string `json:"reason"`
+	} `json:"skipped"`
+}
+
+// logExtraction сообщает итог распаковки, если она выполнялась.
+func logExtraction(extraction *extractionResult) {
+	if extraction == nil {
+		return
+	}
+	if extraction.Status != "completed" {
+		log.Printf("Server failed to extract the archive: %s", extraction.Error)
+		return
+	}
+	log.Printf("Extracted %d files (%d bytes) into %s", extraction.Extracted, extraction.TotalSize, extraction.Directory)
+	for _, entry := range extraction.Skipped {
+		log.Printf("  skipped %s: %s", entry.Name, entry.Reason)
+	}
+}
+
+// CalculateFileHash рассчитывает хэш файла поблочно с использованием SHA-256.
+func CalculateFileHash(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	buffer := make([]byte, 10*1024*1024) // 10 MB за раз
+	for {
+		n, err := file.Read(buffer)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if n == 0 {
+			break
+		}
+		hash.Write(buffer[:n])
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
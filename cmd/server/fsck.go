@@ -0,0 +1,93 @@
+package main
+
+import (
+	"BASProject/config"
+	"BASProject/internal/services"
+	"BASProject/internal/storage"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runFsck реализует подкоманду "server fsck": проверяет согласованность Redis и файлов чанков
+// и возвращает код выхода 1, если остались неисправленные расхождения.
+func runFsck(args []string) int {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: server fsck [-repair] [-json] [-storage PATH] [-config PATH]")
+		fs.PrintDefaults()
+	}
+	repair := fs.Bool("repair", false, "Fix the issues found (untrack missing parts, delete stray parts, recompute sizes)")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	storagePath := fs.String("storage", "data", "Path to storage")
+	cfgPath := fs.String("config", "config/config.yaml", "Path to the config file")
+	fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*cfgPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 2
+	}
+	if _, err := os.Stat(*storagePath); err != nil {
+		fmt.Fprintf(os.Stderr, "Storage path %s is not accessible: %v\n", *storagePath, err)
+		return 2
+	}
+
+	redisClient := storage.NewRedisClient(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB)
+	fileService := services.NewFileService(redisClient, *storagePath)
+	fileService.Chunking = cfg.Chunking
+	if cfg.Encryption.Enabled {
+		// Размер зашифрованных частей определяется по открытым данным
+		fileService.Envelope, err = loadKeyring(cfg.Encryption)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing encryption: %v\n", err)
+			return 2
+		}
+	}
+	sessionService := services.NewSessionService(redisClient, fileService)
+
+	report, err := sessionService.Fsck(*repair)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fsck failed: %v\n", err)
+		return 2
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		printFsckReport(report)
+	}
+	if len(report.Issues) > report.Repaired {
+		return 1
+	}
+	return 0
+}
+
+func printFsckReport(report *services.FsckReport) {
+	fmt.Printf("Checked %d sessions and %d chunk files in %s\n", report.Sessions, report.Parts, report.FinishedAt.Sub(report.StartedAt).Round(time.Millisecond))
+	if len(report.Issues) == 0 {
+		fmt.Println("No issues found.")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SESSION\tKIND\tPART\tREPAIRED\tDETAIL")
+	for _, issue := range report.Issues {
+		repaired := "no"
+		if issue.Repaired {
+			repaired = "yes"
+		} else if issue.RepairError != "" {
+			repaired = "failed: " + issue.RepairError
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", issue.SessionID, issue.Kind, issue.Part, repaired, issue.Detail)
+	}
+	w.Flush()
+	fmt.Printf("%d issues found, %d repaired\n", len(report.Issues), report.Repaired)
+	if !report.Repair {
+		fmt.Println("Run with -repair to fix them.")
+	}
+}
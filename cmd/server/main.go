@@ -5,6 +5,7 @@ import (
 	"BASProject/internal/handlers"
 	"BASProject/internal/services"
 	"BASProject/internal/storage"
+	"BASProject/internal/utils"
 	"flag"
 	"fmt"
 	"log"
@@ -15,6 +16,10 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "fsck" {
+		os.Exit(runFsck(os.Args[2:]))
+	}
+
 	// Параметры командной строки для порта и пути к хранилищу
 	port := flag.Int("port", 0, "Port for the server (overrides config)")
 	storagePath := flag.String("storage", "data", "Path to storage (overrides config, default: 'data')")
@@ -62,19 +67,108 @@ func main() {
 	// Инициализация сервисов и обработчиков
 	redisClient := storage.NewRedisClient(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB)
 	fileService := services.NewFileService(redisClient, cfg.Storage.Path)
+	fileService.Chunking = cfg.Chunking
+	fileService.Policies = cfg.FilePolicies
+	fileService.MinFreeSpace = int64(cfg.Storage.MinFree)
+	fileService.Extraction = cfg.Extraction
+	fileService.Namespaces = cfg.Namespaces
+	fileService.OnConflict = cfg.Storage.OnConflict
+	// Политика rename оставлена для прежних конфигураций
+	if cfg.Storage.OnConflict == services.OnConflictRename {
+		log.Printf("storage.on_conflict: rename is deprecated and keeps no version history; use version instead")
+	}
+	for name, namespace := range cfg.Namespaces {
+		if namespace.OnConflict == services.OnConflictRename {
+			log.Printf("namespaces: %s: on_conflict rename is deprecated and keeps no version history; use version instead", name)
+		}
+	}
+	fileService.Assembly = cfg.Storage.Assembly
+	progressService := services.NewProgressService(redisClient)
+	fileService.Progress = progressService
+	if cfg.Encryption.Enabled {
+		fileService.Envelope, err = loadKeyring(cfg.Encryption)
+		if err != nil {
+			log.Fatalf("Error initializing encryption: %v", err)
+		}
+		log.Printf("Encryption at rest enabled (active master key %s)", fileService.Envelope.ActiveKey())
+		if cfg.Storage.Assembly == services.AssemblyPreallocate {
+			log.Printf("Preallocated assembly is not used with encryption; chunks are stored as parts")
+		}
+	}
 	sessionService := services.NewSessionService(redisClient, fileService)
+	webhookService := services.NewWebhookService(redisClient, cfg.Webhooks)
+	if len(cfg.Webhooks.Targets) > 0 {
+		log.Printf("Webhooks enabled for %d targets", len(cfg.Webhooks.Targets))
+	}
 	startHandler := handlers.NewStartHandler(sessionService)
+	startHandler.Webhooks = webhookService
 	uploadChunkHandler := handlers.NewUploadChunkHandler(sessionService)
+	uploadChunkHandler.MaxChunkSize = int(cfg.Chunking.MaxSize)
+	uploadChunkHandler.Webhooks = webhookService
+	uploadChunkHandler.Progress = progressService
+	uploadChunkHandler.Pipeline, err = services.NewPipeline(fileService, cfg.Pipeline)
+	if err != nil {
+		log.Fatalf("Error initializing processing pipeline: %v", err)
+	}
+	if uploadChunkHandler.Pipeline.Enabled() {
+		log.Printf("Processing pipeline enabled with %d processors", len(cfg.Pipeline.Processors))
+	}
+	batchService := services.NewBatchService(sessionService)
+	batchService.Pipeline = uploadChunkHandler.Pipeline
+	batchService.Webhooks = webhookService
+	// Фиксации пакетов, прерванные остановкой сервера, доводятся до конца или откатываются
+	batchService.RecoverBatches()
+	batchHandler := handlers.NewBatchHandler(batchService)
 	statusHandler := handlers.NewStatusHandler(sessionService)
 	deleteHandler := handlers.NewDeleteHandler(sessionService)
+	deleteHandler.Webhooks = webhookService
+	deleteHandler.Progress = progressService
+	eventsHandler := handlers.NewEventsHandler(sessionService, progressService)
+	adminHandler := handlers.NewAdminHandler(sessionService)
+	webhooksHandler := handlers.NewWebhooksHandler(webhookService)
+	filesHandler := handlers.NewFilesHandler(fileService)
+	keysHandler := handlers.NewKeysHandler(services.NewKeyRotationService(fileService))
+	chunkStoreHandler := handlers.NewChunkStoreHandler(fileService)
+	chunkStoreHandler.MaxChunkSize = int(cfg.Chunking.MaxSize)
 
 	// Настройка маршрутов
 	router := mux.NewRouter()
 	router.HandleFunc("/upload/start", startHandler.StartSession).Methods("POST")
 	router.HandleFunc("/upload/{session_id}/chunk", uploadChunkHandler.UploadChunk).Methods("POST")
+	router.HandleFunc("/upload/{session_id}/refs", uploadChunkHandler.LinkChunks).Methods("POST")
 	router.HandleFunc("/upload/complete/{session_id}", uploadChunkHandler.CompleteUpload).Methods("POST")
 	router.HandleFunc("/upload/status/{session_id}", statusHandler.GetUploadStatus).Methods("GET")
+	router.HandleFunc("/upload/{session_id}/events", eventsHandler.StreamEvents).Methods("GET")
+	router.HandleFunc("/upload/sessions", statusHandler.ListSessions).Methods("GET")
 	router.HandleFunc("/upload/{session_id}", deleteHandler.DeleteSession).Methods("DELETE")
+	router.HandleFunc("/batches", batchHandler.CreateBatch).Methods("POST")
+	router.HandleFunc("/batches/{batch_id}", batchHandler.GetBatch).Methods("GET")
+	router.HandleFunc("/batches/{batch_id}/commit", batchHandler.CommitBatch).Methods("POST")
+	router.HandleFunc("/batches/{batch_id}", batchHandler.AbortBatch).Methods("DELETE")
+	router.HandleFunc("/chunks/lookup", chunkStoreHandler.LookupChunks).Methods("POST")
+	router.HandleFunc("/chunks", chunkStoreHandler.StoreChunk).Methods("POST")
+	router.HandleFunc("/files", filesHandler.ListFiles).Methods("GET")
+	// Имя файла может содержать "/", поэтому миниатюры и версии вынесены из /files/{name}:
+	// иначе файл с именем вида a.txt/versions был бы недоступен
+	router.HandleFunc("/files/{name:.+}", filesHandler.DownloadFile).Methods("GET")
+	router.HandleFunc("/thumbnails/{name:.+}", filesHandler.Thumbnail).Methods("GET")
+	router.HandleFunc("/versions/{name:.+}/{version:[0-9]+}/promote", filesHandler.PromoteVersion).Methods("POST")
+	router.HandleFunc("/versions/{name:.+}/{version:[0-9]+}", filesHandler.DeleteVersion).Methods("DELETE")
+	router.HandleFunc("/versions/{name:.+}", filesHandler.ListVersions).Methods("GET")
+
+	// Административные маршруты
+	if cfg.Admin.Token == "" {
+		log.Printf("Admin token is not set; /admin routes are disabled")
+	}
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(handlers.RequireAdminToken(cfg.Admin.Token))
+	admin.HandleFunc("/sessions", adminHandler.ListSessions).Methods("GET")
+	admin.HandleFunc("/sessions/{session_id}", adminHandler.GetSession).Methods("GET")
+	admin.HandleFunc("/fsck", adminHandler.Fsck).Methods("GET", "POST")
+	admin.HandleFunc("/keys/rewrap", keysHandler.StartRewrap).Methods("POST")
+	admin.HandleFunc("/keys/rewrap", keysHandler.RewrapStatus).Methods("GET")
+	admin.HandleFunc("/webhooks/dead-letters", webhooksHandler.ListDeadLetters).Methods("GET")
+	admin.HandleFunc("/webhooks/dead-letters/redeliver", webhooksHandler.RedeliverDeadLetters).Methods("POST")
 
 	// Запуск сервера
 	addr := fmt.Sprintf(":%d", cfg.Server.Port)
@@ -83,3 +177,23 @@ func main() {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
+
+// loadKeyring загружает мастер-ключ или связку версий ключа из конфигурации.
+func loadKeyring(cfg config.EncryptionConfig) (*utils.Envelope, error) {
+	if len(cfg.Keys) == 0 {
+		masterKey, err := utils.LoadKeyFile(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return utils.NewEnvelope(masterKey)
+	}
+	versions := make([]utils.KeyVersion, 0, len(cfg.Keys))
+	for _, key := range cfg.Keys {
+		masterKey, err := utils.LoadKeyFile(key.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key.ID, err)
+		}
+		versions = append(versions, utils.KeyVersion{ID: key.ID, Key: masterKey})
+	}
+	return utils.NewKeyring(versions, cfg.ActiveKey)
+}
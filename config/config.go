@@ -1,7 +1,13 @@
 package config
 
 import (
+	"encoding/hex"
+	"fmt"
 	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -19,7 +25,275 @@ type Config struct {
 
 	Storage struct {
 		Path string `yaml:"path"`
+		// MinFree — место на томе хранилища, которое не отдаётся под загрузки.
+		MinFree ByteSize `yaml:"min_free"`
+		// OnConflict — что делать при загрузке под занятым именем: version, overwrite или reject;
+		// rename оставлено для совместимости с прежними конфигурациями.
+		OnConflict string `yaml:"on_conflict"`
+		// Assembly — способ сборки файла: parts (чанки в отдельных файлах) или preallocate
+		// (чанки пишутся сразу в выделенный при создании сессии итоговый файл).
+		Assembly string `yaml:"assembly"`
 	} `yaml:"storage"`
+
+	Chunking ChunkingConfig `yaml:"chunking"`
+
+	Encryption EncryptionConfig `yaml:"encryption"`
+
+	Webhooks WebhooksConfig `yaml:"webhooks"`
+
+	FilePolicies FilePoliciesConfig `yaml:"file_policies"`
+
+	Pipeline PipelineConfig `yaml:"pipeline"`
+
+	Extraction ExtractionConfig `yaml:"extraction"`
+
+	Namespaces map[string]NamespaceConfig `yaml:"namespaces"`
+
+	Admin struct {
+		// Token защищает маршруты /admin/*; пустой — маршруты отключены.
+		Token string `yaml:"token"`
+	} `yaml:"admin"`
+}
+
+// WebhooksConfig задаёт получателей уведомлений о событиях загрузки и политику повторов.
+// Недоставленные после MaxAttempts попыток события попадают в список недоставленных.
+type WebhooksConfig struct {
+	Targets            []WebhookTarget `yaml:"targets"`
+	MaxAttempts        int             `yaml:"max_attempts"`
+	InitialBackoff     time.Duration   `yaml:"initial_backoff"`
+	MaxBackoff         time.Duration   `yaml:"max_backoff"`
+	Timeout            time.Duration   `yaml:"timeout"`
+	ChunkBatchInterval time.Duration   `yaml:"chunk_batch_interval"`
+}
+
+// WebhookTarget — получатель уведомлений. Тело запроса подписывается HMAC-SHA256 с Secret.
+// Пустой Events подписывает на все события, кроме chunk.received.
+type WebhookTarget struct {
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"`
+	Events []string `yaml:"events"`
+}
+
+// FilePoliciesConfig задаёт допустимые типы файлов: политику по умолчанию
+// и политики отдельных пространств имён, полностью заменяющие её.
+type FilePoliciesConfig struct {
+	Default    FileTypePolicy            `yaml:"default"`
+	Namespaces map[string]FileTypePolicy `yaml:"namespaces"`
+}
+
+// FileTypePolicy ограничивает файлы по расширению имени, MIME-типу, определённому по содержимому,
+// и сигнатуре — первым байтам в hex (например 4d5a для исполняемых файлов Windows).
+// Запрет имеет приоритет; непустой список разрешённых пропускает только перечисленное.
+// MIME-типы задаются точно (image/png) или по группе (image/*).
+type FileTypePolicy struct {
+	AllowExtensions []string `yaml:"allow_extensions,omitempty"`
+	DenyExtensions  []string `yaml:"deny_extensions,omitempty"`
+	AllowMIMETypes  []string `yaml:"allow_mime_types,omitempty"`
+	DenyMIMETypes   []string `yaml:"deny_mime_types,omitempty"`
+	AllowMagic      []string `yaml:"allow_magic,omitempty"`
+	DenyMagic       []string `yaml:"deny_magic,omitempty"`
+}
+
+// Validate проверяет сигнатуры политик.
+func (c FilePoliciesConfig) Validate() error {
+	policies := map[string]FileTypePolicy{"default": c.Default}
+	for name, policy := range c.Namespaces {
+		policies["namespace "+name] = policy
+	}
+	for name, policy := range policies {
+		for _, magic := range append(append([]string{}, policy.AllowMagic...), policy.DenyMagic...) {
+			if _, err := hex.DecodeString(strings.ReplaceAll(magic, " ", "")); err != nil || magic == "" {
+				return fmt.Errorf("file_policies: %s has invalid magic %q, expected hex bytes", name, magic)
+			}
+		}
+	}
+	return nil
+}
+
+// PipelineConfig задаёт обработчики, которые по порядку запускаются над собранным файлом.
+// Файл становится доступным для скачивания, только если все обработчики завершились успешно;
+// при неудаче файл перемещается в карантин (quarantine), удаляется (delete) или остаётся
+// недоступным на месте (keep).
+type PipelineConfig struct {
+	Processors []ProcessorConfig `yaml:"processors"`
+	OnFailure  string            `yaml:"on_failure"`
+}
+
+// ProcessorConfig — обработчик конвейера. Type "command" запускает внешнюю команду
+// (код выхода 0 — проверка пройдена); прочие типы — обработчики, встроенные в сервер.
+// В аргументах команды {path}, {name}, {hash} и {content_type} заменяются сведениями о файле.
+type ProcessorConfig struct {
+	Name    string            `yaml:"name"`
+	Type    string            `yaml:"type"`
+	Command []string          `yaml:"command,omitempty"`
+	Timeout time.Duration     `yaml:"timeout,omitempty"`
+	Options map[string]string `yaml:"options,omitempty"`
+}
+
+// DefaultProcessorTimeout ограничивает обработчик, для которого не задан timeout.
+const DefaultProcessorTimeout = 5 * time.Minute
+
+// Validate проверяет описание конвейера.
+func (c PipelineConfig) Validate() error {
+	switch c.OnFailure {
+	case "", "quarantine", "delete", "keep":
+	default:
+		return fmt.Errorf("pipeline: on_failure must be quarantine, delete or keep, got %q", c.OnFailure)
+	}
+	for i, processor := range c.Processors {
+		if processor.Type == "" {
+			return fmt.Errorf("pipeline: processor %d has no type", i+1)
+		}
+		if processor.Type == "command" && len(processor.Command) == 0 {
+			return fmt.Errorf("pipeline: command processor %d has no command", i+1)
+		}
+		if processor.Timeout < 0 {
+			return fmt.Errorf("pipeline: processor %d has a negative timeout", i+1)
+		}
+	}
+	return nil
+}
+
+// NamespaceConfig — пространство имён (bucket) со своим корневым каталогом внутри хранилища.
+// Файлы, загруженные с namespace, хранятся под Root; пустой Root совпадает с именем пространства.
+type NamespaceConfig struct {
+	Root string `yaml:"root"`
+	// OnConflict заменяет storage.on_conflict для файлов пространства имён.
+	OnConflict string `yaml:"on_conflict"`
+}
+
+// ValidateOnConflict проверяет политику загрузки под занятым именем; пустая — политика по умолчанию.
+func ValidateOnConflict(policy string) error {
+	switch policy {
+	case "", "version", "overwrite", "reject", "rename":
+		return nil
+	}
+	return fmt.Errorf("on_conflict must be version, overwrite, reject or rename, got %q", policy)
+}
+
+var namespaceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ValidateNamespaces проверяет имена и корневые каталоги пространств имён и заполняет пустые Root.
+func ValidateNamespaces(namespaces map[string]NamespaceConfig) error {
+	roots := map[string]string{}
+	for name, namespace := range namespaces {
+		if !namespaceNamePattern.MatchString(name) {
+			return fmt.Errorf("namespaces: invalid name %q: use lowercase letters, digits, '-' and '_'", name)
+		}
+		root := namespace.Root
+		if root == "" {
+			root = name
+		}
+		clean := path.Clean(strings.ReplaceAll(root, "\\", "/"))
+		if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") || strings.HasPrefix(clean, ".") {
+			return fmt.Errorf("namespaces: root %q of %s must be a relative path inside the storage", root, name)
+		}
+		if err := ValidateOnConflict(namespace.OnConflict); err != nil {
+			return fmt.Errorf("namespaces: %s: %w", name, err)
+		}
+		if other, ok := roots[clean]; ok {
+			return fmt.Errorf("namespaces: %s and %s share the root %q", other, name, clean)
+		}
+		roots[clean] = name
+		namespace.Root = clean
+		namespaces[name] = namespace
+	}
+	return nil
+}
+
+// ExtractionConfig ограничивает распаковку архивов, загруженных с extract: true.
+// Размеры считаются по фактически записанным данным, а не по заголовкам архива.
+type ExtractionConfig struct {
+	MaxEntries   int      `yaml:"max_entries"`
+	MaxTotalSize ByteSize `yaml:"max_total_size"`
+	MaxEntrySize ByteSize `yaml:"max_entry_size"`
+}
+
+// DefaultExtraction — ограничения распаковки по умолчанию.
+func DefaultExtraction() ExtractionConfig {
+	return ExtractionConfig{
+		MaxEntries:   10000,
+		MaxTotalSize: 10 << 30,
+		MaxEntrySize: 2 << 30,
+	}
+}
+
+// DefaultWebhooks — политика доставки по умолчанию.
+func DefaultWebhooks() WebhooksConfig {
+	return WebhooksConfig{
+		MaxAttempts:        5,
+		InitialBackoff:     time.Second,
+		MaxBackoff:         5 * time.Minute,
+		Timeout:            10 * time.Second,
+		ChunkBatchInterval: 5 * time.Second,
+	}
+}
+
+// EncryptionConfig включает шифрование чанков и собранных файлов на диске.
+// Ключ задаётся одним файлом KeyFile либо связкой версий Keys, из которых новые файлы
+// шифруются версией ActiveKey (по умолчанию последней). Файлы ключей содержат
+// 32-байтовый мастер-ключ (как есть, в hex или base64).
+type EncryptionConfig struct {
+	Enabled   bool         `yaml:"enabled"`
+	KeyFile   string       `yaml:"key_file"`
+	ActiveKey string       `yaml:"active_key"`
+	Keys      []KeyVersion `yaml:"keys"`
+}
+
+// KeyVersion — версия мастер-ключа; ID записывается в заголовок каждого зашифрованного файла.
+type KeyVersion struct {
+	ID      string `yaml:"id"`
+	KeyFile string `yaml:"key_file"`
+}
+
+// ChunkingConfig задаёт допустимые размеры чанков и правила выбора размера по умолчанию.
+type ChunkingConfig struct {
+	MinSize     ByteSize    `yaml:"min_size"`
+	MaxSize     ByteSize    `yaml:"max_size"`
+	DefaultSize ByteSize    `yaml:"default_size"`
+	Tiers       []ChunkTier `yaml:"tiers"`
+}
+
+// ChunkTier назначает размер чанка файлам меньше MaxFileSize; MaxFileSize 0 — без ограничения.
+type ChunkTier struct {
+	MaxFileSize ByteSize `yaml:"max_file_size"`
+	ChunkSize   ByteSize `yaml:"chunk_size"`
+}
+
+// DefaultChunking повторяет прежние жёстко заданные уровни 4/8/16 MB.
+func DefaultChunking() ChunkingConfig {
+	return ChunkingConfig{
+		MinSize:     256 << 10,
+		MaxSize:     1 << 30,
+		DefaultSize: 4 << 20,
+		Tiers: []ChunkTier{
+			{MaxFileSize: 50 << 20, ChunkSize: 4 << 20},
+			{MaxFileSize: 500 << 20, ChunkSize: 8 << 20},
+			{MaxFileSize: 0, ChunkSize: 16 << 20},
+		},
+	}
+}
+
+// Validate проверяет согласованность границ и уровней.
+func (c ChunkingConfig) Validate() error {
+	if c.MinSize <= 0 || c.MaxSize < c.MinSize {
+		return fmt.Errorf("chunking: need 0 < min_size <= max_size, got %s and %s", c.MinSize, c.MaxSize)
+	}
+	if c.DefaultSize < c.MinSize || c.DefaultSize > c.MaxSize {
+		return fmt.Errorf("chunking: default_size %s is outside [%s, %s]", c.DefaultSize, c.MinSize, c.MaxSize)
+	}
+	for i, tier := range c.Tiers {
+		if tier.ChunkSize <= 0 {
+			return fmt.Errorf("chunking: tier %d has no chunk_size", i+1)
+		}
+		if tier.MaxFileSize == 0 && i != len(c.Tiers)-1 {
+			return fmt.Errorf("chunking: only the last tier may omit max_file_size")
+		}
+		if i > 0 && tier.MaxFileSize != 0 && tier.MaxFileSize <= c.Tiers[i-1].MaxFileSize {
+			return fmt.Errorf("chunking: tiers must be sorted by max_file_size")
+		}
+	}
+	return nil
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -32,6 +306,87 @@ func LoadConfig(path string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	// Незаданные параметры чанков берём из значений по умолчанию
+	defaults := DefaultChunking()
+	if cfg.Chunking.MinSize == 0 {
+		cfg.Chunking.MinSize = defaults.MinSize
+	}
+	if cfg.Chunking.MaxSize == 0 {
+		cfg.Chunking.MaxSize = defaults.MaxSize
+	}
+	if cfg.Chunking.DefaultSize == 0 {
+		cfg.Chunking.DefaultSize = defaults.DefaultSize
+	}
+	if cfg.Chunking.Tiers == nil {
+		cfg.Chunking.Tiers = defaults.Tiers
+	}
+	if err := cfg.Chunking.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Encryption.Enabled && cfg.Encryption.KeyFile == "" && len(cfg.Encryption.Keys) == 0 {
+		return nil, fmt.Errorf("encryption: key_file or keys is required when encryption is enabled")
+	}
+
+	webhookDefaults := DefaultWebhooks()
+	if cfg.Webhooks.MaxAttempts == 0 {
+		cfg.Webhooks.MaxAttempts = webhookDefaults.MaxAttempts
+	}
+	if cfg.Webhooks.InitialBackoff == 0 {
+		cfg.Webhooks.InitialBackoff = webhookDefaults.InitialBackoff
+	}
+	if cfg.Webhooks.MaxBackoff == 0 {
+		cfg.Webhooks.MaxBackoff = webhookDefaults.MaxBackoff
+	}
+	if cfg.Webhooks.Timeout == 0 {
+		cfg.Webhooks.Timeout = webhookDefaults.Timeout
+	}
+	if cfg.Webhooks.ChunkBatchInterval == 0 {
+		cfg.Webhooks.ChunkBatchInterval = webhookDefaults.ChunkBatchInterval
+	}
+	for i, target := range cfg.Webhooks.Targets {
+		if target.URL == "" {
+			return nil, fmt.Errorf("webhooks: target %d has no url", i+1)
+		}
+	}
+	if err := cfg.FilePolicies.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Pipeline.OnFailure == "" {
+		cfg.Pipeline.OnFailure = "quarantine"
+	}
+	if err := cfg.Pipeline.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Storage.OnConflict == "" {
+		cfg.Storage.OnConflict = "version"
+	}
+	if err := ValidateOnConflict(cfg.Storage.OnConflict); err != nil {
+		return nil, fmt.Errorf("storage: %w", err)
+	}
+	if err := ValidateNamespaces(cfg.Namespaces); err != nil {
+		return nil, err
+	}
+	switch cfg.Storage.Assembly {
+	case "":
+		cfg.Storage.Assembly = "parts"
+	case "parts", "preallocate":
+	default:
+		return nil, fmt.Errorf("storage: assembly must be parts or preallocate, got %q", cfg.Storage.Assembly)
+	}
+	extractionDefaults := DefaultExtraction()
+	if cfg.Extraction.MaxEntries == 0 {
+		cfg.Extraction.MaxEntries = extractionDefaults.MaxEntries
+	}
+	if cfg.Extraction.MaxTotalSize == 0 {
+		cfg.Extraction.MaxTotalSize = extractionDefaults.MaxTotalSize
+	}
+	if cfg.Extraction.MaxEntrySize == 0 {
+		cfg.Extraction.MaxEntrySize = extractionDefaults.MaxEntrySize
+	}
+	if cfg.Extraction.MaxEntries < 0 || cfg.Extraction.MaxTotalSize < 0 || cfg.Extraction.MaxEntrySize < 0 {
+		return nil, fmt.Errorf("extraction: limits must not be negative")
+	}
 	return cfg, nil
 }
 
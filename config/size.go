@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteSize — размер в байтах, который в YAML можно записать как 4194304, "512KB" или "64MB".
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize разбирает размер с необязательным суффиксом B, KB, MB или GB (основание 1024).
+func ParseByteSize(value string) (ByteSize, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			number := strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			n, err := strconv.ParseInt(number, 10, 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid size %q", value)
+			}
+			return ByteSize(n * unit.factor), nil
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return ByteSize(n), nil
+}
+
+func (b ByteSize) String() string {
+	for _, unit := range byteSizeUnits {
+		if b != 0 && int64(b)%unit.factor == 0 {
+			return fmt.Sprintf("%d%s", int64(b)/unit.factor, unit.suffix)
+		}
+	}
+	return strconv.FormatInt(int64(b), 10)
+}
+
+func (b *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	size, err := ParseByteSize(raw)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+func (b ByteSize) MarshalYAML() (interface{}, error) {
+	return b.String(), nil
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"BASProject/config"
+	"BASProject/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+type AdminHandler struct {
+	SessionService services.ISessionService
+}
+
+func NewAdminHandler(sessionService services.ISessionService) *AdminHandler {
+	return &AdminHandler{
+		SessionService: sessionService,
+	}
+}
+
+// RequireAdminToken пропускает к административным маршрутам только запросы
+// с заголовком Authorization: Bearer <token>. Пустой token закрывает маршруты для всех.
+func RequireAdminToken(token string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				sendErrorResponse(w, http.StatusForbidden, 403, "Admin API is disabled.", nil, "Set admin.token in the server configuration to enable it.")
+				return
+			}
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				sendErrorResponse(w, http.StatusUnauthorized, 401, "Admin token required.", nil, "Send the admin token as Authorization: Bearer <token>.")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ListSessions возвращает страницу сессий с фильтрами status, owner, min_age, max_age
+// (длительности вида 90m или 24h), min_size, max_size (например 10MB) и пагинацией offset/limit.
+func (h *AdminHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseSessionFilter(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid filter.", err.Error(), "Use durations like 24h for ages and sizes like 10MB for sizes.")
+		return
+	}
+
+	page, err := h.SessionService.QuerySessions(filter)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Internal server error.", err.Error(), "Please try again later.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "success",
+		"sessions": page.Sessions,
+		"total":    page.Total,
+		"offset":   page.Offset,
+		"limit":    page.Limit,
+	})
+}
+
+// GetSession возвращает подробные сведения о сессии: чанки, файлы на диске и метки времени.
+func (h *AdminHandler) GetSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["session_id"]
+	if sessionID == "" {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Missing session_id in URL.", nil, "")
+		return
+	}
+
+	details, err := h.SessionService.SessionDetails(sessionID)
+	if err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			sendErrorResponse(w, http.StatusNotFound, 404, "Upload session not found.", map[string]interface{}{
+				"session_id": sessionID,
+			}, "")
+			return
+		}
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Internal server error.", err.Error(), "Please try again later.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"session": details,
+	})
+}
+
+// Fsck сверяет состояние сессий в Redis с файлами чанков на диске.
+// GET только формирует отчёт; POST с repair=true также исправляет найденные расхождения.
+func (h *AdminHandler) Fsck(w http.ResponseWriter, r *http.Request) {
+	repair := false
+	if value := r.URL.Query().Get("repair"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid repair flag.", err.Error(), "Use repair=true or repair=false.")
+			return
+		}
+		repair = parsed
+	}
+	if repair && r.Method != http.MethodPost {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, 405, "Repair requires POST.", nil, "Send POST /admin/fsck?repair=true to fix the issues.")
+		return
+	}
+
+	report, err := h.SessionService.Fsck(repair)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Internal server error.", err.Error(), "Please try again later.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"report": report,
+	})
+}
+
+func parseSessionFilter(r *http.Request) (services.SessionFilter, error) {
+	query := r.URL.Query()
+	filter := services.SessionFilter{
+		Status: query.Get("status"),
+		Owner:  query.Get("owner"),
+	}
+	durations := map[string]*time.Duration{"min_age": &filter.MinAge, "max_age": &filter.MaxAge}
+	for name, target := range durations {
+		if value := query.Get(name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return filter, errors.New(name + " must be a non-negative duration")
+			}
+			*target = d
+		}
+	}
+	sizes := map[string]*int64{"min_size": &filter.MinSize, "max_size": &filter.MaxSize}
+	for name, target := range sizes {
+		if value := query.Get(name); value != "" {
+			size, err := config.ParseByteSize(value)
+			if err != nil {
+				return filter, errors.New(name + " must be a size like 1024 or 10MB")
+			}
+			*target = int64(size)
+		}
+	}
+	ints := map[string]*int{"offset": &filter.Offset, "limit": &filter.Limit}
+	for name, target := range ints {
+		if value := query.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return filter, errors.New(name + " must be a non-negative integer")
+			}
+			*target = n
+		}
+	}
+	return filter, nil
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"BASProject/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+type BatchHandler struct {
+	BatchService services.IBatchService
+}
+
+func NewBatchHandler(batchService services.IBatchService) *BatchHandler {
+	return &BatchHandler{
+		BatchService: batchService,
+	}
+}
+
+// CreateBatch создаёт пакет загрузок по манифесту: по сессии на каждый файл.
+func (h *BatchHandler) CreateBatch(w http.ResponseWriter, r *http.Request) {
+	var requestData struct {
+		Owner     string `json:"owner"`
+		Namespace string `json:"namespace"`
+		Files     []struct {
+			FileName           string            `json:"file_name"`
+			FileSize           int64             `json:"file_size"`
+			FileHash           string            `json:"file_hash"`
+			PreferredChunkSize int64             `json:"preferred_chunk_size"`
+			ChunkMode          string            `json:"chunk_mode"`
+			ContentType        string            `json:"content_type"`
+			Metadata           map[string]string `json:"metadata"`
+		} `json:"files"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid JSON format.", err.Error(), "")
+		return
+	}
+	if len(requestData.Files) == 0 || len(requestData.Files) > services.MaxBatchFiles {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid batch manifest.", fmt.Sprintf("A batch holds 1 to %d files.", services.MaxBatchFiles), "")
+		return
+	}
+
+	params := services.BatchParams{Owner: requestData.Owner, Namespace: requestData.Namespace}
+	for i, file := range requestData.Files {
+		if file.FileName == "" || file.FileSize <= 0 || file.FileHash == "" || file.PreferredChunkSize < 0 {
+			sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid batch manifest.",
+				fmt.Sprintf("File %d: file name, size, and hash are required.", i+1), "")
+			return
+		}
+		params.Files = append(params.Files, services.SessionParams{
+			FileName:           file.FileName,
+			FileSize:           file.FileSize,
+			FileHash:           file.FileHash,
+			PreferredChunkSize: file.PreferredChunkSize,
+			ChunkMode:          file.ChunkMode,
+			ContentType:        file.ContentType,
+			Metadata:           file.Metadata,
+		})
+	}
+
+	batch, err := h.BatchService.CreateBatch(params)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrBatchInvalid), errors.Is(err, services.ErrInvalidFileName), errors.Is(err, services.ErrUnknownNamespace),
+		errors.Is(err, services.ErrInvalidMetadata):
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid batch manifest.", err.Error(),
+			"Send distinct relative file names without '..', control characters or reserved names.")
+		return
+	case errors.Is(err, services.ErrFileTypeRejected):
+		sendErrorResponse(w, http.StatusUnsupportedMediaType, 415, "File type is not allowed.", err.Error(), "Check the file type policy of the server.")
+		return
+	case errors.Is(err, services.ErrInsufficientStorage):
+		sendErrorResponse(w, http.StatusInsufficientStorage, 507, "Insufficient storage.", err.Error(), "Free up space on the server or retry later.")
+		return
+	case errors.Is(err, services.ErrFileExists):
+		sendErrorResponse(w, http.StatusConflict, 409, "File already exists.", err.Error(), "The namespace does not allow replacing files; upload under another name.")
+		return
+	default:
+		log.Printf("Ошибка при создании пакета: %v", err)
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to create batch.", err.Error(), "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"batch":   batch,
+		"message": "Batch created. Upload the chunks of every file, then commit the batch.",
+	})
+}
+
+// GetBatch возвращает состояние пакета и ход загрузки его файлов.
+func (h *BatchHandler) GetBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := h.BatchService.GetBatch(mux.Vars(r)["batch_id"])
+	if err != nil {
+		batchError(w, err, batch)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"batch":  batch,
+	})
+}
+
+// CommitBatch переносит все файлы пакета в хранилище одной операцией.
+func (h *BatchHandler) CommitBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := h.BatchService.CommitBatch(mux.Vars(r)["batch_id"])
+	if err != nil {
+		batchError(w, err, batch)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if batch.Status == services.BatchStatusProcessing {
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  "success",
+			"batch":   batch,
+			"message": "Batch assembled; processing is in progress. Poll GET /batches/{batch_id} for the result.",
+		})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"batch":   batch,
+		"message": "Batch committed; all files are available.",
+	})
+}
+
+// AbortBatch отменяет пакет и удаляет загруженные чанки его файлов.
+func (h *BatchHandler) AbortBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := h.BatchService.AbortBatch(mux.Vars(r)["batch_id"])
+	if err != nil {
+		batchError(w, err, batch)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"batch":   batch,
+		"message": "Batch aborted.",
+	})
+}
+
+// batchError отвечает на ошибку операции с пакетом; batch, если известен, передаётся в details.
+func batchError(w http.ResponseWriter, err error, batch *services.Batch) {
+	switch {
+	case errors.Is(err, services.ErrBatchNotFound):
+		sendErrorResponse(w, http.StatusNotFound, 404, "Batch not found.", nil, "")
+	case errors.Is(err, services.ErrBatchIncomplete):
+		sendErrorResponse(w, http.StatusConflict, 409, "Batch upload incomplete. Some files are still missing chunks.", batch,
+			"Upload the missing chunks and commit the batch again.")
+	case errors.Is(err, services.ErrBatchBusy):
+		sendErrorResponse(w, http.StatusConflict, 409, "Batch is being committed.", batch, "Poll GET /batches/{batch_id} for the result.")
+	case errors.Is(err, services.ErrBatchClosed):
+		sendErrorResponse(w, http.StatusConflict, 409, "Batch is closed.", batch, "Create a new batch.")
+	case errors.Is(err, services.ErrSessionNotFound):
+		sendErrorResponse(w, http.StatusConflict, 409, "An upload session of the batch no longer exists.", err.Error(), "Abort the batch and create a new one.")
+	case errors.Is(err, services.ErrInsufficientStorage):
+		sendErrorResponse(w, http.StatusInsufficientStorage, 507, "Insufficient storage.", err.Error(), "Chunks are kept; commit the batch again once space is freed.")
+	case batch != nil && batch.Status == services.BatchStatusFailed:
+		sendErrorResponse(w, http.StatusUnprocessableEntity, 422, "Batch commit failed; no file of the batch was stored.", batch,
+			"Batch sessions have been cleaned up. Fix the failing file and create a new batch.")
+	default:
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Batch operation failed.", err.Error(), "")
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"BASProject/internal/services"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
@@ -17,6 +19,11 @@ import (
 type UploadChunkHandler struct {
 	SessionService services.ISessionService
 	MaxChunkSize   int
+	Webhooks       *services.WebhookService
+	Progress       *services.ProgressService
+	Pipeline       *services.Pipeline
+	// ChunkTimeout — минимальный таймаут приёма чанка; 0 — 60 секунд
+	ChunkTimeout time.Duration
 }
 
 func NewUploadChunkHandler(sessionService services.ISessionService) *UploadChunkHandler {
@@ -36,12 +43,50 @@ func (h *UploadChunkHandler) UploadChunk(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	chunkIDStr := r.FormValue("chunk_id")
-	chunkID, err := strconv.Atoi(chunkIDStr)
-	if err != nil {
-		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid chunk_id format.", nil, "")
+	// Используем Content-Length для определения размера текущего чанка
+	chunkSize := r.ContentLength
+
+	// Вычисляем таймаут в зависимости от размера чанка
+	minTimeout := h.ChunkTimeout
+	if minTimeout <= 0 { // Минимальный таймаут — 60 секунд
+		minTimeout = 60 * time.Second
+	}
+	timeout := time.Duration(10*chunkSize/1024/1024) * time.Second
+	if timeout < minTimeout {
+		timeout = minTimeout
+	}
+	// Таймаут ограничивает приём тела запроса: медленный клиент не держит обработчик бесконечно.
+	// ResponseWriter без поддержки дедлайнов (например, в тестах) оставляет чтение без ограничения
+	http.NewResponseController(w).SetReadDeadline(time.Now().Add(timeout))
+
+	if !decodeChunkForm(w, r, int64(h.MaxChunkSize)) {
 		return
 	}
+	if err := r.ParseMultipartForm(32 << 20); errors.Is(err, os.ErrDeadlineExceeded) {
+		sendErrorResponse(w, http.StatusGatewayTimeout, 504, fmt.Sprintf("Timeout processing chunk. Chunk size: %d bytes, timeout: %.0f seconds.", chunkSize, timeout.Seconds()), nil, "Please try uploading the chunk again.")
+		return
+	}
+
+	// Чанк адресуется либо номером (chunk_id), либо смещением в байтах (offset)
+	var chunkID int
+	var offset int64
+	offsetStr := r.FormValue("offset")
+	byOffset := offsetStr != ""
+	if byOffset {
+		parsed, err := strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || parsed < 0 {
+			sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid offset format.", nil, "")
+			return
+		}
+		offset = parsed
+	} else {
+		parsed, err := strconv.Atoi(r.FormValue("chunk_id"))
+		if err != nil || parsed < 1 {
+			sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid chunk_id format.", "chunk_id must be a positive integer.", "Chunks are numbered from 1.")
+			return
+		}
+		chunkID = parsed
+	}
 
 	checksum := r.FormValue("checksum")
 	if checksum == "" {
@@ -57,15 +102,6 @@ func (h *UploadChunkHandler) UploadChunk(w http.ResponseWriter, r *http.Request)
 	}
 	defer chunkFile.Close()
 
-	// Используем Content-Length для определения размера текущего чанка
-	chunkSize := r.ContentLength
-
-	// Вычисляем таймаут в зависимости от размера чанка
-	timeout := time.Duration(10*chunkSize/1024/1024) * time.Second
-	if timeout < 60*time.Second { // Минимальный таймаут — 60 секунд
-		timeout = 60 * time.Second
-	}
-
 	// Контекст с динамическим таймаутом
 	ctx, cancel := context.WithTimeout(r.Context(), timeout)
 	defer cancel()
@@ -107,8 +143,19 @@ func (h *UploadChunkHandler) UploadChunk(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if byOffset {
+		h.saveChunkAt(w, sessionID, offset, fileData)
+		return
+	}
+
 	// Проверка, существует ли уже чанк на сервере
 	exists, err := h.SessionService.GetFileService().ChunkExists(sessionID, chunkID)
+	if errors.Is(err, services.ErrSessionNotFound) {
+		sendErrorResponse(w, http.StatusNotFound, 404, "Upload session not found.", map[string]interface{}{
+			"session_id": sessionID,
+		}, "Ensure that the session ID is correct or restart the upload.")
+		return
+	}
 	if err != nil {
 		sendErrorResponse(w, http.StatusInternalServerError, 500, "Error checking chunk existence.", err.Error(), "")
 		return
@@ -123,11 +170,47 @@ func (h *UploadChunkHandler) UploadChunk(w http.ResponseWriter, r *http.Request)
 
 	// Сохраняем чанк
 	err = h.SessionService.GetFileService().SaveChunk(sessionID, chunkID, fileData)
+	if errors.Is(err, services.ErrFileTypeRejected) {
+		sendErrorResponse(w, http.StatusUnsupportedMediaType, 415, "File type is not allowed.", err.Error(), "Check the file type policy of the server.")
+		return
+	}
+	if errors.Is(err, services.ErrInsufficientStorage) {
+		sendErrorResponse(w, http.StatusInsufficientStorage, 507, "Insufficient storage.", err.Error(), "Free up space on the server or retry later.")
+		return
+	}
+	// Чанк должен занимать своё место в файле: номер в 1..total_chunks и точный размер
+	if errors.Is(err, services.ErrChunkOutOfRange) {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid chunk_id.", err.Error(), "Check total_chunks via /upload/status.")
+		return
+	}
+	if errors.Is(err, services.ErrChunkSizeInvalid) {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid chunk size.", err.Error(), "Every chunk except the last must be exactly chunk_size bytes.")
+		return
+	}
+	if errors.Is(err, services.ErrChunkModeMismatch) {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Session expects chunks addressed by offset.", nil, "Send the offset field instead of chunk_id.")
+		return
+	}
+	if errors.Is(err, services.ErrSessionNotFound) {
+		sendErrorResponse(w, http.StatusNotFound, 404, "Upload session not found.", map[string]interface{}{
+			"session_id": sessionID,
+		}, "Ensure that the session ID is correct or restart the upload.")
+		return
+	}
+	if errors.Is(err, services.ErrChunkAlreadyExists) {
+		// Параллельный запрос успел сохранить тот же чанк
+		sendErrorResponse(w, http.StatusConflict, 409, "Chunk already uploaded.", map[string]interface{}{
+			"chunk_id":   chunkID,
+			"session_id": sessionID,
+		}, "Check uploaded chunks via /upload/status before sending.")
+		return
+	}
 	if err != nil {
 		sendErrorResponse(w, http.StatusInternalServerError, 500, "Internal server error.", err.Error(), "Please try again later.")
 		return
 	}
 
+	h.Webhooks.ChunkReceived(sessionID, chunkID, int64(len(fileData)))
 	nextChunkID := chunkID + 1
 
 	// Ответ о успешной загрузке чанка
@@ -141,6 +224,57 @@ func (h *UploadChunkHandler) UploadChunk(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// saveChunkAt сохраняет чанк, адресованный смещением, и сообщает следующее смещение.
+func (h *UploadChunkHandler) saveChunkAt(w http.ResponseWriter, sessionID string, offset int64, fileData []byte) {
+	err := h.SessionService.GetFileService().SaveChunkAt(sessionID, offset, fileData)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrSessionNotFound):
+		sendErrorResponse(w, http.StatusNotFound, 404, "Upload session not found.", map[string]interface{}{
+			"session_id": sessionID,
+		}, "Ensure that the session ID is correct or restart the upload.")
+		return
+	case errors.Is(err, services.ErrChunkAlreadyExists):
+		sendErrorResponse(w, http.StatusConflict, 409, "Chunk already uploaded.", map[string]interface{}{
+			"offset":     offset,
+			"session_id": sessionID,
+		}, "Check uploaded ranges via /upload/status before sending.")
+		return
+	case errors.Is(err, services.ErrChunkOverlap):
+		sendErrorResponse(w, http.StatusConflict, 409, "Chunk overlaps an uploaded range.", err.Error(), "Check uploaded ranges via /upload/status before sending.")
+		return
+	case errors.Is(err, services.ErrChunkModeMismatch):
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Session expects chunks addressed by chunk_id.", nil, "Start the session with chunk_mode \"offset\" to upload by offset.")
+		return
+	case errors.Is(err, services.ErrChunkSizeInvalid):
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid chunk size.", err.Error(), "")
+		return
+	case errors.Is(err, services.ErrFileTypeRejected):
+		sendErrorResponse(w, http.StatusUnsupportedMediaType, 415, "File type is not allowed.", err.Error(), "Check the file type policy of the server.")
+		return
+	case errors.Is(err, services.ErrInsufficientStorage):
+		sendErrorResponse(w, http.StatusInsufficientStorage, 507, "Insufficient storage.", err.Error(), "Free up space on the server or retry later.")
+		return
+	case errors.Is(err, services.ErrSessionBusy):
+		sendErrorResponse(w, http.StatusServiceUnavailable, 503, "Session is busy.", nil, "Please retry the chunk.")
+		return
+	default:
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Internal server error.", err.Error(), "Please try again later.")
+		return
+	}
+
+	h.Webhooks.ChunkReceived(sessionID, offset, int64(len(fileData)))
+	nextOffset := offset + int64(len(fileData))
+	log.Printf("Range at offset %d uploaded successfully. Next offset: %d", offset, nextOffset)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "success",
+		"message":     fmt.Sprintf("Chunk at offset %d uploaded successfully.", offset),
+		"next_offset": nextOffset,
+	})
+}
+
 func sendErrorResponse(w http.ResponseWriter, statusCode int, errorCode int, message string, details interface{}, suggestion string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"BASProject/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// maxLookupHashes ограничивает число хешей в одном запросе к хранилищу чанков.
+const maxLookupHashes = 10000
+
+type ChunkStoreHandler struct {
+	FileService  services.IFileService
+	MaxChunkSize int
+}
+
+func NewChunkStoreHandler(fileService services.IFileService) *ChunkStoreHandler {
+	return &ChunkStoreHandler{
+		FileService: fileService,
+	}
+}
+
+// LookupChunks сообщает, каких чанков из списка ещё нет в хранилище.
+func (h *ChunkStoreHandler) LookupChunks(w http.ResponseWriter, r *http.Request) {
+	var requestData struct {
+		Hashes []string `json:"hashes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid JSON format.", err.Error(), "")
+		return
+	}
+	if len(requestData.Hashes) > maxLookupHashes {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Too many hashes in one request.", map[string]interface{}{
+			"max_hashes": maxLookupHashes,
+		}, "Split the lookup into several requests.")
+		return
+	}
+
+	missing, err := h.FileService.MissingChunks(requestData.Hashes)
+	if errors.Is(err, services.ErrChunkHashInvalid) {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid chunk hash.", err.Error(), "Chunk hashes are hex-encoded SHA-256.")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to look up chunks.", err.Error(), "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"missing": missing,
+	})
+}
+
+// StoreChunk сохраняет чанк в хранилище под его SHA-256.
+func (h *ChunkStoreHandler) StoreChunk(w http.ResponseWriter, r *http.Request) {
+	if !decodeChunkForm(w, r, int64(h.MaxChunkSize)) {
+		return
+	}
+	checksum := r.FormValue("checksum")
+	if checksum == "" {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Missing checksum.", nil, "")
+		return
+	}
+	chunkFile, _, err := r.FormFile("chunk_data")
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Error reading chunk data.", nil, "")
+		log.Println(err)
+		return
+	}
+	defer chunkFile.Close()
+
+	fileData, err := io.ReadAll(chunkFile)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to read chunk data.", err.Error(), "")
+		return
+	}
+	if !h.FileService.ValidateChecksum(fileData, checksum) {
+		sendErrorResponse(w, http.StatusPreconditionFailed, 412, "Checksum validation failed.", map[string]interface{}{
+			"expected_checksum": checksum,
+			"provided_checksum": h.FileService.CalculateChecksum(fileData),
+		}, "Please resend the chunk with the correct data.")
+		return
+	}
+
+	hash, created, err := h.FileService.StoreChunk(fileData)
+	if errors.Is(err, services.ErrChunkSizeInvalid) {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid chunk size.", err.Error(), "")
+		return
+	}
+	if errors.Is(err, services.ErrInsufficientStorage) {
+		sendErrorResponse(w, http.StatusInsufficientStorage, 507, "Insufficient storage.", err.Error(), "Free up space on the server or retry later.")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Internal server error.", err.Error(), "Please try again later.")
+		return
+	}
+
+	statusCode, message := http.StatusCreated, "Chunk stored."
+	if !created {
+		statusCode, message = http.StatusOK, "Chunk is already stored."
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"hash":    hash,
+		"size":    len(fileData),
+		"message": message,
+	})
+}
+
+// LinkChunks помещает в сессию чанки из хранилища по их хешам, без передачи данных.
+// Чанки, которых нет в хранилище, возвращаются в missing; их нужно загрузить и сослаться повторно.
+func (h *UploadChunkHandler) LinkChunks(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["session_id"]
+	if sessionID == "" {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Missing session_id in URL.", nil, "")
+		return
+	}
+
+	var requestData struct {
+		Chunks []services.ChunkRef `json:"chunks"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid JSON format.", err.Error(), "")
+		return
+	}
+	if len(requestData.Chunks) > maxLookupHashes {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Too many chunks in one request.", map[string]interface{}{
+			"max_chunks": maxLookupHashes,
+		}, "Split the references into several requests.")
+		return
+	}
+
+	linked := 0
+	linkedSize := int64(0)
+	missing := []services.ChunkRef{}
+	for _, ref := range requestData.Chunks {
+		size, err := h.SessionService.GetFileService().LinkChunkAt(sessionID, ref.Offset, ref.Hash)
+		switch {
+		case err == nil, errors.Is(err, services.ErrChunkAlreadyExists):
+			linked++
+			linkedSize += size
+		case errors.Is(err, services.ErrChunkNotStored):
+			missing = append(missing, ref)
+		case errors.Is(err, services.ErrSessionNotFound):
+			sendErrorResponse(w, http.StatusNotFound, 404, "Upload session not found.", map[string]interface{}{
+				"session_id": sessionID,
+			}, "Ensure that the session ID is correct or restart the upload.")
+			return
+		case errors.Is(err, services.ErrChunkModeMismatch):
+			sendErrorResponse(w, http.StatusBadRequest, 400, "Session expects chunks addressed by chunk_id.", nil, "Start the session with chunk_mode \"offset\" to reference stored chunks.")
+			return
+		case errors.Is(err, services.ErrChunkHashInvalid):
+			sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid chunk hash.", map[string]interface{}{
+				"offset": ref.Offset,
+				"hash":   ref.Hash,
+			}, "Chunk hashes are hex-encoded SHA-256.")
+			return
+		case errors.Is(err, services.ErrChunkSizeInvalid):
+			sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid chunk size.", err.Error(), "")
+			return
+		case errors.Is(err, services.ErrChunkOverlap):
+			sendErrorResponse(w, http.StatusConflict, 409, "Chunk overlaps an uploaded range.", err.Error(), "Check uploaded ranges via /upload/status before sending.")
+			return
+		case errors.Is(err, services.ErrSessionBusy):
+			sendErrorResponse(w, http.StatusServiceUnavailable, 503, "Session is busy.", nil, "Please retry the request.")
+			return
+		case errors.Is(err, services.ErrInsufficientStorage):
+			sendErrorResponse(w, http.StatusInsufficientStorage, 507, "Insufficient storage.", err.Error(), "Free up space on the server or retry later.")
+			return
+		default:
+			sendErrorResponse(w, http.StatusInternalServerError, 500, "Internal server error.", err.Error(), "Please try again later.")
+			return
+		}
+	}
+
+	log.Printf("Linked %d stored chunks (%d bytes) into session %s, %d missing", linked, linkedSize, sessionID, len(missing))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "success",
+		"linked":      linked,
+		"linked_size": linkedSize,
+		"missing":     missing,
+	})
+}
@@ -2,12 +2,15 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
+
+	"BASProject/internal/services"
 
 	"github.com/gorilla/mux"
 )
@@ -24,6 +27,41 @@ func (h *UploadChunkHandler) CompleteUpload(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Для отложенных сессий клиент передаёт хеш и итоговый размер файла в теле запроса
+	var requestData struct {
+		FileHash string `json:"file_hash"`
+		FileSize int64  `json:"file_size"`
+	}
+	if r.Body != nil {
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil && err != io.EOF {
+			sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid JSON format.", err.Error(), "")
+			return
+		}
+	}
+	if requestData.FileHash != "" || requestData.FileSize != 0 {
+		err := h.SessionService.FinalizeSession(sessionID, requestData.FileHash, requestData.FileSize)
+		switch {
+		case err == nil:
+		case errors.Is(err, services.ErrSessionNotFound):
+			sendErrorResponse(w, http.StatusNotFound, 404, "Upload session not found.", map[string]interface{}{
+				"session_id": sessionID,
+			}, "")
+			return
+		case errors.Is(err, services.ErrSessionNotDeferred):
+			sendErrorResponse(w, http.StatusBadRequest, 400, "Session was created with a file hash; do not send it on completion.", nil, "")
+			return
+		case errors.Is(err, services.ErrInsufficientStorage):
+			sendErrorResponse(w, http.StatusInsufficientStorage, 507, "Insufficient storage.", err.Error(), "Free up space on the server or retry later.")
+			return
+		case errors.Is(err, services.ErrDeferredSizeInvalid):
+			sendErrorResponse(w, http.StatusConflict, 409, "Uploaded chunks do not match the declared file size.", err.Error(), "Check uploaded chunks via /upload/status before completing.")
+			return
+		default:
+			sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid file hash or file size.", err.Error(), "")
+			return
+		}
+	}
+
 	// Обновляем прогресс загрузки перед проверкой статуса
 	err := h.SessionService.UpdateProgress(sessionID)
 	if err != nil {
@@ -38,6 +76,14 @@ func (h *UploadChunkHandler) CompleteUpload(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Файлы пакета попадают в хранилище только вместе, при фиксации пакета
+	if batchID, _ := status["batch_id"].(string); batchID != "" {
+		sendErrorResponse(w, http.StatusConflict, 409, "Session belongs to a batch.", map[string]interface{}{
+			"batch_id": batchID,
+		}, "Commit the whole batch via POST /batches/{batch_id}/commit.")
+		return
+	}
+
 	// Извлекаем и проверяем статус 'completed'
 	completedInterface, ok := status["completed"]
 	if !ok {
@@ -62,9 +108,21 @@ func (h *UploadChunkHandler) CompleteUpload(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	deferred, _ := status["deferred"].(bool)
+	if deferred && requestData.FileHash == "" {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Deferred session requires file_hash and file_size on completion.", nil, "")
+		return
+	}
+
 	if !completed || statusStr != "completed" {
+		details := map[string]interface{}{
+			"missing_chunks": status["pending_chunks"],
+		}
+		if ranges, ok := status["missing_ranges"]; ok {
+			details["missing_ranges"] = ranges
+		}
 		h.cleanupSession(sessionID)
-		sendErrorResponse(w, http.StatusConflict, 409, "Upload incomplete or session is in progress. Session data has been cleaned up.", nil, "")
+		sendErrorResponse(w, http.StatusConflict, 409, "File upload incomplete. Some chunks are still missing.", details, "Session data has been cleaned up. Please restart the upload.")
 		return
 	}
 
@@ -79,52 +137,260 @@ func (h *UploadChunkHandler) CompleteUpload(w http.ResponseWriter, r *http.Reque
 		sendErrorResponse(w, http.StatusInternalServerError, 500, "Invalid 'file_name'.", nil, "")
 		return
 	}
-
-	// Получаем путь для сборки полного файла из FileService через интерфейсный метод
-	storagePath, err := h.SessionService.GetFileService().GetStoragePath()
+	// Имя проверяется при создании сессии; повторная проверка защищает от сессий,
+	// созданных до её появления, с путями вроде ../../etc/x
+	fileName, err = services.SanitizeFileName(fileName)
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to retrieve storage path.", nil, "")
+		h.cleanupSession(sessionID)
+		h.uploadFailed(sessionID, fileNameInterface.(string), "invalid_name", err.Error())
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid file name.", err.Error(), "Session data has been cleaned up. Restart the upload with a relative file name.")
 		return
 	}
 
-	// Генерируем уникальное имя файла
-	uniqueFileName, err := GenerateUniqueFileName(storagePath, fileName)
+	fileService := h.SessionService.GetFileService()
+	storagePath, err := fileService.GetStoragePath()
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to generate unique file name.", nil, "")
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to retrieve storage path.", nil, "")
 		return
 	}
 
-	// Задаём путь к выходному файлу
-	outputFilePath := filepath.Join(storagePath, uniqueFileName)
-
-	// Убеждаемся, что директория для загрузок существует
-	if err := os.MkdirAll(storagePath, os.ModePerm); err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to create uploads directory.", err.Error(), "")
+	// Файл собирается во временный путь и попадает под своё имя только после всех проверок,
+	// поэтому прежняя версия остаётся доступной до конца сборки
+	assemblyPath, err := fileService.AssemblyPath(sessionID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to prepare assembly.", err.Error(), "")
 		return
 	}
 
 	// Собираем файл
-	err = h.SessionService.GetFileService().AssembleChunks(sessionID, outputFilePath)
+	err = fileService.AssembleChunks(sessionID, assemblyPath)
 	if err != nil {
+		os.Remove(assemblyPath)
+		if errors.Is(err, services.ErrInsufficientStorage) {
+			// Чанки сохраняются: после освобождения места сборку можно повторить
+			sendErrorResponse(w, http.StatusInsufficientStorage, 507, "Insufficient storage.", err.Error(), "Chunks are kept; complete the upload again once space is freed.")
+			return
+		}
 		h.cleanupSession(sessionID)
-		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to assemble chunks. Session data has been cleaned up.", err.Error(), "")
+		h.uploadFailed(sessionID, fileName, "assembly_failed", err.Error())
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to assemble chunks.", err.Error(), "Session data has been cleaned up.")
 		return
 	}
 
-	// Удаляем файлы чанков
-	err = h.SessionService.GetFileService().DeleteChunks(sessionID)
-	if err != nil {
-		log.Printf("Failed to delete chunks for session %s: %v", sessionID, err)
+	// Повторно проверяем тип по собранному файлу
+	if err := fileService.CheckAssembledFile(fileName, assemblyPath); err != nil {
+		os.Remove(assemblyPath)
+		h.cleanupSession(sessionID)
+		if errors.Is(err, services.ErrFileTypeRejected) {
+			h.uploadFailed(sessionID, fileName, "type_rejected", err.Error())
+			sendErrorResponse(w, http.StatusUnsupportedMediaType, 415, "File type is not allowed.", err.Error(), "Session data has been cleaned up.")
+			return
+		}
+		h.uploadFailed(sessionID, fileName, "assembly_failed", err.Error())
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to check assembled file.", err.Error(), "Session data has been cleaned up.")
+		return
+	}
+
+	// Сверяем хеш собранного файла с заявленным: для отложенной сессии он
+	// не проверялся при создании, для обычной — защищает индекс содержимого
+	expectedHash, _ := status["file_hash"].(string)
+	if deferred {
+		expectedHash = requestData.FileHash
+	}
+	if expectedHash != "" {
+		actualHash, err := fileService.CalculateFileChecksum(assemblyPath)
+		if err != nil || actualHash != expectedHash {
+			os.Remove(assemblyPath)
+			h.cleanupSession(sessionID)
+			h.uploadFailed(sessionID, fileName, "hash_mismatch", fmt.Sprintf("expected %s, got %s", expectedHash, actualHash))
+			sendErrorResponse(w, http.StatusUnprocessableEntity, 422, "File hash mismatch.", map[string]interface{}{
+				"expected_hash": expectedHash,
+				"actual_hash":   actualHash,
+			}, "Session data has been cleaned up. Please restart the upload.")
+			return
+		}
+	}
+
+	// Тип содержимого и метаданные сессии переходят к собранному файлу
+	contentType, _ := status["content_type"].(string)
+	metadata, _ := status["metadata"].(map[string]string)
+	owner, _ := status["owner"].(string)
+	fileMeta := services.FileMeta{ContentType: contentType, Metadata: metadata, SessionID: sessionID, FileHash: expectedHash, Owner: owner}
+
+	var uniqueFileName, outputFilePath string
+	var version int
+	// store переносит собранный файл в хранилище. Занятое имя разрешается политикой
+	// пространства имён: новая версия, замена, отказ или новое имя
+	store := func() error {
+		name, v, err := fileService.CommitFile(fileName, assemblyPath)
+		if err != nil {
+			return err
+		}
+		uniqueFileName, version = name, v
+		outputFilePath = filepath.Join(storagePath, filepath.FromSlash(uniqueFileName))
+
+		// Удаляем файлы чанков
+		if err := fileService.DeleteChunks(sessionID); err != nil {
+			log.Printf("Failed to delete chunks for session %s: %v", sessionID, err)
+		}
+		h.SessionService.ReleaseReservation(sessionID)
+
+		if err := fileService.SaveFileMeta(uniqueFileName, fileMeta); err != nil {
+			log.Printf("Failed to save metadata of %s: %v", uniqueFileName, err)
+		}
+		return nil
+	}
+
+	fileSize, _ := status["file_size"].(int64)
+	if deferred {
+		fileSize = requestData.FileSize
+	}
+	extract, _ := status["extract"].(bool)
+	extractDir, _ := status["extract_dir"].(string)
+	// available завершает загрузку, когда файл готов к выдаче; архив при запросе распаковывается
+	available := func() *services.ExtractionResult {
+		// Проверенное содержимое доступно для мгновенной загрузки
+		if expectedHash != "" {
+			if err := fileService.IndexContent(expectedHash, outputFilePath); err != nil {
+				log.Printf("Failed to index content of %s: %v", outputFilePath, err)
+			}
+		}
+		completed := withFileMeta(map[string]interface{}{
+			"session_id": sessionID,
+			"file_name":  uniqueFileName,
+			"version":    version,
+			"path":       outputFilePath,
+			"file_size":  fileSize,
+			"file_hash":  expectedHash,
+		}, contentType, metadata)
+		var extraction *services.ExtractionResult
+		if extract {
+			extraction = extractArchive(fileService, uniqueFileName, outputFilePath, extractDir, fileMeta)
+			completed["extraction"] = extraction
+		}
+		h.Webhooks.Emit(services.EventUploadCompleted, completed)
+		h.Progress.Publish(services.ProgressEvent{
+			Type:         services.ProgressCompleted,
+			SessionID:    sessionID,
+			UploadedSize: fileSize,
+			FileSize:     fileSize,
+			FileName:     uniqueFileName,
+			FileHash:     expectedHash,
+		})
+		return extraction
+	}
+
+	// С конвейером обработки файл остаётся во временном пути и переносится в хранилище
+	// только после успешного завершения: до этого под именем доступна прежняя версия
+	if h.Pipeline.Enabled() {
+		h.Pipeline.Start(services.ProcessedFile{
+			SessionID:   sessionID,
+			Name:        fileName,
+			Path:        assemblyPath,
+			FileHash:    expectedHash,
+			ContentType: contentType,
+			Metadata:    metadata,
+			Commit: func() (string, error) {
+				err := store()
+				return uniqueFileName, err
+			},
+		}, func(result services.PipelineResult) {
+			if result.Status == services.FileStatusAvailable {
+				available()
+				return
+			}
+			if uniqueFileName == "" {
+				// Файл не попал в хранилище: чанки и резерв больше не нужны
+				if err := fileService.DeleteChunks(sessionID); err != nil {
+					log.Printf("Failed to delete chunks for session %s: %v", sessionID, err)
+				}
+				h.SessionService.ReleaseReservation(sessionID)
+			}
+			h.uploadFailed(sessionID, fileName, "processing_failed", result.FailureMessage())
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":     services.FileStatusProcessing,
+			"session_id": sessionID,
+			"file_name":  fileName,
+			"message":    "File assembled; processing is in progress. Poll /upload/status for the result.",
+		})
+		return
+	}
+
+	if err := store(); err != nil {
+		os.Remove(assemblyPath)
+		h.cleanupSession(sessionID)
+		if errors.Is(err, services.ErrFileExists) {
+			h.uploadFailed(sessionID, fileName, "file_exists", err.Error())
+			sendErrorResponse(w, http.StatusConflict, 409, "File already exists.", err.Error(), "Session data has been cleaned up. Upload under another name or delete the existing file.")
+			return
+		}
+		h.uploadFailed(sessionID, fileName, "assembly_failed", err.Error())
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to store assembled file.", err.Error(), "Session data has been cleaned up.")
+		return
+	}
+	responseData := map[string]interface{}{
+		"status":     "success",
+		"session_id": sessionID,
+		"file_name":  uniqueFileName,
+		"version":    version,
+		"message":    "File upload completed successfully.",
+	}
+	if extraction := available(); extraction != nil {
+		responseData["extraction"] = extraction
 	}
 
 	// Возвращаем успешный ответ
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":     "success",
+	json.NewEncoder(w).Encode(responseData)
+}
+
+// uploadFailed уведомляет о загрузке, завершившейся ошибкой после получения всех чанков.
+func (h *UploadChunkHandler) uploadFailed(sessionID, fileName, reason, message string) {
+	h.Webhooks.Emit(services.EventUploadFailed, map[string]interface{}{
 		"session_id": sessionID,
-		"message":    "File upload completed successfully.",
+		"file_name":  fileName,
+		"reason":     reason,
+		"error":      message,
 	})
+	h.Progress.Publish(services.ProgressEvent{
+		Type:          services.ProgressFailed,
+		SessionID:     sessionID,
+		RemainingSize: -1,
+		FileName:      fileName,
+		Status:        reason,
+		Error:         message,
+	})
+}
+
+// extractArchive распаковывает загруженный архив. Ошибка распаковки не отменяет загрузку:
+// она записывается в итог, который попадает в ответ, уведомление и статус сессии.
+func extractArchive(fileService services.IFileService, name, path, dir string, meta services.FileMeta) *services.ExtractionResult {
+	extraction, err := fileService.ExtractArchive(name, path, dir, meta)
+	if err != nil {
+		log.Printf("Failed to extract %s uploaded in session %s: %v", name, meta.SessionID, err)
+		if extraction == nil {
+			extraction = &services.ExtractionResult{Archive: name}
+		}
+		extraction.Status, extraction.Error = services.ExtractionFailed, err.Error()
+	}
+	return extraction
+}
+
+// storedPath возвращает путь к файлу хранилища для уведомлений.
+func storedPath(fileService services.IFileService, name string) string {
+	if fileService == nil {
+		return name
+	}
+	storagePath, err := fileService.GetStoragePath()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(storagePath, name)
 }
 
 func (h *UploadChunkHandler) cleanupSession(sessionID string) {
@@ -140,31 +406,3 @@ func (h *UploadChunkHandler) cleanupSession(sessionID string) {
 		log.Printf("Failed to delete session data for session %s: %v", sessionID, err)
 	}
 }
-
-// GenerateUniqueFileName проверяет, существует ли файл, и добавляет суффикс, если нужно.
-func GenerateUniqueFileName(directory, fileName string) (string, error) {
-	// Разделяем имя файла и расширение
-	baseName := strings.TrimSuffix(fileName, filepath.Ext(fileName))
-	extension := filepath.Ext(fileName)
-	uniqueName := fileName
-	counter := 1
-
-	for {
-		// Формируем путь к файлу
-		filePath := filepath.Join(directory, uniqueName)
-
-		// Проверяем, существует ли файл
-		_, err := os.Stat(filePath)
-		if os.IsNotExist(err) {
-			// Файл не существует, можно использовать это имя
-			return uniqueName, nil
-		} else if err != nil {
-			// Произошла какая-то другая ошибка при доступе к файлу
-			return "", err
-		}
-
-		// Если файл существует, добавляем суффикс и проверяем снова
-		uniqueName = fmt.Sprintf("%s(%d)%s", baseName, counter, extension)
-		counter++
-	}
-}
@@ -11,6 +11,8 @@ import (
 
 type DeleteHandler struct {
 	SessionService services.ISessionService
+	Webhooks       *services.WebhookService
+	Progress       *services.ProgressService
 }
 
 func NewDeleteHandler(sessionService services.ISessionService) *DeleteHandler {
@@ -39,6 +41,11 @@ func (h *DeleteHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.Webhooks.Emit(services.EventSessionDeleted, map[string]interface{}{
+		"session_id": sessionID,
+	})
+	h.Progress.Publish(services.ProgressEvent{Type: services.ProgressDeleted, SessionID: sessionID, RemainingSize: -1})
+
 	response := map[string]interface{}{
 		"status":     "success",
 		"session_id": sessionID,
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// multipartOverhead — запас на заголовки и поля multipart сверх размера самого чанка.
+const multipartOverhead = 1 << 20
+
+var (
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+	errBodyTooLarge        = errors.New("decompressed request body is too large")
+)
+
+// zstdMaxWindow ограничивает окно zstd-потока: память декодера не зависит от заявленного клиентом окна.
+const zstdMaxWindow = 8 << 20
+
+// chunkDecoders — поддерживаемые значения Content-Encoding для тела запроса с чанком.
+// Распакованный объём ограничивает decodeRequestBody одинаково для всех кодировок.
+var chunkDecoders = map[string]func(io.Reader) (io.ReadCloser, error){
+	"gzip": func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	"zstd": func(r io.Reader) (io.ReadCloser, error) {
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(zstdMaxWindow))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	},
+}
+
+// supportedEncodings возвращает список поддерживаемых Content-Encoding для ответа клиенту.
+func supportedEncodings() []string {
+	encodings := []string{"identity"}
+	for name := range chunkDecoders {
+		encodings = append(encodings, name)
+	}
+	sort.Strings(encodings[1:])
+	return encodings
+}
+
+// decodeRequestBody подменяет тело запроса потоковым распаковщиком по Content-Encoding.
+// Контрольная сумма чанка затем проверяется по распакованным данным.
+// maxSize > 0 ограничивает объём распакованного тела, защищая от «zip-бомб».
+func decodeRequestBody(r *http.Request, maxSize int64) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		return nil
+	}
+	newDecoder, ok := chunkDecoders[encoding]
+	if !ok {
+		return fmt.Errorf("%w: %q", errUnsupportedEncoding, encoding)
+	}
+	decoder, err := newDecoder(r.Body)
+	if err != nil {
+		return fmt.Errorf("invalid %s body: %w", encoding, err)
+	}
+	var body io.Reader = decoder
+	if maxSize > 0 {
+		body = &limitedBody{r: decoder, remaining: maxSize + multipartOverhead}
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, decoder}
+	r.Header.Del("Content-Encoding")
+	r.ContentLength = -1
+	return nil
+}
+
+// decodeChunkForm распаковывает сжатое тело запроса с чанком и сразу разбирает multipart-форму:
+// ошибки распаковки проявляются только при чтении тела. При ошибке отправляет ответ и возвращает false.
+func decodeChunkForm(w http.ResponseWriter, r *http.Request, maxSize int64) bool {
+	if r.Header.Get("Content-Encoding") == "" {
+		return true
+	}
+	if err := decodeRequestBody(r, maxSize); err != nil {
+		sendDecodeError(w, err)
+		return false
+	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		sendDecodeError(w, err)
+		return false
+	}
+	return true
+}
+
+// limitedBody возвращает errBodyTooLarge, когда данные превышают лимит.
+type limitedBody struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// sendDecodeError отвечает на ошибку decodeRequestBody или чтения распакованного тела.
+func sendDecodeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errUnsupportedEncoding):
+		sendErrorResponse(w, http.StatusUnsupportedMediaType, 415, "Unsupported Content-Encoding.", map[string]interface{}{
+			"supported_encodings": supportedEncodings(),
+		}, "Send the chunk uncompressed or use a supported encoding.")
+	case errors.Is(err, errBodyTooLarge):
+		sendErrorResponse(w, http.StatusRequestEntityTooLarge, 413, "Decompressed chunk is too large.", nil, "")
+	default:
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid compressed request body.", err.Error(), "")
+	}
+}
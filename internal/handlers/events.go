@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"BASProject/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// eventsHeartbeat — интервал комментариев, не дающих прокси закрыть простаивающий поток.
+var eventsHeartbeat = 15 * time.Second
+
+type EventsHandler struct {
+	SessionService services.ISessionService
+	Progress       *services.ProgressService
+}
+
+func NewEventsHandler(sessionService services.ISessionService, progress *services.ProgressService) *EventsHandler {
+	return &EventsHandler{
+		SessionService: sessionService,
+		Progress:       progress,
+	}
+}
+
+// StreamEvents отдаёт прогресс сессии потоком Server-Sent Events: сначала текущее состояние
+// (progress), затем события сохранённых чанков (chunk) до завершающего completed, failed или deleted.
+func (h *EventsHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sessionID := vars["session_id"]
+	if sessionID == "" {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Missing session_id in URL.", nil, "")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Streaming is not supported.", nil, "")
+		return
+	}
+
+	// Подписываемся до чтения состояния, чтобы не пропустить чанки, сохранённые между ними
+	c, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	events, err := h.Progress.Subscribe(c, sessionID)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to subscribe to session events.", err.Error(), "")
+		return
+	}
+
+	status, err := h.SessionService.GetUploadStatus(sessionID)
+	if err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			sendErrorResponse(w, http.StatusNotFound, 404, "Upload session not found.", map[string]interface{}{
+				"session_id": sessionID,
+			}, "Ensure that the session ID is correct or restart the upload.")
+			return
+		}
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Internal server error.", err.Error(), "Please try again later.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fileSize, _ := status["file_size"].(int64)
+	uploadedSize, _ := status["uploaded_size"].(int64)
+	fileName, _ := status["file_name"].(string)
+	sessionStatus, _ := status["status"].(string)
+	remaining := int64(-1)
+	if fileSize > 0 {
+		remaining = max(fileSize-uploadedSize, 0)
+	}
+	id := 0
+	writeEvent(w, &id, services.ProgressEvent{
+		Type:          services.ProgressSnapshot,
+		SessionID:     sessionID,
+		UploadedSize:  uploadedSize,
+		FileSize:      fileSize,
+		RemainingSize: remaining,
+		Status:        sessionStatus,
+		FileName:      fileName,
+	})
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			writeEvent(w, &id, event)
+			flusher.Flush()
+			if event.Final() {
+				return
+			}
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeEvent записывает событие в формате text/event-stream с порядковым id.
+func writeEvent(w http.ResponseWriter, id *int, event services.ProgressEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	*id++
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", *id, event.Type, data)
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"BASProject/internal/services"
+
+	"github.com/gorilla/mux"
+)
+
+// FileMetaHeaderPrefix — префикс заголовков с пользовательскими метаданными файла при скачивании.
+const FileMetaHeaderPrefix = "X-Meta-"
+
+type FilesHandler struct {
+	FileService services.IFileService
+}
+
+func NewFilesHandler(fileService services.IFileService) *FilesHandler {
+	return &FilesHandler{
+		FileService: fileService,
+	}
+}
+
+// ListFiles возвращает список собранных файлов в хранилище; ?namespace= оставляет файлы одного пространства имён.
+func (h *FilesHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	files, err := h.FileService.ListFiles()
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to list files.", err.Error(), "")
+		return
+	}
+	if namespace := r.URL.Query().Get("namespace"); namespace != "" {
+		filtered := []services.StoredFile{}
+		for _, file := range files {
+			if file.Namespace == namespace {
+				filtered = append(filtered, file)
+			}
+		}
+		files = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"files":  files,
+	})
+}
+
+// DownloadFile отдаёт собранный файл; поддерживаются Range-запросы. ?version=N отдаёт версию N.
+func (h *FilesHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Missing file name in URL.", nil, "")
+		return
+	}
+	metaKey := name
+	var file services.FileReader
+	var err error
+	if value := r.URL.Query().Get("version"); value != "" {
+		version, parseErr := strconv.Atoi(value)
+		if parseErr != nil || version <= 0 {
+			sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid file version.", value, "Pass version as a positive number from GET /versions/{name}.")
+			return
+		}
+		if !h.isCurrentVersion(name, version) {
+			metaKey = services.VersionMetaKey(name, version)
+		}
+		file, err = h.FileService.OpenVersion(name, version)
+		w.Header().Set("X-File-Version", value)
+	} else {
+		file, err = h.FileService.OpenFile(name)
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrFileNotFound) || errors.Is(err, services.ErrVersionNotFound) {
+			sendErrorResponse(w, http.StatusNotFound, 404, "File not found.", map[string]interface{}{
+				"name": name,
+			}, "Use GET /files to list available files and GET /versions/{name} to list versions.")
+			return
+		}
+		if errors.Is(err, services.ErrFileNotAvailable) {
+			details := map[string]interface{}{"name": name}
+			if meta, _ := h.FileService.GetFileMeta(metaKey); meta != nil {
+				details["status"] = meta.Status
+				details["processing"] = meta.Processing
+			}
+			sendErrorResponse(w, http.StatusConflict, 409, "File is not available.", details, "The file is being processed or was rejected by the processing pipeline.")
+			return
+		}
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to open file.", err.Error(), "")
+		return
+	}
+	defer file.Close()
+
+	// Тип содержимого и метаданные, переданные при загрузке, отдаются заголовками
+	meta, err := h.FileService.GetFileMeta(metaKey)
+	if err != nil {
+		log.Printf("Failed to read metadata of %s: %v", metaKey, err)
+	}
+	if meta != nil {
+		if meta.ContentType != "" {
+			w.Header().Set("Content-Type", meta.ContentType)
+		}
+		for key, value := range meta.Metadata {
+			w.Header().Set(FileMetaHeaderPrefix+key, value)
+		}
+	}
+
+	// Содержимое отдаётся расшифрованным; Range-запросы работают и для зашифрованных файлов
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+path.Base(name)+"\"")
+	http.ServeContent(w, r, path.Base(name), file.ModTime(), file)
+}
+
+// isCurrentVersion сообщает, что version — текущая версия файла name.
+func (h *FilesHandler) isCurrentVersion(name string, version int) bool {
+	versions, err := h.FileService.ListVersions(name)
+	if err != nil {
+		return false
+	}
+	for _, v := range versions {
+		if v.Version == version {
+			return v.Current
+		}
+	}
+	return false
+}
+
+// ListVersions возвращает версии файла, начиная с новейшей.
+func (h *FilesHandler) ListVersions(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	versions, err := h.FileService.ListVersions(name)
+	if err != nil {
+		h.versionError(w, name, 0, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "success",
+		"name":     name,
+		"versions": versions,
+	})
+}
+
+// PromoteVersion делает прежнюю версию файла текущей.
+func (h *FilesHandler) PromoteVersion(w http.ResponseWriter, r *http.Request) {
+	name, version, ok := versionVars(w, r)
+	if !ok {
+		return
+	}
+	if err := h.FileService.PromoteVersion(name, version); err != nil {
+		h.versionError(w, name, version, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"name":    name,
+		"version": version,
+		"message": "Version promoted to current.",
+	})
+}
+
+// DeleteVersion удаляет версию файла; вместо удалённой текущей версии текущей становится новейшая прежняя.
+func (h *FilesHandler) DeleteVersion(w http.ResponseWriter, r *http.Request) {
+	name, version, ok := versionVars(w, r)
+	if !ok {
+		return
+	}
+	if err := h.FileService.DeleteVersion(name, version); err != nil {
+		h.versionError(w, name, version, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"name":    name,
+		"version": version,
+		"message": "Version deleted.",
+	})
+}
+
+// versionVars читает имя файла и номер версии из URL.
+func versionVars(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	vars := mux.Vars(r)
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil || version <= 0 {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid file version.", vars["version"], "Pass version as a positive number from GET /versions/{name}.")
+		return "", 0, false
+	}
+	return vars["name"], version, true
+}
+
+func (h *FilesHandler) versionError(w http.ResponseWriter, name string, version int, err error) {
+	details := map[string]interface{}{"name": name}
+	if version > 0 {
+		details["version"] = version
+	}
+	switch {
+	case errors.Is(err, services.ErrFileNotFound):
+		sendErrorResponse(w, http.StatusNotFound, 404, "File not found.", details, "Use GET /files to list available files.")
+	case errors.Is(err, services.ErrVersionNotFound):
+		sendErrorResponse(w, http.StatusNotFound, 404, "File version not found.", details, "Use GET /versions/{name} to list versions.")
+	default:
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to manage file versions.", err.Error(), "")
+	}
+}
+
+// Thumbnail отдаёт уменьшенную копию изображения; ?size= выбирает наименьшую копию не меньше заданной.
+func (h *FilesHandler) Thumbnail(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if name == "" {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Missing file name in URL.", nil, "")
+		return
+	}
+	size := 0
+	if value := r.URL.Query().Get("size"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid thumbnail size.", value, "Pass size as a positive number of pixels.")
+			return
+		}
+		size = parsed
+	}
+
+	thumb, info, err := h.FileService.OpenThumbnail(name, size)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrThumbnailNotFound), errors.Is(err, services.ErrFileNotFound):
+			sendErrorResponse(w, http.StatusNotFound, 404, "Thumbnail not found.", map[string]interface{}{
+				"name": name,
+			}, "Thumbnails are generated for JPEG, PNG and GIF images by the thumbnail processor.")
+		case errors.Is(err, services.ErrFileNotAvailable):
+			sendErrorResponse(w, http.StatusConflict, 409, "File is not available.", map[string]interface{}{
+				"name": name,
+			}, "The file is being processed or was rejected by the processing pipeline.")
+		default:
+			sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to open thumbnail.", err.Error(), "")
+		}
+		return
+	}
+	defer thumb.Close()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("X-Thumbnail-Size", strconv.Itoa(info.Size))
+	w.Header().Set("X-Thumbnail-Dimensions", fmt.Sprintf("%dx%d", info.Width, info.Height))
+	http.ServeContent(w, r, "", thumb.ModTime(), thumb)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"BASProject/internal/services"
+)
+
+type KeysHandler struct {
+	KeyRotation *services.KeyRotationService
+}
+
+func NewKeysHandler(keyRotation *services.KeyRotationService) *KeysHandler {
+	return &KeysHandler{
+		KeyRotation: keyRotation,
+	}
+}
+
+// StartRewrap запускает перешифровку ключей данных всех файлов активной версией мастер-ключа.
+func (h *KeysHandler) StartRewrap(w http.ResponseWriter, r *http.Request) {
+	progress, err := h.KeyRotation.StartRewrap()
+	switch {
+	case errors.Is(err, services.ErrEncryptionDisabled):
+		sendErrorResponse(w, http.StatusConflict, 409, "Encryption at rest is not enabled.", nil, "Enable encryption in the server configuration first.")
+		return
+	case errors.Is(err, services.ErrRewrapRunning):
+		sendErrorResponse(w, http.StatusConflict, 409, "Rewrap is already running.", progress, "Poll GET /admin/keys/rewrap for progress.")
+		return
+	case err != nil:
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to start rewrap.", err.Error(), "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "success",
+		"message":  "Rewrap started.",
+		"progress": progress,
+	})
+}
+
+// RewrapStatus возвращает ход последней перешифровки.
+func (h *KeysHandler) RewrapStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "success",
+		"progress": h.KeyRotation.Progress(),
+	})
+}
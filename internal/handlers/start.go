@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 
@@ -10,6 +12,7 @@ import (
 
 type StartHandler struct {
 	SessionService services.ISessionService
+	Webhooks       *services.WebhookService
 }
 
 func NewStartHandler(sessionService services.ISessionService) *StartHandler {
@@ -20,9 +23,18 @@ func NewStartHandler(sessionService services.ISessionService) *StartHandler {
 
 func (h *StartHandler) StartSession(w http.ResponseWriter, r *http.Request) {
 	var requestData struct {
-		FileName string `json:"file_name"`
-		FileSize int64  `json:"file_size"`
-		FileHash string `json:"file_hash"`
+		FileName           string            `json:"file_name"`
+		FileSize           int64             `json:"file_size"`
+		FileHash           string            `json:"file_hash"`
+		Deferred           bool              `json:"deferred"`
+		PreferredChunkSize int64             `json:"preferred_chunk_size"`
+		ChunkMode          string            `json:"chunk_mode"`
+		Owner              string            `json:"owner"`
+		ContentType        string            `json:"content_type"`
+		Metadata           map[string]string `json:"metadata"`
+		Extract            bool              `json:"extract"`
+		ExtractDir         string            `json:"extract_dir"`
+		Namespace          string            `json:"namespace"`
 	}
 
 	// Декодируем данные из тела запроса
@@ -33,21 +45,70 @@ func (h *StartHandler) StartSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Проверяем корректность полученных данных
-	if requestData.FileName == "" || requestData.FileSize <= 0 || requestData.FileHash == "" {
+	// Проверяем корректность полученных данных.
+	// В отложенном режиме хеш и размер передаются при завершении загрузки.
+	invalid := requestData.FileName == "" || requestData.FileSize <= 0 || requestData.FileHash == ""
+	if requestData.Deferred {
+		invalid = requestData.FileName == "" || requestData.FileSize < 0
+	}
+	invalid = invalid || requestData.PreferredChunkSize < 0
+	invalid = invalid || (requestData.ChunkMode != "" && requestData.ChunkMode != services.ChunkModeFixed && requestData.ChunkMode != services.ChunkModeOffset)
+	if invalid {
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":     "error",
 			"error_code": 400,
 			"message":    "Invalid request. Missing or incorrect parameters.",
-			"details":    "File name, size, and hash are required.",
+			"details":    "File name, size, and hash are required; chunk_mode must be \"fixed\" or \"offset\".",
 		})
 		log.Println("Ошибка: недостающие или некорректные параметры")
 		return
 	}
 
+	if err := services.ValidateFileMeta(requestData.ContentType, requestData.Metadata); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid content type or metadata.", err.Error(),
+			fmt.Sprintf("Use up to %d metadata keys of letters, digits, '-', '_' or '.', values up to %d bytes.", services.MaxMetadataKeys, services.MaxMetadataValueLength))
+		return
+	}
+
+	if err := services.ValidateExtraction(requestData.FileName, requestData.Extract, requestData.ExtractDir); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid extraction request.", err.Error(),
+			"Only .zip, .tar, .tar.gz and .tgz uploads can be extracted; extract_dir must be a relative path.")
+		return
+	}
+
 	// Создаем сессию, используя полученные данные
-	chunkSize, err := h.SessionService.CreateSession(requestData.FileName, requestData.FileSize, requestData.FileHash)
+	session, err := h.SessionService.CreateSession(services.SessionParams{
+		FileName:           requestData.FileName,
+		FileSize:           requestData.FileSize,
+		FileHash:           requestData.FileHash,
+		Deferred:           requestData.Deferred,
+		PreferredChunkSize: requestData.PreferredChunkSize,
+		ChunkMode:          requestData.ChunkMode,
+		Owner:              requestData.Owner,
+		ContentType:        requestData.ContentType,
+		Metadata:           requestData.Metadata,
+		Extract:            requestData.Extract,
+		ExtractDir:         requestData.ExtractDir,
+		Namespace:          requestData.Namespace,
+	})
+	if errors.Is(err, services.ErrInvalidFileName) || errors.Is(err, services.ErrUnknownNamespace) {
+		sendErrorResponse(w, http.StatusBadRequest, 400, "Invalid file name or namespace.", err.Error(),
+			"Send a relative name without '..', control characters or reserved names, e.g. docs/report.pdf.")
+		return
+	}
+	if errors.Is(err, services.ErrFileTypeRejected) {
+		sendErrorResponse(w, http.StatusUnsupportedMediaType, 415, "File type is not allowed.", err.Error(), "Check the file type policy of the server.")
+		return
+	}
+	if errors.Is(err, services.ErrInsufficientStorage) {
+		sendErrorResponse(w, http.StatusInsufficientStorage, 507, "Insufficient storage.", err.Error(), "Free up space on the server or retry later.")
+		return
+	}
+	if errors.Is(err, services.ErrFileExists) {
+		sendErrorResponse(w, http.StatusConflict, 409, "File already exists.", err.Error(), "The namespace does not allow replacing files; upload under another name.")
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
@@ -60,9 +121,79 @@ func (h *StartHandler) StartSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Ответ с размером чанка
+	// Файл с таким хешем уже хранится — загрузка не нужна
+	if session.Status == "already_present" {
+		fileService := h.SessionService.GetFileService()
+		completed := withFileMeta(map[string]interface{}{
+			"session_id": session.SessionID,
+			"file_name":  session.StoredName,
+			"version":    session.Version,
+			"path":       storedPath(fileService, session.StoredName),
+			"file_size":  requestData.FileSize,
+			"file_hash":  requestData.FileHash,
+			"instant":    true,
+		}, requestData.ContentType, requestData.Metadata)
+		responseData := map[string]interface{}{
+			"session_id": session.SessionID,
+			"status":     session.Status,
+			"file_name":  session.StoredName,
+			"version":    session.Version,
+			"message":    "File with the same content is already stored; upload skipped.",
+		}
+		// Распаковка не зависит от того, пришлось ли загружать архив
+		if requestData.Extract {
+			extraction := extractArchive(fileService, session.StoredName, storedPath(fileService, session.StoredName), session.ExtractDir, services.FileMeta{
+				SessionID: session.SessionID,
+				Owner:     requestData.Owner,
+			})
+			completed["extraction"], responseData["extraction"] = extraction, extraction
+		}
+		h.Webhooks.Emit(services.EventUploadCompleted, completed)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(responseData); err != nil {
+			log.Printf("Ошибка при отправке ответа: %v", err)
+		}
+		return
+	}
+
+	// Ключ хранилища, в который сервер превратил имя клиента
+	if session.FileName == "" {
+		session.FileName = requestData.FileName
+	}
+
+	if session.Status == "created" {
+		h.Webhooks.Emit(services.EventSessionCreated, withFileMeta(map[string]interface{}{
+			"session_id": session.SessionID,
+			"file_name":  session.FileName,
+			"file_size":  requestData.FileSize,
+			"file_hash":  requestData.FileHash,
+			"chunk_size": session.ChunkSize,
+			"chunk_mode": session.ChunkMode,
+			"deferred":   session.Deferred,
+		}, requestData.ContentType, requestData.Metadata))
+	}
+
+	// Ответ с идентификатором сессии и согласованным размером чанка
 	responseData := map[string]interface{}{
-		"chunk_size": chunkSize,
+		"session_id": session.SessionID,
+		"file_name":  session.FileName,
+		"chunk_size": session.ChunkSize,
+		"deferred":   session.Deferred,
+	}
+	if session.Status != "" {
+		responseData["status"] = session.Status
+	}
+	if requestData.PreferredChunkSize > 0 {
+		responseData["preferred_chunk_size"] = requestData.PreferredChunkSize
+	}
+	if session.ChunkMode != "" {
+		responseData["chunk_mode"] = session.ChunkMode
+	}
+	if session.ChunkMode == services.ChunkModeOffset {
+		// Клиент может менять размер чанков в этих пределах
+		responseData["min_chunk_size"] = session.MinChunkSize
+		responseData["max_chunk_size"] = session.MaxChunkSize
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -71,3 +202,14 @@ func (h *StartHandler) StartSession(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Ошибка при отправке ответа: %v", err)
 	}
 }
+
+// withFileMeta добавляет в данные уведомления тип содержимого и метаданные файла, если они заданы.
+func withFileMeta(data map[string]interface{}, contentType string, metadata map[string]string) map[string]interface{} {
+	if contentType != "" {
+		data["content_type"] = contentType
+	}
+	if len(metadata) > 0 {
+		data["metadata"] = metadata
+	}
+	return data
+}
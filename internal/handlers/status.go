@@ -44,13 +44,45 @@ func (h *StatusHandler) GetUploadStatus(w http.ResponseWriter, r *http.Request)
 	response := map[string]interface{}{
 		"status":          "success",
 		"session_id":      sessionID,
+		"file_name":       status["file_name"],
+		"file_size":       status["file_size"],
+		"uploaded_size":   status["uploaded_size"],
+		"session_status":  status["status"],
 		"uploaded_chunks": status["uploaded_chunks"],
 		"pending_chunks":  status["pending_chunks"],
 		"total_chunks":    status["total_chunks"],
 		"message":         status["message"],
 	}
+	if ranges, ok := status["uploaded_ranges"]; ok {
+		// Сессия в режиме offset: прогресс описывается диапазонами байт
+		response["chunk_mode"] = status["chunk_mode"]
+		response["uploaded_ranges"] = ranges
+		response["missing_ranges"] = status["missing_ranges"]
+	}
+	// Состояние собранного файла после конвейера обработки и распаковки архива
+	for _, key := range []string{"stored_name", "file_status", "processing", "extract", "extraction"} {
+		if value, ok := status[key]; ok {
+			response[key] = value
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// ListSessions возвращает все известные сессии загрузки.
+func (h *StatusHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := h.SessionService.ListSessions()
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Internal server error.", err.Error(), "Please try again later.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "success",
+		"sessions": sessions,
+	})
+}
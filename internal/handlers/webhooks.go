@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"BASProject/internal/services"
+)
+
+type WebhooksHandler struct {
+	Webhooks *services.WebhookService
+}
+
+func NewWebhooksHandler(webhooks *services.WebhookService) *WebhooksHandler {
+	return &WebhooksHandler{
+		Webhooks: webhooks,
+	}
+}
+
+// ListDeadLetters возвращает уведомления, которые не удалось доставить.
+func (h *WebhooksHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	letters, err := h.Webhooks.DeadLetters()
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to list dead letters.", err.Error(), "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":       "success",
+		"dead_letters": letters,
+		"count":        len(letters),
+	})
+}
+
+// RedeliverDeadLetters снова ставит недоставленные уведомления в очередь отправки.
+func (h *WebhooksHandler) RedeliverDeadLetters(w http.ResponseWriter, r *http.Request) {
+	queued, err := h.Webhooks.RedeliverDeadLetters()
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, 500, "Failed to redeliver dead letters.", err.Error(), "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"queued":  queued,
+		"message": "Dead letters queued for redelivery.",
+	})
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSessionPageSize = 50
+	maxSessionPageSize     = 500
+)
+
+// SessionFilter — условия выборки сессий административного API. Нулевые значения не ограничивают выборку.
+// Возраст считается от created_at; сессии, созданные до появления этого поля, под фильтр по возрасту не попадают.
+type SessionFilter struct {
+	Status  string
+	Owner   string
+	MinAge  time.Duration
+	MaxAge  time.Duration
+	MinSize int64
+	MaxSize int64
+	Offset  int
+	Limit   int
+}
+
+// SessionPage — страница сессий, отсортированных от новых к старым.
+type SessionPage struct {
+	Sessions []map[string]interface{} `json:"sessions"`
+	Total    int                      `json:"total"`
+	Offset   int                      `json:"offset"`
+	Limit    int                      `json:"limit"`
+}
+
+// SessionPart — файл чанка сессии на диске.
+type SessionPart struct {
+	Name    string    `json:"name"`
+	ChunkID int       `json:"chunk_id,omitempty"`
+	Offset  *int64    `json:"offset,omitempty"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// setSessionMeta дополняет новую сессию владельцем, временем создания, типом содержимого и метаданными.
+func setSessionMeta(sessionData map[string]interface{}, params SessionParams) {
+	now := time.Now().Unix()
+	sessionData["created_at"] = now
+	sessionData["updated_at"] = now
+	if params.Owner != "" {
+		sessionData["owner"] = params.Owner
+	}
+	if params.Namespace != "" {
+		sessionData["namespace"] = params.Namespace
+	}
+	setSessionFileMeta(sessionData, params)
+}
+
+// sessionTime переводит метку времени сессии в time.Time; нулевое время — метки нет.
+func sessionTime(value interface{}) time.Time {
+	seconds, err := extractInt64(value)
+	if err != nil || seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0).UTC()
+}
+
+// sessionSummary — краткие сведения о сессии для списков.
+func sessionSummary(id string, sessionData map[string]interface{}) map[string]interface{} {
+	summary := map[string]interface{}{
+		"session_id":    id,
+		"file_name":     sessionData["file_name"],
+		"file_size":     sessionData["file_size"],
+		"uploaded_size": sessionData["uploaded_size"],
+		"chunk_size":    sessionData["chunk_size"],
+		"status":        sessionData["status"],
+		"deferred":      isDeferred(sessionData),
+	}
+	if owner, ok := sessionData["owner"]; ok {
+		summary["owner"] = owner
+	}
+	if created := sessionTime(sessionData["created_at"]); !created.IsZero() {
+		summary["created_at"] = created
+	}
+	if updated := sessionTime(sessionData["updated_at"]); !updated.IsZero() {
+		summary["updated_at"] = updated
+	}
+	addFileMeta(summary, sessionData)
+	return summary
+}
+
+// matches проверяет сессию на соответствие фильтру.
+func (f SessionFilter) matches(sessionData map[string]interface{}, now time.Time) bool {
+	if f.Status != "" && sessionData["status"] != f.Status {
+		return false
+	}
+	if f.Owner != "" && sessionData["owner"] != f.Owner {
+		return false
+	}
+	if f.MinSize > 0 || f.MaxSize > 0 {
+		size, _ := extractInt64(sessionData["file_size"])
+		if size < f.MinSize || (f.MaxSize > 0 && size > f.MaxSize) {
+			return false
+		}
+	}
+	if f.MinAge > 0 || f.MaxAge > 0 {
+		created := sessionTime(sessionData["created_at"])
+		if created.IsZero() {
+			return false
+		}
+		age := now.Sub(created)
+		if age < f.MinAge || (f.MaxAge > 0 && age > f.MaxAge) {
+			return false
+		}
+	}
+	return true
+}
+
+// QuerySessions возвращает страницу сессий из индекса sessions:index, подходящих под фильтр.
+func (s *SessionService) QuerySessions(filter SessionFilter) (*SessionPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultSessionPageSize
+	}
+	filter.Limit = min(filter.Limit, maxSessionPageSize)
+	filter.Offset = max(filter.Offset, 0)
+
+	ids, err := s.Storage.ListSessionIDs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	type entry struct {
+		id      string
+		created int64
+		data    map[string]interface{}
+	}
+	now := time.Now()
+	matched := []entry{}
+	for _, id := range ids {
+		exists, err := s.Storage.SessionExists(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check session existence: %w", err)
+		}
+		if exists == 0 {
+			// Сессия удалена или истекла, а индекс ещё не обновлён
+			continue
+		}
+		sessionData, err := s.Storage.GetSessionData(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve session %s: %w", id, err)
+		}
+		if !filter.matches(sessionData, now) {
+			continue
+		}
+		created, _ := extractInt64(sessionData["created_at"])
+		matched = append(matched, entry{id: id, created: created, data: sessionData})
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].created != matched[j].created {
+			return matched[i].created > matched[j].created
+		}
+		return matched[i].id < matched[j].id
+	})
+
+	page := &SessionPage{Sessions: []map[string]interface{}{}, Total: len(matched), Offset: filter.Offset, Limit: filter.Limit}
+	for i := filter.Offset; i < len(matched) && i < filter.Offset+filter.Limit; i++ {
+		page.Sessions = append(page.Sessions, sessionSummary(matched[i].id, matched[i].data))
+	}
+	return page, nil
+}
+
+// SessionDetails возвращает полные сведения о сессии: поля из Redis, множество чанков
+// или диапазонов, файлы чанков на диске и расхождения между ними.
+func (s *SessionService) SessionDetails(sessionID string) (map[string]interface{}, error) {
+	exists, err := s.Storage.SessionExists(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check session existence: %w", err)
+	}
+	if exists == 0 {
+		return nil, ErrSessionNotFound
+	}
+	sessionData, err := s.Storage.GetSessionData(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve session data: %w", err)
+	}
+
+	details := sessionSummary(sessionID, sessionData)
+	details["chunk_mode"] = chunkMode(sessionData)
+	details["file_hash"] = sessionFileHash(sessionID, sessionData)
+
+	parts, err := s.FileService.sessionParts(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	details["parts"] = parts
+
+	onDisk := map[string]bool{}
+	for _, part := range parts {
+		onDisk[part.Name] = true
+	}
+	tracked := map[string]bool{}
+	missing := []string{}
+	if chunkMode(sessionData) == ChunkModeOffset {
+		ranges, err := s.Storage.GetUploadedRanges(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get uploaded ranges: %w", err)
+		}
+		details["uploaded_ranges"] = ranges
+		for _, rng := range ranges {
+			name := filepath.Base(offsetPartPath(s.FileService.LocalPath, sessionID, rng.Offset))
+			tracked[name] = true
+			if !onDisk[name] {
+				missing = append(missing, name)
+			}
+		}
+	} else if isPreallocated(sessionData) {
+		// Чанки записываются в выделенный файл и отмечаются в битовой карте, частей .part нет
+		bitmap, err := s.Storage.GetChunkBitmap(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chunk bitmap: %w", err)
+		}
+		details["uploaded_chunks"] = bitmapChunks(bitmap)
+		path := s.FileService.preallocatedPath(sessionID)
+		if info, err := os.Stat(path); err == nil {
+			details["preallocated_file"] = SessionPart{Name: filepath.Base(path), Size: info.Size(), ModTime: info.ModTime().UTC()}
+		} else {
+			missing = append(missing, filepath.Base(path))
+		}
+	} else {
+		chunks, err := s.Storage.GetChunks(sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve chunks: %w", err)
+		}
+		sort.Ints(chunks)
+		details["uploaded_chunks"] = chunks
+		for _, chunkID := range chunks {
+			name := fmt.Sprintf("%s_%d.part", sessionID, chunkID)
+			tracked[name] = true
+			if !onDisk[name] {
+				missing = append(missing, name)
+			}
+		}
+	}
+	// Части на диске без записи в Redis и записи без файла указывают на сбой при сохранении
+	untracked := []string{}
+	for _, part := range parts {
+		if !tracked[part.Name] {
+			untracked = append(untracked, part.Name)
+		}
+	}
+	details["missing_parts"] = missing
+	details["untracked_parts"] = untracked
+	return details, nil
+}
+
+// sessionParts перечисляет файлы чанков сессии в LocalPath.
+func (f *FileService) sessionParts(sessionID string) ([]SessionPart, error) {
+	files, err := filepath.Glob(filepath.Join(f.LocalPath, fmt.Sprintf("%s_*.part", sessionID)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunk files: %w", err)
+	}
+	parts := []SessionPart{}
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		part := SessionPart{Name: filepath.Base(path), Size: info.Size(), ModTime: info.ModTime().UTC()}
+		if size, err := f.storedSize(path); err == nil {
+			part.Size = size
+		}
+		suffix := strings.TrimSuffix(strings.TrimPrefix(part.Name, sessionID+"_"), ".part")
+		if strings.HasPrefix(suffix, "o") {
+			if offset, err := strconv.ParseInt(suffix[1:], 10, 64); err == nil {
+				part.Offset = &offset
+			}
+		} else if chunkID, err := strconv.Atoi(suffix); err == nil {
+			part.ChunkID = chunkID
+		}
+		parts = append(parts, part)
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		if parts[i].Offset != nil && parts[j].Offset != nil {
+			return *parts[i].Offset < *parts[j].Offset
+		}
+		if parts[i].ChunkID != parts[j].ChunkID {
+			return parts[i].ChunkID < parts[j].ChunkID
+		}
+		return parts[i].Name < parts[j].Name
+	})
+	return parts, nil
+}
@@ -0,0 +1,696 @@
+package services
+
+import (
+	"BASProject/internal/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Пакеты загрузок: файлы пакета загружаются отдельными сессиями, а в хранилище переносятся
+// вместе при фиксации пакета — становятся доступны либо все, либо ни один.
+const (
+	BatchStatusOpen       = "open"
+	BatchStatusCommitting = "committing"
+	BatchStatusProcessing = "processing"
+	BatchStatusCommitted  = "committed"
+	BatchStatusAborted    = "aborted"
+	BatchStatusFailed     = "failed"
+)
+
+// BatchFileRolledBack — состояние файла, не попавшего в хранилище вместе с пакетом
+// из-за неудачи другого файла.
+const BatchFileRolledBack = "rolled_back"
+
+// MaxBatchFiles ограничивает число файлов в одном пакете.
+const MaxBatchFiles = 1000
+
+// batchLockTTL — на сколько секунд фиксация или отмена захватывает пакет.
+const batchLockTTL = 600
+
+var (
+	ErrBatchNotFound   = errors.New("batch not found")
+	ErrBatchInvalid    = errors.New("invalid batch")
+	ErrBatchIncomplete = errors.New("batch upload incomplete")
+	ErrBatchBusy       = errors.New("batch is being committed")
+	ErrBatchClosed     = errors.New("batch is closed")
+)
+
+// BatchFile — файл пакета. Instant — содержимое уже хранится, файл создаётся ссылкой
+// при фиксации без загрузки. StoredName, Version и Status заполняются при фиксации.
+type BatchFile struct {
+	SessionID    string            `json:"session_id,omitempty"`
+	FileName     string            `json:"file_name"`
+	FileSize     int64             `json:"file_size"`
+	FileHash     string            `json:"file_hash"`
+	ContentType  string            `json:"content_type,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	ChunkSize    int64             `json:"chunk_size,omitempty"`
+	ChunkMode    string            `json:"chunk_mode,omitempty"`
+	Instant      bool              `json:"instant,omitempty"`
+	UploadedSize int64             `json:"uploaded_size"`
+	Completed    bool              `json:"completed"`
+	StoredName   string            `json:"stored_name,omitempty"`
+	Version      int               `json:"version,omitempty"`
+	Status       string            `json:"status,omitempty"`
+}
+
+// Batch — пакет загрузок и его состояние.
+type Batch struct {
+	ID        string      `json:"batch_id"`
+	Status    string      `json:"status"`
+	Owner     string      `json:"owner,omitempty"`
+	Namespace string      `json:"namespace,omitempty"`
+	Files     []BatchFile `json:"files"`
+	Error     string      `json:"error,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// BatchParams — манифест пакета. Владелец и пространство имён общие для всех файлов.
+type BatchParams struct {
+	Owner     string
+	Namespace string
+	Files     []SessionParams
+}
+
+type IBatchService interface {
+	CreateBatch(params BatchParams) (*Batch, error)
+	GetBatch(batchID string) (*Batch, error)
+	CommitBatch(batchID string) (*Batch, error)
+	AbortBatch(batchID string) (*Batch, error)
+}
+
+type BatchService struct {
+	Sessions *SessionService
+	// Pipeline обрабатывает файлы пакета до того, как они станут доступны; nil — без обработки.
+	Pipeline *Pipeline
+	Webhooks *WebhookService
+
+	wg sync.WaitGroup
+}
+
+func NewBatchService(sessions *SessionService) *BatchService {
+	return &BatchService{
+		Sessions: sessions,
+	}
+}
+
+// CreateBatch создаёт сессии всех файлов манифеста. Если какой-то файл не принят,
+// уже созданные сессии удаляются и пакет не создаётся.
+func (b *BatchService) CreateBatch(params BatchParams) (*Batch, error) {
+	if len(params.Files) == 0 || len(params.Files) > MaxBatchFiles {
+		return nil, fmt.Errorf("%w: a batch holds 1 to %d files", ErrBatchInvalid, MaxBatchFiles)
+	}
+	now := time.Now().UTC()
+	batch := &Batch{
+		ID:        utils.GenerateBatchID(),
+		Status:    BatchStatusOpen,
+		Owner:     params.Owner,
+		Namespace: params.Namespace,
+		Files:     []BatchFile{},
+		CreatedAt: now,
+	}
+	names := map[string]int{}
+	for i, file := range params.Files {
+		file.Owner, file.Namespace, file.Batch = params.Owner, params.Namespace, batch.ID
+		info, err := b.Sessions.CreateSession(file)
+		if err != nil {
+			b.dropSessions(batch)
+			return nil, fmt.Errorf("file %d (%s): %w", i+1, file.FileName, err)
+		}
+		batch.Files = append(batch.Files, BatchFile{
+			SessionID:   info.SessionID,
+			FileName:    info.FileName,
+			FileSize:    file.FileSize,
+			FileHash:    file.FileHash,
+			ContentType: file.ContentType,
+			Metadata:    file.Metadata,
+			ChunkSize:   info.ChunkSize,
+			ChunkMode:   info.ChunkMode,
+			Instant:     info.Status == "already_present",
+			Completed:   info.Status == "already_present",
+		})
+		if previous, ok := names[info.FileName]; ok {
+			b.dropSessions(batch)
+			return nil, fmt.Errorf("%w: files %d and %d are both stored as %s", ErrBatchInvalid, previous, i+1, info.FileName)
+		}
+		names[info.FileName] = i + 1
+	}
+	if err := b.save(batch); err != nil {
+		b.dropSessions(batch)
+		return nil, err
+	}
+	log.Printf("Batch %s created with %d files", batch.ID, len(batch.Files))
+	return batch, nil
+}
+
+// GetBatch возвращает пакет; для открытого пакета — с текущим ходом загрузки файлов.
+func (b *BatchService) GetBatch(batchID string) (*Batch, error) {
+	batch, err := b.load(batchID)
+	if err != nil {
+		return nil, err
+	}
+	if batch.Status != BatchStatusOpen {
+		return batch, nil
+	}
+	for i := range batch.Files {
+		file := &batch.Files[i]
+		if file.Instant {
+			continue
+		}
+		status, err := b.Sessions.GetUploadStatus(file.SessionID)
+		if err != nil {
+			log.Printf("Failed to get status of session %s in batch %s: %v", file.SessionID, batchID, err)
+			continue
+		}
+		file.UploadedSize, _ = status["uploaded_size"].(int64)
+		file.Completed, _ = status["completed"].(bool)
+	}
+	return batch, nil
+}
+
+// CommitBatch проверяет, что все файлы пакета загружены, собирает их и переносит
+// в хранилище одной операцией. С конвейером обработки файлы становятся доступны,
+// когда все они пройдут обработку. Повторная фиксация зафиксированного пакета ничего не делает.
+func (b *BatchService) CommitBatch(batchID string) (*Batch, error) {
+	batch, unlock, err := b.lock(batchID)
+	if err != nil {
+		return batch, err
+	}
+	defer unlock()
+
+	// committing под свободной блокировкой — прерванная фиксация; её можно повторить
+	switch batch.Status {
+	case BatchStatusOpen, BatchStatusCommitting:
+	case BatchStatusCommitted:
+		return batch, nil
+	case BatchStatusProcessing:
+		return batch, ErrBatchBusy
+	default:
+		return batch, fmt.Errorf("%w: batch is %s", ErrBatchClosed, batch.Status)
+	}
+
+	// Все файлы должны быть загружены полностью
+	incomplete := []string{}
+	for i := range batch.Files {
+		complete, err := b.uploadComplete(&batch.Files[i])
+		if err != nil {
+			return batch, err
+		}
+		if !complete {
+			incomplete = append(incomplete, batch.Files[i].FileName)
+		}
+	}
+	if len(incomplete) > 0 {
+		return batch, fmt.Errorf("%w: %s", ErrBatchIncomplete, strings.Join(incomplete, ", "))
+	}
+
+	batch.Status = BatchStatusCommitting
+	if err := b.save(batch); err != nil {
+		return batch, err
+	}
+
+	fileService := b.Sessions.FileService
+	entries := make([]*BatchEntry, 0, len(batch.Files))
+	for i := range batch.Files {
+		file := &batch.Files[i]
+		path, err := b.stage(file)
+		if err != nil {
+			b.discard(batch, entries, -1)
+			if errors.Is(err, ErrInsufficientStorage) {
+				// Чанки сохраняются: после освобождения места пакет можно зафиксировать снова
+				batch.Status = BatchStatusOpen
+				b.save(batch)
+				return batch, err
+			}
+			return b.fail(batch, fmt.Errorf("%s: %w", file.FileName, err))
+		}
+		meta := FileMeta{ContentType: file.ContentType, Metadata: file.Metadata, SessionID: file.SessionID, FileHash: file.FileHash, Owner: batch.Owner}
+		if file.Instant {
+			meta.SessionID = file.FileHash
+		}
+		entries = append(entries, &BatchEntry{Name: file.FileName, Path: path, Meta: meta})
+	}
+
+	// С конвейером обработки файлы остаются во временных путях, пока все не пройдут обработку
+	if b.Pipeline.Enabled() {
+		batch.Status = BatchStatusProcessing
+		if err := b.save(batch); err != nil {
+			log.Printf("Failed to save batch %s: %v", batch.ID, err)
+		}
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			b.process(batch, entries)
+		}()
+		return batch, nil
+	}
+	if err := fileService.CommitBatch(batch.ID, entries); err != nil {
+		b.discard(batch, entries, -1)
+		return b.fail(batch, err)
+	}
+	b.stored(batch, entries)
+	fileService.ReleaseBatch(entries)
+	b.publish(batch, entries)
+	return batch, nil
+}
+
+// discard удаляет временные файлы пакета, кроме файла с номером skip.
+func (b *BatchService) discard(batch *Batch, entries []*BatchEntry, skip int) {
+	for i, entry := range entries {
+		switch {
+		case i == skip:
+		case batch.Files[i].Instant:
+			os.Remove(entry.Path)
+		default:
+			b.Sessions.FileService.unassemble(batch.Files[i].SessionID, entry.Path)
+		}
+	}
+}
+
+// stored отмечает перенесённые в хранилище файлы пакета и освобождает их сессии.
+func (b *BatchService) stored(batch *Batch, entries []*BatchEntry) {
+	fileService := b.Sessions.FileService
+	for i, entry := range entries {
+		file := &batch.Files[i]
+		file.StoredName, file.Version, file.Status = entry.StoredName, entry.Version, entry.Meta.Status
+		if file.Instant {
+			continue
+		}
+		if err := fileService.DeleteChunks(file.SessionID); err != nil {
+			log.Printf("Failed to delete chunks for session %s: %v", file.SessionID, err)
+		}
+		b.Sessions.ReleaseReservation(file.SessionID)
+		if err := b.Sessions.Storage.UpdateSessionFields(file.SessionID, map[string]interface{}{"stored_name": entry.StoredName}); err != nil {
+			log.Printf("Failed to record stored name in session %s: %v", file.SessionID, err)
+		}
+	}
+}
+
+// RecoverBatches разбирает фиксации пакетов, прерванные остановкой сервера; вызывается
+// при запуске. Пакет, файлы которого уже доступны, фиксируется до конца, остальные
+// откатываются и отмечаются неудавшимися.
+func (b *BatchService) RecoverBatches() {
+	recovered, err := b.Sessions.FileService.RecoverBatches()
+	if err != nil {
+		log.Printf("Failed to recover interrupted batch commits: %v", err)
+		return
+	}
+	for _, interrupted := range recovered {
+		batch, err := b.load(interrupted.BatchID)
+		if err != nil {
+			log.Printf("Failed to load recovered batch %s: %v", interrupted.BatchID, err)
+			continue
+		}
+		if !interrupted.Committed {
+			b.fail(batch, errors.New("commit was interrupted by a server restart and rolled back"))
+			continue
+		}
+		if len(batch.Files) != len(interrupted.Entries) {
+			log.Printf("Recovered batch %s has %d files, its journal %d", batch.ID, len(batch.Files), len(interrupted.Entries))
+			continue
+		}
+		b.stored(batch, interrupted.Entries)
+		b.publish(batch, interrupted.Entries)
+	}
+}
+
+// AbortBatch отменяет открытый или неудавшийся пакет и удаляет загруженные чанки.
+func (b *BatchService) AbortBatch(batchID string) (*Batch, error) {
+	batch, unlock, err := b.lock(batchID)
+	if err != nil {
+		return batch, err
+	}
+	defer unlock()
+
+	switch batch.Status {
+	case BatchStatusOpen, BatchStatusCommitting, BatchStatusFailed:
+	case BatchStatusAborted:
+		return batch, nil
+	case BatchStatusProcessing:
+		return batch, ErrBatchBusy
+	default:
+		return batch, fmt.Errorf("%w: batch is %s", ErrBatchClosed, batch.Status)
+	}
+	b.dropSessions(batch)
+	batch.Status = BatchStatusAborted
+	if err := b.save(batch); err != nil {
+		return batch, err
+	}
+	log.Printf("Batch %s aborted", batch.ID)
+	return batch, nil
+}
+
+// Wait дожидается обработки зафиксированных пакетов.
+func (b *BatchService) Wait() {
+	b.wg.Wait()
+}
+
+// lock захватывает пакет на время фиксации или отмены. Занятый пакет возвращается с ErrBatchBusy.
+func (b *BatchService) lock(batchID string) (*Batch, func(), error) {
+	key := "batch:" + batchID + ":lock"
+	locked, err := b.Sessions.Storage.AcquireLock(key, batchLockTTL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lock batch: %w", err)
+	}
+	if !locked {
+		batch, err := b.load(batchID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return batch, nil, ErrBatchBusy
+	}
+	unlock := func() {
+		if err := b.Sessions.Storage.ReleaseLock(key); err != nil {
+			log.Printf("Failed to unlock batch %s: %v", batchID, err)
+		}
+	}
+	batch, err := b.load(batchID)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return batch, unlock, nil
+}
+
+// uploadComplete обновляет ход загрузки файла и сообщает, получены ли все его чанки.
+func (b *BatchService) uploadComplete(file *BatchFile) (bool, error) {
+	if file.Instant {
+		return true, nil
+	}
+	if err := b.Sessions.UpdateProgress(file.SessionID); err != nil {
+		return false, fmt.Errorf("%s: %w", file.FileName, ErrSessionNotFound)
+	}
+	status, err := b.Sessions.GetUploadStatus(file.SessionID)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", file.FileName, err)
+	}
+	file.UploadedSize, _ = status["uploaded_size"].(int64)
+	completed, _ := status["completed"].(bool)
+	statusStr, _ := status["status"].(string)
+	file.Completed = completed && statusStr == "completed"
+	return file.Completed, nil
+}
+
+// stage готовит собранный и проверенный файл пакета во временном пути.
+func (b *BatchService) stage(file *BatchFile) (string, error) {
+	fileService := b.Sessions.FileService
+	if file.Instant {
+		return fileService.StageContent(file.FileHash, file.FileName)
+	}
+	path, err := fileService.AssemblyPath(file.SessionID)
+	if err != nil {
+		return "", err
+	}
+	if err := fileService.AssembleChunks(file.SessionID, path); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	if err := fileService.CheckAssembledFile(file.FileName, path); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	actualHash, err := fileService.CalculateFileChecksum(path)
+	if err != nil || actualHash != file.FileHash {
+		os.Remove(path)
+		return "", fmt.Errorf("file hash mismatch: expected %s, got %s", file.FileHash, actualHash)
+	}
+	return path, nil
+}
+
+// process прогоняет файлы пакета через конвейер. Файлы переносятся в хранилище вместе,
+// если все прошли обработку; иначе в хранилище не попадает ни один.
+func (b *BatchService) process(batch *Batch, entries []*BatchEntry) {
+	results, rejected, err := b.Pipeline.RunBatch(batch.ID, entries)
+	if err != nil {
+		b.discard(batch, entries, -1)
+		b.fail(batch, err)
+		return
+	}
+	if rejected >= 0 {
+		// С непрошедшим файлом уже поступили по on_failure
+		b.discard(batch, entries, rejected)
+		for j := range batch.Files {
+			batch.Files[j].Status = BatchFileRolledBack
+		}
+		batch.Files[rejected].Status = results[rejected].Status
+		b.fail(batch, fmt.Errorf("%s was rejected by processing: %s", entries[rejected].Name, results[rejected].FailureMessage()))
+		return
+	}
+	b.stored(batch, entries)
+	b.publish(batch, entries)
+}
+
+// publish завершает пакет: индексирует содержимое и уведомляет о файлах и о пакете.
+func (b *BatchService) publish(batch *Batch, entries []*BatchEntry) {
+	fileService := b.Sessions.FileService
+	for i, entry := range entries {
+		file := batch.Files[i]
+		path := filepath.Join(fileService.LocalPath, filepath.FromSlash(entry.StoredName))
+		if !file.Instant {
+			if err := fileService.IndexContent(file.FileHash, path); err != nil {
+				log.Printf("Failed to index content of %s: %v", path, err)
+			}
+		}
+		completed := map[string]interface{}{
+			"session_id": entry.Meta.SessionID,
+			"batch_id":   batch.ID,
+			"file_name":  entry.StoredName,
+			"version":    entry.Version,
+			"path":       path,
+			"file_size":  file.FileSize,
+			"file_hash":  file.FileHash,
+			"instant":    file.Instant,
+		}
+		if file.ContentType != "" {
+			completed["content_type"] = file.ContentType
+		}
+		if len(file.Metadata) > 0 {
+			completed["metadata"] = file.Metadata
+		}
+		b.Webhooks.Emit(EventUploadCompleted, completed)
+	}
+	batch.Status = BatchStatusCommitted
+	if err := b.save(batch); err != nil {
+		log.Printf("Failed to save batch %s: %v", batch.ID, err)
+	}
+	b.Webhooks.Emit(EventBatchCommitted, map[string]interface{}{
+		"batch_id": batch.ID,
+		"files":    batch.Files,
+	})
+	log.Printf("Batch %s committed with %d files", batch.ID, len(batch.Files))
+}
+
+// fail отмечает пакет неудавшимся и удаляет его сессии; в хранилище пакет не попадает.
+func (b *BatchService) fail(batch *Batch, cause error) (*Batch, error) {
+	log.Printf("Batch %s failed: %v", batch.ID, cause)
+	b.dropSessions(batch)
+	batch.Status, batch.Error = BatchStatusFailed, cause.Error()
+	if err := b.save(batch); err != nil {
+		log.Printf("Failed to save batch %s: %v", batch.ID, err)
+	}
+	b.Webhooks.Emit(EventBatchFailed, map[string]interface{}{
+		"batch_id": batch.ID,
+		"error":    batch.Error,
+	})
+	return batch, cause
+}
+
+// dropSessions удаляет сессии файлов пакета вместе с чанками и резервами места.
+func (b *BatchService) dropSessions(batch *Batch) {
+	for _, file := range batch.Files {
+		if file.Instant || file.SessionID == "" {
+			continue
+		}
+		if err := b.Sessions.DeleteSession(file.SessionID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			log.Printf("Failed to delete session %s of batch %s: %v", file.SessionID, batch.ID, err)
+		}
+	}
+}
+
+func (b *BatchService) save(batch *Batch) error {
+	batch.UpdatedAt = time.Now().UTC()
+	encoded, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch: %w", err)
+	}
+	if err := b.Sessions.Storage.SaveBatch(batch.ID, encoded); err != nil {
+		return fmt.Errorf("failed to save batch: %w", err)
+	}
+	return nil
+}
+
+func (b *BatchService) load(batchID string) (*Batch, error) {
+	encoded, err := b.Sessions.Storage.GetBatch(batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load batch: %w", err)
+	}
+	if encoded == nil {
+		return nil, ErrBatchNotFound
+	}
+	batch := &Batch{}
+	if err := json.Unmarshal(encoded, batch); err != nil {
+		return nil, fmt.Errorf("failed to decode batch: %w", err)
+	}
+	return batch, nil
+}
+
+// BatchEntry — собранный файл пакета для FileService.CommitBatch.
+// StoredName и Version заполняются при переносе в хранилище.
+type BatchEntry struct {
+	Name       string
+	Path       string
+	Meta       FileMeta
+	StoredName string
+	Version    int
+
+	// backup — содержимое, заменённое по политике overwrite, с метаданными и номером
+	// версии; возвращается при откате.
+	backup        string
+	backupMeta    *FileMeta
+	backupVersion int
+	// journal — журнал фиксации пакета, удаляемый ReleaseBatch или RollbackBatch
+	journal *batchJournal
+}
+
+// CommitBatch переносит собранные файлы пакета batchID в хранилище так, что читатели OpenFile
+// и ListFiles видят либо все файлы, либо ни одного. При ошибке уже перенесённые файлы
+// откатываются. Заменённое по политике overwrite содержимое и журнал фиксации хранятся
+// до ReleaseBatch или RollbackBatch; после сбоя пакет доводит до конца или откатывает RecoverBatches.
+func (f *FileService) CommitBatch(batchID string, entries []*BatchEntry) error {
+	f.commitMu.Lock()
+	defer f.commitMu.Unlock()
+
+	// Занятые имена при политике reject отклоняются до переноса первого файла
+	for _, entry := range entries {
+		if err := f.CheckConflict(entry.Name); err != nil {
+			return err
+		}
+	}
+	journal, err := f.openJournal(batchID, entries)
+	if err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		if err := f.commitEntry(entry, &journal.Entries[i]); err != nil {
+			f.rollbackEntries(entries[:i])
+			removeJournals(entries)
+			return err
+		}
+	}
+	journal.State = journalCommitted
+	if err := journal.save(); err != nil {
+		f.rollbackEntries(entries)
+		removeJournals(entries)
+		return err
+	}
+	return nil
+}
+
+// RollbackBatch убирает из хранилища файлы, перенесённые CommitBatch: под их именами
+// снова доступны прежние версии или заменённое содержимое.
+func (f *FileService) RollbackBatch(entries []*BatchEntry) {
+	f.commitMu.Lock()
+	defer f.commitMu.Unlock()
+	f.rollbackEntries(entries)
+	removeJournals(entries)
+}
+
+// ReleaseBatch удаляет сохранённое для отката содержимое и журнал окончательно зафиксированного пакета.
+func (f *FileService) ReleaseBatch(entries []*BatchEntry) {
+	for _, entry := range entries {
+		f.releaseBackup(entry)
+	}
+	removeJournals(entries)
+}
+
+// commitEntry переносит файл пакета в хранилище, предварительно записав в журнал (record),
+// под каким именем он появится и как вернуть прежнее содержимое.
+func (f *FileService) commitEntry(entry *BatchEntry, record *journalEntry) error {
+	policy := f.ConflictPolicy(entry.Name)
+	target := filepath.Join(f.LocalPath, filepath.FromSlash(entry.Name))
+	if info, err := os.Stat(target); err == nil && info.Mode().IsRegular() && policy == OnConflictOverwrite {
+		backup, err := f.processingTemp(fmt.Sprintf("backup-%d", time.Now().UnixNano()))
+		if err != nil {
+			return err
+		}
+		if err := linkOrCopy(target, backup); err != nil {
+			return fmt.Errorf("failed to keep replaced %s: %w", entry.Name, err)
+		}
+		entry.backup = backup
+		entry.backupVersion = f.currentVersion(entry.Name)
+		if entry.backupMeta, err = f.GetFileMeta(entry.Name); err != nil {
+			log.Printf("Failed to read metadata of %s: %v", entry.Name, err)
+		}
+	}
+	// Журнал записывается под итоговым именем (при политике rename оно выбирается в commitFile),
+	// чтобы после сбоя было известно, где искать файл
+	name, version, err := f.commitFile(entry.Name, entry.Path, policy, func(name string, archive bool) error {
+		record.Name, record.Moving, record.Archived = name, true, archive
+		record.Backup, record.BackupMeta, record.BackupVersion = entry.backup, entry.backupMeta, entry.backupVersion
+		return entry.journal.save()
+	})
+	if err != nil {
+		f.releaseBackup(entry)
+		return err
+	}
+	entry.StoredName, entry.Version = name, version
+	record.Version = version
+	if err := f.SaveFileMeta(name, entry.Meta); err != nil {
+		log.Printf("Failed to save metadata of %s: %v", name, err)
+	}
+	return nil
+}
+
+func (f *FileService) rollbackEntries(entries []*BatchEntry) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.StoredName == "" {
+			continue
+		}
+		if entry.backup != "" {
+			f.restoreBackup(entry)
+		} else if err := f.DeleteVersion(entry.StoredName, entry.Version); err != nil {
+			log.Printf("Failed to roll back %s: %v", entry.StoredName, err)
+		}
+		log.Printf("Rolled back version %d of %s", entry.Version, entry.StoredName)
+		entry.StoredName, entry.Version = "", 0
+	}
+}
+
+// restoreBackup возвращает под имя содержимое, заменённое по политике overwrite.
+func (f *FileService) restoreBackup(entry *BatchEntry) {
+	f.versionsMu.Lock()
+	defer f.versionsMu.Unlock()
+
+	f.removeThumbnails(entry.StoredName)
+	if err := os.Rename(entry.backup, filepath.Join(f.LocalPath, filepath.FromSlash(entry.StoredName))); err != nil {
+		log.Printf("Failed to restore replaced %s: %v", entry.StoredName, err)
+		return
+	}
+	entry.backup = ""
+	restored := FileMeta{}
+	if entry.backupMeta != nil {
+		restored = *entry.backupMeta
+	}
+	if err := f.SaveFileMeta(entry.StoredName, restored); err != nil {
+		log.Printf("Failed to save metadata of %s: %v", entry.StoredName, err)
+	}
+	if err := f.setCurrentVersion(entry.StoredName, entry.backupVersion); err != nil {
+		log.Printf("Failed to record version %d of %s: %v", entry.backupVersion, entry.StoredName, err)
+	}
+}
+
+func (f *FileService) releaseBackup(entry *BatchEntry) {
+	if entry.backup != "" {
+		os.Remove(entry.backup)
+		entry.backup = ""
+	}
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Журнал фиксации пакета: перед переносом первого файла в .processing/batch-<id>.journal
+// записываются все файлы пакета, а перед переносом каждого — под каким именем он появится
+// и что было под этим именем раньше. Журнал удаляется, когда пакет окончательно зафиксирован
+// (ReleaseBatch) или откачен (RollbackBatch). Журнал, оставшийся после остановки сервера,
+// разбирает RecoverBatches: пакет либо доводится до конца, либо откатывается целиком.
+const (
+	journalCommitting = "committing"
+	journalCommitted  = "committed"
+)
+
+type batchJournal struct {
+	BatchID string         `json:"batch_id"`
+	State   string         `json:"state"`
+	Entries []journalEntry `json:"entries"`
+
+	path string
+}
+
+// journalEntry — файл пакета в журнале. Moving отмечается до переноса: после сбоя перенос
+// мог как состояться, так и нет, и это определяется по наличию временного файла Path.
+type journalEntry struct {
+	Name    string   `json:"name"`
+	Path    string   `json:"path"`
+	Meta    FileMeta `json:"meta"`
+	Moving  bool     `json:"moving,omitempty"`
+	Version int      `json:"version,omitempty"`
+	// Archived — прежний файл под именем стал прежней версией (политика version)
+	Archived      bool      `json:"archived,omitempty"`
+	Backup        string    `json:"backup,omitempty"`
+	BackupMeta    *FileMeta `json:"backup_meta,omitempty"`
+	BackupVersion int       `json:"backup_version,omitempty"`
+}
+
+// RecoveredBatch — пакет, фиксация которого была прервана. Committed — все файлы были
+// перенесены и доступны, фиксация доведена до конца; иначе пакет откачен.
+type RecoveredBatch struct {
+	BatchID   string
+	Committed bool
+	Entries   []*BatchEntry
+}
+
+func (f *FileService) journalPath(batchID string) string {
+	return filepath.Join(f.LocalPath, processingDir, "batch-"+batchID+".journal")
+}
+
+// openJournal записывает журнал фиксации пакета batchID до переноса первого файла.
+func (f *FileService) openJournal(batchID string, entries []*BatchEntry) (*batchJournal, error) {
+	if err := os.MkdirAll(filepath.Join(f.LocalPath, processingDir), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create processing directory: %w", err)
+	}
+	journal := &batchJournal{BatchID: batchID, State: journalCommitting, path: f.journalPath(batchID)}
+	for _, entry := range entries {
+		journal.Entries = append(journal.Entries, journalEntry{Name: entry.Name, Path: entry.Path, Meta: entry.Meta})
+		entry.journal = journal
+	}
+	if err := journal.save(); err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+// save атомарно перезаписывает журнал и сбрасывает его на диск.
+func (j *batchJournal) save() error {
+	encoded, err := json.Marshal(j)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch journal: %w", err)
+	}
+	tmp := j.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write batch journal: %w", storageError(err))
+	}
+	_, err = file.Write(encoded)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, j.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write batch journal: %w", storageError(err))
+	}
+	// Переименование сохраняется на диске только со сбросом каталога
+	if err := syncDir(filepath.Dir(j.path)); err != nil {
+		return fmt.Errorf("failed to write batch journal: %w", storageError(err))
+	}
+	return nil
+}
+
+// syncDir сбрасывает на диск записи каталога dir.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// removeJournals удаляет журналы, к которым относятся entries.
+func removeJournals(entries []*BatchEntry) {
+	for _, entry := range entries {
+		if entry.journal == nil {
+			continue
+		}
+		if err := os.Remove(entry.journal.path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove batch journal %s: %v", entry.journal.path, err)
+		}
+		entry.journal = nil
+	}
+}
+
+// RecoverBatches разбирает журналы фиксаций пакетов, прерванных остановкой сервера.
+// Пакет, все файлы которого перенесены, уже доступен читателям —
+// его фиксация доводится до конца. Остальные откатываются: под именами снова лежит
+// прежнее содержимое, временные файлы удаляются.
+func (f *FileService) RecoverBatches() ([]RecoveredBatch, error) {
+	dir := filepath.Join(f.LocalPath, processingDir)
+	names, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read processing directory: %w", err)
+	}
+
+	f.commitMu.Lock()
+	defer f.commitMu.Unlock()
+
+	recovered := []RecoveredBatch{}
+	for _, name := range names {
+		if !strings.HasPrefix(name.Name(), "batch-") || !strings.HasSuffix(name.Name(), ".journal") {
+			continue
+		}
+		path := filepath.Join(dir, name.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Failed to read batch journal %s: %v", path, err)
+			continue
+		}
+		journal := &batchJournal{path: path}
+		if err := json.Unmarshal(data, journal); err != nil {
+			log.Printf("Failed to decode batch journal %s: %v", path, err)
+			continue
+		}
+
+		entries := make([]*BatchEntry, len(journal.Entries))
+		for i, record := range journal.Entries {
+			entries[i] = &BatchEntry{Name: record.Name, Path: record.Path, Meta: record.Meta, StoredName: record.Name, Version: record.Version,
+				backup: record.Backup, backupMeta: record.BackupMeta, backupVersion: record.BackupVersion, journal: journal}
+		}
+		batch := RecoveredBatch{BatchID: journal.BatchID, Entries: entries}
+		if journal.State == journalCommitted {
+			for _, entry := range entries {
+				f.releaseBackup(entry)
+			}
+			batch.Committed = true
+			log.Printf("Batch %s: interrupted commit completed", journal.BatchID)
+		} else {
+			for i := len(journal.Entries) - 1; i >= 0; i-- {
+				f.rollbackRecord(journal.Entries[i])
+			}
+			log.Printf("Batch %s: interrupted commit rolled back", journal.BatchID)
+		}
+		removeJournals(entries)
+		recovered = append(recovered, batch)
+	}
+	return recovered, nil
+}
+
+// rollbackRecord возвращает под имя файла журнала то, что было там до фиксации пакета.
+func (f *FileService) rollbackRecord(record journalEntry) {
+	if _, err := os.Stat(record.Path); err == nil || !record.Moving {
+		// Файл не переносился
+		os.Remove(record.Path)
+	} else {
+		f.versionsMu.Lock()
+		target := filepath.Join(f.LocalPath, filepath.FromSlash(record.Name))
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to roll back %s: %v", record.Name, err)
+		}
+		if err := f.SaveFileMeta(record.Name, FileMeta{}); err != nil {
+			log.Printf("Failed to delete metadata of %s: %v", record.Name, err)
+		}
+		f.removeThumbnails(record.Name)
+		f.versionsMu.Unlock()
+	}
+
+	switch {
+	case record.Backup != "":
+		f.restoreBackup(&BatchEntry{StoredName: record.Name, backup: record.Backup, backupMeta: record.BackupMeta, backupVersion: record.BackupVersion})
+	case record.Archived:
+		if _, err := f.RestoreLatestVersion(record.Name); err != nil {
+			log.Printf("Failed to restore previous version of %s: %v", record.Name, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// chunkStoreDir — каталог хранилища чанков внутри LocalPath.
+// Чанки адресуются своим SHA-256 и переиспользуются между файлами и сессиями.
+const chunkStoreDir = ".chunks"
+
+var (
+	ErrChunkNotStored   = errors.New("chunk is not in the chunk store")
+	ErrChunkHashInvalid = errors.New("invalid chunk hash")
+)
+
+// ChunkRef ссылается из сессии на чанк хранилища по его хешу.
+type ChunkRef struct {
+	Offset int64  `json:"offset"`
+	Hash   string `json:"hash"`
+}
+
+// storedChunkPath возвращает путь к чанку в хранилище: .chunks/<первые 2 символа>/<hash>.
+func (f *FileService) storedChunkPath(hash string) (string, error) {
+	if len(hash) != 64 {
+		return "", ErrChunkHashInvalid
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", ErrChunkHashInvalid
+	}
+	return filepath.Join(f.LocalPath, chunkStoreDir, hash[:2], hash), nil
+}
+
+// MissingChunks возвращает хеши из списка, которых ещё нет в хранилище чанков.
+func (f *FileService) MissingChunks(hashes []string) ([]string, error) {
+	missing := []string{}
+	for _, hash := range hashes {
+		path, err := f.storedChunkPath(hash)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", err, hash)
+		}
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			missing = append(missing, hash)
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to check chunk %s: %w", hash, err)
+		}
+	}
+	return missing, nil
+}
+
+// StoreChunk кладёт чанк в хранилище под его SHA-256.
+// Возвращает false, если такой чанк уже хранится.
+func (f *FileService) StoreChunk(chunkData []byte) (string, bool, error) {
+	if len(chunkData) == 0 {
+		return "", false, fmt.Errorf("%w: chunk is empty", ErrChunkSizeInvalid)
+	}
+	if maxSize := int64(f.Chunking.MaxSize); int64(len(chunkData)) > maxSize {
+		return "", false, fmt.Errorf("%w: %d bytes exceeds the maximum of %d bytes", ErrChunkSizeInvalid, len(chunkData), maxSize)
+	}
+	hash := f.CalculateChecksum(chunkData)
+	path, err := f.storedChunkPath(hash)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return hash, false, nil
+	}
+	if err := f.ensureSpace(int64(len(chunkData))); err != nil {
+		return "", false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return "", false, fmt.Errorf("failed to create chunk store directory: %w", err)
+	}
+
+	// Пишем во временный файл и переименовываем, чтобы параллельные запросы не увидели неполный чанк
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".*.tmp")
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create chunk file: %w", storageError(err))
+	}
+	writer, err := f.encryptTo(tmp)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", false, err
+	}
+	if _, err := writer.Write(chunkData); err != nil {
+		writer.Close()
+		os.Remove(tmp.Name())
+		return "", false, fmt.Errorf("failed to write chunk file: %w", storageError(err))
+	}
+	if err := writer.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", false, fmt.Errorf("failed to write chunk file: %w", storageError(err))
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", false, fmt.Errorf("failed to store chunk: %w", err)
+	}
+	log.Printf("Stored chunk %s (%d bytes)", hash, len(chunkData))
+	return hash, true, nil
+}
+
+// LinkChunkAt помещает в сессию по смещению offset чанк из хранилища, не передавая его данные.
+// Проверки размера и пересечений те же, что у SaveChunkAt.
+func (f *FileService) LinkChunkAt(sessionID string, offset int64, hash string) (int64, error) {
+	path, err := f.storedChunkPath(hash)
+	if err != nil {
+		return 0, err
+	}
+	size, err := f.storedSize(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrChunkNotStored
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to check chunk %s: %w", hash, err)
+	}
+
+	err = f.addRange(sessionID, offset, size, func(partPath string) error {
+		if err := os.Link(path, partPath); err != nil {
+			if err := copyFile(path, partPath); err != nil {
+				return fmt.Errorf("failed to link chunk %s: %w", hash, err)
+			}
+		}
+		return nil
+	})
+	return size, err
+}
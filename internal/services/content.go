@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var ErrContentNotFound = errors.New("content not found")
+
+// IndexContent добавляет собранный файл в индекс содержимого по его SHA-256.
+// Хеш должен быть проверен вызывающим: по индексу файл выдаётся другим клиентам без загрузки.
+func (f *FileService) IndexContent(fileHash string, filePath string) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat indexed file: %w", err)
+	}
+	rel, err := filepath.Rel(f.LocalPath, filePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve indexed file path: %w", err)
+	}
+	return f.Storage.SaveContentRef(fileHash, map[string]interface{}{
+		"path":     filepath.ToSlash(rel),
+		"size":     info.Size(),
+		"mod_time": info.ModTime().UnixNano(),
+	})
+}
+
+// lookupContent возвращает путь к сохранённому файлу с данным хешем.
+// Если файл удалён или изменён после индексации, запись удаляется и возвращается ErrContentNotFound.
+func (f *FileService) lookupContent(fileHash string) (string, os.FileInfo, error) {
+	ref, err := f.Storage.GetContentRef(fileHash)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to look up content: %w", err)
+	}
+	if len(ref) == 0 {
+		return "", nil, ErrContentNotFound
+	}
+
+	path := filepath.Join(f.LocalPath, filepath.FromSlash(ref["path"]))
+	size, _ := strconv.ParseInt(ref["size"], 10, 64)
+	modTime, _ := strconv.ParseInt(ref["mod_time"], 10, 64)
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != size || info.ModTime().UnixNano() != modTime {
+		log.Printf("Content index entry for %s is stale, removing", fileHash)
+		if err := f.Storage.DeleteContentRef(fileHash); err != nil {
+			return "", nil, fmt.Errorf("failed to remove stale content entry: %w", err)
+		}
+		return "", nil, ErrContentNotFound
+	}
+	return path, info, nil
+}
+
+// LinkContent создаёт файл fileName с уже сохранённым содержимым fileHash — жёсткой ссылкой,
+// а если она невозможна (другая файловая система), копией. Занятое имя разрешается так же,
+// как при обычной загрузке. Возвращает имя созданного файла и номер его версии.
+func (f *FileService) LinkContent(fileHash string, fileName string) (string, int, error) {
+	tmpPath, err := f.StageContent(fileHash, fileName)
+	if err != nil {
+		return "", 0, err
+	}
+	storedName, version, err := f.CommitFile(fileName, tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", 0, err
+	}
+	log.Printf("Content %s is already present, stored as %s", fileHash, storedName)
+	return storedName, version, nil
+}
+
+// StageContent готовит во временном файле копию уже сохранённого содержимого fileHash
+// для переноса в хранилище под именем fileName через CommitFile. Содержимое проверяется
+// политикой типов пространства имён fileName: в исходном пространстве оно могло быть разрешено.
+func (f *FileService) StageContent(fileHash, fileName string) (string, error) {
+	sourcePath, _, err := f.lookupContent(fileHash)
+	if err != nil {
+		return "", err
+	}
+
+	tmpPath, err := f.processingTemp(fmt.Sprintf("link-%s-%d", fileHash, time.Now().UnixNano()))
+	if err != nil {
+		return "", err
+	}
+	if err := linkOrCopy(sourcePath, tmpPath); err != nil {
+		return "", err
+	}
+	if err := f.CheckAssembledFile(fileName, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+	return tmpPath, nil
+}
+
+// linkOrCopy создаёт targetPath жёсткой ссылкой на sourcePath, а если это невозможно — копией.
+func linkOrCopy(sourcePath, targetPath string) error {
+	if err := os.Link(sourcePath, targetPath); err != nil {
+		log.Printf("Hardlink %s -> %s failed, copying instead: %v", sourcePath, targetPath, err)
+		return copyFile(sourcePath, targetPath)
+	}
+	return nil
+}
+
+func copyFile(sourcePath, targetPath string) error {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer source.Close()
+
+	target, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create target file: %w", err)
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close()
+		os.Remove(targetPath)
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+	return target.Close()
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"BASProject/internal/utils"
+	"errors"
+	"fmt"
+	"log"
+	"syscall"
+)
+
+var ErrInsufficientStorage = errors.New("insufficient storage")
+
+// availableSpace возвращает свободное место тома хранилища за вычетом MinFreeSpace.
+// ok == false — размер тома определить не удалось, проверки пропускаются.
+func (f *FileService) availableSpace() (int64, bool) {
+	free, err := utils.FreeSpace(f.LocalPath)
+	if err != nil {
+		return 0, false
+	}
+	return free - f.MinFreeSpace, true
+}
+
+// ensureSpace проверяет, что на томе есть size байт сверх MinFreeSpace.
+func (f *FileService) ensureSpace(size int64) error {
+	if available, ok := f.availableSpace(); ok && available < size {
+		return fmt.Errorf("%w: %d bytes needed, %d bytes available", ErrInsufficientStorage, size, max(available, 0))
+	}
+	return nil
+}
+
+// storageError помечает ошибку переполнения тома как ErrInsufficientStorage.
+func storageError(err error) error {
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) {
+		return fmt.Errorf("%w: %v", ErrInsufficientStorage, err)
+	}
+	return err
+}
+
+// reserveSpace резервирует место под чанки и собранную копию файла размером fileSize,
+// чтобы параллельные сессии не рассчитывали на одно и то же свободное место.
+// Сессии с выделенным файлом (preallocated) копию не создают и резервируют место один раз.
+func (s *SessionService) reserveSpace(sessionID string, fileSize int64, preallocated bool) error {
+	available, ok := s.FileService.availableSpace()
+	if !ok {
+		return nil
+	}
+	need := 2 * fileSize
+	if preallocated {
+		need = fileSize
+	}
+	reserved, outstanding, err := s.Storage.ReserveSpace(sessionID, need, available)
+	if err != nil {
+		return fmt.Errorf("failed to reserve space: %w", err)
+	}
+	if !reserved {
+		return fmt.Errorf("%w: session needs %d bytes for chunks and the assembled file, %d bytes are free and %d are reserved by other sessions",
+			ErrInsufficientStorage, need, max(available, 0), outstanding)
+	}
+	return nil
+}
+
+// ReleaseReservation снимает резерв места сессии после сборки файла.
+func (s *SessionService) ReleaseReservation(sessionID string) error {
+	if err := s.Storage.ReleaseSpace(sessionID); err != nil {
+		log.Printf("Failed to release space reservation of session %s: %v", sessionID, err)
+		return err
+	}
+	return nil
+}
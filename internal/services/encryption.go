@@ -0,0 +1,139 @@
+package services
+
+import (
+	"BASProject/internal/utils"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// FileReader — открытый файл хранилища с расшифрованным содержимым.
+type FileReader interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+	// Size возвращает размер содержимого (без заголовков шифрования).
+	Size() int64
+	ModTime() time.Time
+}
+
+// plainFile — незашифрованный файл хранилища.
+type plainFile struct {
+	*os.File
+	info os.FileInfo
+}
+
+func (p *plainFile) Size() int64        { return p.info.Size() }
+func (p *plainFile) ModTime() time.Time { return p.info.ModTime() }
+
+// encryptedFile — зашифрованный файл, расшифровываемый при чтении.
+type encryptedFile struct {
+	*utils.DecryptReader
+	file *os.File
+	info os.FileInfo
+}
+
+func (e *encryptedFile) Close() error       { return e.file.Close() }
+func (e *encryptedFile) ModTime() time.Time { return e.info.ModTime() }
+
+// openStored открывает файл хранилища для чтения. Зашифрованные файлы определяются по заголовку,
+// поэтому файлы, записанные до включения шифрования, по-прежнему читаются.
+func (f *FileService) openStored(path string) (FileReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if !utils.IsEncrypted(file) {
+		return &plainFile{File: file, info: info}, nil
+	}
+	if f.Envelope == nil {
+		file.Close()
+		return nil, fmt.Errorf("%s is encrypted but no master key is configured", path)
+	}
+	reader, err := f.Envelope.NewReader(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+	return &encryptedFile{DecryptReader: reader, file: file, info: info}, nil
+}
+
+// storedSize возвращает размер содержимого файла хранилища.
+func (f *FileService) storedSize(path string) (int64, error) {
+	file, err := f.openStored(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return file.Size(), nil
+}
+
+// encryptTo оборачивает открытый на запись файл шифрованием, если оно включено.
+// Close результата закрывает и сам файл.
+func (f *FileService) encryptTo(file *os.File) (io.WriteCloser, error) {
+	if f.Envelope == nil {
+		return file, nil
+	}
+	writer, err := f.Envelope.NewWriter(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start encryption: %w", err)
+	}
+	return &encryptedWriter{WriteCloser: writer, file: file}, nil
+}
+
+type encryptedWriter struct {
+	io.WriteCloser
+	file *os.File
+}
+
+func (e *encryptedWriter) Close() error {
+	err := e.WriteCloser.Close()
+	if closeErr := e.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// createStored создаёт файл хранилища; при включённом шифровании данные шифруются потоково.
+func (f *FileService) createStored(path string) (io.WriteCloser, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := f.encryptTo(file)
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return writer, nil
+}
+
+// writeStored записывает data в файл хранилища целиком.
+// При нехватке места на томе возвращается ErrInsufficientStorage, недописанный файл удаляется.
+func (f *FileService) writeStored(path string, data []byte) error {
+	if err := f.ensureSpace(int64(len(data))); err != nil {
+		return err
+	}
+	writer, err := f.createStored(path)
+	if err != nil {
+		return storageError(err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		os.Remove(path)
+		return storageError(err)
+	}
+	if err := writer.Close(); err != nil {
+		os.Remove(path)
+		return storageError(err)
+	}
+	return nil
+}
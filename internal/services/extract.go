@@ -0,0 +1,427 @@
+package services
+
+import (
+	"BASProject/config"
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Итоги распаковки архива и отдельных его записей.
+const (
+	ExtractionCompleted = "completed"
+	ExtractionFailed    = "failed"
+)
+
+var (
+	ErrNotArchive       = errors.New("file is not a supported archive")
+	ErrExtractionLimit  = errors.New("archive exceeds extraction limits")
+	ErrInvalidExtractTo = errors.New("invalid extraction directory")
+)
+
+// SkippedEntry — запись архива, которая не была распакована, и причина.
+type SkippedEntry struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ExtractionResult — итог распаковки архива. Каждый распакованный файл получает
+// собственную запись метаданных со ссылкой на архив (ExtractedFrom).
+type ExtractionResult struct {
+	Archive   string         `json:"archive"`
+	Directory string         `json:"directory,omitempty"`
+	Status    string         `json:"status"`
+	Error     string         `json:"error,omitempty"`
+	Extracted int            `json:"extracted"`
+	TotalSize int64          `json:"total_size"`
+	Skipped   []SkippedEntry `json:"skipped,omitempty"`
+}
+
+// archiveFormat определяет формат архива по имени: zip, tar, tar.gz или пустая строка.
+func archiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(lower, ".tar"):
+		return "tar"
+	}
+	return ""
+}
+
+// IsExtractableName сообщает, что файл с таким именем можно распаковать на сервере.
+func IsExtractableName(name string) bool {
+	return archiveFormat(name) != ""
+}
+
+// ValidateExtractDir проверяет каталог распаковки, заданный клиентом: относительный путь
+// внутри хранилища, не ведущий в служебные каталоги.
+func ValidateExtractDir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if _, err := SanitizeFileName(dir); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidExtractTo, err)
+	}
+	return nil
+}
+
+// ValidateExtraction проверяет запрос распаковки: распаковать можно только zip, tar и tar.gz,
+// каталог распаковки задаётся только вместе с extract.
+func ValidateExtraction(fileName string, extract bool, dir string) error {
+	if !extract {
+		if dir != "" {
+			return fmt.Errorf("%w: extract_dir requires extract", ErrInvalidExtractTo)
+		}
+		return nil
+	}
+	if !IsExtractableName(fileName) {
+		return fmt.Errorf("%w: %s is not a .zip, .tar, .tar.gz or .tgz file", ErrNotArchive, fileName)
+	}
+	return ValidateExtractDir(dir)
+}
+
+// extractionTarget — каталог распаковки по умолчанию: имя архива без расширения.
+func extractionTarget(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name
+}
+
+// extractor распаковывает записи во временный каталог с учётом ограничений.
+// prefix — каталог хранилища, в который попадут записи; по нему выбирается политика типов.
+type extractor struct {
+	fileService *FileService
+	limits      config.ExtractionConfig
+	dir         string
+	prefix      string
+	entries     int
+	files       []string
+	seen        map[string]bool
+	result      *ExtractionResult
+}
+
+func (e *extractor) skip(name, reason string) {
+	e.result.Skipped = append(e.result.Skipped, SkippedEntry{Name: name, Reason: reason})
+}
+
+// entry обрабатывает одну запись архива; open вызывается только для обычных файлов.
+func (e *extractor) entry(name string, isDir, regular bool, sizeHint int64, open func() (io.ReadCloser, error)) error {
+	e.entries++
+	if e.entries > e.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrExtractionLimit, e.limits.MaxEntries)
+	}
+	// Имена записей проверяются так же строго, как имена загружаемых файлов (zip slip и пр.)
+	clean, err := sanitizeKey(name)
+	if err != nil {
+		e.skip(name, err.Error())
+		return nil
+	}
+	// Записи проверяются политикой типов пространства имён, как и загружаемые файлы
+	stored := path.Join(e.prefix, clean)
+	if !isDir && regular {
+		if err := e.fileService.CheckFileName(stored, ""); err != nil {
+			e.skip(name, err.Error())
+			return nil
+		}
+	}
+	target := filepath.Join(e.dir, filepath.FromSlash(clean))
+	if isDir {
+		if err := os.MkdirAll(target, os.ModePerm); err != nil {
+			e.skip(name, "cannot create directory")
+		}
+		return nil
+	}
+	if !regular {
+		e.skip(name, "unsupported entry type")
+		return nil
+	}
+	if sizeHint > int64(e.limits.MaxEntrySize) {
+		return fmt.Errorf("%w: %s declares %d bytes, at most %d are allowed", ErrExtractionLimit, name, sizeHint, e.limits.MaxEntrySize)
+	}
+	if err := e.fileService.ensureSpace(max(sizeHint, 0)); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		e.skip(name, "cannot create directory")
+		return nil
+	}
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		e.skip(name, "conflicts with a directory")
+		return nil
+	}
+
+	source, err := open()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	defer source.Close()
+	content := bufio.NewReaderSize(source, sniffLength)
+	head, err := content.Peek(sniffLength)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if err := e.fileService.CheckFileContent(stored, head); err != nil {
+		e.skip(name, err.Error())
+		return nil
+	}
+	output, err := e.fileService.createStored(target)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", clean, storageError(err))
+	}
+	// Размер проверяется по фактически прочитанным байтам: заголовкам архива верить нельзя
+	written, err := io.Copy(output, io.LimitReader(content, int64(e.limits.MaxEntrySize)+1))
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", name, storageError(err))
+	}
+	if written > int64(e.limits.MaxEntrySize) {
+		return fmt.Errorf("%w: %s is larger than %d bytes", ErrExtractionLimit, name, e.limits.MaxEntrySize)
+	}
+	e.result.TotalSize += written
+	if e.result.TotalSize > int64(e.limits.MaxTotalSize) {
+		return fmt.Errorf("%w: more than %d bytes in total", ErrExtractionLimit, e.limits.MaxTotalSize)
+	}
+	// Повторная запись с тем же путём заменяет файл, но учитывается один раз
+	if !e.seen[clean] {
+		e.seen[clean] = true
+		e.files = append(e.files, clean)
+	}
+	return nil
+}
+
+func (e *extractor) extractZip(archive FileReader) error {
+	reader, err := zip.NewReader(archive, archive.Size())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotArchive, err)
+	}
+	for _, file := range reader.File {
+		mode := file.Mode()
+		isDir := mode.IsDir() || strings.HasSuffix(file.Name, "/")
+		if err := e.entry(file.Name, isDir, mode.IsRegular(), int64(file.UncompressedSize64), file.Open); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *extractor) extractTar(archive io.Reader, gzipped bool) error {
+	source := archive
+	if gzipped {
+		gz, err := gzip.NewReader(bufio.NewReader(archive))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrNotArchive, err)
+		}
+		defer gz.Close()
+		source = gz
+	}
+	reader := tar.NewReader(source)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrNotArchive, err)
+		}
+		// Тело записи читается из потока tar; закрывать его не нужно
+		open := func() (io.ReadCloser, error) { return io.NopCloser(reader), nil }
+		isDir := header.Typeflag == tar.TypeDir
+		regular := header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA
+		if err := e.entry(header.Name, isDir, regular, header.Size, open); err != nil {
+			return err
+		}
+	}
+}
+
+// ExtractArchive распаковывает собранный архив name (лежащий в archivePath) в каталог
+// хранилища: dir или, если он пуст, имя архива без расширения. Занятый каталог разрешается
+// политикой пространства имён (см. extractionDir). Распаковка в новый каталог атомарна:
+// при ошибке или превышении ограничений ничего не остаётся.
+// Итог записывается в метаданные архива и в сессию meta.SessionID.
+func (f *FileService) ExtractArchive(name, archivePath, dir string, meta FileMeta) (*ExtractionResult, error) {
+	result := &ExtractionResult{Archive: name, Status: ExtractionFailed}
+	err := f.extractArchive(name, archivePath, dir, meta, result)
+	if err != nil {
+		result.Error = err.Error()
+		log.Printf("Failed to extract %s: %v", name, err)
+	} else {
+		result.Status = ExtractionCompleted
+		log.Printf("Extracted %d files (%d bytes) from %s into %s", result.Extracted, result.TotalSize, name, result.Directory)
+	}
+	f.recordExtraction(name, meta, result)
+	return result, err
+}
+
+func (f *FileService) extractArchive(name, archivePath, dir string, meta FileMeta, result *ExtractionResult) error {
+	format := archiveFormat(name)
+	if format == "" {
+		return fmt.Errorf("%w: %s", ErrNotArchive, name)
+	}
+	if err := ValidateExtractDir(dir); err != nil {
+		return err
+	}
+	limits := f.Extraction
+	defaults := config.DefaultExtraction()
+	if limits.MaxEntries <= 0 {
+		limits.MaxEntries = defaults.MaxEntries
+	}
+	if limits.MaxTotalSize <= 0 {
+		limits.MaxTotalSize = defaults.MaxTotalSize
+	}
+	if limits.MaxEntrySize <= 0 {
+		limits.MaxEntrySize = defaults.MaxEntrySize
+	}
+
+	if dir == "" {
+		dir = extractionTarget(name)
+	}
+	dir, merge, err := f.extractionDir(dir)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(f.LocalPath, filepath.FromSlash(dir))
+	published := false
+	if !merge {
+		// Занятый под распаковку пустой каталог убирается, если распаковка не удалась
+		defer func() {
+			if !published {
+				os.Remove(target)
+			}
+		}()
+	}
+
+	// Распаковываем во временный каталог того же тома и переносим его целиком
+	workDir := filepath.Join(f.LocalPath, processingDir)
+	if err := os.MkdirAll(workDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create processing directory: %w", err)
+	}
+	tmp, err := os.MkdirTemp(workDir, "extract-*")
+	if err != nil {
+		return fmt.Errorf("failed to create extraction directory: %w", storageError(err))
+	}
+	defer os.RemoveAll(tmp)
+
+	archive, err := f.openStored(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer archive.Close()
+
+	e := &extractor{fileService: f, limits: limits, dir: tmp, prefix: dir, seen: map[string]bool{}, result: result}
+	if format == "zip" {
+		err = e.extractZip(archive)
+	} else {
+		err = e.extractTar(archive, format == "tar.gz")
+	}
+	if err != nil {
+		return err
+	}
+
+	result.Directory = dir
+	stored := make([]string, 0, len(e.files))
+	if merge {
+		// Каждый файл попадает в существующий каталог по политике своего имени: новая версия или замена
+		for _, file := range e.files {
+			committed, _, err := f.CommitFile(path.Join(dir, file), filepath.Join(tmp, filepath.FromSlash(file)))
+			if err != nil {
+				e.skip(file, err.Error())
+				continue
+			}
+			stored = append(stored, committed)
+		}
+	} else {
+		// Пустой каталог, созданный extractionDir, заменяется переименованием; если в него
+		// успели что-то записать, переименование не удаётся (ENOTEMPTY) и ничего не перезаписывается.
+		// os.Rename не заменяет существующие каталоги даже пустыми, поэтому rename(2) вызывается напрямую
+		if err := syscall.Rename(tmp, target); err != nil {
+			return fmt.Errorf("failed to move extracted files: %w", err)
+		}
+		published = true
+		for _, file := range e.files {
+			stored = append(stored, path.Join(dir, file))
+		}
+	}
+	result.Extracted = len(stored)
+
+	// Запись о каждом распакованном файле со ссылкой на архив
+	for _, file := range stored {
+		entryMeta := FileMeta{SessionID: meta.SessionID, Owner: meta.Owner, ExtractedFrom: name}
+		if err := f.SaveFileMeta(file, entryMeta); err != nil {
+			log.Printf("Failed to save metadata of extracted file %s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// extractionDir выбирает каталог распаковки dir по политике пространства имён. Свободный
+// каталог создаётся пустым (os.Mkdir не перезаписывает существующий), поэтому две распаковки
+// не займут его одновременно. Если каталог занят: reject — ошибка ErrFileExists, rename —
+// свободное имя с суффиксом, version и overwrite — распаковка в существующий каталог (merge).
+func (f *FileService) extractionDir(dir string) (string, bool, error) {
+	for {
+		target := filepath.Join(f.LocalPath, filepath.FromSlash(dir))
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return "", false, fmt.Errorf("failed to create extraction directory: %w", storageError(err))
+		}
+		err := os.Mkdir(target, os.ModePerm)
+		if err == nil {
+			return dir, false, nil
+		}
+		if !os.IsExist(err) {
+			return "", false, fmt.Errorf("failed to create extraction directory: %w", storageError(err))
+		}
+		info, err := os.Stat(target)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to check %s: %w", dir, err)
+		}
+		switch f.ConflictPolicy(dir) {
+		case OnConflictReject:
+			return "", false, fmt.Errorf("%w: %s", ErrFileExists, dir)
+		case OnConflictRename:
+			dir = f.GenerateUniqueName(dir)
+		default:
+			if !info.IsDir() {
+				return "", false, fmt.Errorf("%w: %s is a file", ErrFileExists, dir)
+			}
+			return dir, true, nil
+		}
+	}
+}
+
+// recordExtraction сохраняет итог распаковки в метаданных архива и в сессии.
+func (f *FileService) recordExtraction(name string, meta FileMeta, result *ExtractionResult) {
+	if stored, err := f.GetFileMeta(name); err == nil && stored != nil {
+		meta = *stored
+	}
+	meta.Extraction = result
+	if err := f.SaveFileMeta(name, meta); err != nil {
+		log.Printf("Failed to record extraction of %s: %v", name, err)
+	}
+	if f.Storage == nil || meta.SessionID == "" {
+		return
+	}
+	encoded, _ := json.Marshal(result)
+	if err := f.Storage.UpdateSessionFields(meta.SessionID, map[string]interface{}{"extraction": string(encoded)}); err != nil {
+		log.Printf("Failed to record extraction in session %s: %v", meta.SessionID, err)
+	}
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"BASProject/config"
 	"BASProject/internal/storage"
 	"BASProject/internal/utils"
 	"crypto/sha256"
@@ -11,27 +12,91 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 type FileService struct {
 	Storage         *storage.RedisClient
 	ChecksumService *utils.ChecksumService
 	LocalPath       string
+	Chunking        config.ChunkingConfig
+	// Envelope шифрует чанки и собранные файлы на диске; nil — шифрование выключено.
+	Envelope *utils.Envelope
+	// Progress публикует события прогресса для потоков /upload/{id}/events; nil — не публикует.
+	Progress *ProgressService
+	// Policies ограничивает допустимые типы файлов; пустые политики пропускают всё.
+	Policies config.FilePoliciesConfig
+	// MinFreeSpace — сколько байтов тома хранилища не отдаётся под загрузки.
+	MinFreeSpace int64
+	// Extraction ограничивает распаковку архивов; нулевые значения — ограничения по умолчанию.
+	Extraction config.ExtractionConfig
+	// Namespaces — пространства имён со своими корневыми каталогами внутри LocalPath.
+	Namespaces map[string]config.NamespaceConfig
+	// OnConflict — политика загрузки под занятым именем; пустая — OnConflictVersion.
+	OnConflict string
+	// Assembly — способ сборки новых сессий: AssemblyParts (по умолчанию) или AssemblyPreallocate.
+	Assembly string
+
+	// versionsMu упорядочивает перенос версий одного хранилища.
+	versionsMu sync.Mutex
+	// commitMu не даёт читателям увидеть пакет загрузок частично перенесённым.
+	commitMu sync.RWMutex
 }
 type IFileService interface {
 	FileExists(fileName string) bool
-	CalculateChunkSize(fileSize, MaxChunkSize int64) int64
+	CalculateChunkSize(fileSize, preferredSize int64) int64
 	SaveChunk(sessionID string, chunkID int, chunkData []byte) error
+	SaveChunkAt(sessionID string, offset int64, chunkData []byte) error
+	MissingChunks(hashes []string) ([]string, error)
+	StoreChunk(chunkData []byte) (string, bool, error)
+	LinkChunkAt(sessionID string, offset int64, hash string) (int64, error)
 	GetNextChunkID(sessionID string) (int, error)
 	ValidateChecksum(chunkData []byte, expectedChecksum string) bool
 	CalculateChecksum(chunkData []byte) string
+	CalculateFileChecksum(filePath string) (string, error)
 	AssembleChunks(sessionID string, outputFilePath string) error
 	DeleteChunks(sessionID string) error
 	ChunkExists(sessionID string, chunkID int) (bool, error)
 	GetStoragePath() (string, error)
+	ListFiles() ([]StoredFile, error)
+	IndexContent(fileHash string, filePath string) error
+	LinkContent(fileHash string, fileName string) (string, int, error)
+	OpenFile(name string) (FileReader, error)
+	SaveFileMeta(name string, meta FileMeta) error
+	GetFileMeta(name string) (*FileMeta, error)
+	CheckAssembledFile(fileName, filePath string) error
+	OpenThumbnail(name string, size int) (FileReader, *Thumbnail, error)
+	ExtractArchive(name, archivePath, dir string, meta FileMeta) (*ExtractionResult, error)
+	CheckConflict(name string) error
+	AssemblyPath(sessionID string) (string, error)
+	CommitFile(name, assembledPath string) (string, int, error)
+	ListVersions(name string) ([]FileVersion, error)
+	OpenVersion(name string, version int) (FileReader, error)
+	PromoteVersion(name string, version int) error
+	DeleteVersion(name string, version int) error
 }
 
+// StoredFile описывает собранный файл в хранилище.
+type StoredFile struct {
+	Name        string            `json:"name"`
+	Size        int64             `json:"size"`
+	ModTime     time.Time         `json:"mod_time"`
+	ContentType string            `json:"content_type,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Status      string            `json:"status,omitempty"`
+	Thumbnails  []Thumbnail       `json:"thumbnails,omitempty"`
+	// ExtractedFrom — архив, из которого распакован файл.
+	ExtractedFrom string `json:"extracted_from,omitempty"`
+	Namespace     string `json:"namespace,omitempty"`
+	// Version — номер текущей версии; прежние версии перечисляет ListVersions.
+	Version int `json:"version"`
+}
+
+var ErrFileNotFound = errors.New("file not found")
+
 func NewFileService(storage *storage.RedisClient, localPath string) *FileService {
 	if localPath == "" {
 		localPath = "data"
@@ -40,6 +105,7 @@ func NewFileService(storage *storage.RedisClient, localPath string) *FileService
 		Storage:         storage,
 		ChecksumService: utils.NewChecksumService(),
 		LocalPath:       localPath,
+		Chunking:        config.DefaultChunking(),
 	}
 }
 
@@ -50,27 +116,52 @@ func (f *FileService) FileExists(fileName string) bool {
 	return !errors.Is(err, os.ErrNotExist)
 }
 
-// Вычисление подходящего размера чанка в зависимости от размера файла
-func (f *FileService) CalculateChunkSize(fileSize, MaxChunkSize int64) int64 {
-	log.Printf("fileSize: %d, MaxChunkSize: %d", fileSize, MaxChunkSize)
-	chunkSize := int64(0)
-	if fileSize < 50*1024*1024 { // Меньше 50MB
-		chunkSize = 4 * 1024 * 1024 // 4MB
-	} else if fileSize < 500*1024*1024 { // Меньше 500MB
-		chunkSize = 8 * 1024 * 1024 // 8MB
-	} else {
-		chunkSize = 16 * 1024 * 1024 // Больше 500MB
+// Вычисление размера чанка: предложение клиента (preferredSize > 0) или уровень по размеру файла.
+// Результат всегда приводится к границам [min_size, max_size] из конфигурации.
+func (f *FileService) CalculateChunkSize(fileSize, preferredSize int64) int64 {
+	log.Printf("fileSize: %d, preferredSize: %d", fileSize, preferredSize)
+	chunkSize := int64(f.Chunking.DefaultSize)
+	if preferredSize > 0 {
+		chunkSize = preferredSize
+	} else if fileSize > 0 {
+		for _, tier := range f.Chunking.Tiers {
+			if tier.MaxFileSize == 0 || fileSize < int64(tier.MaxFileSize) {
+				chunkSize = int64(tier.ChunkSize)
+				break
+			}
+		}
+	}
+
+	if min := int64(f.Chunking.MinSize); chunkSize < min {
+		chunkSize = min
 	}
-	if MaxChunkSize > 0 && chunkSize > MaxChunkSize {
-		chunkSize = MaxChunkSize
+	if max := int64(f.Chunking.MaxSize); max > 0 && chunkSize > max {
+		chunkSize = max
 	}
 	return chunkSize
 }
 
-// Сохранение чанка
+// Сохранение чанка. Номер и размер чанка проверяются по геометрии сессии (ValidateChunk),
+// чтобы при сборке каждый чанк лёг точно на своё место.
 func (f *FileService) SaveChunk(sessionID string, chunkID int, chunkData []byte) error {
+	sessionData, err := f.sessionData(sessionID)
+	if err != nil {
+		return err
+	}
+	if chunkMode(sessionData) == ChunkModeOffset {
+		return ErrChunkModeMismatch
+	}
+	chunkSize, fileSize, err := chunkGeometry(sessionData)
+	if err != nil {
+		return err
+	}
+	if err := ValidateChunk(chunkID, int64(len(chunkData)), chunkSize, fileSize); err != nil {
+		return err
+	}
+	preallocated := isPreallocated(sessionData)
+
 	// Проверяем, существует ли чанк в Redis
-	ChunkExists, err := f.Storage.ChunkExists(sessionID, chunkID)
+	ChunkExists, err := f.chunkExists(sessionID, chunkID, preallocated)
 	if err != nil {
 		return fmt.Errorf("failed to check chunk existence: %w", err)
 	}
@@ -79,29 +170,49 @@ func (f *FileService) SaveChunk(sessionID string, chunkID int, chunkData []byte)
 		return ErrChunkAlreadyExists
 	}
 
+	// Тип файла определяется по первому чанку до записи на диск
+	if chunkID == 1 {
+		if err := f.checkFirstChunk(sessionID, chunkData); err != nil {
+			return err
+		}
+	}
+
 	log.Printf("Saving chunk %d for session %s", chunkID, sessionID)
-	// Сохраняем чанк на диск
-	filePath := filepath.Join(f.LocalPath, fmt.Sprintf("%s_%d.part", sessionID, chunkID))
+	if preallocated {
+		// Чанк записывается сразу на своё место в итоговом файле
+		if err := f.writePreallocated(sessionID, chunkID, chunkSize, chunkData); err != nil {
+			return err
+		}
+	} else {
+		// Сохраняем чанк на диск
+		filePath := filepath.Join(f.LocalPath, fmt.Sprintf("%s_%d.part", sessionID, chunkID))
 
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create chunk file: %w", err)
-	}
-	defer file.Close()
-	_, err = file.Write(chunkData)
-	if err != nil {
-		return fmt.Errorf("failed to write chunk chunkData: %w", err)
-	}
+		err = f.writeStored(filePath, chunkData)
+		if err != nil {
+			return fmt.Errorf("failed to write chunk chunkData: %w", err)
+		}
 
-	// Отмечаем чанк как загруженный в Redis
-	err = f.Storage.AddUploadedChunk(sessionID, chunkID)
-	if err != nil {
-		return fmt.Errorf("failed to mark chunk %d as uploaded: %w", chunkID, err)
+		// Отмечаем чанк как загруженный в Redis
+		err = f.Storage.AddUploadedChunk(sessionID, chunkID)
+		if err != nil {
+			return fmt.Errorf("failed to mark chunk %d as uploaded: %w", chunkID, err)
+		}
 	}
-	err = f.Storage.UpdateUploadedSize(sessionID, int64(len(chunkData)))
+	uploadedSize, err := f.Storage.UpdateUploadedSize(sessionID, int64(len(chunkData)))
 	if err != nil {
 		return fmt.Errorf("failed to mark chunk %d as uploaded: %w", chunkID, err)
 	}
+	if f.Progress != nil {
+		f.Progress.Publish(ProgressEvent{
+			Type:          ProgressChunk,
+			SessionID:     sessionID,
+			ChunkID:       chunkID,
+			Size:          int64(len(chunkData)),
+			UploadedSize:  uploadedSize,
+			FileSize:      fileSize,
+			RemainingSize: remaining(fileSize, uploadedSize),
+		})
+	}
 
 	log.Printf("Chunk %d for session %s saved successfully.", chunkID, sessionID)
 	return nil
@@ -114,6 +225,13 @@ func (f *FileService) GetNextChunkID(sessionID string) (int, error) {
 	if err != nil {
 		return 0, fmt.Errorf("failed to retrieve chunks: %w", err)
 	}
+	if sessionData, err := f.Storage.GetSessionData(sessionID); err == nil && isPreallocated(sessionData) {
+		bitmap, err := f.Storage.GetChunkBitmap(sessionID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get chunk bitmap: %w", err)
+		}
+		chunks = bitmapChunks(bitmap)
+	}
 
 	// Ищем максимальный существующий ID чанка
 	maxChunkID := -1
@@ -141,6 +259,16 @@ func (f *FileService) CalculateChecksum(chunkData []byte) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// CalculateFileChecksum вычисляет SHA-256 собранного файла.
+func (f *FileService) CalculateFileChecksum(filePath string) (string, error) {
+	file, err := f.openStored(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return f.ChecksumService.CalculateReaderChecksum(file)
+}
+
 // Сборка чанков в итоговый файл
 func (fs *FileService) AssembleChunks(sessionID string, outputFilePath string) error {
 	sessionData, err := fs.Storage.GetSessionData(sessionID)
@@ -153,11 +281,19 @@ func (fs *FileService) AssembleChunks(sessionID string, outputFilePath string) e
 		return fmt.Errorf("invalid file size in session data: %v", err)
 	}
 
+	if chunkMode(sessionData) == ChunkModeOffset {
+		return fs.assembleRanges(sessionID, fileSize, outputFilePath)
+	}
+
 	chunkSize, err := extractInt64(sessionData["chunk_size"])
 	if err != nil {
 		return fmt.Errorf("invalid chunk size in session data: %v", err)
 	}
 
+	if isPreallocated(sessionData) {
+		return fs.finishPreallocated(sessionID, fileSize, chunkSize, outputFilePath)
+	}
+
 	totalChunks := int((fileSize + chunkSize - 1) / chunkSize)
 
 	missingChunks := []int{}
@@ -172,26 +308,26 @@ func (fs *FileService) AssembleChunks(sessionID string, outputFilePath string) e
 		return fmt.Errorf("missing chunks: %v", missingChunks)
 	}
 
-	outputFile, err := os.Create(outputFilePath)
+	outputFile, err := fs.createStored(outputFilePath)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return fmt.Errorf("failed to create output file: %w", storageError(err))
 	}
 	defer outputFile.Close()
 
 	for i := 1; i <= totalChunks; i++ {
 		chunkFile := filepath.Join(fs.LocalPath, fmt.Sprintf("%s_%d.part", sessionID, i))
-		err := appendChunk(outputFile, chunkFile)
+		err := fs.appendChunk(outputFile, chunkFile)
 		if err != nil {
-			return fmt.Errorf("failed to append chunk %s: %w", chunkFile, err)
+			return fmt.Errorf("failed to append chunk %s: %w", chunkFile, storageError(err))
 		}
 	}
 
-	return nil
+	return storageError(outputFile.Close())
 }
 
 // Вспомогательная функция для записи чанка в выходной файл
-func appendChunk(outputFile *os.File, chunkFilePath string) error {
-	chunkFile, err := os.Open(chunkFilePath)
+func (f *FileService) appendChunk(outputFile io.Writer, chunkFilePath string) error {
+	chunkFile, err := f.openStored(chunkFilePath)
 	if err != nil {
 		return fmt.Errorf("failed to open chunk file %s: %w", chunkFilePath, err)
 	}
@@ -220,10 +356,21 @@ func (f *FileService) DeleteChunks(sessionID string) error {
 			return fmt.Errorf("failed to delete chunk file %s: %w", file, err)
 		}
 	}
-	return nil
+	return f.removePreallocated(sessionID)
 }
 
+// GenerateUniqueName предлагает свободное имя вида name(N).ext. Имя не занимается: между
+// проверкой и записью его может занять другой файл, поэтому вызывающий занимает его сам
+// атомарно (как extractionDir через os.Mkdir). Файлы хранилища получают такие имена
+// только в commitFile под versionsMu.
 func (f *FileService) GenerateUniqueName(fileName string) string {
+	f.versionsMu.Lock()
+	defer f.versionsMu.Unlock()
+	return f.uniqueName(fileName)
+}
+
+// uniqueName — GenerateUniqueName для вызывающего, который держит versionsMu.
+func (f *FileService) uniqueName(fileName string) string {
 	baseName := strings.TrimSuffix(fileName, filepath.Ext(fileName))
 	extension := filepath.Ext(fileName)
 
@@ -236,6 +383,55 @@ func (f *FileService) GenerateUniqueName(fileName string) string {
 }
 
 func (f *FileService) ChunkExists(sessionID string, chunkID int) (bool, error) {
+	sessionData, err := f.sessionData(sessionID)
+	if err != nil {
+		return false, err
+	}
+	// Чанк вне файла не загружен; ошибку с ожидаемым диапазоном сообщит SaveChunk
+	chunkSize, fileSize, err := chunkGeometry(sessionData)
+	if err != nil {
+		return false, err
+	}
+	if _, _, err := chunkLengthRange(chunkID, chunkSize, fileSize); err != nil {
+		return false, nil
+	}
+	return f.chunkExists(sessionID, chunkID, isPreallocated(sessionData))
+}
+
+// chunkGeometry возвращает размер чанка и размер файла сессии; размер отложенной сессии до завершения — 0.
+func chunkGeometry(sessionData map[string]interface{}) (int64, int64, error) {
+	chunkSize, err := extractInt64(sessionData["chunk_size"])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid chunk size in session data: %v", err)
+	}
+	fileSize, err := extractInt64(sessionData["file_size"])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid file size in session data: %v", err)
+	}
+	return chunkSize, fileSize, nil
+}
+
+// sessionData возвращает данные существующей сессии; ErrSessionNotFound — сессии нет.
+func (f *FileService) sessionData(sessionID string) (map[string]interface{}, error) {
+	exists, err := f.Storage.SessionExists(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check session existence: %w", err)
+	}
+	if exists == 0 {
+		return nil, ErrSessionNotFound
+	}
+	sessionData, err := f.Storage.GetSessionData(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session data: %w", err)
+	}
+	return sessionData, nil
+}
+
+// chunkExists проверяет отметку чанка: в битовой карте для выделенного файла, иначе в множестве чанков.
+func (f *FileService) chunkExists(sessionID string, chunkID int, preallocated bool) (bool, error) {
+	if preallocated {
+		return f.Storage.ChunkBitSet(sessionID, chunkID)
+	}
 	return f.Storage.ChunkExists(sessionID, chunkID)
 }
 
@@ -245,3 +441,78 @@ func (f *FileService) GetStoragePath() (string, error) {
 	}
 	return f.LocalPath, nil
 }
+
+// ListFiles возвращает собранные файлы хранилища; временные .part файлы и хранилище чанков пропускаются.
+func (f *FileService) ListFiles() ([]StoredFile, error) {
+	f.commitMu.RLock()
+	defer f.commitMu.RUnlock()
+
+	files := []StoredFile{}
+	err := filepath.WalkDir(f.LocalPath, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(f.LocalPath, path); err == nil && d.IsDir() && isInternalPath(rel) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || strings.HasSuffix(d.Name(), ".part") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size, err := f.storedSize(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(f.LocalPath, path)
+		if err != nil {
+			return err
+		}
+		file := StoredFile{Name: filepath.ToSlash(rel), Size: size, ModTime: info.ModTime()}
+		file.Namespace = f.NamespaceOf(file.Name)
+		file.Version = f.currentVersion(file.Name)
+		if meta, err := f.GetFileMeta(file.Name); err != nil {
+			log.Printf("Failed to read metadata of %s: %v", file.Name, err)
+		} else if meta != nil {
+			file.ContentType, file.Metadata, file.Status, file.Thumbnails = meta.ContentType, meta.Metadata, meta.Status, meta.Thumbnails
+			file.ExtractedFrom = meta.ExtractedFrom
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	return files, nil
+}
+
+// OpenFile открывает собранный файл по имени относительно хранилища.
+func (f *FileService) OpenFile(name string) (FileReader, error) {
+	clean, err := storedKey(name)
+	if err != nil {
+		return nil, err
+	}
+	f.commitMu.RLock()
+	defer f.commitMu.RUnlock()
+	// Файл отдаётся только после успешной обработки конвейером
+	if meta, err := f.GetFileMeta(filepath.ToSlash(clean)); err != nil {
+		return nil, fmt.Errorf("failed to read file metadata: %w", err)
+	} else if meta != nil && !meta.Available() {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotAvailable, meta.Status)
+	}
+	path := filepath.Join(f.LocalPath, clean)
+	if info, err := os.Stat(path); errors.Is(err, os.ErrNotExist) || (err == nil && info.IsDir()) {
+		return nil, ErrFileNotFound
+	}
+	file, err := f.openStored(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	return file, nil
+}
@@ -0,0 +1,474 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Виды расхождений между Redis и файлами чанков на диске.
+const (
+	FsckMissingPart    = "missing_part"     // чанк отмечен в Redis, файла нет
+	FsckUntrackedPart  = "untracked_part"   // файл есть, в Redis чанк не отмечен
+	FsckOrphanPart     = "orphan_part"      // файл чанка сессии, которой нет в Redis
+	FsckWrongChunkSize = "wrong_chunk_size" // размер части не соответствует сессии
+	FsckSizeMismatch   = "size_mismatch"    // uploaded_size не равен сумме частей
+	FsckStaleIndex     = "stale_index"      // сессия в индексе, но её данных нет
+)
+
+// fsckGracePeriod — части моложе этого возраста могут ещё записываться
+// (файл создаётся до отметки в Redis), поэтому не считаются лишними.
+const fsckGracePeriod = 10 * time.Minute
+
+// FsckIssue — найденное расхождение и результат его исправления.
+type FsckIssue struct {
+	SessionID   string `json:"session_id"`
+	Kind        string `json:"kind"`
+	Part        string `json:"part,omitempty"`
+	Detail      string `json:"detail"`
+	Repaired    bool   `json:"repaired"`
+	RepairError string `json:"repair_error,omitempty"`
+}
+
+// FsckReport — итог проверки согласованности.
+type FsckReport struct {
+	Repair     bool        `json:"repair"`
+	Sessions   int         `json:"sessions"`
+	Parts      int         `json:"parts"`
+	Issues     []FsckIssue `json:"issues"`
+	Repaired   int         `json:"repaired"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+}
+
+// fsckPart — файл чанка в LocalPath.
+type fsckPart struct {
+	name     string
+	path     string
+	chunkID  int
+	offset   int64
+	byOffset bool
+	// preallocated — выделенный файл сессии в каталоге .processing, а не часть .part.
+	preallocated bool
+	modTime      time.Time
+}
+
+// fsckRun накапливает расхождения одной проверки.
+type fsckRun struct {
+	s      *SessionService
+	report *FsckReport
+	now    time.Time
+}
+
+// Fsck сверяет сессии в Redis (множества чанков, диапазоны и uploaded_size) с файлами .part на диске.
+// С repair расхождения исправляются так, чтобы клиент мог докачать недостающее:
+// отметки без файлов и части неверного размера удаляются, лишние части стираются,
+// uploaded_size пересчитывается, устаревшие записи индекса удаляются.
+func (s *SessionService) Fsck(repair bool) (*FsckReport, error) {
+	run := &fsckRun{s: s, now: time.Now(), report: &FsckReport{Repair: repair, Issues: []FsckIssue{}, StartedAt: time.Now().UTC()}}
+
+	partsBySession, err := s.FileService.scanParts()
+	if err != nil {
+		return nil, err
+	}
+	indexed, err := s.Storage.ListSessionIDs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	inIndex := map[string]bool{}
+	ids := []string{}
+	for _, id := range indexed {
+		inIndex[id] = true
+		ids = append(ids, id)
+	}
+	for id, parts := range partsBySession {
+		run.report.Parts += len(parts)
+		if !inIndex[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		exists, err := s.Storage.SessionExists(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check session existence: %w", err)
+		}
+		if exists == 0 {
+			run.checkOrphan(id, inIndex[id], partsBySession[id])
+			continue
+		}
+		run.report.Sessions++
+		check := func() error { return run.checkSession(id, partsBySession[id]) }
+		if repair {
+			err = s.FileService.withSessionLock(id, check)
+		} else {
+			err = check()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("session %s: %w", id, err)
+		}
+	}
+
+	for _, issue := range run.report.Issues {
+		if issue.Repaired {
+			run.report.Repaired++
+		}
+	}
+	run.report.FinishedAt = time.Now().UTC()
+	return run.report, nil
+}
+
+// issue записывает расхождение; fix вызывается только в режиме исправления.
+func (r *fsckRun) issue(sessionID, kind, part, detail string, fix func() error) {
+	issue := FsckIssue{SessionID: sessionID, Kind: kind, Part: part, Detail: detail}
+	if r.report.Repair && fix != nil {
+		if err := fix(); err != nil {
+			issue.RepairError = err.Error()
+		} else {
+			issue.Repaired = true
+			log.Printf("fsck: repaired %s in session %s %s", kind, sessionID, part)
+		}
+	}
+	r.report.Issues = append(r.report.Issues, issue)
+}
+
+func (r *fsckRun) recent(part fsckPart) bool {
+	return r.now.Sub(part.modTime) < fsckGracePeriod
+}
+
+// checkOrphan обрабатывает сессию, данных которой в Redis нет.
+func (r *fsckRun) checkOrphan(sessionID string, indexed bool, parts []fsckPart) {
+	if indexed {
+		r.issue(sessionID, FsckStaleIndex, "", "session is listed in the index but has no data", func() error {
+			return r.s.Storage.RemoveFromSessionIndex(sessionID)
+		})
+	}
+	for _, part := range parts {
+		if r.recent(part) {
+			continue
+		}
+		r.issue(sessionID, FsckOrphanPart, part.name, "chunk file belongs to no session", removePart(part))
+	}
+}
+
+func (r *fsckRun) checkSession(sessionID string, parts []fsckPart) error {
+	sessionData, err := r.s.Storage.GetSessionData(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve session data: %w", err)
+	}
+	if sessionData["status"] == "completed" && len(parts) == 0 {
+		// Файл собран, части удалены после сборки
+		return nil
+	}
+
+	var file *fsckPart
+	chunkParts := []fsckPart{}
+	for _, part := range parts {
+		if part.preallocated {
+			file = &part
+			continue
+		}
+		chunkParts = append(chunkParts, part)
+	}
+	if file != nil && !isPreallocated(sessionData) && !r.recent(*file) {
+		r.issue(sessionID, FsckUntrackedPart, file.name, "preallocated file in a session that stores chunks as parts", removePart(*file))
+	}
+
+	var uploaded int64
+	switch {
+	case chunkMode(sessionData) == ChunkModeOffset:
+		uploaded, err = r.checkRanges(sessionID, chunkParts)
+	case isPreallocated(sessionData):
+		uploaded, err = r.checkPreallocated(sessionID, sessionData, file, chunkParts)
+	default:
+		uploaded, err = r.checkChunks(sessionID, sessionData, chunkParts)
+	}
+	if err != nil {
+		return err
+	}
+
+	recorded, _ := extractInt64(sessionData["uploaded_size"])
+	if recorded != uploaded {
+		r.issue(sessionID, FsckSizeMismatch, "", fmt.Sprintf("uploaded_size is %d, valid parts hold %d bytes", recorded, uploaded), func() error {
+			return r.s.Storage.SetUploadedSize(sessionID, uploaded)
+		})
+	}
+	return nil
+}
+
+// checkChunks проверяет сессию с чанками фиксированного размера и возвращает объём корректных частей.
+func (r *fsckRun) checkChunks(sessionID string, sessionData map[string]interface{}, parts []fsckPart) (int64, error) {
+	chunks, err := r.s.Storage.GetChunks(sessionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve chunks: %w", err)
+	}
+	fileSize, _ := extractInt64(sessionData["file_size"])
+	chunkSize, err := extractInt64(sessionData["chunk_size"])
+	if err != nil || chunkSize <= 0 {
+		return 0, fmt.Errorf("invalid chunk size in session data")
+	}
+
+	tracked := map[int]bool{}
+	lastChunk := 0
+	for _, chunkID := range chunks {
+		tracked[chunkID] = true
+		lastChunk = max(lastChunk, chunkID)
+	}
+	totalChunks := 0
+	if fileSize > 0 {
+		totalChunks = int((fileSize + chunkSize - 1) / chunkSize)
+		lastChunk = totalChunks
+	}
+
+	onDisk := map[int]fsckPart{}
+	for _, part := range parts {
+		if part.byOffset {
+			r.issue(sessionID, FsckUntrackedPart, part.name, "offset-addressed part in a session with fixed chunks", removePart(part))
+			continue
+		}
+		onDisk[part.chunkID] = part
+	}
+
+	var uploaded int64
+	for _, chunkID := range chunks {
+		chunkID := chunkID
+		part, ok := onDisk[chunkID]
+		if !ok {
+			r.issue(sessionID, FsckMissingPart, fmt.Sprintf("%s_%d.part", sessionID, chunkID), "chunk is marked as uploaded but its file is missing", func() error {
+				return r.s.Storage.RemoveUploadedChunk(sessionID, chunkID)
+			})
+			continue
+		}
+
+		size, err := r.s.FileService.storedSize(part.path)
+		expected := chunkSize
+		if chunkID == lastChunk && fileSize > 0 {
+			expected = fileSize - int64(totalChunks-1)*chunkSize
+		}
+		var problem string
+		switch {
+		case err != nil:
+			problem = fmt.Sprintf("part is unreadable: %v", err)
+		case chunkID < 1 || (totalChunks > 0 && chunkID > totalChunks):
+			problem = fmt.Sprintf("chunk %d is outside of 1..%d", chunkID, totalChunks)
+		case chunkID == lastChunk && fileSize == 0 && (size == 0 || size > chunkSize):
+			problem = fmt.Sprintf("last chunk has %d bytes, expected 1..%d", size, chunkSize)
+		case (chunkID != lastChunk || fileSize > 0) && size != expected:
+			problem = fmt.Sprintf("part has %d bytes, expected %d", size, expected)
+		}
+		if problem != "" {
+			r.issue(sessionID, FsckWrongChunkSize, part.name, problem, func() error {
+				if err := removePart(part)(); err != nil {
+					return err
+				}
+				return r.s.Storage.RemoveUploadedChunk(sessionID, chunkID)
+			})
+			continue
+		}
+		uploaded += size
+	}
+
+	for chunkID, part := range onDisk {
+		if tracked[chunkID] || r.recent(part) {
+			continue
+		}
+		r.issue(sessionID, FsckUntrackedPart, part.name, "chunk file is not marked as uploaded", removePart(part))
+	}
+	return uploaded, nil
+}
+
+// checkRanges проверяет сессию с диапазонами произвольного размера.
+func (r *fsckRun) checkRanges(sessionID string, parts []fsckPart) (int64, error) {
+	ranges, err := r.s.Storage.GetUploadedRanges(sessionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get uploaded ranges: %w", err)
+	}
+
+	onDisk := map[int64]fsckPart{}
+	for _, part := range parts {
+		if !part.byOffset {
+			r.issue(sessionID, FsckUntrackedPart, part.name, "numbered part in a session with offset-addressed chunks", removePart(part))
+			continue
+		}
+		onDisk[part.offset] = part
+	}
+
+	var uploaded int64
+	tracked := map[int64]bool{}
+	for _, rng := range ranges {
+		rng := rng
+		tracked[rng.Offset] = true
+		part, ok := onDisk[rng.Offset]
+		if !ok {
+			r.issue(sessionID, FsckMissingPart, filepath.Base(offsetPartPath(r.s.FileService.LocalPath, sessionID, rng.Offset)), "range is marked as uploaded but its file is missing", func() error {
+				return r.s.Storage.RemoveUploadedRange(sessionID, rng.Offset, rng.Length)
+			})
+			continue
+		}
+		size, err := r.s.FileService.storedSize(part.path)
+		if err != nil || size != rng.Length {
+			detail := fmt.Sprintf("part has %d bytes, range length is %d", size, rng.Length)
+			if err != nil {
+				detail = fmt.Sprintf("part is unreadable: %v", err)
+			}
+			r.issue(sessionID, FsckWrongChunkSize, part.name, detail, func() error {
+				if err := removePart(part)(); err != nil {
+					return err
+				}
+				return r.s.Storage.RemoveUploadedRange(sessionID, rng.Offset, rng.Length)
+			})
+			continue
+		}
+		uploaded += size
+	}
+
+	for offset, part := range onDisk {
+		if tracked[offset] || r.recent(part) {
+			continue
+		}
+		r.issue(sessionID, FsckUntrackedPart, part.name, "range file is not marked as uploaded", removePart(part))
+	}
+	return uploaded, nil
+}
+
+// checkPreallocated проверяет сессию, чанки которой пишутся в выделенный файл: файл должен
+// иметь размер файла сессии, объём загруженного считается по битовой карте.
+func (r *fsckRun) checkPreallocated(sessionID string, sessionData map[string]interface{}, file *fsckPart, parts []fsckPart) (int64, error) {
+	for _, part := range parts {
+		if r.recent(part) {
+			continue
+		}
+		r.issue(sessionID, FsckUntrackedPart, part.name, "chunk file in a session that writes chunks into a preallocated file", removePart(part))
+	}
+
+	fileSize, _ := extractInt64(sessionData["file_size"])
+	chunkSize, err := extractInt64(sessionData["chunk_size"])
+	if err != nil || chunkSize <= 0 || fileSize <= 0 {
+		return 0, fmt.Errorf("invalid chunk size or file size in session data")
+	}
+	size := int64(-1)
+	if file != nil {
+		if info, err := os.Stat(file.path); err == nil {
+			size = info.Size()
+		}
+	}
+	if size != fileSize {
+		detail := "preallocated file is missing"
+		if size >= 0 {
+			detail = fmt.Sprintf("preallocated file has %d bytes, expected %d", size, fileSize)
+		}
+		r.issue(sessionID, FsckMissingPart, filepath.Base(r.s.FileService.preallocatedPath(sessionID)), detail, func() error {
+			// Записанные чанки потеряны: файл выделяется заново, и клиент загружает их повторно
+			allocated, err := r.s.FileService.preallocate(sessionID, fileSize)
+			if err != nil {
+				return err
+			}
+			if allocated {
+				r.s.ReleaseReservation(sessionID)
+			}
+			return r.s.Storage.DeleteChunkBitmap(sessionID)
+		})
+		return 0, nil
+	}
+
+	totalChunks := int((fileSize + chunkSize - 1) / chunkSize)
+	chunks, err := r.s.FileService.preallocatedChunks(sessionID, totalChunks)
+	if err != nil {
+		return 0, err
+	}
+	var uploaded int64
+	for _, chunkID := range chunks {
+		length, _ := ChunkLength(chunkID, chunkSize, fileSize)
+		uploaded += length
+	}
+	return uploaded, nil
+}
+
+func removePart(part fsckPart) func() error {
+	return func() error {
+		if err := os.Remove(part.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+}
+
+// scanParts находит файлы чанков в LocalPath и группирует их по сессиям.
+func (f *FileService) scanParts() (map[string][]fsckPart, error) {
+	entries, err := os.ReadDir(f.LocalPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage directory: %w", err)
+	}
+	parts := map[string][]fsckPart{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		sessionID, part, ok := parsePartName(entry.Name())
+		if !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		part.path = filepath.Join(f.LocalPath, part.name)
+		part.modTime = info.ModTime()
+		parts[sessionID] = append(parts[sessionID], part)
+	}
+
+	// Выделенные файлы сессий лежат в .processing под именами upload-<id>.tmp
+	entries, err = os.ReadDir(filepath.Join(f.LocalPath, processingDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read processing directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		sessionID, ok := strings.CutSuffix(strings.TrimPrefix(name, "upload-"), ".tmp")
+		if !entry.Type().IsRegular() || !strings.HasPrefix(name, "upload-") || !ok || sessionID == "" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		parts[sessionID] = append(parts[sessionID], fsckPart{
+			name:         name,
+			path:         filepath.Join(f.LocalPath, processingDir, name),
+			preallocated: true,
+			modTime:      info.ModTime(),
+		})
+	}
+	return parts, nil
+}
+
+// parsePartName разбирает имена <id>_<n>.part и <id>_o<offset>.part.
+func parsePartName(name string) (string, fsckPart, bool) {
+	base, ok := strings.CutSuffix(name, ".part")
+	sep := strings.LastIndex(base, "_")
+	if !ok || sep <= 0 {
+		return "", fsckPart{}, false
+	}
+	sessionID, suffix := base[:sep], base[sep+1:]
+	part := fsckPart{name: name}
+	if offset, ok := strings.CutPrefix(suffix, "o"); ok {
+		n, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil || n < 0 {
+			return "", fsckPart{}, false
+		}
+		part.offset, part.byOffset = n, true
+		return sessionID, part, true
+	}
+	n, err := strconv.Atoi(suffix)
+	if err != nil {
+		return "", fsckPart{}, false
+	}
+	part.chunkID = n
+	return sessionID, part, true
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"BASProject/internal/utils"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRewrapRunning      = errors.New("rewrap is already running")
+	ErrEncryptionDisabled = errors.New("encryption at rest is not enabled")
+)
+
+// RewrapProgress — состояние перешифровки ключей данных активной версией мастер-ключа.
+type RewrapProgress struct {
+	State      string    `json:"state"` // idle, running, completed, failed
+	ActiveKey  string    `json:"active_key"`
+	Total      int       `json:"total"`
+	Processed  int       `json:"processed"`
+	Rewrapped  int       `json:"rewrapped"`
+	Skipped    int       `json:"skipped"`
+	Failed     int       `json:"failed"`
+	Errors     []string  `json:"errors"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+}
+
+// maxRewrapErrors ограничивает число ошибок, сохраняемых в RewrapProgress.
+const maxRewrapErrors = 100
+
+// KeyRotationService перешифровывает ключи данных всех файлов хранилища в фоне.
+type KeyRotationService struct {
+	FileService *FileService
+
+	mu       sync.Mutex
+	progress RewrapProgress
+}
+
+func NewKeyRotationService(fileService *FileService) *KeyRotationService {
+	return &KeyRotationService{
+		FileService: fileService,
+		progress:    RewrapProgress{State: "idle", Errors: []string{}},
+	}
+}
+
+// Progress возвращает копию текущего состояния перешифровки.
+func (k *KeyRotationService) Progress() RewrapProgress {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	progress := k.progress
+	progress.Errors = append([]string{}, k.progress.Errors...)
+	return progress
+}
+
+// StartRewrap запускает перешифровку ключей данных в фоне и сразу возвращает начальное состояние.
+func (k *KeyRotationService) StartRewrap() (RewrapProgress, error) {
+	envelope := k.FileService.Envelope
+	if envelope == nil {
+		return RewrapProgress{}, ErrEncryptionDisabled
+	}
+
+	k.mu.Lock()
+	if k.progress.State == "running" {
+		k.mu.Unlock()
+		return k.Progress(), ErrRewrapRunning
+	}
+	k.progress = RewrapProgress{State: "running", ActiveKey: envelope.ActiveKey(), Errors: []string{}, StartedAt: time.Now()}
+	k.mu.Unlock()
+
+	go k.run()
+	return k.Progress(), nil
+}
+
+func (k *KeyRotationService) run() {
+	paths, err := k.FileService.encryptedCandidates()
+	if err != nil {
+		k.update(func(p *RewrapProgress) {
+			p.State = "failed"
+			p.Errors = append(p.Errors, err.Error())
+			p.FinishedAt = time.Now()
+		})
+		return
+	}
+	k.update(func(p *RewrapProgress) { p.Total = len(paths) })
+	log.Printf("Rewrapping data keys of %d files with master key %s", len(paths), k.FileService.Envelope.ActiveKey())
+
+	for _, path := range paths {
+		changed, err := k.FileService.RewrapFile(path)
+		k.update(func(p *RewrapProgress) {
+			p.Processed++
+			switch {
+			case err != nil:
+				p.Failed++
+				if len(p.Errors) < maxRewrapErrors {
+					p.Errors = append(p.Errors, err.Error())
+				}
+			case changed:
+				p.Rewrapped++
+			default:
+				p.Skipped++
+			}
+		})
+	}
+
+	k.update(func(p *RewrapProgress) {
+		p.State = "completed"
+		if p.Failed > 0 {
+			p.State = "failed"
+		}
+		p.FinishedAt = time.Now()
+		log.Printf("Rewrap finished: %d rewrapped, %d skipped, %d failed", p.Rewrapped, p.Skipped, p.Failed)
+	})
+}
+
+func (k *KeyRotationService) update(fn func(p *RewrapProgress)) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	fn(&k.progress)
+}
+
+// encryptedCandidates перечисляет все файлы хранилища, включая чанки и хранилище чанков.
+func (f *FileService) encryptedCandidates() ([]string, error) {
+	paths := []string{}
+	err := filepath.WalkDir(f.LocalPath, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && !strings.HasSuffix(d.Name(), ".tmp") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage files: %w", err)
+	}
+	return paths, nil
+}
+
+// RewrapFile заменяет заголовок зашифрованного файла ключом данных, обёрнутым активной
+// версией мастер-ключа. Содержимое не перешифровывается; время изменения сохраняется,
+// чтобы не инвалидировать индекс содержимого. Возвращает false для незашифрованных файлов
+// и файлов, уже зашифрованных активной версией.
+func (f *FileService) RewrapFile(path string) (bool, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	if !utils.IsEncrypted(file) {
+		return false, nil
+	}
+
+	header, oldLength, err := f.Envelope.Rewrap(file)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+	if header == nil {
+		return false, nil
+	}
+
+	// Заголовок никогда не переписывается на месте: сбой посреди записи оставил бы заголовок,
+	// который не разворачивается ни одной версией ключа, и файл был бы потерян
+	if err := replaceHeader(file, path, info, header, oldLength); err != nil {
+		return false, err
+	}
+
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		return true, fmt.Errorf("%s: failed to restore modification time: %w", path, err)
+	}
+	return true, nil
+}
+
+// replaceHeader записывает новый заголовок и прежнее зашифрованное содержимое во временный файл
+// и атомарно подменяет им исходный. Жёсткие ссылки на исходный файл сохраняют прежний заголовок
+// и перешифровываются отдельно, когда до них доходит обход хранилища.
+func replaceHeader(file *os.File, path string, info os.FileInfo, header []byte, oldLength int64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(header)
+	if err == nil {
+		_, err = io.Copy(tmp, io.NewSectionReader(file, oldLength, info.Size()-oldLength))
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: failed to write rewrapped copy: %w", path, err)
+	}
+
+	// Файл, изменившийся во время копирования, ещё пишется — оставляем его до следующего запуска
+	if current, err := os.Stat(path); err != nil || current.Size() != info.Size() || !current.ModTime().Equal(info.ModTime()) {
+		return fmt.Errorf("%s: file changed during rewrap", path)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("%s: failed to replace file: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"unicode"
+)
+
+// Ограничения пользовательских метаданных: ключи передаются в заголовках X-Meta-<key>
+// при скачивании, поэтому допускаются только символы, безопасные для имён заголовков.
+const (
+	MaxMetadataKeys        = 32
+	MaxMetadataKeyLength   = 64
+	MaxMetadataValueLength = 1024
+	MaxMetadataSize        = 8 << 10
+	MaxContentTypeLength   = 255
+)
+
+var ErrInvalidMetadata = errors.New("invalid file metadata")
+
+// FileMeta — тип содержимого и метаданные, сохраняемые с сессией и собранным файлом.
+type FileMeta struct {
+	ContentType string            `json:"content_type,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	SessionID   string            `json:"session_id,omitempty"`
+	FileHash    string            `json:"file_hash,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	// Status — состояние после конвейера обработки, Location — путь в карантине.
+	Status     string             `json:"status,omitempty"`
+	Processing []ProcessorOutcome `json:"processing,omitempty"`
+	Location   string             `json:"location,omitempty"`
+	// Thumbnails — уменьшенные копии изображения, созданные обработчиком thumbnail.
+	Thumbnails []Thumbnail `json:"thumbnails,omitempty"`
+	// Extraction — итог распаковки архива; ExtractedFrom — архив, из которого распакован файл.
+	Extraction    *ExtractionResult `json:"extraction,omitempty"`
+	ExtractedFrom string            `json:"extracted_from,omitempty"`
+}
+
+// Available сообщает, что файл можно отдавать: конвейер пройден или не запускался.
+func (m FileMeta) Available() bool {
+	return m.Status == "" || m.Status == FileStatusAvailable
+}
+
+// Empty сообщает, что о файле нечего хранить: не заполнено ни одно сохраняемое поле.
+// Запись без пользовательских полей всё равно нужна, если в ней есть сессия, хеш или владелец.
+func (m FileMeta) Empty() bool {
+	return m.ContentType == "" && len(m.Metadata) == 0 && m.SessionID == "" && m.FileHash == "" && m.Owner == "" &&
+		m.Status == "" && len(m.Processing) == 0 && m.Location == "" && len(m.Thumbnails) == 0 &&
+		m.Extraction == nil && m.ExtractedFrom == ""
+}
+
+// ValidateFileMeta проверяет тип содержимого и метаданные на соответствие ограничениям.
+func ValidateFileMeta(contentType string, metadata map[string]string) error {
+	if contentType != "" {
+		if len(contentType) > MaxContentTypeLength {
+			return fmt.Errorf("%w: content_type is longer than %d bytes", ErrInvalidMetadata, MaxContentTypeLength)
+		}
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return fmt.Errorf("%w: content_type %q is not a valid media type", ErrInvalidMetadata, contentType)
+		}
+	}
+	if len(metadata) > MaxMetadataKeys {
+		return fmt.Errorf("%w: at most %d metadata keys are allowed", ErrInvalidMetadata, MaxMetadataKeys)
+	}
+	total := 0
+	for key, value := range metadata {
+		if key == "" || len(key) > MaxMetadataKeyLength || strings.IndexFunc(key, invalidMetadataKeyRune) >= 0 {
+			return fmt.Errorf("%w: key %q must be 1-%d letters, digits, '-', '_' or '.'", ErrInvalidMetadata, key, MaxMetadataKeyLength)
+		}
+		if len(value) > MaxMetadataValueLength {
+			return fmt.Errorf("%w: value of %q is longer than %d bytes", ErrInvalidMetadata, key, MaxMetadataValueLength)
+		}
+		if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+			return fmt.Errorf("%w: value of %q contains control characters", ErrInvalidMetadata, key)
+		}
+		total += len(key) + len(value)
+	}
+	if total > MaxMetadataSize {
+		return fmt.Errorf("%w: metadata takes %d bytes, at most %d are allowed", ErrInvalidMetadata, total, MaxMetadataSize)
+	}
+	return nil
+}
+
+func invalidMetadataKeyRune(r rune) bool {
+	return !(r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.'))
+}
+
+// setSessionFileMeta сохраняет тип содержимого и метаданные в данных сессии.
+func setSessionFileMeta(sessionData map[string]interface{}, params SessionParams) {
+	if params.ContentType != "" {
+		sessionData["content_type"] = params.ContentType
+	}
+	if len(params.Metadata) > 0 {
+		encoded, _ := json.Marshal(params.Metadata)
+		sessionData["metadata"] = string(encoded)
+	}
+	if params.Extract {
+		sessionData["extract"] = true
+		if params.ExtractDir != "" {
+			sessionData["extract_dir"] = params.ExtractDir
+		}
+	}
+}
+
+// sessionFileMeta читает тип содержимого и метаданные из данных сессии.
+func sessionFileMeta(sessionData map[string]interface{}) FileMeta {
+	meta := FileMeta{}
+	meta.ContentType, _ = sessionData["content_type"].(string)
+	meta.Owner, _ = sessionData["owner"].(string)
+	if encoded, ok := sessionData["metadata"].(string); ok && encoded != "" {
+		if err := json.Unmarshal([]byte(encoded), &meta.Metadata); err != nil {
+			meta.Metadata = nil
+		}
+	}
+	return meta
+}
+
+// addFileMeta дополняет ответ о сессии владельцем, типом содержимого и метаданными, если они заданы.
+func addFileMeta(target map[string]interface{}, sessionData map[string]interface{}) {
+	meta := sessionFileMeta(sessionData)
+	if meta.Owner != "" {
+		target["owner"] = meta.Owner
+	}
+	if namespace, _ := sessionData["namespace"].(string); namespace != "" {
+		target["namespace"] = namespace
+	}
+	if batchID, _ := sessionData["batch_id"].(string); batchID != "" {
+		target["batch_id"] = batchID
+	}
+	if meta.ContentType != "" {
+		target["content_type"] = meta.ContentType
+	}
+	if len(meta.Metadata) > 0 {
+		target["metadata"] = meta.Metadata
+	}
+	if extract, _ := sessionData["extract"].(string); extract == "true" {
+		target["extract"] = true
+		if dir, _ := sessionData["extract_dir"].(string); dir != "" {
+			target["extract_dir"] = dir
+		}
+	}
+	if encoded, ok := sessionData["extraction"].(string); ok && encoded != "" {
+		extraction := &ExtractionResult{}
+		if err := json.Unmarshal([]byte(encoded), extraction); err == nil {
+			target["extraction"] = extraction
+		}
+	}
+	addProcessingStatus(target, sessionData)
+}
+
+// SaveFileMeta сохраняет тип содержимого и метаданные собранного файла name.
+// Пустые метаданные удаляют запись, чтобы файл не унаследовал данные прежнего файла с тем же именем.
+func (f *FileService) SaveFileMeta(name string, meta FileMeta) error {
+	if f.Storage == nil {
+		return nil
+	}
+	if meta.Empty() {
+		return f.Storage.DeleteFileMeta(name)
+	}
+	encoded, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode file metadata: %w", err)
+	}
+	return f.Storage.SaveFileMeta(name, encoded)
+}
+
+// GetFileMeta возвращает метаданные собранного файла; nil — метаданных нет.
+func (f *FileService) GetFileMeta(name string) (*FileMeta, error) {
+	if f.Storage == nil {
+		return nil, nil
+	}
+	encoded, err := f.Storage.GetFileMeta(name)
+	if err != nil || encoded == nil {
+		return nil, err
+	}
+	meta := &FileMeta{}
+	if err := json.Unmarshal(encoded, meta); err != nil {
+		return nil, fmt.Errorf("failed to decode file metadata: %w", err)
+	}
+	return meta, nil
+}
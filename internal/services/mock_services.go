@@ -1,15 +1,39 @@
 package services
 
-import "errors"
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
 
 // FileServiceMock — структура для мокирования IFileService в тестах.
 
 type FileServiceMock struct {
 	ValidateChecksumFunc func(data []byte, checksum string) bool
 	SaveChunkFunc        func(sessionID string, chunkID int, data []byte) error
+	SaveChunkAtFunc      func(sessionID string, offset int64, data []byte) error
 	AssembleChunksFunc   func(sessionID string, outputFilePath string) error
 	DeleteChunksFunc     func(sessionID string) error
 	ChunkExistsFunc      func(sessionID string, chunkID int) (bool, error)
+	FileChecksumFunc     func(filePath string) (string, error)
+	ListFilesFunc        func() ([]StoredFile, error)
+	OpenFileFunc         func(name string) (FileReader, error)
+	IndexContentFunc     func(fileHash string, filePath string) error
+	MissingChunksFunc    func(hashes []string) ([]string, error)
+	StoreChunkFunc       func(chunkData []byte) (string, bool, error)
+	LinkChunkAtFunc      func(sessionID string, offset int64, hash string) (int64, error)
+	LinkContentFunc      func(fileHash string, fileName string) (string, int, error)
+	SaveFileMetaFunc     func(name string, meta FileMeta) error
+	GetFileMetaFunc      func(name string) (*FileMeta, error)
+	CheckAssembledFunc   func(fileName, filePath string) error
+	OpenThumbnailFunc    func(name string, size int) (FileReader, *Thumbnail, error)
+	ExtractArchiveFunc   func(name, archivePath, dir string, meta FileMeta) (*ExtractionResult, error)
+	CheckConflictFunc    func(name string) error
+	CommitFileFunc       func(name, assembledPath string) (string, int, error)
+	ListVersionsFunc     func(name string) ([]FileVersion, error)
+	OpenVersionFunc      func(name string, version int) (FileReader, error)
+	PromoteVersionFunc   func(name string, version int) error
+	DeleteVersionFunc    func(name string, version int) error
 }
 
 // Реализация методов интерфейса IFileService
@@ -30,7 +54,7 @@ func (m *FileServiceMock) ChunkExists(sessionID string, chunkID int) (bool, erro
 	return false, nil
 }
 
-func (m *FileServiceMock) CalculateChunkSize(fileSize, MaxChunkSize int64) int64 {
+func (m *FileServiceMock) CalculateChunkSize(fileSize, preferredSize int64) int64 {
 	return 1024
 }
 
@@ -41,6 +65,13 @@ func (m *FileServiceMock) SaveChunk(sessionID string, chunkID int, data []byte)
 	return nil
 }
 
+func (m *FileServiceMock) SaveChunkAt(sessionID string, offset int64, data []byte) error {
+	if m.SaveChunkAtFunc != nil {
+		return m.SaveChunkAtFunc(sessionID, offset, data)
+	}
+	return nil
+}
+
 func (m *FileServiceMock) GetNextChunkID(sessionID string) (int, error) {
 	return 1, nil
 }
@@ -56,6 +87,152 @@ func (m *FileServiceMock) CalculateChecksum(data []byte) string {
 	return "mockedchecksum"
 }
 
+func (m *FileServiceMock) CalculateFileChecksum(filePath string) (string, error) {
+	if m.FileChecksumFunc != nil {
+		return m.FileChecksumFunc(filePath)
+	}
+	return "mockedchecksum", nil
+}
+
+func (m *FileServiceMock) GetStoragePath() (string, error) {
+	return os.TempDir(), nil
+}
+
+func (m *FileServiceMock) ListFiles() ([]StoredFile, error) {
+	if m.ListFilesFunc != nil {
+		return m.ListFilesFunc()
+	}
+	return []StoredFile{}, nil
+}
+
+func (m *FileServiceMock) OpenFile(name string) (FileReader, error) {
+	if m.OpenFileFunc != nil {
+		return m.OpenFileFunc(name)
+	}
+	return nil, ErrFileNotFound
+}
+
+func (m *FileServiceMock) SaveFileMeta(name string, meta FileMeta) error {
+	if m.SaveFileMetaFunc != nil {
+		return m.SaveFileMetaFunc(name, meta)
+	}
+	return nil
+}
+
+func (m *FileServiceMock) GetFileMeta(name string) (*FileMeta, error) {
+	if m.GetFileMetaFunc != nil {
+		return m.GetFileMetaFunc(name)
+	}
+	return nil, nil
+}
+
+func (m *FileServiceMock) CheckAssembledFile(fileName, filePath string) error {
+	if m.CheckAssembledFunc != nil {
+		return m.CheckAssembledFunc(fileName, filePath)
+	}
+	return nil
+}
+
+func (m *FileServiceMock) OpenThumbnail(name string, size int) (FileReader, *Thumbnail, error) {
+	if m.OpenThumbnailFunc != nil {
+		return m.OpenThumbnailFunc(name, size)
+	}
+	return nil, nil, ErrThumbnailNotFound
+}
+
+func (m *FileServiceMock) ExtractArchive(name, archivePath, dir string, meta FileMeta) (*ExtractionResult, error) {
+	if m.ExtractArchiveFunc != nil {
+		return m.ExtractArchiveFunc(name, archivePath, dir, meta)
+	}
+	return &ExtractionResult{Archive: name, Status: ExtractionCompleted}, nil
+}
+
+func (m *FileServiceMock) MissingChunks(hashes []string) ([]string, error) {
+	if m.MissingChunksFunc != nil {
+		return m.MissingChunksFunc(hashes)
+	}
+	return hashes, nil
+}
+
+func (m *FileServiceMock) StoreChunk(chunkData []byte) (string, bool, error) {
+	if m.StoreChunkFunc != nil {
+		return m.StoreChunkFunc(chunkData)
+	}
+	return m.CalculateChecksum(chunkData), true, nil
+}
+
+func (m *FileServiceMock) LinkChunkAt(sessionID string, offset int64, hash string) (int64, error) {
+	if m.LinkChunkAtFunc != nil {
+		return m.LinkChunkAtFunc(sessionID, offset, hash)
+	}
+	return 0, ErrChunkNotStored
+}
+
+func (m *FileServiceMock) IndexContent(fileHash string, filePath string) error {
+	if m.IndexContentFunc != nil {
+		return m.IndexContentFunc(fileHash, filePath)
+	}
+	return nil
+}
+
+func (m *FileServiceMock) LinkContent(fileHash string, fileName string) (string, int, error) {
+	if m.LinkContentFunc != nil {
+		return m.LinkContentFunc(fileHash, fileName)
+	}
+	return "", 0, ErrContentNotFound
+}
+
+func (m *FileServiceMock) CheckConflict(name string) error {
+	if m.CheckConflictFunc != nil {
+		return m.CheckConflictFunc(name)
+	}
+	return nil
+}
+
+// AssemblyPath собирает файл во временном каталоге, как и GetStoragePath.
+func (m *FileServiceMock) AssemblyPath(sessionID string) (string, error) {
+	return filepath.Join(os.TempDir(), sessionID+".assembling"), nil
+}
+
+// CommitFile по умолчанию переносит собранный файл под имя name во временном каталоге.
+func (m *FileServiceMock) CommitFile(name, assembledPath string) (string, int, error) {
+	if m.CommitFileFunc != nil {
+		return m.CommitFileFunc(name, assembledPath)
+	}
+	if err := os.Rename(assembledPath, filepath.Join(os.TempDir(), name)); err != nil && !os.IsNotExist(err) {
+		return "", 0, err
+	}
+	return name, 1, nil
+}
+
+func (m *FileServiceMock) ListVersions(name string) ([]FileVersion, error) {
+	if m.ListVersionsFunc != nil {
+		return m.ListVersionsFunc(name)
+	}
+	return nil, ErrFileNotFound
+}
+
+func (m *FileServiceMock) OpenVersion(name string, version int) (FileReader, error) {
+	if m.OpenVersionFunc != nil {
+		return m.OpenVersionFunc(name, version)
+	}
+	return nil, ErrVersionNotFound
+}
+
+func (m *FileServiceMock) PromoteVersion(name string, version int) error {
+	if m.PromoteVersionFunc != nil {
+		return m.PromoteVersionFunc(name, version)
+	}
+	return ErrVersionNotFound
+}
+
+func (m *FileServiceMock) DeleteVersion(name string, version int) error {
+	if m.DeleteVersionFunc != nil {
+		return m.DeleteVersionFunc(name, version)
+	}
+	return ErrVersionNotFound
+}
+
 // Реализация AssembleChunks
 func (m *FileServiceMock) AssembleChunks(sessionID string, outputFilePath string) error {
 	if m.AssembleChunksFunc != nil {
@@ -66,19 +243,25 @@ func (m *FileServiceMock) AssembleChunks(sessionID string, outputFilePath string
 
 // SessionServiceMock — структура для мокирования ISessionService в тестах.
 type SessionServiceMock struct {
-	CreateSessionFunc   func(fileName string, fileSize int64, fileHash string) (int64, error)
-	GetUploadStatusFunc func(sessionID string) (map[string]interface{}, error)
-	UpdateProgressFunc  func(sessionID string, uploadedSize int64) error
-	FileService         IFileService
-	DeleteSessionFunc   func(sessionID string) error
+	CreateSessionFunc      func(params SessionParams) (*SessionInfo, error)
+	GetUploadStatusFunc    func(sessionID string) (map[string]interface{}, error)
+	UpdateProgressFunc     func(sessionID string) error
+	FinalizeSessionFunc    func(sessionID string, fileHash string, fileSize int64) error
+	ListSessionsFunc       func() ([]map[string]interface{}, error)
+	QuerySessionsFunc      func(filter SessionFilter) (*SessionPage, error)
+	SessionDetailsFunc     func(sessionID string) (map[string]interface{}, error)
+	FsckFunc               func(repair bool) (*FsckReport, error)
+	ReleaseReservationFunc func(sessionID string) error
+	FileService            IFileService
+	DeleteSessionFunc      func(sessionID string) error
 }
 
 // Реализация метода CreateSession
-func (m *SessionServiceMock) CreateSession(fileName string, fileSize int64, fileHash string) (int64, error) {
+func (m *SessionServiceMock) CreateSession(params SessionParams) (*SessionInfo, error) {
 	if m.CreateSessionFunc != nil {
-		return m.CreateSessionFunc(fileName, fileSize, fileHash)
+		return m.CreateSessionFunc(params)
 	}
-	return 0, errors.New("CreateSessionFunc not implemented")
+	return nil, errors.New("CreateSessionFunc not implemented")
 }
 
 func (m *SessionServiceMock) GetFileService() IFileService {
@@ -94,11 +277,18 @@ func (m *SessionServiceMock) GetUploadStatus(sessionID string) (map[string]inter
 }
 
 // Реализация метода UpdateProgress
-func (m *SessionServiceMock) UpdateProgress(sessionID string, uploadedSize int64) error {
+func (m *SessionServiceMock) UpdateProgress(sessionID string) error {
 	if m.UpdateProgressFunc != nil {
-		return m.UpdateProgressFunc(sessionID, uploadedSize)
+		return m.UpdateProgressFunc(sessionID)
 	}
-	return errors.New("UpdateProgressFunc not implemented")
+	return nil
+}
+
+func (m *SessionServiceMock) FinalizeSession(sessionID string, fileHash string, fileSize int64) error {
+	if m.FinalizeSessionFunc != nil {
+		return m.FinalizeSessionFunc(sessionID, fileHash, fileSize)
+	}
+	return nil
 }
 
 func (m *SessionServiceMock) DeleteSession(sessionID string) error {
@@ -107,3 +297,74 @@ func (m *SessionServiceMock) DeleteSession(sessionID string) error {
 	}
 	return nil
 }
+
+func (m *SessionServiceMock) ListSessions() ([]map[string]interface{}, error) {
+	if m.ListSessionsFunc != nil {
+		return m.ListSessionsFunc()
+	}
+	return []map[string]interface{}{}, nil
+}
+
+func (m *SessionServiceMock) QuerySessions(filter SessionFilter) (*SessionPage, error) {
+	if m.QuerySessionsFunc != nil {
+		return m.QuerySessionsFunc(filter)
+	}
+	return &SessionPage{Sessions: []map[string]interface{}{}, Limit: filter.Limit}, nil
+}
+
+func (m *SessionServiceMock) SessionDetails(sessionID string) (map[string]interface{}, error) {
+	if m.SessionDetailsFunc != nil {
+		return m.SessionDetailsFunc(sessionID)
+	}
+	return nil, ErrSessionNotFound
+}
+
+func (m *SessionServiceMock) Fsck(repair bool) (*FsckReport, error) {
+	if m.FsckFunc != nil {
+		return m.FsckFunc(repair)
+	}
+	return &FsckReport{Repair: repair, Issues: []FsckIssue{}}, nil
+}
+
+func (m *SessionServiceMock) ReleaseReservation(sessionID string) error {
+	if m.ReleaseReservationFunc != nil {
+		return m.ReleaseReservationFunc(sessionID)
+	}
+	return nil
+}
+
+// BatchServiceMock — структура для мокирования IBatchService в тестах.
+type BatchServiceMock struct {
+	CreateBatchFunc func(params BatchParams) (*Batch, error)
+	GetBatchFunc    func(batchID string) (*Batch, error)
+	CommitBatchFunc func(batchID string) (*Batch, error)
+	AbortBatchFunc  func(batchID string) (*Batch, error)
+}
+
+func (m *BatchServiceMock) CreateBatch(params BatchParams) (*Batch, error) {
+	if m.CreateBatchFunc != nil {
+		return m.CreateBatchFunc(params)
+	}
+	return &Batch{ID: "batch123", Status: BatchStatusOpen}, nil
+}
+
+func (m *BatchServiceMock) GetBatch(batchID string) (*Batch, error) {
+	if m.GetBatchFunc != nil {
+		return m.GetBatchFunc(batchID)
+	}
+	return nil, ErrBatchNotFound
+}
+
+func (m *BatchServiceMock) CommitBatch(batchID string) (*Batch, error) {
+	if m.CommitBatchFunc != nil {
+		return m.CommitBatchFunc(batchID)
+	}
+	return &Batch{ID: batchID, Status: BatchStatusCommitted}, nil
+}
+
+func (m *BatchServiceMock) AbortBatch(batchID string) (*Batch, error) {
+	if m.AbortBatchFunc != nil {
+		return m.AbortBatchFunc(batchID)
+	}
+	return &Batch{ID: batchID, Status: BatchStatusAborted}, nil
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Ограничения ключей хранилища (имён файлов относительно корня хранилища).
+const (
+	MaxFileNameLength    = 1024
+	MaxNameSegmentLength = 255
+	MaxNameDepth         = 32
+)
+
+var (
+	ErrInvalidFileName  = errors.New("invalid file name")
+	ErrUnknownNamespace = errors.New("unknown namespace")
+)
+
+// reservedDeviceNames — имена устройств Windows, недопустимые в любом регистре и с любым расширением.
+var reservedDeviceNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+func invalidName(name, format string, args ...interface{}) error {
+	return fmt.Errorf("%w %q: %s", ErrInvalidFileName, name, fmt.Sprintf(format, args...))
+}
+
+// SanitizeFileName превращает имя, присланное клиентом, в безопасный ключ хранилища:
+// разделители приводятся к "/", Unicode — к составной форме, сегменты "." отбрасываются.
+// Отклоняются абсолютные пути, "..", управляющие и невидимые символы форматирования,
+// символы, запрещённые в Windows, имена устройств, сегменты с точкой или пробелом в конце,
+// суффикс .part и служебные имена верхнего уровня, начинающиеся с точки.
+func SanitizeFileName(name string) (string, error) {
+	key, err := sanitizeKey(name)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(key, ".") {
+		return "", invalidName(name, "top-level names starting with '.' are reserved")
+	}
+	return key, nil
+}
+
+// sanitizeKey проверяет относительный путь без ограничений на имена верхнего уровня;
+// используется и для записей распаковываемых архивов.
+func sanitizeKey(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", invalidName(name, "not valid UTF-8")
+	}
+	// Одно и то же имя из macOS (NFD) и Windows/Linux (NFC) даёт один ключ хранилища
+	normalized := norm.NFC.String(strings.ReplaceAll(name, "\\", "/"))
+	if strings.HasPrefix(normalized, "/") || (len(normalized) >= 2 && normalized[1] == ':' && normalized[0] < utf8.RuneSelf && unicode.IsLetter(rune(normalized[0]))) {
+		return "", invalidName(name, "absolute paths are not allowed")
+	}
+
+	segments := []string{}
+	for _, segment := range strings.Split(normalized, "/") {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			return "", invalidName(name, "path traversal is not allowed")
+		}
+		if err := checkNameSegment(name, segment); err != nil {
+			return "", err
+		}
+		segments = append(segments, segment)
+	}
+	if len(segments) == 0 {
+		return "", invalidName(name, "name is empty")
+	}
+	if len(segments) > MaxNameDepth {
+		return "", invalidName(name, "more than %d directory levels", MaxNameDepth)
+	}
+	key := strings.Join(segments, "/")
+	if len(key) > MaxFileNameLength {
+		return "", invalidName(name, "longer than %d bytes", MaxFileNameLength)
+	}
+	if strings.HasSuffix(key, ".part") {
+		return "", invalidName(name, "the .part suffix is reserved")
+	}
+	return key, nil
+}
+
+func checkNameSegment(name, segment string) error {
+	if len(segment) > MaxNameSegmentLength {
+		return invalidName(name, "segment %q is longer than %d bytes", segment, MaxNameSegmentLength)
+	}
+	for _, r := range segment {
+		switch {
+		case unicode.IsControl(r):
+			return invalidName(name, "control characters are not allowed")
+		case unicode.Is(unicode.Cf, r):
+			return invalidName(name, "invisible formatting character U+%04X is not allowed", r)
+		case strings.ContainsRune(`<>:"|?*`, r):
+			return invalidName(name, "character %q is not allowed", r)
+		}
+	}
+	if strings.HasSuffix(segment, ".") || strings.HasSuffix(segment, " ") || strings.HasPrefix(segment, " ") {
+		return invalidName(name, "segment %q starts with a space or ends with a dot or space", segment)
+	}
+	base, _, _ := strings.Cut(segment, ".")
+	if reservedDeviceNames[strings.ToUpper(strings.TrimSpace(base))] {
+		return invalidName(name, "%q is a reserved device name", segment)
+	}
+	return nil
+}
+
+// ResolveFileName строит ключ хранилища для имени, присланного клиентом: безопасный ключ
+// в корне пространства имён namespace; пустое пространство — корень хранилища.
+func (f *FileService) ResolveFileName(namespace, name string) (string, error) {
+	key, err := SanitizeFileName(name)
+	if err != nil {
+		return "", err
+	}
+	if namespace == "" {
+		return key, nil
+	}
+	ns, ok := f.Namespaces[namespace]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownNamespace, namespace)
+	}
+	root := ns.Root
+	if root == "" {
+		root = namespace
+	}
+	resolved := path.Join(root, key)
+	if len(resolved) > MaxFileNameLength {
+		return "", invalidName(name, "longer than %d bytes in namespace %s", MaxFileNameLength, namespace)
+	}
+	return resolved, nil
+}
+
+// NamespaceOf возвращает пространство имён, в корне которого лежит файл name; пустая строка —
+// файл вне пространств. При вложенных корнях выбирается самый длинный.
+func (f *FileService) NamespaceOf(name string) string {
+	found, longest := "", 0
+	for namespace, ns := range f.Namespaces {
+		root := ns.Root
+		if root == "" {
+			root = namespace
+		}
+		if strings.HasPrefix(name, root+"/") && len(root) > longest {
+			found, longest = namespace, len(root)
+		}
+	}
+	return found
+}
@@ -0,0 +1,528 @@
+package services
+
+import (
+	"BASProject/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Состояния собранного файла. Файл без состояния доступен (загружен до появления конвейера).
+const (
+	FileStatusProcessing  = "processing"
+	FileStatusAvailable   = "available"
+	FileStatusQuarantined = "quarantined"
+	FileStatusRejected    = "rejected"
+)
+
+// Служебные каталоги внутри LocalPath: карантин и временные открытые копии для внешних команд.
+const (
+	quarantineDir = ".quarantine"
+	processingDir = ".processing"
+)
+
+// commandOutputLimit — сколько байтов вывода команды сохраняется в результате обработки.
+const commandOutputLimit = 1 << 10
+
+var ErrFileNotAvailable = errors.New("file is not available")
+
+// isInternalPath сообщает, что путь относительно LocalPath ведёт в служебный каталог.
+func isInternalPath(clean string) bool {
+	for _, dir := range []string{chunkStoreDir, quarantineDir, processingDir, thumbnailDir, versionsDir} {
+		if clean == dir || strings.HasPrefix(clean, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProcessorOutcome — результат одного обработчика конвейера.
+type ProcessorOutcome struct {
+	Processor  string    `json:"processor"`
+	Status     string    `json:"status"`
+	Message    string    `json:"message,omitempty"`
+	Duration   string    `json:"duration"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// ProcessedFile — собранный файл, передаваемый обработчикам.
+type ProcessedFile struct {
+	SessionID   string
+	Name        string
+	Path        string
+	FileHash    string
+	ContentType string
+	Metadata    map[string]string
+	// Commit, если задан, переносит прошедший обработку файл из временного пути Path в хранилище
+	// и возвращает его итоговое имя. До этого файл не виден под именем Name, а прежняя версия
+	// остаётся текущей.
+	Commit func() (string, error)
+	// batched — файл пакета во временном пути; в хранилище его переносит RunBatch
+	batched bool
+
+	fileService *FileService
+	plainPath   string
+	annotations []func(name string, meta *FileMeta)
+}
+
+// Annotate дополняет запись о файле сведениями обработчика. Применяется под итоговым именем
+// файла и только если файл прошёл конвейер и попал в хранилище.
+func (p *ProcessedFile) Annotate(fn func(name string, meta *FileMeta)) {
+	p.annotations = append(p.annotations, fn)
+}
+
+// staged сообщает, что файл ещё не перенесён в хранилище.
+func (p *ProcessedFile) staged() bool {
+	return p.Commit != nil || p.batched
+}
+
+// Open открывает содержимое файла (при шифровании на диске — расшифрованное).
+func (p *ProcessedFile) Open() (FileReader, error) {
+	return p.fileService.openStored(p.Path)
+}
+
+// PlainPath возвращает путь к открытому содержимому для внешних программ. При шифровании
+// на диске создаётся временная расшифрованная копия, удаляемая после конвейера.
+func (p *ProcessedFile) PlainPath() (string, error) {
+	if p.fileService.Envelope == nil {
+		return p.Path, nil
+	}
+	if p.plainPath != "" {
+		return p.plainPath, nil
+	}
+	dir := filepath.Join(p.fileService.LocalPath, processingDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create processing directory: %w", err)
+	}
+	source, err := p.Open()
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+	tmp, err := os.CreateTemp(dir, "plain-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create plain copy: %w", err)
+	}
+	if _, err := io.Copy(tmp, source); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to decrypt file for processing: %w", storageError(err))
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	p.plainPath = tmp.Name()
+	return p.plainPath, nil
+}
+
+func (p *ProcessedFile) cleanup() {
+	if p.plainPath != "" {
+		os.Remove(p.plainPath)
+		p.plainPath = ""
+	}
+}
+
+// Processor обрабатывает собранный файл. Ошибка означает, что файл не прошёл обработку;
+// сообщение сохраняется в результате в обоих случаях.
+type Processor interface {
+	Process(ctx context.Context, file *ProcessedFile) (string, error)
+}
+
+// ProcessorFactory создаёт обработчик по его описанию в конфигурации.
+type ProcessorFactory func(cfg config.ProcessorConfig, fileService *FileService) (Processor, error)
+
+var processorFactories = map[string]ProcessorFactory{}
+
+// RegisterProcessor делает тип обработчика доступным конфигурации конвейера.
+// Вызывается из init; повторная регистрация заменяет прежнюю.
+func RegisterProcessor(kind string, factory ProcessorFactory) {
+	processorFactories[kind] = factory
+}
+
+func init() {
+	RegisterProcessor("command", newCommandProcessor)
+	RegisterProcessor("file_type", newFileTypeProcessor)
+	RegisterProcessor("thumbnail", newThumbnailProcessor)
+}
+
+// PipelineResult — итог конвейера: состояние файла, его текущее место и результаты обработчиков.
+// Restored — прежняя версия, вернувшаяся под имя файла вместо отклонённой.
+type PipelineResult struct {
+	Status   string             `json:"status"`
+	Path     string             `json:"path,omitempty"`
+	Outcomes []ProcessorOutcome `json:"processing"`
+	Restored int                `json:"restored_version,omitempty"`
+}
+
+// FailureMessage возвращает сообщение обработчика, на котором конвейер остановился.
+func (r PipelineResult) FailureMessage() string {
+	for _, outcome := range r.Outcomes {
+		if outcome.Status == "failed" {
+			return fmt.Sprintf("%s: %s", outcome.Processor, outcome.Message)
+		}
+	}
+	return ""
+}
+
+type pipelineStage struct {
+	name      string
+	timeout   time.Duration
+	processor Processor
+}
+
+// Pipeline запускает обработчики над собранными файлами и записывает результаты
+// в метаданные файла и в сессию. Нулевой или пустой конвейер ничего не делает.
+type Pipeline struct {
+	FileService *FileService
+	stages      []pipelineStage
+	onFailure   string
+	wg          sync.WaitGroup
+}
+
+func NewPipeline(fileService *FileService, cfg config.PipelineConfig) (*Pipeline, error) {
+	pipeline := &Pipeline{FileService: fileService, onFailure: cfg.OnFailure}
+	if pipeline.onFailure == "" {
+		pipeline.onFailure = "quarantine"
+	}
+	for i, processorCfg := range cfg.Processors {
+		factory, ok := processorFactories[processorCfg.Type]
+		if !ok {
+			return nil, fmt.Errorf("pipeline: unknown processor type %q", processorCfg.Type)
+		}
+		processor, err := factory(processorCfg, fileService)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline: processor %d: %w", i+1, err)
+		}
+		stage := pipelineStage{name: processorCfg.Name, timeout: processorCfg.Timeout, processor: processor}
+		if stage.name == "" {
+			stage.name = processorCfg.Type
+		}
+		if stage.timeout == 0 {
+			stage.timeout = config.DefaultProcessorTimeout
+		}
+		pipeline.stages = append(pipeline.stages, stage)
+	}
+	return pipeline, nil
+}
+
+// Enabled сообщает, что в конвейере есть обработчики.
+func (p *Pipeline) Enabled() bool {
+	return p != nil && len(p.stages) > 0
+}
+
+// Start отмечает файл как обрабатываемый и запускает конвейер в фоне; done получает итог.
+func (p *Pipeline) Start(file ProcessedFile, done func(PipelineResult)) {
+	p.record(file, PipelineResult{Status: FileStatusProcessing, Path: file.Path, Outcomes: []ProcessorOutcome{}})
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		result := p.Run(file)
+		if done != nil {
+			done(result)
+		}
+	}()
+}
+
+// Wait дожидается завершения запущенных конвейеров.
+func (p *Pipeline) Wait() {
+	if p != nil {
+		p.wg.Wait()
+	}
+}
+
+// Run последовательно выполняет обработчики и останавливается на первой неудаче,
+// после чего применяет действие on_failure. Файл с Commit переносится в хранилище,
+// только если прошёл все обработчики.
+func (p *Pipeline) Run(file ProcessedFile) PipelineResult {
+	result := p.Check(&file)
+	if result.Status == FileStatusAvailable && file.Commit != nil {
+		started := time.Now()
+		name, err := file.Commit()
+		if err != nil {
+			log.Printf("Failed to store processed file %s: %v", file.Name, err)
+			os.Remove(file.Path)
+			result.Status, result.Path = FileStatusRejected, ""
+			result.Outcomes = append(result.Outcomes, ProcessorOutcome{
+				Processor:  "store",
+				Status:     "failed",
+				Message:    err.Error(),
+				Duration:   time.Since(started).Round(time.Millisecond).String(),
+				FinishedAt: time.Now().UTC(),
+			})
+			p.record(file, result)
+			return result
+		}
+		file.Name, file.Path, file.Commit = name, filepath.Join(p.FileService.LocalPath, filepath.FromSlash(name)), nil
+		result.Path = file.Path
+	}
+	return p.Apply(&file, result)
+}
+
+// Check выполняет обработчики до первой неудачи, не меняя ни файл, ни записи о нём;
+// итог вступает в силу через Apply. Так пакет файлов становится доступен только целиком.
+func (p *Pipeline) Check(file *ProcessedFile) PipelineResult {
+	file.fileService = p.FileService
+	defer file.cleanup()
+
+	result := PipelineResult{Status: FileStatusAvailable, Path: file.Path, Outcomes: []ProcessorOutcome{}}
+	for _, stage := range p.stages {
+		c, cancel := context.WithTimeout(context.Background(), stage.timeout)
+		started := time.Now()
+		message, err := stage.processor.Process(c, file)
+		if err != nil && errors.Is(c.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s", stage.timeout)
+		}
+		cancel()
+
+		outcome := ProcessorOutcome{
+			Processor:  stage.name,
+			Status:     "passed",
+			Message:    message,
+			Duration:   time.Since(started).Round(time.Millisecond).String(),
+			FinishedAt: time.Now().UTC(),
+		}
+		if err != nil {
+			outcome.Status, outcome.Message = "failed", err.Error()
+			log.Printf("Processor %s rejected %s: %v", stage.name, file.Name, err)
+		}
+		result.Outcomes = append(result.Outcomes, outcome)
+		if err != nil {
+			result.Status = FileStatusRejected
+			break
+		}
+	}
+	return result
+}
+
+// Apply применяет итог Check: непрошедший файл обрабатывается по on_failure,
+// состояние записывается в метаданные файла и в сессию.
+func (p *Pipeline) Apply(file *ProcessedFile, result PipelineResult) PipelineResult {
+	if result.Status == FileStatusRejected {
+		p.fail(file, &result)
+	}
+	p.record(*file, result)
+	return result
+}
+
+// RunBatch прогоняет через обработчики файлы пакета batchID, ещё лежащие во временных путях,
+// и только если все прошли, переносит их в хранилище FileService.CommitBatch — тогда они
+// становятся доступны вместе; результат — итоги файлов и -1. Иначе к непрошедшему
+// применяется on_failure, а в хранилище не попадает ни один файл пакета; результат — итоги
+// проверенных файлов и номер непрошедшего. Остальные временные файлы удаляет вызывающий.
+func (p *Pipeline) RunBatch(batchID string, entries []*BatchEntry) ([]PipelineResult, int, error) {
+	fileService := p.FileService
+	files := make([]ProcessedFile, len(entries))
+	results := make([]PipelineResult, len(entries))
+	for i, entry := range entries {
+		files[i] = ProcessedFile{
+			SessionID:   entry.Meta.SessionID,
+			Name:        entry.Name,
+			Path:        entry.Path,
+			FileHash:    entry.Meta.FileHash,
+			ContentType: entry.Meta.ContentType,
+			Metadata:    entry.Meta.Metadata,
+			batched:     true,
+		}
+		results[i] = p.Check(&files[i])
+		if results[i].Status != FileStatusAvailable {
+			results[i] = p.Apply(&files[i], results[i])
+			return results[:i+1], i, nil
+		}
+		entry.Meta.Status, entry.Meta.Processing = results[i].Status, results[i].Outcomes
+	}
+
+	if err := fileService.CommitBatch(batchID, entries); err != nil {
+		return nil, -1, err
+	}
+	for i, entry := range entries {
+		files[i].Name, files[i].batched = entry.StoredName, false
+		files[i].Path = filepath.Join(fileService.LocalPath, filepath.FromSlash(entry.StoredName))
+		results[i].Path = files[i].Path
+		p.record(files[i], results[i])
+	}
+	fileService.ReleaseBatch(entries)
+	return results, -1, nil
+}
+
+// fail применяет к непрошедшему файлу действие on_failure.
+func (p *Pipeline) fail(file *ProcessedFile, result *PipelineResult) {
+	result.Status = FileStatusRejected
+	// Производные файлы, созданные до неудачи, не нужны
+	file.annotations = nil
+	staged := file.staged()
+	if !staged {
+		if err := os.RemoveAll(thumbnailDirFor(p.FileService.LocalPath, file.Name)); err != nil {
+			log.Printf("Failed to remove thumbnails of %s: %v", file.Name, err)
+		}
+	}
+	switch p.onFailure {
+	case "delete":
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete rejected file %s: %v", file.Path, err)
+			return
+		}
+		result.Path = ""
+	case "quarantine":
+		target := filepath.Join(p.FileService.LocalPath, quarantineDir, filepath.FromSlash(file.Name))
+		if _, err := os.Stat(target); err == nil {
+			target = fmt.Sprintf("%s.%d", target, time.Now().UnixNano())
+		}
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			log.Printf("Failed to create quarantine directory: %v", err)
+			return
+		}
+		if err := os.Rename(file.Path, target); err != nil {
+			log.Printf("Failed to quarantine %s: %v", file.Path, err)
+			return
+		}
+		log.Printf("File %s quarantined as %s", file.Name, target)
+		result.Status, result.Path = FileStatusQuarantined, target
+	default:
+		return
+	}
+	if staged {
+		// Файл не попадал в хранилище: прежняя версия и не покидала своего места
+		return
+	}
+	// Под именем снова доступна прежняя версия, если она была
+	restored, err := p.FileService.RestoreLatestVersion(file.Name)
+	if err != nil {
+		log.Printf("Failed to restore previous version of %s: %v", file.Name, err)
+	}
+	result.Restored = restored
+}
+
+// record сохраняет состояние и результаты обработки в метаданных файла и в сессии.
+// Если под имя вернулась прежняя версия, её метаданные не трогаются; файл, ещё не
+// перенесённый в хранилище, записи о файле не имеет — под его именем лежит прежняя версия.
+func (p *Pipeline) record(file ProcessedFile, result PipelineResult) {
+	staged := file.staged()
+	if result.Restored == 0 && !staged {
+		p.recordFileMeta(file, result)
+	}
+
+	if p.FileService.Storage == nil || file.SessionID == "" {
+		return
+	}
+	outcomes, _ := json.Marshal(result.Outcomes)
+	fields := map[string]interface{}{
+		"file_status": result.Status,
+		"processing":  string(outcomes),
+	}
+	if !staged {
+		fields["stored_name"] = file.Name
+	}
+	err := p.FileService.Storage.UpdateSessionFields(file.SessionID, fields)
+	if err != nil {
+		log.Printf("Failed to record processing status in session %s: %v", file.SessionID, err)
+	}
+}
+
+func (p *Pipeline) recordFileMeta(file ProcessedFile, result PipelineResult) {
+	meta, err := p.FileService.GetFileMeta(file.Name)
+	if err != nil || meta == nil {
+		meta = &FileMeta{ContentType: file.ContentType, Metadata: file.Metadata, SessionID: file.SessionID, FileHash: file.FileHash}
+	}
+	meta.Status, meta.Processing, meta.Location = result.Status, result.Outcomes, ""
+	for _, annotate := range file.annotations {
+		annotate(file.Name, meta)
+	}
+	if result.Path != "" && result.Path != file.Path {
+		if rel, err := filepath.Rel(p.FileService.LocalPath, result.Path); err == nil {
+			meta.Location = filepath.ToSlash(rel)
+		}
+	}
+	if err := p.FileService.SaveFileMeta(file.Name, *meta); err != nil {
+		log.Printf("Failed to record processing status of %s: %v", file.Name, err)
+	}
+}
+
+// addProcessingStatus дополняет статус сессии состоянием собранного файла и результатами обработки.
+func addProcessingStatus(target map[string]interface{}, sessionData map[string]interface{}) {
+	if name, ok := sessionData["stored_name"].(string); ok && name != "" {
+		target["stored_name"] = name
+	}
+	if status, ok := sessionData["file_status"].(string); ok && status != "" {
+		target["file_status"] = status
+	}
+	if encoded, ok := sessionData["processing"].(string); ok && encoded != "" {
+		outcomes := []ProcessorOutcome{}
+		if err := json.Unmarshal([]byte(encoded), &outcomes); err == nil {
+			target["processing"] = outcomes
+		}
+	}
+}
+
+// commandProcessor запускает внешнюю команду; код выхода 0 означает, что файл прошёл проверку.
+// Сведения о файле передаются подстановками в аргументах и переменными окружения BAS_*.
+type commandProcessor struct {
+	command []string
+}
+
+func newCommandProcessor(cfg config.ProcessorConfig, fileService *FileService) (Processor, error) {
+	if len(cfg.Command) == 0 {
+		return nil, errors.New("command is required")
+	}
+	return &commandProcessor{command: cfg.Command}, nil
+}
+
+func (c *commandProcessor) Process(ctx context.Context, file *ProcessedFile) (string, error) {
+	path, err := file.PlainPath()
+	if err != nil {
+		return "", err
+	}
+	replacer := strings.NewReplacer("{path}", path, "{name}", file.Name, "{hash}", file.FileHash, "{content_type}", file.ContentType)
+	args := make([]string, len(c.command))
+	for i, arg := range c.command {
+		args[i] = replacer.Replace(arg)
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"BAS_FILE_PATH="+path,
+		"BAS_FILE_NAME="+file.Name,
+		"BAS_FILE_HASH="+file.FileHash,
+		"BAS_SESSION_ID="+file.SessionID,
+		"BAS_CONTENT_TYPE="+file.ContentType,
+	)
+	// Не ждём бесконечно потомков, унаследовавших вывод убитой по таймауту команды
+	cmd.WaitDelay = 5 * time.Second
+	output, err := cmd.CombinedOutput()
+	message := strings.TrimSpace(string(output))
+	if len(message) > commandOutputLimit {
+		message = message[:commandOutputLimit] + "..."
+	}
+	if err != nil {
+		if message != "" {
+			return message, fmt.Errorf("%v: %s", err, message)
+		}
+		return message, err
+	}
+	return message, nil
+}
+
+// fileTypeProcessor повторно проверяет собранный файл политикой типов файлов.
+type fileTypeProcessor struct {
+	fileService *FileService
+}
+
+func newFileTypeProcessor(cfg config.ProcessorConfig, fileService *FileService) (Processor, error) {
+	return &fileTypeProcessor{fileService: fileService}, nil
+}
+
+func (f *fileTypeProcessor) Process(ctx context.Context, file *ProcessedFile) (string, error) {
+	if err := f.fileService.CheckAssembledFile(file.Name, file.Path); err != nil {
+		return "", err
+	}
+	return "file type allowed", nil
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"BASProject/config"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// sniffLength — сколько первых байтов файла используется для определения типа.
+const sniffLength = 512
+
+var ErrFileTypeRejected = errors.New("file type is not allowed")
+
+// Сигнатуры исполняемых форматов, которые http.DetectContentType не различает.
+var executableSignatures = []struct {
+	magic    []byte
+	mimeType string
+}{
+	{[]byte("MZ"), "application/x-msdownload"},
+	{[]byte("\x7fELF"), "application/x-executable"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xce}, "application/x-mach-binary"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xcf}, "application/x-mach-binary"},
+	{[]byte{0xce, 0xfa, 0xed, 0xfe}, "application/x-mach-binary"},
+	{[]byte{0xcf, 0xfa, 0xed, 0xfe}, "application/x-mach-binary"},
+	{[]byte("#!"), "text/x-shellscript"},
+}
+
+// SniffContentType определяет MIME-тип по первым байтам содержимого (без параметров вроде charset).
+func SniffContentType(head []byte) string {
+	for _, signature := range executableSignatures {
+		if bytes.HasPrefix(head, signature.magic) {
+			return signature.mimeType
+		}
+	}
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return mediaType
+}
+
+// policyFor выбирает политику для файла: политика пространства имён, в корне которого
+// лежит файл (или чьё название совпадает с первым каталогом имени), иначе политика по умолчанию.
+func (f *FileService) policyFor(fileName string) (string, config.FileTypePolicy) {
+	if namespace := f.NamespaceOf(fileName); namespace != "" {
+		if policy, found := f.Policies.Namespaces[namespace]; found {
+			return namespace, policy
+		}
+	}
+	// Без настроенного пространства политика выбирается по первому каталогу имени
+	if namespace, _, ok := strings.Cut(strings.TrimPrefix(path.Clean("/"+fileName), "/"), "/"); ok {
+		if policy, found := f.Policies.Namespaces[namespace]; found {
+			return namespace, policy
+		}
+	}
+	return "", f.Policies.Default
+}
+
+func rejectFileType(namespace, format string, args ...interface{}) error {
+	if namespace != "" {
+		return fmt.Errorf("%w in namespace %s: %s", ErrFileTypeRejected, namespace, fmt.Sprintf(format, args...))
+	}
+	return fmt.Errorf("%w: %s", ErrFileTypeRejected, fmt.Sprintf(format, args...))
+}
+
+// CheckFileName проверяет расширение имени файла и заявленный клиентом тип содержимого.
+func (f *FileService) CheckFileName(fileName, contentType string) error {
+	namespace, policy := f.policyFor(fileName)
+	ext := strings.ToLower(path.Ext(fileName))
+	if matchesExtension(policy.DenyExtensions, ext) {
+		return rejectFileType(namespace, "extension %q is denied", ext)
+	}
+	if len(policy.AllowExtensions) > 0 && !matchesExtension(policy.AllowExtensions, ext) {
+		return rejectFileType(namespace, "extension %q is not in the allowed list %v", ext, policy.AllowExtensions)
+	}
+	if contentType != "" {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		if err := checkMIMEType(namespace, policy, mediaType, "declared"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckFileContent проверяет MIME-тип и сигнатуру по первым байтам файла.
+func (f *FileService) CheckFileContent(fileName string, head []byte) error {
+	namespace, policy := f.policyFor(fileName)
+	if len(head) > sniffLength {
+		head = head[:sniffLength]
+	}
+	for _, magic := range policy.DenyMagic {
+		if hasMagic(head, magic) {
+			return rejectFileType(namespace, "content starts with denied signature %s", magic)
+		}
+	}
+	if len(policy.AllowMagic) > 0 {
+		allowed := false
+		for _, magic := range policy.AllowMagic {
+			allowed = allowed || hasMagic(head, magic)
+		}
+		if !allowed {
+			return rejectFileType(namespace, "content does not start with an allowed signature %v", policy.AllowMagic)
+		}
+	}
+	return checkMIMEType(namespace, policy, SniffContentType(head), "detected")
+}
+
+// CheckAssembledFile повторно проверяет тип собранного файла: первые чанки могли
+// быть получены до изменения политики или связаны из хранилища чанков без проверки.
+func (f *FileService) CheckAssembledFile(fileName, filePath string) error {
+	file, err := f.openStored(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open assembled file: %w", err)
+	}
+	defer file.Close()
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("failed to read assembled file: %w", err)
+	}
+	if err := f.CheckFileName(fileName, ""); err != nil {
+		return err
+	}
+	return f.CheckFileContent(fileName, head[:n])
+}
+
+// checkFirstChunk проверяет тип файла по первому чанку сессии до его сохранения.
+func (f *FileService) checkFirstChunk(sessionID string, chunkData []byte) error {
+	exists, err := f.Storage.SessionExists(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to check session existence: %w", err)
+	}
+	if exists == 0 {
+		return ErrSessionNotFound
+	}
+	sessionData, err := f.Storage.GetSessionData(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session data: %w", err)
+	}
+	fileName, _ := sessionData["file_name"].(string)
+	return f.CheckFileContent(fileName, chunkData)
+}
+
+func checkMIMEType(namespace string, policy config.FileTypePolicy, mediaType, source string) error {
+	if matchesMIMEType(policy.DenyMIMETypes, mediaType) {
+		return rejectFileType(namespace, "%s type %s is denied", source, mediaType)
+	}
+	if len(policy.AllowMIMETypes) > 0 && !matchesMIMEType(policy.AllowMIMETypes, mediaType) {
+		return rejectFileType(namespace, "%s type %s is not in the allowed list %v", source, mediaType, policy.AllowMIMETypes)
+	}
+	return nil
+}
+
+func matchesExtension(list []string, ext string) bool {
+	for _, item := range list {
+		item = strings.ToLower(item)
+		if !strings.HasPrefix(item, ".") {
+			item = "." + item
+		}
+		if item == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMIMEType сравнивает тип с шаблонами вида image/png, image/* или */*.
+func matchesMIMEType(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == mediaType || pattern == "*/*" {
+			return true
+		}
+		if group, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, group+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMagic(head []byte, magic string) bool {
+	prefix, err := hex.DecodeString(strings.ReplaceAll(magic, " ", ""))
+	return err == nil && len(prefix) > 0 && bytes.HasPrefix(head, prefix)
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"BASProject/internal/utils"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Способы сборки файла из чанков.
+// В режиме parts каждый чанк хранится в своём файле .part и при завершении копируется в итоговый файл.
+// В режиме preallocate итоговый файл выделяется при создании сессии, чанк n записывается в него
+// по смещению (n-1)*chunk_size, а записанные чанки отмечаются в битовой карте в Redis.
+const (
+	AssemblyParts       = "parts"
+	AssemblyPreallocate = "preallocate"
+)
+
+// preallocates сообщает, собирается ли новая сессия в выделенном файле. Нужны номера чанков
+// и известный размер файла; зашифрованный поток нельзя дописывать по смещению.
+func (f *FileService) preallocates(params SessionParams) bool {
+	return f.Assembly == AssemblyPreallocate && params.ChunkMode == ChunkModeFixed && !params.Deferred && f.Envelope == nil
+}
+
+// isPreallocated сообщает, что чанки сессии записываются в выделенный файл.
+func isPreallocated(sessionData map[string]interface{}) bool {
+	assembly, _ := sessionData["assembly"].(string)
+	return assembly == AssemblyPreallocate
+}
+
+// preallocatedPath — путь к выделенному файлу сессии в каталоге .processing.
+func (f *FileService) preallocatedPath(sessionID string) string {
+	return filepath.Join(f.LocalPath, processingDir, "upload-"+sessionID+".tmp")
+}
+
+// preallocate выделяет файл сессии размером fileSize. Возвращает true, если место на диске
+// выделено сразу, а не по мере записи чанков.
+func (f *FileService) preallocate(sessionID string, fileSize int64) (bool, error) {
+	path, err := f.processingTemp("upload-" + sessionID)
+	if err != nil {
+		return false, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return false, fmt.Errorf("failed to create preallocated file: %w", storageError(err))
+	}
+	allocated, err := utils.Preallocate(file, fileSize)
+	if err != nil {
+		file.Close()
+		os.Remove(path)
+		return false, fmt.Errorf("failed to preallocate %d bytes: %w", fileSize, storageError(err))
+	}
+	return allocated, file.Close()
+}
+
+// writePreallocated записывает чанк chunkID на его место в выделенном файле сессии
+// и отмечает его в битовой карте. Номер и размер чанка проверены ValidateChunk.
+func (f *FileService) writePreallocated(sessionID string, chunkID int, chunkSize int64, chunkData []byte) error {
+	file, err := os.OpenFile(f.preallocatedPath(sessionID), os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open preallocated file: %w", err)
+	}
+	if _, err := file.WriteAt(chunkData, int64(chunkID-1)*chunkSize); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write chunk %d: %w", chunkID, storageError(err))
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write chunk %d: %w", chunkID, storageError(err))
+	}
+	if err := f.Storage.SetChunkBit(sessionID, chunkID); err != nil {
+		return fmt.Errorf("failed to mark chunk %d as uploaded: %w", chunkID, err)
+	}
+	return nil
+}
+
+// bitmapChunks перечисляет номера чанков, отмеченных в битовой карте:
+// чанку n соответствует бит n-1, биты в байте считаются от старшего.
+func bitmapChunks(bitmap []byte) []int {
+	chunks := []int{}
+	for i, b := range bitmap {
+		for bit := 0; bit < 8; bit++ {
+			if b&(0x80>>bit) != 0 {
+				chunks = append(chunks, i*8+bit+1)
+			}
+		}
+	}
+	return chunks
+}
+
+// preallocatedChunks возвращает записанные в выделенный файл чанки из 1..totalChunks.
+func (f *FileService) preallocatedChunks(sessionID string, totalChunks int) ([]int, error) {
+	bitmap, err := f.Storage.GetChunkBitmap(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chunk bitmap: %w", err)
+	}
+	chunks := []int{}
+	for _, chunkID := range bitmapChunks(bitmap) {
+		if chunkID <= totalChunks {
+			chunks = append(chunks, chunkID)
+		}
+	}
+	return chunks, nil
+}
+
+// finishPreallocated проверяет, что записаны все чанки, сбрасывает выделенный файл на диск
+// и переименовывает его в outputFilePath. Данные при этом не копируются.
+func (f *FileService) finishPreallocated(sessionID string, fileSize, chunkSize int64, outputFilePath string) error {
+	totalChunks := int((fileSize + chunkSize - 1) / chunkSize)
+	chunks, err := f.preallocatedChunks(sessionID, totalChunks)
+	if err != nil {
+		return err
+	}
+	if len(chunks) != totalChunks {
+		written := map[int]bool{}
+		for _, chunkID := range chunks {
+			written[chunkID] = true
+		}
+		missingChunks := []int{}
+		for i := 1; i <= totalChunks; i++ {
+			if !written[i] {
+				missingChunks = append(missingChunks, i)
+			}
+		}
+		return fmt.Errorf("missing chunks: %v", missingChunks)
+	}
+
+	path := f.preallocatedPath(sessionID)
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open preallocated file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync preallocated file: %w", storageError(err))
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to sync preallocated file: %w", storageError(err))
+	}
+	if err := os.Rename(path, outputFilePath); err != nil {
+		return fmt.Errorf("failed to move preallocated file: %w", err)
+	}
+	return nil
+}
+
+// unassemble убирает собранный, но не перенесённый в хранилище файл сессии. Выделенный файл
+// возвращается на место, чтобы сборку можно было повторить; файл, собранный из частей, удаляется.
+func (f *FileService) unassemble(sessionID, path string) {
+	if sessionData, err := f.sessionData(sessionID); err == nil && isPreallocated(sessionData) {
+		if err := os.Rename(path, f.preallocatedPath(sessionID)); err == nil {
+			return
+		}
+	}
+	os.Remove(path)
+}
+
+// removePreallocated удаляет выделенный файл сессии, если он есть.
+func (f *FileService) removePreallocated(sessionID string) error {
+	if err := os.Remove(f.preallocatedPath(sessionID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete preallocated file: %w", err)
+	}
+	return nil
+}
+
+// reserveAssembly резервирует место под новую сессию и, если она собирается в выделенном файле,
+// отмечает это в sessionData и выделяет файл. Резерв защищает место до выделения; выделенный
+// файл уже занимает его на диске, и резерв снимается, чтобы не учитывать те же байты дважды.
+func (s *SessionService) reserveAssembly(sessionID string, sessionData map[string]interface{}, params SessionParams) error {
+	preallocated := s.FileService.preallocates(params)
+	if err := s.reserveSpace(sessionID, params.FileSize, preallocated); err != nil {
+		return err
+	}
+	if !preallocated {
+		return nil
+	}
+	allocated, err := s.FileService.preallocate(sessionID, params.FileSize)
+	if err != nil {
+		s.ReleaseReservation(sessionID)
+		return err
+	}
+	if allocated {
+		s.ReleaseReservation(sessionID)
+	}
+	sessionData["assembly"] = AssemblyPreallocate
+	return nil
+}
+
+// releaseAssembly снимает резерв места и удаляет выделенный файл сессии, которую не удалось сохранить.
+func (s *SessionService) releaseAssembly(sessionID string) {
+	s.ReleaseReservation(sessionID)
+	if err := s.FileService.removePreallocated(sessionID); err != nil {
+		log.Printf("Failed to remove preallocated file of session %s: %v", sessionID, err)
+	}
+}
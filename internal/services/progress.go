@@ -0,0 +1,150 @@
+package services
+
+import (
+	"BASProject/internal/storage"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+)
+
+// Типы событий прогресса сессии.
+const (
+	ProgressSnapshot  = "progress"
+	ProgressChunk     = "chunk"
+	ProgressCompleted = "completed"
+	ProgressFailed    = "failed"
+	ProgressDeleted   = "deleted"
+)
+
+// progressBuffer — число событий, которые подписчик может не успеть прочитать;
+// при переполнении новые события для него пропускаются.
+const progressBuffer = 64
+
+var errProgressDisabled = errors.New("progress events are disabled")
+
+// ProgressEvent — событие прогресса загрузки. RemainingSize равен -1, пока размер
+// отложенной сессии неизвестен.
+type ProgressEvent struct {
+	Type          string `json:"type"`
+	SessionID     string `json:"session_id"`
+	ChunkID       int    `json:"chunk_id,omitempty"`
+	Offset        *int64 `json:"offset,omitempty"`
+	Size          int64  `json:"size,omitempty"`
+	UploadedSize  int64  `json:"uploaded_size"`
+	FileSize      int64  `json:"file_size"`
+	RemainingSize int64  `json:"remaining_size"`
+	Status        string `json:"status,omitempty"`
+	FileName      string `json:"file_name,omitempty"`
+	FileHash      string `json:"file_hash,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// Final сообщает, что после события поток сессии завершается.
+func (e ProgressEvent) Final() bool {
+	return e.Type == ProgressCompleted || e.Type == ProgressFailed || e.Type == ProgressDeleted
+}
+
+// ProgressService рассылает события прогресса подписчикам сессии через Redis pub/sub,
+// поэтому поток событий работает при балансировке между узлами.
+// Без Redis события рассылаются в пределах процесса.
+// Методы безопасно вызывать у nil: события тогда не публикуются.
+type ProgressService struct {
+	Storage *storage.RedisClient
+
+	mu          sync.Mutex
+	subscribers map[string]map[chan ProgressEvent]struct{}
+}
+
+func NewProgressService(storage *storage.RedisClient) *ProgressService {
+	return &ProgressService{
+		Storage:     storage,
+		subscribers: map[string]map[chan ProgressEvent]struct{}{},
+	}
+}
+
+// Publish рассылает событие; ошибки доставки только логируются.
+func (p *ProgressService) Publish(event ProgressEvent) {
+	if p == nil {
+		return
+	}
+	if p.Storage == nil {
+		p.publishLocal(event)
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err == nil {
+		err = p.Storage.PublishSessionEvent(event.SessionID, payload)
+	}
+	if err != nil {
+		log.Printf("Failed to publish %s event for session %s: %v", event.Type, event.SessionID, err)
+	}
+}
+
+// Subscribe возвращает события сессии до отмены c; затем канал закрывается.
+func (p *ProgressService) Subscribe(c context.Context, sessionID string) (<-chan ProgressEvent, error) {
+	if p == nil {
+		return nil, errProgressDisabled
+	}
+	events := make(chan ProgressEvent, progressBuffer)
+	if p.Storage == nil {
+		p.mu.Lock()
+		if p.subscribers[sessionID] == nil {
+			p.subscribers[sessionID] = map[chan ProgressEvent]struct{}{}
+		}
+		p.subscribers[sessionID][events] = struct{}{}
+		p.mu.Unlock()
+
+		go func() {
+			<-c.Done()
+			p.mu.Lock()
+			delete(p.subscribers[sessionID], events)
+			if len(p.subscribers[sessionID]) == 0 {
+				delete(p.subscribers, sessionID)
+			}
+			close(events)
+			p.mu.Unlock()
+		}()
+		return events, nil
+	}
+
+	payloads, err := p.Storage.SubscribeSessionEvents(c, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer close(events)
+		for payload := range payloads {
+			var event ProgressEvent
+			if err := json.Unmarshal(payload, &event); err != nil {
+				log.Printf("Skipping malformed progress event for session %s: %v", sessionID, err)
+				continue
+			}
+			select {
+			case events <- event:
+			default:
+			}
+		}
+	}()
+	return events, nil
+}
+
+func (p *ProgressService) publishLocal(event ProgressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for events := range p.subscribers[event.SessionID] {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// remaining возвращает оставшийся объём или -1, если размер файла неизвестен.
+func remaining(fileSize, uploadedSize int64) int64 {
+	if fileSize <= 0 {
+		return -1
+	}
+	return max(fileSize-uploadedSize, 0)
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"BASProject/internal/storage"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Режимы адресации чанков в сессии.
+// В режиме fixed все чанки, кроме последнего, имеют размер chunk_size и адресуются номером.
+// В режиме offset клиент сам выбирает размер каждого чанка и передаёт его смещение в байтах.
+const (
+	ChunkModeFixed  = "fixed"
+	ChunkModeOffset = "offset"
+)
+
+var (
+	ErrChunkModeMismatch = errors.New("chunk addressing does not match the session chunk mode")
+	ErrChunkOverlap      = errors.New("chunk overlaps an already uploaded range")
+	ErrChunkSizeInvalid  = errors.New("invalid chunk size")
+	ErrChunkOutOfRange   = errors.New("chunk is outside of the file")
+	ErrSessionBusy       = errors.New("session is locked by another request")
+)
+
+// chunkMode возвращает режим адресации чанков сессии; старые сессии — fixed.
+func chunkMode(sessionData map[string]interface{}) string {
+	if mode, _ := sessionData["chunk_mode"].(string); mode == ChunkModeOffset {
+		return ChunkModeOffset
+	}
+	return ChunkModeFixed
+}
+
+// ChunkLength возвращает размер, который должен иметь чанк chunkID файла fileSize,
+// разбитого на чанки chunkSize: все чанки, кроме последнего, имеют размер chunkSize.
+func ChunkLength(chunkID int, chunkSize, fileSize int64) (int64, error) {
+	if chunkSize <= 0 || fileSize <= 0 {
+		return 0, fmt.Errorf("%w: chunk size %d, file size %d", ErrChunkSizeInvalid, chunkSize, fileSize)
+	}
+	totalChunks := int((fileSize-1)/chunkSize + 1)
+	if chunkID < 1 || chunkID > totalChunks {
+		return 0, fmt.Errorf("%w: chunk %d is outside of 1..%d", ErrChunkOutOfRange, chunkID, totalChunks)
+	}
+	if chunkID == totalChunks {
+		return fileSize - int64(totalChunks-1)*chunkSize, nil
+	}
+	return chunkSize, nil
+}
+
+// ValidateChunk проверяет, что чанк chunkID длиной length укладывается в геометрию сессии:
+// номер лежит в 1..total_chunks, все чанки, кроме последнего, имеют размер ровно chunkSize,
+// последний — остаток файла. Пока размер отложенной сессии неизвестен (fileSize == 0),
+// допускается любой номер и размер от 1 до chunkSize; остальное проверяется при завершении.
+func ValidateChunk(chunkID int, length, chunkSize, fileSize int64) error {
+	min, max, err := chunkLengthRange(chunkID, chunkSize, fileSize)
+	if err != nil {
+		return err
+	}
+	if length < min || length > max {
+		expected := fmt.Sprintf("%d", min)
+		if min != max {
+			expected = fmt.Sprintf("%d..%d", min, max)
+		}
+		return fmt.Errorf("%w: chunk %d has %d bytes, expected %s", ErrChunkSizeInvalid, chunkID, length, expected)
+	}
+	return nil
+}
+
+// chunkLengthRange возвращает допустимые размеры чанка chunkID или ошибку, если номер вне файла.
+func chunkLengthRange(chunkID int, chunkSize, fileSize int64) (int64, int64, error) {
+	if fileSize > 0 {
+		length, err := ChunkLength(chunkID, chunkSize, fileSize)
+		return length, length, err
+	}
+	if chunkSize <= 0 {
+		return 0, 0, fmt.Errorf("%w: chunk size %d", ErrChunkSizeInvalid, chunkSize)
+	}
+	// Смещение чанка (chunkID-1)*chunkSize должно помещаться в int64
+	if last := math.MaxInt64 / chunkSize; chunkID < 1 || int64(chunkID) > last {
+		return 0, 0, fmt.Errorf("%w: chunk %d is outside of 1..%d", ErrChunkOutOfRange, chunkID, last)
+	}
+	return 1, chunkSize, nil
+}
+
+// offsetPartPath — путь к файлу чанка, загруженного по смещению.
+func offsetPartPath(localPath, sessionID string, offset int64) string {
+	return filepath.Join(localPath, fmt.Sprintf("%s_o%d.part", sessionID, offset))
+}
+
+// rangeCoverage считает загруженный объём и пропуски в [0, size).
+// Если size == 0 (размер потока ещё неизвестен), учитываются только пропуски между диапазонами.
+func rangeCoverage(ranges []storage.ChunkRange, size int64) (int64, []storage.ChunkRange) {
+	sorted := append([]storage.ChunkRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Offset < sorted[j].Offset })
+
+	uploaded := int64(0)
+	gaps := []storage.ChunkRange{}
+	next := int64(0)
+	for _, rng := range sorted {
+		if rng.Offset > next {
+			gaps = append(gaps, storage.ChunkRange{Offset: next, Length: rng.Offset - next})
+		}
+		uploaded += rng.Length
+		if end := rng.Offset + rng.Length; end > next {
+			next = end
+		}
+	}
+	if size > next {
+		gaps = append(gaps, storage.ChunkRange{Offset: next, Length: size - next})
+	}
+	return uploaded, gaps
+}
+
+// withSessionLock выполняет fn под блокировкой сессии в Redis.
+func (f *FileService) withSessionLock(sessionID string, fn func() error) error {
+	lockKey := fmt.Sprintf("%s:lock", sessionID)
+	for attempt := 0; ; attempt++ {
+		acquired, err := f.Storage.AcquireLock(lockKey, 30)
+		if err != nil {
+			return fmt.Errorf("failed to acquire session lock: %w", err)
+		}
+		if acquired {
+			break
+		}
+		if attempt >= 250 {
+			return ErrSessionBusy
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	defer f.Storage.ReleaseLock(lockKey)
+	return fn()
+}
+
+// SaveChunkAt сохраняет чанк произвольного размера по смещению offset.
+// Размер чанка должен лежать в [min_size, max_size]; меньше min_size может быть только последний чанк.
+func (f *FileService) SaveChunkAt(sessionID string, offset int64, chunkData []byte) error {
+	if offset == 0 {
+		if err := f.checkFirstChunk(sessionID, chunkData); err != nil {
+			return err
+		}
+	}
+	return f.addRange(sessionID, offset, int64(len(chunkData)), func(partPath string) error {
+		if err := f.writeStored(partPath, chunkData); err != nil {
+			return fmt.Errorf("failed to write chunk file: %w", err)
+		}
+		return nil
+	})
+}
+
+// addRange проверяет диапазон [offset, offset+length) сессии в режиме offset и под блокировкой
+// сессии создаёт файл чанка через write, после чего отмечает диапазон загруженным.
+func (f *FileService) addRange(sessionID string, offset, length int64, write func(partPath string) error) error {
+	exists, err := f.Storage.SessionExists(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to check session existence: %w", err)
+	}
+	if exists == 0 {
+		return ErrSessionNotFound
+	}
+	sessionData, err := f.Storage.GetSessionData(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session data: %w", err)
+	}
+	if chunkMode(sessionData) != ChunkModeOffset {
+		return ErrChunkModeMismatch
+	}
+
+	fileSize, err := extractInt64(sessionData["file_size"])
+	if err != nil {
+		return fmt.Errorf("invalid file size in session data: %v", err)
+	}
+	deferred := isDeferred(sessionData)
+	maxSize, minSize := int64(f.Chunking.MaxSize), int64(f.Chunking.MinSize)
+
+	switch {
+	case offset < 0:
+		return fmt.Errorf("%w: offset %d is negative", ErrChunkSizeInvalid, offset)
+	case length == 0:
+		return fmt.Errorf("%w: chunk is empty", ErrChunkSizeInvalid)
+	case length > maxSize:
+		return fmt.Errorf("%w: %d bytes exceeds the maximum of %d bytes", ErrChunkSizeInvalid, length, maxSize)
+	case !deferred && offset+length > fileSize:
+		return fmt.Errorf("%w: range [%d, %d) exceeds the file size of %d bytes", ErrChunkSizeInvalid, offset, offset+length, fileSize)
+	case !deferred && length < minSize && offset+length != fileSize:
+		return fmt.Errorf("%w: %d bytes is below the minimum of %d bytes and is not the last chunk", ErrChunkSizeInvalid, length, minSize)
+	}
+
+	return f.withSessionLock(sessionID, func() error {
+		ranges, err := f.Storage.GetUploadedRanges(sessionID)
+		if err != nil {
+			return fmt.Errorf("failed to get uploaded ranges: %w", err)
+		}
+		for _, rng := range ranges {
+			if rng.Offset == offset && rng.Length == length {
+				log.Printf("Range at offset %d for session %s already exists. Skipping upload.", offset, sessionID)
+				return ErrChunkAlreadyExists
+			}
+			if offset < rng.Offset+rng.Length && rng.Offset < offset+length {
+				return fmt.Errorf("%w: [%d, %d) intersects [%d, %d)", ErrChunkOverlap, offset, offset+length, rng.Offset, rng.Offset+rng.Length)
+			}
+		}
+
+		log.Printf("Saving %d bytes at offset %d for session %s", length, offset, sessionID)
+		if err := write(offsetPartPath(f.LocalPath, sessionID, offset)); err != nil {
+			return err
+		}
+		if err := f.Storage.AddUploadedRange(sessionID, offset, length); err != nil {
+			return fmt.Errorf("failed to mark range at offset %d as uploaded: %w", offset, err)
+		}
+		uploadedSize, err := f.Storage.UpdateUploadedSize(sessionID, length)
+		if err != nil {
+			return fmt.Errorf("failed to mark range at offset %d as uploaded: %w", offset, err)
+		}
+		f.Progress.Publish(ProgressEvent{
+			Type:          ProgressChunk,
+			SessionID:     sessionID,
+			Offset:        &offset,
+			Size:          length,
+			UploadedSize:  uploadedSize,
+			FileSize:      fileSize,
+			RemainingSize: remaining(fileSize, uploadedSize),
+		})
+		return nil
+	})
+}
+
+// uploadedRanges возвращает диапазоны, у которых есть файл чанка на диске.
+func (f *FileService) uploadedRanges(sessionID string) ([]storage.ChunkRange, error) {
+	ranges, err := f.Storage.GetUploadedRanges(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get uploaded ranges: %w", err)
+	}
+	onDisk := []storage.ChunkRange{}
+	for _, rng := range ranges {
+		if _, err := os.Stat(offsetPartPath(f.LocalPath, sessionID, rng.Offset)); err == nil {
+			onDisk = append(onDisk, rng)
+		}
+	}
+	return onDisk, nil
+}
+
+// assembleRanges собирает файл из чанков, загруженных по смещению.
+func (f *FileService) assembleRanges(sessionID string, fileSize int64, outputFilePath string) error {
+	ranges, err := f.uploadedRanges(sessionID)
+	if err != nil {
+		return err
+	}
+	uploaded, gaps := rangeCoverage(ranges, fileSize)
+	if len(gaps) > 0 || uploaded != fileSize {
+		return fmt.Errorf("missing ranges: %v", gaps)
+	}
+
+	outputFile, err := f.createStored(outputFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", storageError(err))
+	}
+	defer outputFile.Close()
+
+	for _, rng := range ranges {
+		chunkFile := offsetPartPath(f.LocalPath, sessionID, rng.Offset)
+		if err := f.appendChunk(outputFile, chunkFile); err != nil {
+			return fmt.Errorf("failed to append chunk %s: %w", chunkFile, storageError(err))
+		}
+	}
+	return storageError(outputFile.Close())
+}
+
+// finalizeRanges проверяет, что диапазоны отложенной сессии без пропусков покрывают fileSize.
+func (s *SessionService) finalizeRanges(sessionID string, fileSize int64) error {
+	ranges, err := s.FileService.uploadedRanges(sessionID)
+	if err != nil {
+		return err
+	}
+	uploaded, gaps := rangeCoverage(ranges, fileSize)
+	if len(gaps) > 0 || uploaded != fileSize {
+		return fmt.Errorf("%w: declared %d bytes, uploaded %d bytes, missing ranges %v", ErrDeferredSizeInvalid, fileSize, uploaded, gaps)
+	}
+	minSize := int64(s.FileService.Chunking.MinSize)
+	for i, rng := range ranges {
+		if i < len(ranges)-1 && rng.Length < minSize {
+			return fmt.Errorf("%w: chunk at offset %d has %d bytes, below the minimum of %d bytes", ErrChunkSizeInvalid, rng.Offset, rng.Length, minSize)
+		}
+	}
+	return nil
+}
+
+// rangeUploadStatus формирует статус сессии в режиме offset.
+func (s *SessionService) rangeUploadStatus(sessionID string, sessionData map[string]interface{}, fileSize int64) (map[string]interface{}, error) {
+	ranges, err := s.FileService.uploadedRanges(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	uploaded, gaps := rangeCoverage(ranges, fileSize)
+
+	isComplete := fileSize > 0 && len(gaps) == 0 && uploaded == fileSize
+	message := "Upload is in progress."
+	if isComplete {
+		message = "Upload is complete."
+	}
+
+	status := map[string]interface{}{
+		"file_name":       sessionData["file_name"],
+		"file_size":       fileSize,
+		"uploaded_size":   uploaded,
+		"completed":       isComplete,
+		"remaining_size":  fileSize - uploaded,
+		"status":          sessionData["status"].(string),
+		"chunk_mode":      ChunkModeOffset,
+		"uploaded_ranges": ranges,
+		"missing_ranges":  gaps,
+		"uploaded_chunks": []int{},
+		"pending_chunks":  []int{},
+		"total_chunks":    len(ranges),
+		"deferred":        isDeferred(sessionData),
+		"file_hash":       sessionFileHash(sessionID, sessionData),
+		"message":         message,
+	}
+	addFileMeta(status, sessionData)
+	return status, nil
+}
@@ -2,11 +2,13 @@ package services
 
 import (
 	"BASProject/internal/storage"
+	"BASProject/internal/utils"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 )
 
@@ -16,13 +18,64 @@ type SessionService struct {
 }
 
 type ISessionService interface {
-	CreateSession(fileName string, fileSize int64, fileHash string) (int64, error)
+	CreateSession(params SessionParams) (*SessionInfo, error)
 	GetUploadStatus(fileHash string) (map[string]interface{}, error)
 	UpdateProgress(fileHash string) error
+	FinalizeSession(sessionID string, fileHash string, fileSize int64) error
 	DeleteSession(fileHash string) error
+	ListSessions() ([]map[string]interface{}, error)
+	QuerySessions(filter SessionFilter) (*SessionPage, error)
+	SessionDetails(sessionID string) (map[string]interface{}, error)
+	Fsck(repair bool) (*FsckReport, error)
+	ReleaseReservation(sessionID string) error
 	GetFileService() IFileService
 }
 
+// SessionParams — параметры запроса /upload/start.
+// В режиме Deferred хеш и итоговый размер файла неизвестны заранее
+// (например, при загрузке из stdin) и передаются только при завершении.
+type SessionParams struct {
+	FileName           string
+	FileSize           int64
+	FileHash           string
+	Deferred           bool
+	PreferredChunkSize int64
+	ChunkMode          string
+	// Owner — необязательный владелец загрузки для фильтрации в административном API.
+	Owner string
+	// ContentType и Metadata переносятся на собранный файл и отдаются при скачивании.
+	ContentType string
+	Metadata    map[string]string
+	// Namespace — пространство имён, в корне которого сохраняется файл; пустое — корень хранилища.
+	Namespace string
+	// Extract — распаковать архив после завершения загрузки в ExtractDir (по умолчанию — имя архива без расширения).
+	Extract    bool
+	ExtractDir string
+	// Batch — пакет, в который входит файл; в хранилище он переносится при фиксации пакета.
+	Batch string
+}
+
+// SessionInfo — результат создания сессии, возвращаемый клиенту.
+// MinChunkSize и MaxChunkSize ограничивают размеры чанков в режиме offset.
+// Status "already_present" означает, что файл с таким хешем уже хранится
+// и сохранён под именем StoredName без загрузки.
+type SessionInfo struct {
+	SessionID string
+	Status    string
+	// FileName — ключ хранилища, в который превращено имя файла клиента.
+	FileName   string
+	StoredName string
+	// Version — номер версии файла StoredName, созданного без загрузки.
+	Version int
+	// ExtractDir — каталог распаковки такого файла, разрешённый в пространстве имён.
+	ExtractDir   string
+	ChunkSize    int64
+	Deferred     bool
+	ChunkMode    string
+	MinChunkSize int64
+	MaxChunkSize int64
+}
+
 func NewSessionService(storage *storage.RedisClient, fileService *FileService) *SessionService {
 	return &SessionService{
 		Storage:     storage,
@@ -30,30 +83,87 @@ func NewSessionService(storage *storage.RedisClient, fileService *FileService) *
 	}
 }
 
-var ErrSessionNotFound = errors.New("session not found")
+var (
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrSessionNotDeferred  = errors.New("session does not accept deferred file hash")
+	ErrDeferredSizeInvalid = errors.New("uploaded chunks do not match the declared file size")
+)
 
 // CreateSession creates a new file upload session using the file hash provided by the client.
-func (s *SessionService) CreateSession(fileName string, fileSize int64, fileHash string) (int64, error) {
+// In deferred mode the session ID is generated by the server, and the hash is supplied on completion.
+func (s *SessionService) CreateSession(params SessionParams) (*SessionInfo, error) {
+	switch params.ChunkMode {
+	case "":
+		params.ChunkMode = ChunkModeFixed
+	case ChunkModeFixed, ChunkModeOffset:
+	default:
+		return nil, fmt.Errorf("unknown chunk mode %q", params.ChunkMode)
+	}
+	if err := ValidateFileMeta(params.ContentType, params.Metadata); err != nil {
+		return nil, err
+	}
+	// Имя клиента (часто полный локальный путь) становится безопасным ключом в пространстве имён
+	fileName, err := s.FileService.ResolveFileName(params.Namespace, params.FileName)
+	if err != nil {
+		return nil, err
+	}
+	params.FileName = fileName
+	if params.ExtractDir != "" {
+		if params.ExtractDir, err = s.FileService.ResolveFileName(params.Namespace, params.ExtractDir); err != nil {
+			return nil, err
+		}
+	}
+	if err := ValidateExtraction(params.FileName, params.Extract, params.ExtractDir); err != nil {
+		return nil, err
+	}
+	if err := s.FileService.CheckFileName(params.FileName, params.ContentType); err != nil {
+		return nil, err
+	}
+	// При политике reject занятое имя отклоняется до загрузки
+	if err := s.FileService.CheckConflict(params.FileName); err != nil {
+		return nil, err
+	}
+	if params.Batch != "" {
+		return s.createBatchSession(params)
+	}
+	if params.Deferred {
+		return s.createDeferredSession(params)
+	}
+
+	fileName, fileSize, fileHash := params.FileName, params.FileSize, params.FileHash
 	if fileName == "" || fileSize <= 0 || fileHash == "" {
-		return 0, errors.New("invalid file name, file size, or file hash")
+		return nil, errors.New("invalid file name, file size, or file hash")
+	}
+
+	// Файл с таким содержимым уже хранится: создаём новый файл ссылкой без загрузки
+	storedName, version, err := s.FileService.LinkContent(fileHash, fileName)
+	if err == nil {
+		meta := FileMeta{ContentType: params.ContentType, Metadata: params.Metadata, SessionID: fileHash, FileHash: fileHash, Owner: params.Owner}
+		if err := s.FileService.SaveFileMeta(storedName, meta); err != nil {
+			log.Printf("Failed to save metadata of %s: %v", storedName, err)
+		}
+		return &SessionInfo{SessionID: fileHash, Status: "already_present", FileName: fileName, StoredName: storedName, Version: version, ExtractDir: params.ExtractDir}, nil
+	}
+	if !errors.Is(err, ErrContentNotFound) {
+		return nil, fmt.Errorf("failed to reuse stored content: %w", err)
 	}
 
 	// Проверяем, существует ли сессия по хешу
 	exists, err := s.Storage.SessionExists(fileHash)
 	if err != nil {
-		return 0, fmt.Errorf("failed to check session existence: %w", err)
+		return nil, fmt.Errorf("failed to check session existence: %w", err)
 	}
 	if exists > 0 {
 		// Если сессия существует, получаем её статус
 		sessionData, err := s.Storage.GetSessionData(fileHash)
 		if err != nil {
-			return 0, fmt.Errorf("failed to retrieve session data: %w", err)
+			return nil, fmt.Errorf("failed to retrieve session data: %w", err)
 		}
 
 		sessionStatus, ok := sessionData["status"].(string)
 		if !ok {
 			log.Printf("Invalid session status: %v", sessionData)
-			return 0, errors.New("invalid session status")
+			return nil, errors.New("invalid session status")
 		}
 
 		switch sessionStatus {
@@ -61,18 +171,20 @@ func (s *SessionService) CreateSession(fileName string, fileSize int64, fileHash
 			// Удаляем текущую сессию и начинаем заново
 			err = s.DeleteSession(fileHash)
 			if err != nil {
-				return 0, fmt.Errorf("failed to delete completed session: %w", err)
+				return nil, fmt.Errorf("failed to delete completed session: %w", err)
 			}
 
 		case "in_progress":
-			// Возвращаем существующую информацию о чанках
-			return sessionData["chunk_size"].(int64), nil
+			// Возвращаем существующую информацию о чанках; режим адресации остаётся прежним
+			info := s.sessionInfo(fileHash, sessionData["chunk_size"].(int64), false, chunkMode(sessionData))
+			info.Status = "in_progress"
+			info.FileName, _ = sessionData["file_name"].(string)
+			return info, nil
 		}
 	}
 
 	// Новая сессия: определяем размер чанков
-	maxChunkSize := int64(1024 * 1024 * 1024) // 1GB max chunk size
-	chunkSize := s.FileService.CalculateChunkSize(fileSize, maxChunkSize)
+	chunkSize := s.FileService.CalculateChunkSize(fileSize, params.PreferredChunkSize)
 
 	log.Printf("Creating session with fileHash: %s", fileHash)
 	sessionData := map[string]interface{}{
@@ -81,14 +193,190 @@ func (s *SessionService) CreateSession(fileName string, fileSize int64, fileHash
 		"chunk_size":    chunkSize,
 		"uploaded_size": 0,
 		"status":        "in_progress",
+		"chunk_mode":    params.ChunkMode,
+	}
+	setSessionMeta(sessionData, params)
+	if err := s.reserveAssembly(fileHash, sessionData, params); err != nil {
+		return nil, err
 	}
 	err = s.Storage.SaveSession(fileHash, sessionData)
 	if err != nil {
 		log.Printf("Error saving session to Redis: %v", err)
-		return 0, fmt.Errorf("failed to save session: %w", err)
+		s.releaseAssembly(fileHash)
+		return nil, fmt.Errorf("failed to save session: %w", err)
 	}
 	log.Printf("Session %s saved successfully", fileHash)
-	return chunkSize, nil
+	info := s.sessionInfo(fileHash, chunkSize, false, params.ChunkMode)
+	info.FileName = fileName
+	return info, nil
+}
+
+func (s *SessionService) sessionInfo(sessionID string, chunkSize int64, deferred bool, mode string) *SessionInfo {
+	return &SessionInfo{
+		SessionID:    sessionID,
+		Status:       "created",
+		ChunkSize:    chunkSize,
+		Deferred:     deferred,
+		ChunkMode:    mode,
+		MinChunkSize: int64(s.FileService.Chunking.MinSize),
+		MaxChunkSize: int64(s.FileService.Chunking.MaxSize),
+	}
+}
+
+// createDeferredSession создаёт сессию для потока неизвестного размера.
+// FileSize, если передан, используется только как подсказка для выбора размера чанка.
+func (s *SessionService) createDeferredSession(params SessionParams) (*SessionInfo, error) {
+	if params.FileName == "" || params.FileSize < 0 {
+		return nil, errors.New("invalid file name or file size")
+	}
+
+	sessionID := utils.GenerateSessionID()
+	chunkSize := s.FileService.CalculateChunkSize(params.FileSize, params.PreferredChunkSize)
+
+	log.Printf("Creating deferred session %s for %s", sessionID, params.FileName)
+	sessionData := map[string]interface{}{
+		"file_name":     params.FileName,
+		"file_size":     0,
+		"chunk_size":    chunkSize,
+		"uploaded_size": 0,
+		"status":        "in_progress",
+		"deferred":      true,
+		"chunk_mode":    params.ChunkMode,
+	}
+	setSessionMeta(sessionData, params)
+	// Размер потока неизвестен: резервируем место по подсказке клиента, если она есть
+	if err := s.reserveSpace(sessionID, params.FileSize, false); err != nil {
+		return nil, err
+	}
+	if err := s.Storage.SaveSession(sessionID, sessionData); err != nil {
+		log.Printf("Error saving session to Redis: %v", err)
+		s.ReleaseReservation(sessionID)
+		return nil, fmt.Errorf("failed to save session: %w", err)
+	}
+	info := s.sessionInfo(sessionID, chunkSize, true, params.ChunkMode)
+	info.FileName = params.FileName
+	return info, nil
+}
+
+// createBatchSession создаёт сессию файла пакета. Идентификатор генерируется сервером,
+// чтобы одинаковое содержимое в разных пакетах не делило одну сессию. Если содержимое
+// уже хранится, сессия не создаётся: файл создаётся ссылкой при фиксации пакета.
+func (s *SessionService) createBatchSession(params SessionParams) (*SessionInfo, error) {
+	if params.Deferred || params.Extract {
+		return nil, errors.New("batch files cannot be deferred or extracted")
+	}
+	if params.FileName == "" || params.FileSize <= 0 || params.FileHash == "" {
+		return nil, errors.New("invalid file name, file size, or file hash")
+	}
+	if sourcePath, _, err := s.FileService.lookupContent(params.FileHash); err == nil {
+		// Хранимое содержимое проверяется политикой пространства имён нового файла
+		if err := s.FileService.CheckAssembledFile(params.FileName, sourcePath); err != nil {
+			return nil, err
+		}
+		return &SessionInfo{Status: "already_present", FileName: params.FileName}, nil
+	} else if !errors.Is(err, ErrContentNotFound) {
+		return nil, fmt.Errorf("failed to reuse stored content: %w", err)
+	}
+
+	sessionID := utils.GenerateSessionID()
+	chunkSize := s.FileService.CalculateChunkSize(params.FileSize, params.PreferredChunkSize)
+
+	log.Printf("Creating session %s for %s in batch %s", sessionID, params.FileName, params.Batch)
+	sessionData := map[string]interface{}{
+		"file_name":     params.FileName,
+		"file_size":     params.FileSize,
+		"file_hash":     params.FileHash,
+		"chunk_size":    chunkSize,
+		"uploaded_size": 0,
+		"status":        "in_progress",
+		"chunk_mode":    params.ChunkMode,
+		"batch_id":      params.Batch,
+	}
+	setSessionMeta(sessionData, params)
+	if err := s.reserveAssembly(sessionID, sessionData, params); err != nil {
+		return nil, err
+	}
+	if err := s.Storage.SaveSession(sessionID, sessionData); err != nil {
+		log.Printf("Error saving session to Redis: %v", err)
+		s.releaseAssembly(sessionID)
+		return nil, fmt.Errorf("failed to save session: %w", err)
+	}
+	info := s.sessionInfo(sessionID, chunkSize, false, params.ChunkMode)
+	info.FileName = params.FileName
+	return info, nil
+}
+
+// FinalizeSession фиксирует хеш и итоговый размер файла для отложенной сессии.
+// Загруженные чанки должны в точности покрывать fileSize.
+func (s *SessionService) FinalizeSession(sessionID string, fileHash string, fileSize int64) error {
+	exists, err := s.Storage.SessionExists(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to check session existence: %w", err)
+	}
+	if exists == 0 {
+		return ErrSessionNotFound
+	}
+
+	sessionData, err := s.Storage.GetSessionData(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve session data: %w", err)
+	}
+	if !isDeferred(sessionData) {
+		return ErrSessionNotDeferred
+	}
+	if fileHash == "" || fileSize <= 0 {
+		return errors.New("invalid file size or file hash")
+	}
+
+	if chunkMode(sessionData) == ChunkModeOffset {
+		if err := s.finalizeRanges(sessionID, fileSize); err != nil {
+			return err
+		}
+		return s.saveFinalizedSession(sessionID, sessionData, fileHash, fileSize)
+	}
+
+	chunkSize, err := extractInt64(sessionData["chunk_size"])
+	if err != nil {
+		return fmt.Errorf("invalid chunk size in session data: %v", err)
+	}
+	totalChunks := int((fileSize + chunkSize - 1) / chunkSize)
+
+	uploadedSize := int64(0)
+	for i := 1; i <= totalChunks; i++ {
+		chunkFile := filepath.Join(s.FileService.LocalPath, fmt.Sprintf("%s_%d.part", sessionID, i))
+		size, err := s.FileService.storedSize(chunkFile)
+		if err != nil {
+			return fmt.Errorf("%w: chunk %d is missing", ErrDeferredSizeInvalid, i)
+		}
+		// Размер потока стал известен: каждый чанк должен занимать ровно своё место в файле
+		if expected, _ := ChunkLength(i, chunkSize, fileSize); size != expected {
+			return fmt.Errorf("%w: chunk %d has %d bytes, expected %d", ErrDeferredSizeInvalid, i, size, expected)
+		}
+		uploadedSize += size
+	}
+	partCount, err := s.FileService.CountChunks(sessionID)
+	if err != nil {
+		return err
+	}
+	if partCount > totalChunks || uploadedSize != fileSize {
+		return fmt.Errorf("%w: declared %d bytes, uploaded %d bytes in %d chunks", ErrDeferredSizeInvalid, fileSize, uploadedSize, partCount)
+	}
+	return s.saveFinalizedSession(sessionID, sessionData, fileHash, fileSize)
+}
+
+// saveFinalizedSession записывает в отложенную сессию подтверждённые хеш и размер.
+func (s *SessionService) saveFinalizedSession(sessionID string, sessionData map[string]interface{}, fileHash string, fileSize int64) error {
+	// Теперь размер известен: резерв должен покрыть и собранную копию. Записанные в счёт
+	// прежнего резерва чанки уже лежат на диске, и нового места под них не требуется
+	if err := s.reserveSpace(sessionID, fileSize, false); err != nil {
+		return err
+	}
+	sessionData["file_size"] = fileSize
+	sessionData["file_hash"] = fileHash
+	if err := s.Storage.SaveSession(sessionID, sessionData); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
 }
 
 // UpdateProgress обновлен для использования LocalPath
@@ -111,10 +399,31 @@ func (s *SessionService) UpdateProgress(fileHash string) error {
 	totalChunks := int((fileSize + chunkSize - 1) / chunkSize)
 
 	uploadedSize := int64(0)
-	for i := 1; i <= totalChunks; i++ {
-		chunkFile := filepath.Join(s.FileService.LocalPath, fmt.Sprintf("%s_%d.part", fileHash, i))
-		if fi, err := os.Stat(chunkFile); err == nil {
-			uploadedSize += fi.Size()
+	covered := true
+	if chunkMode(sessionData) == ChunkModeOffset {
+		// Диапазоны могут прийти не по порядку: завершённой считается только сплошная загрузка
+		ranges, err := s.FileService.uploadedRanges(fileHash)
+		if err != nil {
+			return err
+		}
+		var gaps []storage.ChunkRange
+		uploadedSize, gaps = rangeCoverage(ranges, fileSize)
+		covered = len(gaps) == 0
+	} else if isPreallocated(sessionData) {
+		chunks, err := s.FileService.preallocatedChunks(fileHash, totalChunks)
+		if err != nil {
+			return err
+		}
+		for _, chunkID := range chunks {
+			size, _ := ChunkLength(chunkID, chunkSize, fileSize)
+			uploadedSize += size
+		}
+	} else {
+		for i := 1; i <= totalChunks; i++ {
+			chunkFile := filepath.Join(s.FileService.LocalPath, fmt.Sprintf("%s_%d.part", fileHash, i))
+			if size, err := s.FileService.storedSize(chunkFile); err == nil {
+				uploadedSize += size
+			}
 		}
 	}
 
@@ -125,7 +434,7 @@ func (s *SessionService) UpdateProgress(fileHash string) error {
 		return fmt.Errorf("failed to save updated session data: %w", err)
 	}
 
-	if uploadedSize >= fileSize {
+	if fileSize > 0 && covered && uploadedSize >= fileSize {
 		sessionData["status"] = "completed"
 	} else {
 		sessionData["status"] = "in_progress"
@@ -166,14 +475,38 @@ func (s *SessionService) GetUploadStatus(fileHash string) (map[string]interface{
 		return nil, fmt.Errorf("invalid chunk size in session data: %v", err)
 	}
 
+	if chunkMode(sessionData) == ChunkModeOffset {
+		return s.rangeUploadStatus(fileHash, sessionData, fileSize)
+	}
+
 	totalChunks := int((fileSize + chunkSize - 1) / chunkSize)
+	deferred := isDeferred(sessionData)
+	if deferred && fileSize == 0 {
+		// Размер потока ещё неизвестен: считаем полученные чанки по Redis
+		chunks, err := s.Storage.GetChunks(fileHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve chunks: %w", err)
+		}
+		sort.Ints(chunks)
+		totalChunks = 0
+		if len(chunks) > 0 {
+			totalChunks = chunks[len(chunks)-1]
+		}
+	}
 
-	// Проверяем фактическое наличие чанков на диске
+	// Проверяем фактическое наличие чанков на диске; чанки выделенного файла отмечены в битовой карте
 	uploadedChunks := []int{}
-	for i := 1; i <= totalChunks; i++ {
-		chunkFile := filepath.Join(s.FileService.LocalPath, fmt.Sprintf("%s_%d.part", fileHash, i))
-		if _, err := os.Stat(chunkFile); err == nil {
-			uploadedChunks = append(uploadedChunks, i)
+	if isPreallocated(sessionData) {
+		uploadedChunks, err = s.FileService.preallocatedChunks(fileHash, totalChunks)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for i := 1; i <= totalChunks; i++ {
+			chunkFile := filepath.Join(s.FileService.LocalPath, fmt.Sprintf("%s_%d.part", fileHash, i))
+			if _, err := os.Stat(chunkFile); err == nil {
+				uploadedChunks = append(uploadedChunks, i)
+			}
 		}
 	}
 
@@ -190,7 +523,7 @@ func (s *SessionService) GetUploadStatus(fileHash string) (map[string]interface{
 		}
 	}
 
-	isComplete := len(pendingChunks) == 0
+	isComplete := len(pendingChunks) == 0 && fileSize > 0
 	message := "Upload is in progress."
 	if isComplete {
 		message = "Upload is complete."
@@ -228,8 +561,11 @@ func (s *SessionService) GetUploadStatus(fileHash string) (map[string]interface{
 		"uploaded_chunks": uploadedChunks,
 		"pending_chunks":  pendingChunks,
 		"total_chunks":    totalChunks,
+		"deferred":        deferred,
+		"file_hash":       sessionFileHash(fileHash, sessionData),
 		"message":         message,
 	}
+	addFileMeta(status, sessionData)
 
 	return status, nil
 }
@@ -258,6 +594,33 @@ func (s *SessionService) DeleteSession(fileHash string) error {
 	return nil
 }
 
+// ListSessions возвращает краткие сведения обо всех сессиях, отсортированные по идентификатору.
+func (s *SessionService) ListSessions() ([]map[string]interface{}, error) {
+	ids, err := s.Storage.ListSessionIDs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	sort.Strings(ids)
+
+	sessions := []map[string]interface{}{}
+	for _, id := range ids {
+		exists, err := s.Storage.SessionExists(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check session existence: %w", err)
+		}
+		if exists == 0 {
+			// Сессия удалена или истекла, а индекс ещё не обновлён
+			continue
+		}
+		sessionData, err := s.Storage.GetSessionData(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve session %s: %w", id, err)
+		}
+		sessions = append(sessions, sessionSummary(id, sessionData))
+	}
+	return sessions, nil
+}
+
 func (s *SessionService) GetFileService() IFileService {
 	return s.FileService
 }
@@ -272,6 +635,24 @@ func (fs *FileService) CountChunks(fileHash string) (int, error) {
 	return len(files), nil
 }
 
+// sessionFileHash возвращает ожидаемый SHA-256 файла: хеш, записанный в сессии (сессии пакетов
+// и завершённые отложенные), или идентификатор сессии. Отложенная сессия без хеша — пустая строка.
+func sessionFileHash(sessionID string, sessionData map[string]interface{}) string {
+	if hash, _ := sessionData["file_hash"].(string); hash != "" {
+		return hash
+	}
+	if isDeferred(sessionData) {
+		return ""
+	}
+	return sessionID
+}
+
+// isDeferred сообщает, ожидает ли сессия хеш и размер файла при завершении.
+func isDeferred(sessionData map[string]interface{}) bool {
+	v, _ := sessionData["deferred"].(string)
+	return v == "true"
+}
+
 func extractInt64(value interface{}) (int64, error) {
 	switch v := value.(type) {
 	case int64:
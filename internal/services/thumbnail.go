@@ -0,0 +1,250 @@
+package services
+
+import (
+	"BASProject/config"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // декодер GIF: копии строятся по первому кадру
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// thumbnailDir — служебный каталог с уменьшенными копиями изображений: .thumbnails/<имя файла>/<размер>.<ext>.
+const thumbnailDir = ".thumbnails"
+
+// Ограничения обработчика thumbnail по умолчанию.
+const (
+	defaultThumbnailSizes     = "128,512"
+	defaultThumbnailMaxPixels = 50_000_000
+	defaultThumbnailQuality   = 85
+	maxThumbnailSize          = 4096
+)
+
+var ErrThumbnailNotFound = errors.New("thumbnail not found")
+
+// Thumbnail описывает уменьшенную копию изображения. Size — сторона квадрата,
+// в который вписано изображение; Width и Height — фактические размеры.
+type Thumbnail struct {
+	Size        int    `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+}
+
+func thumbnailDirFor(localPath, name string) string {
+	return filepath.Join(localPath, thumbnailDir, filepath.FromSlash(name))
+}
+
+func thumbnailPath(localPath, name string, thumb Thumbnail) string {
+	ext := ".png"
+	if thumb.ContentType == "image/jpeg" {
+		ext = ".jpg"
+	}
+	return filepath.Join(thumbnailDirFor(localPath, name), strconv.Itoa(thumb.Size)+ext)
+}
+
+// OpenThumbnail открывает уменьшенную копию файла name: наименьшую не меньше size,
+// а если таких нет — наибольшую. size <= 0 выбирает наименьшую.
+func (f *FileService) OpenThumbnail(name string, size int) (FileReader, *Thumbnail, error) {
+	meta, err := f.GetFileMeta(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read file metadata: %w", err)
+	}
+	if meta == nil || len(meta.Thumbnails) == 0 {
+		return nil, nil, ErrThumbnailNotFound
+	}
+	if !meta.Available() {
+		return nil, nil, fmt.Errorf("%w: %s", ErrFileNotAvailable, meta.Status)
+	}
+
+	thumbs := append([]Thumbnail(nil), meta.Thumbnails...)
+	sort.Slice(thumbs, func(i, j int) bool { return thumbs[i].Size < thumbs[j].Size })
+	chosen := thumbs[len(thumbs)-1]
+	for _, thumb := range thumbs {
+		if thumb.Size >= size {
+			chosen = thumb
+			break
+		}
+	}
+
+	reader, err := f.openStored(thumbnailPath(f.LocalPath, name, chosen))
+	if os.IsNotExist(err) {
+		return nil, nil, ErrThumbnailNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, &chosen, nil
+}
+
+// thumbnailProcessor создаёт уменьшенные копии изображений JPEG, PNG и GIF.
+// Прочие файлы и изображения больше max_pixels пропускаются без ошибки.
+//
+// Параметры: sizes — стороны квадратов через запятую, max_pixels, quality — качество JPEG.
+type thumbnailProcessor struct {
+	fileService *FileService
+	sizes       []int
+	maxPixels   int64
+	quality     int
+}
+
+func newThumbnailProcessor(cfg config.ProcessorConfig, fileService *FileService) (Processor, error) {
+	processor := &thumbnailProcessor{fileService: fileService, maxPixels: defaultThumbnailMaxPixels, quality: defaultThumbnailQuality}
+
+	sizes := cfg.Options["sizes"]
+	if sizes == "" {
+		sizes = defaultThumbnailSizes
+	}
+	for _, field := range strings.Split(sizes, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || size <= 0 || size > maxThumbnailSize {
+			return nil, fmt.Errorf("invalid thumbnail size %q: must be between 1 and %d", field, maxThumbnailSize)
+		}
+		processor.sizes = append(processor.sizes, size)
+	}
+	// Меньшие копии строятся из больших
+	sort.Sort(sort.Reverse(sort.IntSlice(processor.sizes)))
+
+	if value := cfg.Options["max_pixels"]; value != "" {
+		maxPixels, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || maxPixels <= 0 {
+			return nil, fmt.Errorf("invalid max_pixels %q", value)
+		}
+		processor.maxPixels = maxPixels
+	}
+	if value := cfg.Options["quality"]; value != "" {
+		quality, err := strconv.Atoi(value)
+		if err != nil || quality < 1 || quality > 100 {
+			return nil, fmt.Errorf("invalid quality %q: must be between 1 and 100", value)
+		}
+		processor.quality = quality
+	}
+	return processor, nil
+}
+
+func (t *thumbnailProcessor) Process(ctx context.Context, file *ProcessedFile) (string, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	// Размеры проверяются до декодирования, чтобы не распаковывать огромные изображения
+	imageConfig, format, err := image.DecodeConfig(reader)
+	if err != nil || (format != "jpeg" && format != "png" && format != "gif") {
+		return "not an image, skipped", nil
+	}
+	if int64(imageConfig.Width)*int64(imageConfig.Height) > t.maxPixels {
+		return fmt.Sprintf("%dx%d image exceeds %d pixels, skipped", imageConfig.Width, imageConfig.Height, t.maxPixels), nil
+	}
+	if _, err := reader.Seek(0, 0); err != nil {
+		return "", err
+	}
+	source, _, err := image.Decode(reader)
+	if err != nil {
+		return fmt.Sprintf("cannot decode %s image, skipped: %v", format, err), nil
+	}
+
+	// JPEG остаётся JPEG; PNG и GIF сохраняются в PNG, чтобы не потерять прозрачность
+	contentType := "image/png"
+	if format == "jpeg" {
+		contentType = "image/jpeg"
+	}
+	// Копии записываются, когда файл попадёт в хранилище под итоговым именем:
+	// до этого под именем может лежать прежняя версия со своими копиями
+	thumbs := []Thumbnail{}
+	encodedThumbs := [][]byte{}
+	current := source
+	for _, size := range t.sizes {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		width, height := fitSize(current.Bounds().Dx(), current.Bounds().Dy(), size)
+		if width != current.Bounds().Dx() || height != current.Bounds().Dy() {
+			current = scaleImage(current, width, height)
+		}
+
+		var encoded bytes.Buffer
+		if contentType == "image/jpeg" {
+			err = jpeg.Encode(&encoded, current, &jpeg.Options{Quality: t.quality})
+		} else {
+			err = png.Encode(&encoded, current)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to encode %dpx thumbnail: %w", size, err)
+		}
+		thumbs = append(thumbs, Thumbnail{Size: size, Width: width, Height: height, ContentType: contentType})
+		encodedThumbs = append(encodedThumbs, encoded.Bytes())
+	}
+
+	file.Annotate(func(name string, meta *FileMeta) {
+		if err := t.writeThumbnails(name, thumbs, encodedThumbs); err != nil {
+			log.Printf("Failed to write thumbnails of %s: %v", name, err)
+			return
+		}
+		sorted := append([]Thumbnail{}, thumbs...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i].Size < sorted[j].Size })
+		meta.Thumbnails = sorted
+	})
+	return fmt.Sprintf("generated %d thumbnails from %dx%d %s", len(thumbs), imageConfig.Width, imageConfig.Height, format), nil
+}
+
+// writeThumbnails записывает уменьшенные копии файла name.
+func (t *thumbnailProcessor) writeThumbnails(name string, thumbs []Thumbnail, encoded [][]byte) error {
+	if err := os.MkdirAll(thumbnailDirFor(t.fileService.LocalPath, name), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create thumbnail directory: %w", err)
+	}
+	for i, thumb := range thumbs {
+		if err := t.fileService.writeStored(thumbnailPath(t.fileService.LocalPath, name, thumb), encoded[i]); err != nil {
+			return fmt.Errorf("failed to write %dpx thumbnail: %w", thumb.Size, err)
+		}
+	}
+	return nil
+}
+
+// fitSize вписывает width×height в квадрат size×size с сохранением пропорций; не увеличивает.
+func fitSize(width, height, size int) (int, int) {
+	if width <= size && height <= size {
+		return width, height
+	}
+	if width >= height {
+		return size, max(1, height*size/width)
+	}
+	return max(1, width*size/height), size
+}
+
+// scaleImage уменьшает изображение усреднением блоков исходных пикселей.
+func scaleImage(src image.Image, width, height int) image.Image {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	dst := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*sh/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*sh/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*sw/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*sw/width)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,500 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Версии файлов: при загрузке под занятым именем (политика version) прежний файл переносится
+// в .versions/<sha256 имени>/<номер>, а под именем остаётся новый. Номер текущей версии хранится
+// в .versions/<sha256 имени>/current; файл без каталога версий — версия 1. Каталог называется
+// хешем, а не самим именем: иначе версии файла a/1 или a/current легли бы на версию 1 и
+// отметку текущей версии файла a.
+const (
+	versionsDir        = ".versions"
+	currentVersionFile = "current"
+)
+
+// Политики загрузки под занятым именем (storage.on_conflict и on_conflict пространства имён).
+const (
+	OnConflictVersion   = "version"
+	OnConflictOverwrite = "overwrite"
+	OnConflictReject    = "reject"
+	// OnConflictRename сохранён для совместимости с прежними конфигурациями: новый файл
+	// получает имя вида name(1).ext, и история версий не ведётся.
+	OnConflictRename = "rename"
+)
+
+var (
+	ErrFileExists      = errors.New("file already exists")
+	ErrVersionNotFound = errors.New("file version not found")
+)
+
+// FileVersion описывает одну версию файла.
+type FileVersion struct {
+	Version     int       `json:"version"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	Current     bool      `json:"current"`
+	FileHash    string    `json:"file_hash,omitempty"`
+	SessionID   string    `json:"session_id,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Status      string    `json:"status,omitempty"`
+}
+
+func versionDirFor(localPath, name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return filepath.Join(localPath, versionsDir, hex.EncodeToString(sum[:]))
+}
+
+func versionPath(localPath, name string, version int) string {
+	return filepath.Join(versionDirFor(localPath, name), strconv.Itoa(version))
+}
+
+// VersionMetaKey — ключ метаданных прежней версии для GetFileMeta; "|" не встречается в проверенных именах файлов.
+func VersionMetaKey(name string, version int) string {
+	return name + "|" + strconv.Itoa(version)
+}
+
+// storedKey проверяет имя файла из запроса и возвращает путь относительно хранилища;
+// служебные каталоги и файлы чанков недоступны.
+func storedKey(name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if name == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) || strings.HasSuffix(clean, ".part") ||
+		isInternalPath(clean) {
+		return "", ErrFileNotFound
+	}
+	return clean, nil
+}
+
+// ConflictPolicy возвращает политику загрузки под занятым именем для файла name.
+func (f *FileService) ConflictPolicy(name string) string {
+	if namespace := f.NamespaceOf(name); namespace != "" {
+		if policy := f.Namespaces[namespace].OnConflict; policy != "" {
+			return policy
+		}
+	}
+	if f.OnConflict != "" {
+		return f.OnConflict
+	}
+	return OnConflictVersion
+}
+
+// CheckConflict отклоняет загрузку под занятым именем заранее, если политика — reject.
+func (f *FileService) CheckConflict(name string) error {
+	if f.ConflictPolicy(name) == OnConflictReject && f.FileExists(name) {
+		return fmt.Errorf("%w: %s", ErrFileExists, name)
+	}
+	return nil
+}
+
+// AssemblyPath возвращает временный путь для сборки файла сессии; в хранилище файл
+// попадает через CommitFile.
+func (f *FileService) AssemblyPath(sessionID string) (string, error) {
+	return f.processingTemp("assemble-" + sessionID)
+}
+
+// processingTemp возвращает путь временного файла в каталоге .processing.
+// Суффикс .tmp исключает файл из перешифровки ключей.
+func (f *FileService) processingTemp(prefix string) (string, error) {
+	dir := filepath.Join(f.LocalPath, processingDir)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create processing directory: %w", err)
+	}
+	return filepath.Join(dir, prefix+".tmp"), nil
+}
+
+// CommitFile переносит собранный файл assembledPath в хранилище под именем name,
+// разрешая конфликт с существующим файлом по политике. Возвращает итоговое имя
+// (при политике rename оно может отличаться) и номер версии.
+func (f *FileService) CommitFile(name, assembledPath string) (string, int, error) {
+	return f.commitFile(name, assembledPath, f.ConflictPolicy(name), nil)
+}
+
+// commitFile — CommitFile с заданной политикой конфликта имён. prepare, если задан, получает
+// итоговое имя и то, станет ли прежний файл версией, до первого изменения хранилища;
+// его ошибка отменяет перенос. Имя по политике rename выбирается и занимается под одной
+// блокировкой versionsMu, поэтому два файла не получат одно имя.
+func (f *FileService) commitFile(name, assembledPath, policy string, prepare func(name string, archive bool) error) (string, int, error) {
+	f.versionsMu.Lock()
+	defer f.versionsMu.Unlock()
+
+	target := filepath.Join(f.LocalPath, filepath.FromSlash(name))
+	info, err := os.Stat(target)
+	if err != nil && !os.IsNotExist(err) {
+		return "", 0, fmt.Errorf("failed to check %s: %w", name, err)
+	}
+	exists := err == nil
+	if exists && info.IsDir() {
+		return "", 0, fmt.Errorf("%w: %s is a directory", ErrFileExists, name)
+	}
+
+	version, archive := 1, false
+	if exists {
+		switch policy {
+		case OnConflictReject:
+			return "", 0, fmt.Errorf("%w: %s", ErrFileExists, name)
+		case OnConflictRename:
+			name = f.uniqueName(name)
+			target = filepath.Join(f.LocalPath, filepath.FromSlash(name))
+		case OnConflictOverwrite:
+			version = f.nextVersion(name)
+		default:
+			version, archive = f.nextVersion(name), true
+		}
+	} else if versions, _ := f.archivedVersions(name); len(versions) > 0 {
+		version = f.nextVersion(name)
+	}
+	if prepare != nil {
+		if err := prepare(name, archive); err != nil {
+			return "", 0, err
+		}
+	}
+
+	archived := false
+	if exists && policy == OnConflictOverwrite {
+		f.removeThumbnails(name)
+	}
+	if archive {
+		if err := f.archiveCurrent(name); err != nil {
+			return "", 0, err
+		}
+		archived = true
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return "", 0, fmt.Errorf("failed to create target directory: %w", err)
+	}
+	if err := os.Rename(assembledPath, target); err != nil {
+		if archived {
+			// Прежняя версия возвращается на место, чтобы имя не осталось без файла
+			if _, restoreErr := f.restoreLatestVersion(name); restoreErr != nil {
+				log.Printf("Failed to restore previous version of %s: %v", name, restoreErr)
+			}
+		}
+		return "", 0, fmt.Errorf("failed to store %s: %w", name, storageError(err))
+	}
+	if err := f.setCurrentVersion(name, version); err != nil {
+		log.Printf("Failed to record version %d of %s: %v", version, name, err)
+	}
+	log.Printf("Stored %s as version %d", name, version)
+	return name, version, nil
+}
+
+// ListVersions возвращает версии файла name, начиная с новейшей.
+func (f *FileService) ListVersions(name string) ([]FileVersion, error) {
+	clean, err := storedKey(name)
+	if err != nil {
+		return nil, err
+	}
+	name = filepath.ToSlash(clean)
+
+	f.versionsMu.Lock()
+	defer f.versionsMu.Unlock()
+
+	versions := []FileVersion{}
+	target := filepath.Join(f.LocalPath, clean)
+	if info, err := os.Stat(target); err == nil && !info.IsDir() {
+		version, err := f.fileVersion(target, name, f.currentVersion(name))
+		if err != nil {
+			return nil, err
+		}
+		version.Current = true
+		versions = append(versions, version)
+	}
+	archived, err := f.archivedVersions(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, number := range archived {
+		version, err := f.fileVersion(versionPath(f.LocalPath, name, number), VersionMetaKey(name, number), number)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	if len(versions) == 0 {
+		return nil, ErrFileNotFound
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions, nil
+}
+
+// OpenVersion открывает версию version файла name; текущая версия открывается как OpenFile.
+func (f *FileService) OpenVersion(name string, version int) (FileReader, error) {
+	clean, err := storedKey(name)
+	if err != nil {
+		return nil, err
+	}
+	name = filepath.ToSlash(clean)
+
+	f.versionsMu.Lock()
+	current := f.currentVersion(name)
+	f.versionsMu.Unlock()
+	if version == current {
+		return f.OpenFile(name)
+	}
+
+	if meta, err := f.GetFileMeta(VersionMetaKey(name, version)); err != nil {
+		return nil, fmt.Errorf("failed to read file metadata: %w", err)
+	} else if meta != nil && !meta.Available() {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotAvailable, meta.Status)
+	}
+	file, err := f.openStored(versionPath(f.LocalPath, name, version))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file version: %w", err)
+	}
+	return file, nil
+}
+
+// PromoteVersion делает прежнюю версию текущей; текущая при этом сохраняется как прежняя.
+func (f *FileService) PromoteVersion(name string, version int) error {
+	clean, err := storedKey(name)
+	if err != nil {
+		return err
+	}
+	name = filepath.ToSlash(clean)
+
+	f.versionsMu.Lock()
+	defer f.versionsMu.Unlock()
+
+	target := filepath.Join(f.LocalPath, clean)
+	_, statErr := os.Stat(target)
+	if statErr == nil && version == f.currentVersion(name) {
+		return nil
+	}
+	if _, err := os.Stat(versionPath(f.LocalPath, name, version)); err != nil {
+		return ErrVersionNotFound
+	}
+	if statErr == nil {
+		if err := f.archiveCurrent(name); err != nil {
+			return err
+		}
+	}
+	return f.restoreVersion(name, version)
+}
+
+// DeleteVersion удаляет версию файла. При удалении текущей версии текущей становится
+// новейшая из прежних; если прежних нет, файл удаляется целиком.
+func (f *FileService) DeleteVersion(name string, version int) error {
+	clean, err := storedKey(name)
+	if err != nil {
+		return err
+	}
+	name = filepath.ToSlash(clean)
+
+	f.versionsMu.Lock()
+	defer f.versionsMu.Unlock()
+
+	target := filepath.Join(f.LocalPath, clean)
+	if info, err := os.Stat(target); err == nil && !info.IsDir() && version == f.currentVersion(name) {
+		if err := os.Remove(target); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", name, err)
+		}
+		if err := f.SaveFileMeta(name, FileMeta{}); err != nil {
+			log.Printf("Failed to delete metadata of %s: %v", name, err)
+		}
+		f.removeThumbnails(name)
+		restored, err := f.restoreLatestVersion(name)
+		if err != nil {
+			return err
+		}
+		if restored == 0 {
+			f.removeVersionDir(name)
+		}
+		return nil
+	}
+
+	archivedPath := versionPath(f.LocalPath, name, version)
+	if err := os.Remove(archivedPath); errors.Is(err, os.ErrNotExist) {
+		return ErrVersionNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to delete version %d of %s: %w", version, name, err)
+	}
+	if err := f.SaveFileMeta(VersionMetaKey(name, version), FileMeta{}); err != nil {
+		log.Printf("Failed to delete metadata of version %d of %s: %v", version, name, err)
+	}
+	if _, err := os.Stat(target); os.IsNotExist(err) {
+		if archived, _ := f.archivedVersions(name); len(archived) == 0 {
+			f.removeVersionDir(name)
+		}
+	}
+	return nil
+}
+
+// RestoreLatestVersion возвращает на место новейшую прежнюю версию, если под именем name
+// не осталось файла (например, новая версия отклонена конвейером). 0 — восстанавливать нечего.
+func (f *FileService) RestoreLatestVersion(name string) (int, error) {
+	f.versionsMu.Lock()
+	defer f.versionsMu.Unlock()
+	if _, err := os.Stat(filepath.Join(f.LocalPath, filepath.FromSlash(name))); err == nil {
+		return 0, nil
+	}
+	return f.restoreLatestVersion(name)
+}
+
+func (f *FileService) restoreLatestVersion(name string) (int, error) {
+	archived, err := f.archivedVersions(name)
+	if err != nil || len(archived) == 0 {
+		return 0, err
+	}
+	latest := archived[len(archived)-1]
+	if err := f.restoreVersion(name, latest); err != nil {
+		return 0, err
+	}
+	log.Printf("Version %d of %s restored as current", latest, name)
+	return latest, nil
+}
+
+// archiveCurrent переносит текущий файл name и его метаданные в прежние версии.
+// Уменьшенные копии относятся к текущему содержимому и удаляются.
+func (f *FileService) archiveCurrent(name string) error {
+	version := f.currentVersion(name)
+	archivedPath := versionPath(f.LocalPath, name, version)
+	if err := os.MkdirAll(filepath.Dir(archivedPath), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create versions directory: %w", err)
+	}
+	if err := os.Rename(filepath.Join(f.LocalPath, filepath.FromSlash(name)), archivedPath); err != nil {
+		return fmt.Errorf("failed to keep version %d of %s: %w", version, name, err)
+	}
+	if meta, err := f.GetFileMeta(name); err != nil {
+		log.Printf("Failed to read metadata of %s: %v", name, err)
+	} else if meta != nil {
+		meta.Thumbnails = nil
+		if err := f.SaveFileMeta(VersionMetaKey(name, version), *meta); err != nil {
+			log.Printf("Failed to save metadata of version %d of %s: %v", version, name, err)
+		}
+		if err := f.SaveFileMeta(name, FileMeta{}); err != nil {
+			log.Printf("Failed to delete metadata of %s: %v", name, err)
+		}
+	}
+	f.removeThumbnails(name)
+	return nil
+}
+
+// restoreVersion делает прежнюю версию текущей; место под именем должно быть свободно.
+func (f *FileService) restoreVersion(name string, version int) error {
+	target := filepath.Join(f.LocalPath, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create target directory: %w", err)
+	}
+	if err := os.Rename(versionPath(f.LocalPath, name, version), target); errors.Is(err, os.ErrNotExist) {
+		return ErrVersionNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to restore version %d of %s: %w", version, name, err)
+	}
+	restored := FileMeta{}
+	if meta, err := f.GetFileMeta(VersionMetaKey(name, version)); err != nil {
+		log.Printf("Failed to read metadata of version %d of %s: %v", version, name, err)
+	} else if meta != nil {
+		restored = *meta
+	}
+	if err := f.SaveFileMeta(name, restored); err != nil {
+		log.Printf("Failed to save metadata of %s: %v", name, err)
+	}
+	if err := f.SaveFileMeta(VersionMetaKey(name, version), FileMeta{}); err != nil {
+		log.Printf("Failed to delete metadata of version %d of %s: %v", version, name, err)
+	}
+	return f.setCurrentVersion(name, version)
+}
+
+// fileVersion описывает версию по её файлу и метаданным.
+func (f *FileService) fileVersion(path, metaKey string, number int) (FileVersion, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileVersion{}, fmt.Errorf("failed to stat version %d: %w", number, err)
+	}
+	size, err := f.storedSize(path)
+	if err != nil {
+		return FileVersion{}, fmt.Errorf("failed to read version %d: %w", number, err)
+	}
+	version := FileVersion{Version: number, Size: size, ModTime: info.ModTime()}
+	if meta, err := f.GetFileMeta(metaKey); err != nil {
+		log.Printf("Failed to read metadata of %s: %v", metaKey, err)
+	} else if meta != nil {
+		version.FileHash, version.SessionID, version.ContentType, version.Status = meta.FileHash, meta.SessionID, meta.ContentType, meta.Status
+	}
+	return version, nil
+}
+
+// currentVersion возвращает номер текущей версии файла name.
+func (f *FileService) currentVersion(name string) int {
+	data, err := os.ReadFile(filepath.Join(versionDirFor(f.LocalPath, name), currentVersionFile))
+	if err != nil {
+		return 1
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || version < 1 {
+		return 1
+	}
+	return version
+}
+
+// setCurrentVersion записывает номер текущей версии; версия 1 без прежних версий не записывается.
+func (f *FileService) setCurrentVersion(name string, version int) error {
+	dir := versionDirFor(f.LocalPath, name)
+	if archived, _ := f.archivedVersions(name); version == 1 && len(archived) == 0 {
+		f.removeVersionDir(name)
+		return nil
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, currentVersionFile), []byte(strconv.Itoa(version)), 0644)
+}
+
+// nextVersion возвращает номер следующей версии файла name.
+func (f *FileService) nextVersion(name string) int {
+	latest := f.currentVersion(name)
+	if archived, _ := f.archivedVersions(name); len(archived) > 0 && archived[len(archived)-1] > latest {
+		latest = archived[len(archived)-1]
+	}
+	return latest + 1
+}
+
+// archivedVersions возвращает номера прежних версий файла name по возрастанию.
+func (f *FileService) archivedVersions(name string) ([]int, error) {
+	entries, err := os.ReadDir(versionDirFor(f.LocalPath, name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list versions of %s: %w", name, err)
+	}
+	versions := []int{}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if version, err := strconv.Atoi(entry.Name()); err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+// removeVersionDir удаляет каталог версий файла name, в котором не осталось прежних версий.
+func (f *FileService) removeVersionDir(name string) {
+	dir := versionDirFor(f.LocalPath, name)
+	os.Remove(filepath.Join(dir, currentVersionFile))
+	os.Remove(dir)
+}
+
+func (f *FileService) removeThumbnails(name string) {
+	if err := os.RemoveAll(thumbnailDirFor(f.LocalPath, name)); err != nil {
+		log.Printf("Failed to remove thumbnails of %s: %v", name, err)
+	}
+}
@@ -0,0 +1,396 @@
+package services
+
+import (
+	"BASProject/config"
+	"BASProject/internal/storage"
+	"BASProject/internal/utils"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// События жизненного цикла загрузки, о которых уведомляются получатели вебхуков.
+const (
+	EventSessionCreated  = "session.created"
+	EventChunkReceived   = "chunk.received"
+	EventUploadCompleted = "upload.completed"
+	EventUploadFailed    = "upload.failed"
+	EventSessionDeleted  = "session.deleted"
+	EventBatchCommitted  = "batch.committed"
+	EventBatchFailed     = "batch.failed"
+)
+
+// webhookQueueSize — число событий в очереди одного получателя; при переполнении
+// события сразу попадают в список недоставленных.
+const webhookQueueSize = 1024
+
+var errWebhookPermanent = errors.New("webhook target rejected the event")
+
+// WebhookEvent — тело уведомления.
+type WebhookEvent struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	CreatedAt time.Time              `json:"created_at"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// DeadLetter — уведомление, которое не удалось доставить получателю.
+type DeadLetter struct {
+	Target    string       `json:"target"`
+	Event     WebhookEvent `json:"event"`
+	Attempts  int          `json:"attempts"`
+	LastError string       `json:"last_error"`
+	FailedAt  time.Time    `json:"failed_at"`
+}
+
+type webhookTarget struct {
+	config.WebhookTarget
+	events map[string]bool
+	queue  chan WebhookEvent
+}
+
+// accepts сообщает, подписан ли получатель на событие.
+func (t *webhookTarget) accepts(eventType string) bool {
+	if len(t.events) == 0 {
+		return eventType != EventChunkReceived
+	}
+	return t.events[eventType]
+}
+
+// chunkBatch накапливает полученные чанки сессии до очередной отправки chunk.received.
+type chunkBatch struct {
+	Chunks []interface{}
+	Bytes  int64
+}
+
+// WebhookService доставляет подписанные уведомления о событиях загрузки с повторами.
+// У каждого получателя своя очередь, события доставляются ему по порядку.
+// Недоставленные события сохраняются в Redis (без Redis — в памяти) и могут быть
+// отправлены повторно через RedeliverDeadLetters.
+// Методы безопасно вызывать у nil: вебхуки тогда просто отключены.
+type WebhookService struct {
+	Storage *storage.RedisClient
+	Config  config.WebhooksConfig
+
+	client  *http.Client
+	targets []*webhookTarget
+
+	mu          sync.Mutex
+	closed      bool
+	batches     map[string]*chunkBatch
+	deadLetters []DeadLetter
+	stop        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewWebhookService запускает доставку уведомлений получателям из cfg.
+func NewWebhookService(storage *storage.RedisClient, cfg config.WebhooksConfig) *WebhookService {
+	w := &WebhookService{
+		Storage: storage,
+		Config:  cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		batches: map[string]*chunkBatch{},
+		stop:    make(chan struct{}),
+	}
+	for _, targetConfig := range cfg.Targets {
+		target := &webhookTarget{WebhookTarget: targetConfig, events: map[string]bool{}, queue: make(chan WebhookEvent, webhookQueueSize)}
+		for _, event := range targetConfig.Events {
+			target.events[event] = true
+		}
+		w.targets = append(w.targets, target)
+		w.wg.Add(1)
+		go w.deliverLoop(target)
+	}
+	if w.wants(EventChunkReceived) && cfg.ChunkBatchInterval > 0 {
+		w.wg.Add(1)
+		go w.batchLoop()
+	}
+	return w
+}
+
+// Close отправляет накопленные chunk.received и дожидается доставки очередей, включая повторы.
+func (w *WebhookService) Close() {
+	if w == nil {
+		return
+	}
+	w.flushChunkBatches()
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.stop)
+	for _, target := range w.targets {
+		close(target.queue)
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+}
+
+func (w *WebhookService) wants(eventType string) bool {
+	for _, target := range w.targets {
+		if target.accepts(eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Emit ставит событие в очереди подписанных получателей, не дожидаясь доставки.
+func (w *WebhookService) Emit(eventType string, data map[string]interface{}) {
+	if w == nil || !w.wants(eventType) {
+		return
+	}
+	event := WebhookEvent{
+		ID:        utils.GenerateEventID(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	for _, target := range w.targets {
+		if !target.accepts(eventType) {
+			continue
+		}
+		select {
+		case target.queue <- event:
+		default:
+			w.saveDeadLetter(DeadLetter{Target: target.URL, Event: event, LastError: "delivery queue is full", FailedAt: time.Now().UTC()})
+		}
+	}
+}
+
+// ChunkReceived запоминает полученный чанк; события chunk.received отправляются пакетами
+// по сессиям раз в ChunkBatchInterval. chunk — номер чанка или смещение диапазона.
+func (w *WebhookService) ChunkReceived(sessionID string, chunk interface{}, size int64) {
+	if w == nil || !w.wants(EventChunkReceived) {
+		return
+	}
+	w.mu.Lock()
+	batch, ok := w.batches[sessionID]
+	if !ok {
+		batch = &chunkBatch{}
+		w.batches[sessionID] = batch
+	}
+	batch.Chunks = append(batch.Chunks, chunk)
+	batch.Bytes += size
+	w.mu.Unlock()
+}
+
+func (w *WebhookService) batchLoop() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.Config.ChunkBatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.flushChunkBatches()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *WebhookService) flushChunkBatches() {
+	w.mu.Lock()
+	batches := w.batches
+	w.batches = map[string]*chunkBatch{}
+	w.mu.Unlock()
+
+	for sessionID, batch := range batches {
+		w.Emit(EventChunkReceived, map[string]interface{}{
+			"session_id": sessionID,
+			"chunks":     batch.Chunks,
+			"count":      len(batch.Chunks),
+			"bytes":      batch.Bytes,
+		})
+	}
+}
+
+func (w *WebhookService) deliverLoop(target *webhookTarget) {
+	defer w.wg.Done()
+	for event := range target.queue {
+		w.deliverWithRetry(target, event)
+	}
+}
+
+// deliverWithRetry отправляет событие с экспоненциальной задержкой между попытками.
+func (w *WebhookService) deliverWithRetry(target *webhookTarget, event WebhookEvent) {
+	backoff := w.Config.InitialBackoff
+	var err error
+	attempt := 0
+	for attempt < max(w.Config.MaxAttempts, 1) {
+		attempt++
+		if err = w.deliver(target, event); err == nil {
+			return
+		}
+		if errors.Is(err, errWebhookPermanent) || attempt >= w.Config.MaxAttempts {
+			break
+		}
+		log.Printf("Webhook %s to %s failed (attempt %d): %v; retrying in %s", event.Type, target.URL, attempt, err, backoff)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, w.Config.MaxBackoff)
+	}
+
+	log.Printf("Webhook %s %s to %s moved to dead letters: %v", event.Type, event.ID, target.URL, err)
+	w.mu.Lock()
+	w.saveDeadLetter(DeadLetter{Target: target.URL, Event: event, Attempts: attempt, LastError: err.Error(), FailedAt: time.Now().UTC()})
+	w.mu.Unlock()
+}
+
+// deliver выполняет одну попытку доставки. Ответы 4xx, кроме 408 и 429, не повторяются.
+func (w *WebhookService) deliver(target *webhookTarget, event WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errWebhookPermanent, err)
+	}
+	req, err := http.NewRequest("POST", target.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errWebhookPermanent, err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-ID", event.ID)
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	if target.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhook(target.Secret, timestamp, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode <= 499 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: status %d", errWebhookPermanent, resp.StatusCode)
+	default:
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
+
+// SignWebhook вычисляет подпись уведомления: hex(HMAC-SHA256(secret, timestamp + "." + body)).
+// Получатель проверяет её по заголовкам X-Webhook-Timestamp и X-Webhook-Signature.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// saveDeadLetter сохраняет недоставленное событие; вызывается под w.mu.
+func (w *WebhookService) saveDeadLetter(letter DeadLetter) {
+	if w.Storage == nil {
+		w.deadLetters = append(w.deadLetters, letter)
+		return
+	}
+	data, err := json.Marshal(letter)
+	if err == nil {
+		err = w.Storage.PushDeadLetter(string(data))
+	}
+	if err != nil {
+		log.Printf("Failed to save dead letter %s for %s: %v", letter.Event.ID, letter.Target, err)
+	}
+}
+
+// DeadLetters возвращает список недоставленных уведомлений.
+func (w *WebhookService) DeadLetters() ([]DeadLetter, error) {
+	if w == nil {
+		return []DeadLetter{}, nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.Storage == nil {
+		return append([]DeadLetter{}, w.deadLetters...), nil
+	}
+	entries, err := w.Storage.ListDeadLetters()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+	return decodeDeadLetters(entries), nil
+}
+
+// RedeliverDeadLetters забирает недоставленные уведомления и снова ставит их в очереди
+// получателей, которые по-прежнему настроены. Возвращает число поставленных событий.
+func (w *WebhookService) RedeliverDeadLetters() (int, error) {
+	if w == nil {
+		return 0, nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, nil
+	}
+
+	var letters []DeadLetter
+	if w.Storage == nil {
+		letters, w.deadLetters = w.deadLetters, nil
+	} else {
+		entries, err := w.Storage.TakeDeadLetters()
+		if err != nil {
+			return 0, fmt.Errorf("failed to take dead letters: %w", err)
+		}
+		letters = decodeDeadLetters(entries)
+	}
+
+	queued := 0
+	for _, letter := range letters {
+		target := w.findTarget(letter.Target)
+		if target == nil {
+			// Получатель удалён из конфигурации — событие остаётся в списке
+			w.saveDeadLetter(letter)
+			continue
+		}
+		select {
+		case target.queue <- letter.Event:
+			queued++
+		default:
+			w.saveDeadLetter(letter)
+		}
+	}
+	return queued, nil
+}
+
+func (w *WebhookService) findTarget(url string) *webhookTarget {
+	for _, target := range w.targets {
+		if target.URL == url {
+			return target
+		}
+	}
+	return nil
+}
+
+func decodeDeadLetters(entries []string) []DeadLetter {
+	letters := make([]DeadLetter, 0, len(entries))
+	for _, entry := range entries {
+		var letter DeadLetter
+		if err := json.Unmarshal([]byte(entry), &letter); err != nil {
+			log.Printf("Skipping malformed dead letter: %v", err)
+			continue
+		}
+		letters = append(letters, letter)
+	}
+	return letters
+}
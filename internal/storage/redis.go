@@ -12,6 +12,9 @@ import (
 
 var ctx = context.Background()
 
+// sessionIndexKey — множество идентификаторов всех существующих сессий.
+const sessionIndexKey = "sessions:index"
+
 type RedisClient struct {
 	Client *redis.Client
 }
@@ -43,6 +46,9 @@ func (s *RedisClient) SaveSession(sessionID string, sessionData map[string]inter
         log.Printf("Failed to save session %s: %v", sessionID, err)
         return err
     }
+    if err := s.Client.SAdd(ctx, sessionIndexKey, sessionID).Err(); err != nil {
+        return fmt.Errorf("failed to index session %s: %w", sessionID, err)
+    }
     log.Printf("Session %s saved successfully", sessionID)
     return nil
 }
@@ -75,10 +81,23 @@ func (r *RedisClient) ChunkExists(sessionID string, chunkID int) (bool, error) {
 	return exists, err
 }
 
-// Обновление загруженного объема данных в сессии
-func (r *RedisClient) UpdateUploadedSize(sessionID string, size int64) error {
-	// Используем HIncrBy, чтобы увеличить "uploaded_size" на заданное количество
-	return r.Client.HIncrBy(ctx, sessionID, "uploaded_size", size).Err()
+// updateUploadedScript увеличивает "uploaded_size" сессии на ARGV[1] и отмечает время активности.
+// Записанные байты уменьшают невыбранную часть резерва места сессии, если резерв ещё есть:
+// у снятого резерва (например, после выделения файла) поле записанного объёма не создаётся.
+var updateUploadedScript = redis.NewScript(`
+local uploaded = redis.call('HINCRBY', KEYS[1], 'uploaded_size', ARGV[1])
+redis.call('HSET', KEYS[1], 'updated_at', ARGV[2])
+if redis.call('HEXISTS', KEYS[2], ARGV[3]) == 1 then
+	redis.call('HINCRBY', KEYS[2], ARGV[3] .. ARGV[4], ARGV[1])
+end
+return uploaded
+`)
+
+// Обновление загруженного объема данных в сессии; возвращает новый объём
+// и отмечает время последней активности сессии
+func (r *RedisClient) UpdateUploadedSize(sessionID string, size int64) (int64, error) {
+	return updateUploadedScript.Run(ctx, r.Client, []string{sessionID, reservationsKey},
+		size, time.Now().Unix(), sessionID, reservationUploadedSuffix).Int64()
 }
 
 // Получение данных сессии
@@ -103,7 +122,7 @@ func (r *RedisClient) GetSessionData(sessionID string) (map[string]interface{},
 	sessionData := make(map[string]interface{})
 	for key, value := range data {
 		switch key {
-		case "file_size", "uploaded_size", "chunk_size":
+		case "file_size", "uploaded_size", "chunk_size", "created_at", "updated_at":
 			// Преобразуем значения в int64
 			intVal, err := strconv.ParseInt(value, 10, 64)
 			if err != nil {
@@ -118,6 +137,64 @@ func (r *RedisClient) GetSessionData(sessionID string) (map[string]interface{},
 	return sessionData, nil
 }
 
+// ListSessionIDs возвращает идентификаторы всех сессий из индекса
+func (r *RedisClient) ListSessionIDs() ([]string, error) {
+	return r.Client.SMembers(ctx, sessionIndexKey).Result()
+}
+
+// ChunkRange — диапазон байт, загруженный одним чанком в режиме адресации по смещению.
+type ChunkRange struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+// AddUploadedRange отмечает диапазон как загруженный; score — смещение, чтобы диапазоны шли по порядку
+func (r *RedisClient) AddUploadedRange(sessionID string, offset, length int64) error {
+	setKey := fmt.Sprintf("%s:ranges", sessionID)
+	return r.Client.ZAdd(ctx, setKey, &redis.Z{
+		Score:  float64(offset),
+		Member: fmt.Sprintf("%d:%d", offset, length),
+	}).Err()
+}
+
+// GetUploadedRanges возвращает загруженные диапазоны, отсортированные по смещению
+func (r *RedisClient) GetUploadedRanges(sessionID string) ([]ChunkRange, error) {
+	setKey := fmt.Sprintf("%s:ranges", sessionID)
+	members, err := r.Client.ZRange(ctx, setKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	ranges := []ChunkRange{}
+	for _, member := range members {
+		var rng ChunkRange
+		if _, err := fmt.Sscanf(member, "%d:%d", &rng.Offset, &rng.Length); err != nil {
+			continue
+		}
+		ranges = append(ranges, rng)
+	}
+	return ranges, nil
+}
+
+// contentKey — ключ записи индекса содержимого для SHA-256 собранного файла.
+func contentKey(fileHash string) string {
+	return fmt.Sprintf("content:%s", fileHash)
+}
+
+// SaveContentRef запоминает, где хранится файл с данным хешем
+func (r *RedisClient) SaveContentRef(fileHash string, ref map[string]interface{}) error {
+	return r.Client.HSet(ctx, contentKey(fileHash), ref).Err()
+}
+
+// GetContentRef возвращает запись индекса содержимого; пустая карта — хеш не найден
+func (r *RedisClient) GetContentRef(fileHash string) (map[string]string, error) {
+	return r.Client.HGetAll(ctx, contentKey(fileHash)).Result()
+}
+
+// DeleteContentRef удаляет устаревшую запись индекса содержимого
+func (r *RedisClient) DeleteContentRef(fileHash string) error {
+	return r.Client.Del(ctx, contentKey(fileHash)).Err()
+}
+
 // Метод GetChunks
 func (r *RedisClient) GetChunks(sessionID string) ([]int, error) {
 	setKey := fmt.Sprintf("%s:chunks", sessionID)
@@ -151,6 +228,29 @@ func (r *RedisClient) DeleteSessionData(sessionID string) error {
 		return fmt.Errorf("failed to delete chunks set: %w", err)
 	}
 
+	// Удаляем диапазоны режима адресации по смещению
+	err = r.Client.Del(ctx, fmt.Sprintf("%s:ranges", sessionID)).Err()
+	if err != nil {
+		return fmt.Errorf("failed to delete ranges set: %w", err)
+	}
+
+	// Удаляем битовую карту чанков выделенного файла
+	err = r.Client.Del(ctx, chunkBitmapKey(sessionID)).Err()
+	if err != nil {
+		return fmt.Errorf("failed to delete chunk bitmap: %w", err)
+	}
+
+	err = r.Client.SRem(ctx, sessionIndexKey, sessionID).Err()
+	if err != nil {
+		return fmt.Errorf("failed to remove session from index: %w", err)
+	}
+
+	// Снимаем резерв места на диске
+	err = r.ReleaseSpace(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to release space reservation: %w", err)
+	}
+
 	// Дополнительно проверим, что ключ удален
 	exists, err := r.Client.Exists(ctx, chunksSetKey).Result()
 	if err != nil {
@@ -175,3 +275,237 @@ func (r *RedisClient) ReleaseLock(key string) error {
 	_, err := r.Client.Del(ctx, key).Result()
 	return err
 }
+
+// webhookDeadLettersKey — список недоставленных уведомлений (JSON), ожидающих повторной отправки.
+const webhookDeadLettersKey = "webhooks:dead_letters"
+
+// PushDeadLetter добавляет недоставленное уведомление в конец списка
+func (r *RedisClient) PushDeadLetter(entry string) error {
+	return r.Client.RPush(ctx, webhookDeadLettersKey, entry).Err()
+}
+
+// ListDeadLetters возвращает все недоставленные уведомления
+func (r *RedisClient) ListDeadLetters() ([]string, error) {
+	return r.Client.LRange(ctx, webhookDeadLettersKey, 0, -1).Result()
+}
+
+// TakeDeadLetters атомарно забирает и очищает список недоставленных уведомлений
+func (r *RedisClient) TakeDeadLetters() ([]string, error) {
+	var entries *redis.StringSliceCmd
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		entries = pipe.LRange(ctx, webhookDeadLettersKey, 0, -1)
+		pipe.Del(ctx, webhookDeadLettersKey)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries.Val(), nil
+}
+
+// sessionEventsChannel — канал pub/sub с событиями прогресса сессии.
+func sessionEventsChannel(sessionID string) string {
+	return fmt.Sprintf("%s:events", sessionID)
+}
+
+// PublishSessionEvent рассылает событие прогресса подписчикам сессии на всех узлах
+func (r *RedisClient) PublishSessionEvent(sessionID string, payload []byte) error {
+	return r.Client.Publish(ctx, sessionEventsChannel(sessionID), payload).Err()
+}
+
+// SubscribeSessionEvents подписывается на события сессии; канал закрывается при отмене c
+func (r *RedisClient) SubscribeSessionEvents(c context.Context, sessionID string) (<-chan []byte, error) {
+	pubsub := r.Client.Subscribe(c, sessionEventsChannel(sessionID))
+	// Дожидаемся подтверждения подписки, чтобы не потерять события, опубликованные сразу после неё
+	if _, err := pubsub.Receive(c); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+	messages := pubsub.Channel()
+	events := make(chan []byte)
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+		for {
+			select {
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case events <- []byte(message.Payload):
+				case <-c.Done():
+					return
+				}
+			case <-c.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// RemoveUploadedChunk снимает отметку о загрузке чанка
+func (r *RedisClient) RemoveUploadedChunk(sessionID string, chunkID int) error {
+	return r.Client.SRem(ctx, fmt.Sprintf("%s:chunks", sessionID), chunkID).Err()
+}
+
+// RemoveUploadedRange снимает отметку о загрузке диапазона
+func (r *RedisClient) RemoveUploadedRange(sessionID string, offset, length int64) error {
+	return r.Client.ZRem(ctx, fmt.Sprintf("%s:ranges", sessionID), fmt.Sprintf("%d:%d", offset, length)).Err()
+}
+
+// setUploadedScript записывает пересчитанный объём ARGV[1] в сессию и, если резерв места
+// сессии ещё есть, в его записанную часть.
+var setUploadedScript = redis.NewScript(`
+redis.call('HSET', KEYS[1], 'uploaded_size', ARGV[1])
+if redis.call('HEXISTS', KEYS[2], ARGV[2]) == 1 then
+	redis.call('HSET', KEYS[2], ARGV[2] .. ARGV[3], ARGV[1])
+end
+return 1
+`)
+
+// SetUploadedSize записывает пересчитанный объём загруженных данных
+func (r *RedisClient) SetUploadedSize(sessionID string, size int64) error {
+	return setUploadedScript.Run(ctx, r.Client, []string{sessionID, reservationsKey}, size, sessionID, reservationUploadedSuffix).Err()
+}
+
+// RemoveFromSessionIndex удаляет из индекса сессию, данных которой уже нет
+func (r *RedisClient) RemoveFromSessionIndex(sessionID string) error {
+	return r.Client.SRem(ctx, sessionIndexKey, sessionID).Err()
+}
+
+func fileMetaKey(name string) string {
+	return "file:" + name
+}
+
+// SaveFileMeta сохраняет метаданные собранного файла (JSON)
+func (r *RedisClient) SaveFileMeta(name string, meta []byte) error {
+	return r.Client.Set(ctx, fileMetaKey(name), meta, 0).Err()
+}
+
+// GetFileMeta возвращает метаданные собранного файла; nil — записи нет
+func (r *RedisClient) GetFileMeta(name string) ([]byte, error) {
+	meta, err := r.Client.Get(ctx, fileMetaKey(name)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return meta, err
+}
+
+// DeleteFileMeta удаляет метаданные собранного файла
+func (r *RedisClient) DeleteFileMeta(name string) error {
+	return r.Client.Del(ctx, fileMetaKey(name)).Err()
+}
+
+// reservationsKey хранит резерв места каждой сессии (поле <session_id>) и объём, уже
+// записанный в счёт резерва (поле <session_id>:uploaded). Оба значения лежат в одном ключе,
+// чтобы скрипт резервирования обращался только к объявленным в KEYS ключам.
+const reservationsKey = "space:reservations"
+
+const reservationUploadedSuffix = ":uploaded"
+
+func reservationUploadedField(sessionID string) string {
+	return sessionID + reservationUploadedSuffix
+}
+
+// reserveSpaceScript атомарно резервирует место под сессию. Ещё не записанная часть
+// резерва каждой сессии — зарезервировано минус записано; новый резерв заменяет прежний
+// резерв сессии и принимается, если его незаписанная часть вместе с ними помещается
+// в ARGV[3] байт. Возвращает {1|0, занято резервами}.
+var reserveSpaceScript = redis.NewScript(`
+local entries = redis.call('HGETALL', KEYS[1])
+local fields = {}
+for i = 1, #entries, 2 do
+	fields[entries[i]] = tonumber(entries[i + 1]) or 0
+end
+local suffix = ARGV[4]
+local outstanding = 0
+for field, reserved in pairs(fields) do
+	if field ~= ARGV[1] and string.sub(field, -#suffix) ~= suffix then
+		local left = reserved - (fields[field .. suffix] or 0)
+		if left > 0 then
+			outstanding = outstanding + left
+		end
+	end
+end
+-- Уже записанные байты сессии на диске есть и свободного места не требуют
+local written = fields[ARGV[1] .. suffix] or 0
+if outstanding + tonumber(ARGV[2]) - written > tonumber(ARGV[3]) then
+	return {0, outstanding}
+end
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+return {1, outstanding}
+`)
+
+// ReserveSpace резервирует size байт под сессию, если с учётом других резервов хватает available байт.
+// Возвращает, принят ли резерв, и объём, уже занятый резервами других сессий.
+func (r *RedisClient) ReserveSpace(sessionID string, size, available int64) (bool, int64, error) {
+	result, err := reserveSpaceScript.Run(ctx, r.Client, []string{reservationsKey}, sessionID, size, available, reservationUploadedSuffix).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	return result[0] == 1, result[1], nil
+}
+
+// ReleaseSpace снимает резерв места сессии
+func (r *RedisClient) ReleaseSpace(sessionID string) error {
+	return r.Client.HDel(ctx, reservationsKey, sessionID, reservationUploadedField(sessionID)).Err()
+}
+
+// UpdateSessionFields обновляет поля существующей сессии; удалённая сессия не воссоздаётся
+func (r *RedisClient) UpdateSessionFields(sessionID string, fields map[string]interface{}) error {
+	exists, err := r.Client.Exists(ctx, sessionID).Result()
+	if err != nil || exists == 0 {
+		return err
+	}
+	return r.Client.HSet(ctx, sessionID, fields).Err()
+}
+
+func batchKey(batchID string) string {
+	return "batch:" + batchID
+}
+
+// SaveBatch сохраняет описание пакета загрузок (JSON)
+func (r *RedisClient) SaveBatch(batchID string, batch []byte) error {
+	return r.Client.Set(ctx, batchKey(batchID), batch, 0).Err()
+}
+
+// GetBatch возвращает описание пакета загрузок; nil — пакета нет
+func (r *RedisClient) GetBatch(batchID string) ([]byte, error) {
+	batch, err := r.Client.Get(ctx, batchKey(batchID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return batch, err
+}
+
+// chunkBitmapKey — битовая карта чанков сессии, записанных в выделенный файл: бит n-1 — чанк n.
+func chunkBitmapKey(sessionID string) string {
+	return fmt.Sprintf("%s:bitmap", sessionID)
+}
+
+// SetChunkBit отмечает чанк chunkID записанным.
+func (r *RedisClient) SetChunkBit(sessionID string, chunkID int) error {
+	return r.Client.SetBit(ctx, chunkBitmapKey(sessionID), int64(chunkID-1), 1).Err()
+}
+
+// ChunkBitSet сообщает, записан ли чанк chunkID.
+func (r *RedisClient) ChunkBitSet(sessionID string, chunkID int) (bool, error) {
+	bit, err := r.Client.GetBit(ctx, chunkBitmapKey(sessionID), int64(chunkID-1)).Result()
+	return bit == 1, err
+}
+
+// GetChunkBitmap возвращает битовую карту чанков; nil — ни один чанк не записан.
+func (r *RedisClient) GetChunkBitmap(sessionID string) ([]byte, error) {
+	bitmap, err := r.Client.Get(ctx, chunkBitmapKey(sessionID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	return bitmap, err
+}
+
+// DeleteChunkBitmap сбрасывает битовую карту чанков.
+func (r *RedisClient) DeleteChunkBitmap(sessionID string) error {
+	return r.Client.Del(ctx, chunkBitmapKey(sessionID)).Err()
+}
@@ -3,6 +3,8 @@ package utils
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"io"
+	"os"
 )
 
 type ChecksumService struct{}
@@ -23,3 +25,22 @@ func (s *ChecksumService) CalculateChecksum(data []byte) string {
 	hash := sha256.Sum256(data)
 	return hex.EncodeToString(hash[:])
 }
+
+// CalculateReaderChecksum вычисляет SHA-256 потока, не загружая его целиком в память.
+func (s *ChecksumService) CalculateReaderChecksum(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// CalculateFileChecksum вычисляет SHA-256 файла на диске.
+func (s *ChecksumService) CalculateFileChecksum(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return s.CalculateReaderChecksum(file)
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package utils
+
+import "errors"
+
+// FreeSpace не поддерживается на этой платформе; проверка свободного места пропускается.
+func FreeSpace(path string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package utils
+
+import "syscall"
+
+// FreeSpace возвращает число байтов, доступных непривилегированному процессу на томе с path.
+func FreeSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,430 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Формат зашифрованного файла:
+//
+//	magic (8) | длина ID ключа (1) | ID мастер-ключа | nonce (12) + обёрнутый ключ данных (32+16)
+//	| размер сегмента (4) | префикс nonce (7) | сегменты
+//
+// Содержимое шифруется AES-256-GCM сегментами по segmentSize байт, каждый со своим тегом.
+// Nonce сегмента — префикс, номер сегмента и флаг последнего сегмента, поэтому
+// перестановка или отбрасывание сегментов обнаруживаются при расшифровке.
+// Ключ данных генерируется для каждого файла и хранится обёрнутым мастер-ключом.
+const (
+	envelopeMagic       = "BASENC01"
+	envelopeSegmentSize = 64 * 1024
+	envelopeKeySize     = 32
+	envelopeNoncePrefix = 7
+)
+
+var (
+	ErrNotEncrypted    = errors.New("file is not encrypted")
+	ErrUnknownKey      = errors.New("file is encrypted with an unknown master key")
+	ErrCorruptedCipher = errors.New("encrypted data is corrupted or has been tampered with")
+)
+
+// Envelope шифрует файлы ключами данных, обёрнутыми мастер-ключом.
+// Связка хранит несколько версий мастер-ключа: новые файлы шифруются активной,
+// остальные нужны для чтения файлов, ещё не перешифрованных после ротации.
+type Envelope struct {
+	keys   map[string]cipher.AEAD
+	active string
+}
+
+// KeyVersion — версия мастер-ключа в связке.
+type KeyVersion struct {
+	ID  string
+	Key []byte
+}
+
+// NewEnvelope создаёт Envelope с единственным 32-байтовым мастер-ключом.
+func NewEnvelope(masterKey []byte) (*Envelope, error) {
+	return NewKeyring([]KeyVersion{{ID: KeyID(masterKey), Key: masterKey}}, "")
+}
+
+// NewKeyring создаёт Envelope со связкой версий ключа; active — версия для новых файлов
+// (по умолчанию последняя в списке).
+func NewKeyring(versions []KeyVersion, active string) (*Envelope, error) {
+	if len(versions) == 0 {
+		return nil, errors.New("keyring has no keys")
+	}
+	e := &Envelope{keys: map[string]cipher.AEAD{}, active: active}
+	for _, version := range versions {
+		if version.ID == "" || len(version.ID) > 255 {
+			return nil, fmt.Errorf("key version id %q must be 1 to 255 bytes long", version.ID)
+		}
+		if _, exists := e.keys[version.ID]; exists {
+			return nil, fmt.Errorf("duplicate key version %q", version.ID)
+		}
+		if len(version.Key) != envelopeKeySize {
+			return nil, fmt.Errorf("master key %s must be %d bytes, got %d", version.ID, envelopeKeySize, len(version.Key))
+		}
+		aead, err := newGCM(version.Key)
+		if err != nil {
+			return nil, err
+		}
+		e.keys[version.ID] = aead
+	}
+	if e.active == "" {
+		e.active = versions[len(versions)-1].ID
+	}
+	if _, ok := e.keys[e.active]; !ok {
+		return nil, fmt.Errorf("active key %q is not in the keyring", e.active)
+	}
+	return e, nil
+}
+
+// ActiveKey возвращает версию ключа, которой шифруются новые файлы.
+func (e *Envelope) ActiveKey() string {
+	return e.active
+}
+
+// KeyID — короткий идентификатор мастер-ключа, записываемый в заголовок файла.
+func KeyID(masterKey []byte) string {
+	sum := sha256.Sum256(masterKey)
+	return hex.EncodeToString(sum[:8])
+}
+
+// LoadKeyFile читает мастер-ключ: 32 байта как есть, либо в hex или base64 одной строкой.
+func LoadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if len(data) == envelopeKeySize {
+		return data, nil
+	}
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == envelopeKeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == envelopeKeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key file %s must contain a %d-byte key (raw, hex or base64)", path, envelopeKeySize)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsEncrypted сообщает, начинается ли содержимое с заголовка зашифрованного файла.
+func IsEncrypted(r io.ReaderAt) bool {
+	magic := make([]byte, len(envelopeMagic))
+	n, _ := r.ReadAt(magic, 0)
+	return n == len(magic) && string(magic) == envelopeMagic
+}
+
+// NewWriter возвращает поток, шифрующий записанные данные в w.
+// Close дописывает последний сегмент, но не закрывает w.
+func (e *Envelope) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	dataKey := make([]byte, envelopeKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, envelopeNoncePrefix)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	header, err := e.buildHeader(dataKey, envelopeSegmentSize, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{w: w, aead: aead, prefix: prefix, buf: make([]byte, 0, envelopeSegmentSize)}, nil
+}
+
+// buildHeader формирует заголовок с ключом данных, обёрнутым активной версией мастер-ключа.
+func (e *Envelope) buildHeader(dataKey []byte, segSize uint32, prefix []byte) ([]byte, error) {
+	master := e.keys[e.active]
+	keyNonce := make([]byte, master.NonceSize())
+	if _, err := rand.Read(keyNonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	var header bytes.Buffer
+	header.WriteString(envelopeMagic)
+	header.WriteByte(byte(len(e.active)))
+	header.WriteString(e.active)
+	header.Write(keyNonce)
+	header.Write(master.Seal(nil, keyNonce, dataKey, []byte(e.active)))
+	binary.Write(&header, binary.BigEndian, segSize)
+	header.Write(prefix)
+	return header.Bytes(), nil
+}
+
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	buf     []byte
+	segment uint32
+	closed  bool
+}
+
+func (ew *encryptWriter) Write(p []byte) (int, error) {
+	if ew.closed {
+		return 0, errors.New("write to closed encrypted stream")
+	}
+	written := 0
+	for len(p) > 0 {
+		// Полный сегмент сбрасываем, только когда известно, что он не последний
+		if len(ew.buf) == envelopeSegmentSize {
+			if err := ew.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(ew.buf[len(ew.buf):cap(ew.buf)], p)
+		ew.buf = ew.buf[:len(ew.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (ew *encryptWriter) flush(last bool) error {
+	sealed := ew.aead.Seal(nil, segmentNonce(ew.prefix, ew.segment, last), ew.buf, nil)
+	if _, err := ew.w.Write(sealed); err != nil {
+		return err
+	}
+	ew.segment++
+	ew.buf = ew.buf[:0]
+	return nil
+}
+
+func (ew *encryptWriter) Close() error {
+	if ew.closed {
+		return nil
+	}
+	ew.closed = true
+	return ew.flush(true)
+}
+
+func segmentNonce(prefix []byte, segment uint32, last bool) []byte {
+	nonce := make([]byte, 0, 12)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, segment)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// DecryptReader — расшифровывающий поток с произвольным доступом (Read, ReadAt, Seek).
+type DecryptReader struct {
+	r         io.ReaderAt
+	aead      cipher.AEAD
+	prefix    []byte
+	headerLen int64
+	segSize   int64
+	segments  int64
+	size      int64
+	offset    int64
+
+	// Последний расшифрованный сегмент
+	cached  int64
+	segment []byte
+}
+
+// NewReader разбирает заголовок зашифрованного содержимого r длиной size.
+func (e *Envelope) NewReader(r io.ReaderAt, size int64) (*DecryptReader, error) {
+	h, err := e.parseHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(h.dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := size - h.length
+	encSeg := int64(h.segSize) + int64(aead.Overhead())
+	segments := (payload + encSeg - 1) / encSeg
+	if payload < int64(aead.Overhead()) || payload-(segments-1)*encSeg < int64(aead.Overhead()) {
+		return nil, ErrCorruptedCipher
+	}
+
+	return &DecryptReader{
+		r:         r,
+		aead:      aead,
+		prefix:    h.prefix,
+		headerLen: h.length,
+		segSize:   int64(h.segSize),
+		segments:  segments,
+		size:      payload - segments*int64(aead.Overhead()),
+		cached:    -1,
+	}, nil
+}
+
+// envelopeHeader — разобранный заголовок зашифрованного файла.
+type envelopeHeader struct {
+	keyID   string
+	dataKey []byte
+	segSize uint32
+	prefix  []byte
+	length  int64
+}
+
+func (e *Envelope) parseHeader(r io.ReaderAt) (*envelopeHeader, error) {
+	if !IsEncrypted(r) {
+		return nil, ErrNotEncrypted
+	}
+	section := io.NewSectionReader(r, int64(len(envelopeMagic)), 1<<20)
+	idLen := make([]byte, 1)
+	if _, err := io.ReadFull(section, idLen); err != nil {
+		return nil, ErrCorruptedCipher
+	}
+	keyID := make([]byte, idLen[0])
+	if _, err := io.ReadFull(section, keyID); err != nil {
+		return nil, ErrCorruptedCipher
+	}
+	master, ok := e.keys[string(keyID)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+
+	wrapped := make([]byte, master.NonceSize()+envelopeKeySize+master.Overhead())
+	if _, err := io.ReadFull(section, wrapped); err != nil {
+		return nil, ErrCorruptedCipher
+	}
+	dataKey, err := master.Open(nil, wrapped[:master.NonceSize()], wrapped[master.NonceSize():], keyID)
+	if err != nil {
+		return nil, ErrCorruptedCipher
+	}
+
+	var segSize uint32
+	if err := binary.Read(section, binary.BigEndian, &segSize); err != nil || segSize == 0 {
+		return nil, ErrCorruptedCipher
+	}
+	prefix := make([]byte, envelopeNoncePrefix)
+	if _, err := io.ReadFull(section, prefix); err != nil {
+		return nil, ErrCorruptedCipher
+	}
+
+	return &envelopeHeader{
+		keyID:   string(keyID),
+		dataKey: dataKey,
+		segSize: segSize,
+		prefix:  prefix,
+		length:  int64(len(envelopeMagic)) + 1 + int64(len(keyID)) + int64(len(wrapped)) + 4 + envelopeNoncePrefix,
+	}, nil
+}
+
+// Rewrap перешифровывает ключ данных файла активной версией мастер-ключа, не трогая
+// зашифрованное содержимое. Возвращает новый заголовок и длину старого; если файл
+// уже зашифрован активной версией, header == nil.
+func (e *Envelope) Rewrap(r io.ReaderAt) (header []byte, oldLength int64, err error) {
+	h, err := e.parseHeader(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	if h.keyID == e.active {
+		return nil, h.length, nil
+	}
+	header, err = e.buildHeader(h.dataKey, h.segSize, h.prefix)
+	if err != nil {
+		return nil, 0, err
+	}
+	return header, h.length, nil
+}
+
+// Size возвращает размер расшифрованного содержимого.
+func (d *DecryptReader) Size() int64 {
+	return d.size
+}
+
+func (d *DecryptReader) loadSegment(index int64) error {
+	if index == d.cached {
+		return nil
+	}
+	encSeg := d.segSize + int64(d.aead.Overhead())
+	start := d.headerLen + index*encSeg
+	length := encSeg
+	if index == d.segments-1 {
+		length = d.size - index*d.segSize + int64(d.aead.Overhead())
+	}
+	sealed := make([]byte, length)
+	if _, err := d.r.ReadAt(sealed, start); err != nil && err != io.EOF {
+		return err
+	}
+	plain, err := d.aead.Open(sealed[:0], segmentNonce(d.prefix, uint32(index), index == d.segments-1), sealed, nil)
+	if err != nil {
+		return ErrCorruptedCipher
+	}
+	d.cached, d.segment = index, plain
+	return nil
+}
+
+func (d *DecryptReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	n := 0
+	for n < len(p) {
+		if off >= d.size {
+			return n, io.EOF
+		}
+		index := off / d.segSize
+		if err := d.loadSegment(index); err != nil {
+			return n, err
+		}
+		copied := copy(p[n:], d.segment[off-index*d.segSize:])
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+func (d *DecryptReader) Read(p []byte) (int, error) {
+	n, err := d.ReadAt(p, d.offset)
+	d.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (d *DecryptReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.offset
+	case io.SeekEnd:
+		offset += d.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	d.offset = offset
+	return offset, nil
+}
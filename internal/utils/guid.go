@@ -5,3 +5,11 @@ import "github.com/google/uuid"
 func GenerateSessionID() string {
 	return uuid.New().String()
 }
+
+func GenerateEventID() string {
+	return uuid.New().String()
+}
+
+func GenerateBatchID() string {
+	return uuid.New().String()
+}
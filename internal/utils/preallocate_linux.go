@@ -0,0 +1,23 @@
+//go:build linux
+
+package utils
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Preallocate выделяет на диске size байтов под file, чтобы запись чанков не упёрлась в нехватку места.
+// Если файловая система не поддерживает fallocate, файл только увеличивается до size.
+// Возвращает true, если место действительно выделено и уже учтено в свободном месте диска.
+func Preallocate(file *os.File, size int64) (bool, error) {
+	if size <= 0 {
+		return false, file.Truncate(size)
+	}
+	err := syscall.Fallocate(int(file.Fd()), 0, 0, size)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return false, file.Truncate(size)
+	}
+	return err == nil, err
+}
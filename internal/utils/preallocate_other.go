@@ -0,0 +1,11 @@
+//go:build !linux
+
+package utils
+
+import "os"
+
+// Preallocate увеличивает file до size байтов; место на диске выделяется по мере записи,
+// поэтому результат всегда false.
+func Preallocate(file *os.File, size int64) (bool, error) {
+	return false, file.Truncate(size)
+}
@@ -0,0 +1,132 @@
+package test
+
+import (
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminListSessions_ParsesFilter(t *testing.T) {
+	var received services.SessionFilter
+	mockService := &services.SessionServiceMock{
+		QuerySessionsFunc: func(filter services.SessionFilter) (*services.SessionPage, error) {
+			received = filter
+			return &services.SessionPage{
+				Sessions: []map[string]interface{}{{"session_id": "abc", "owner": "alice"}},
+				Total:    21,
+				Offset:   filter.Offset,
+				Limit:    filter.Limit,
+			}, nil
+		},
+	}
+	handler := handlers.NewAdminHandler(mockService)
+
+	req := httptest.NewRequest("GET", "/admin/sessions?status=in_progress&owner=alice&min_age=1h&max_age=48h&min_size=1MB&max_size=2GB&offset=20&limit=10", nil)
+	rr := httptest.NewRecorder()
+	handler.ListSessions(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, services.SessionFilter{
+		Status:  "in_progress",
+		Owner:   "alice",
+		MinAge:  time.Hour,
+		MaxAge:  48 * time.Hour,
+		MinSize: 1 << 20,
+		MaxSize: 2 << 30,
+		Offset:  20,
+		Limit:   10,
+	}, received)
+
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, float64(21), response["total"])
+	assert.Equal(t, float64(20), response["offset"])
+	assert.Len(t, response["sessions"], 1)
+}
+
+func TestAdminListSessions_InvalidFilter(t *testing.T) {
+	handler := handlers.NewAdminHandler(&services.SessionServiceMock{})
+	for _, query := range []string{"min_age=yesterday", "max_size=big", "limit=-1", "offset=x"} {
+		rr := httptest.NewRecorder()
+		handler.ListSessions(rr, httptest.NewRequest("GET", "/admin/sessions?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
+
+func TestAdminGetSession(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		SessionDetailsFunc: func(sessionID string) (map[string]interface{}, error) {
+			switch sessionID {
+			case "abc":
+				return map[string]interface{}{
+					"session_id":      "abc",
+					"uploaded_chunks": []int{1, 2},
+					"parts":           []services.SessionPart{{Name: "abc_1.part", ChunkID: 1, Size: 10}},
+					"missing_parts":   []string{"abc_2.part"},
+				}, nil
+			case "broken":
+				return nil, errors.New("redis down")
+			}
+			return nil, services.ErrSessionNotFound
+		},
+	}
+	handler := handlers.NewAdminHandler(mockService)
+
+	get := func(id string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest("GET", "/admin/sessions/"+id, nil), map[string]string{"session_id": id})
+		rr := httptest.NewRecorder()
+		handler.GetSession(rr, req)
+		return rr
+	}
+
+	rr := get("abc")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		Session map[string]interface{} `json:"session"`
+	}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, []interface{}{"abc_2.part"}, response.Session["missing_parts"])
+
+	assert.Equal(t, http.StatusNotFound, get("missing").Code)
+	assert.Equal(t, http.StatusInternalServerError, get("broken").Code)
+}
+
+func TestRequireAdminToken(t *testing.T) {
+	router := mux.NewRouter()
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(handlers.RequireAdminToken("secret"))
+	admin.HandleFunc("/sessions", handlers.NewAdminHandler(&services.SessionServiceMock{}).ListSessions)
+
+	for header, expected := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"secret":        http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		req := httptest.NewRequest("GET", "/admin/sessions", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, expected, rr.Code, header)
+	}
+
+	// Без токена административные маршруты закрыты для любых запросов
+	closed := handlers.RequireAdminToken("")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, header := range []string{"", "Bearer ", "Bearer secret"} {
+		req := httptest.NewRequest("GET", "/admin/sessions", nil)
+		req.Header.Set("Authorization", header)
+		rr := httptest.NewRecorder()
+		closed.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusForbidden, rr.Code, header)
+	}
+}
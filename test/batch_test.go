@@ -0,0 +1,436 @@
+package test
+
+import (
+	"BASProject/config"
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// batchEntry собирает файл пакета с данным содержимым во временном пути.
+func batchEntry(t *testing.T, fileService *services.FileService, name, content string) *services.BatchEntry {
+	path, err := fileService.AssemblyPath("batch-" + filepath.Base(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &services.BatchEntry{Name: name, Path: path}
+}
+
+func TestCommitBatch_StoresAllFiles(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+	commitContent(t, fileService, "release/a.txt", "old")
+
+	entries := []*services.BatchEntry{
+		batchEntry(t, fileService, "release/a.txt", "new a"),
+		batchEntry(t, fileService, "release/b.txt", "new b"),
+	}
+	assert.NoError(t, fileService.CommitBatch("batch1", entries))
+	assert.Equal(t, "release/a.txt", entries[0].StoredName)
+	assert.Equal(t, 2, entries[0].Version)
+	assert.Equal(t, 1, entries[1].Version)
+	assert.Equal(t, "new a", string(readStored(t, fileService, "release/a.txt")))
+	assert.Equal(t, "new b", string(readStored(t, fileService, "release/b.txt")))
+	assert.Equal(t, "old", readVersion(t, fileService, "release/a.txt", 1))
+}
+
+// Test: если один файл пакета не переносится, уже перенесённые откатываются
+func TestCommitBatch_RollsBackOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+	commitContent(t, fileService, "a.txt", "old")
+	// Каталог под именем файла не даёт перенести второй файл
+	if err := os.MkdirAll(filepath.Join(dir, "taken"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []*services.BatchEntry{
+		batchEntry(t, fileService, "a.txt", "new a"),
+		batchEntry(t, fileService, "c.txt", "new c"),
+		batchEntry(t, fileService, "taken", "new"),
+	}
+	err := fileService.CommitBatch("batch1", entries)
+	assert.ErrorIs(t, err, services.ErrFileExists)
+
+	assert.Equal(t, "old", string(readStored(t, fileService, "a.txt")))
+	versions, err := fileService.ListVersions("a.txt")
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 1) {
+		assert.Equal(t, 1, versions[0].Version)
+	}
+	assert.NoFileExists(t, filepath.Join(dir, "c.txt"))
+	files, _ := fileService.ListFiles()
+	assert.Len(t, files, 1)
+}
+
+// Test: при политике reject занятое имя отклоняет пакет до переноса первого файла
+func TestCommitBatch_RejectsBeforeMoving(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+	fileService.Namespaces = map[string]config.NamespaceConfig{
+		"locked": {Root: "locked", OnConflict: services.OnConflictReject},
+	}
+	commitContent(t, fileService, "locked/b.txt", "old")
+
+	entries := []*services.BatchEntry{
+		batchEntry(t, fileService, "a.txt", "new a"),
+		batchEntry(t, fileService, "locked/b.txt", "new b"),
+	}
+	assert.ErrorIs(t, fileService.CommitBatch("batch1", entries), services.ErrFileExists)
+	assert.NoFileExists(t, filepath.Join(dir, "a.txt"))
+	assert.Equal(t, "", entries[0].StoredName)
+}
+
+// Test: откат пакета возвращает содержимое, заменённое по политике overwrite
+func TestRollbackBatch_RestoresOverwritten(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+	fileService.OnConflict = services.OnConflictOverwrite
+	commitContent(t, fileService, "a.txt", "old")
+
+	entries := []*services.BatchEntry{
+		batchEntry(t, fileService, "a.txt", "new a"),
+		batchEntry(t, fileService, "b.txt", "new b"),
+	}
+	assert.NoError(t, fileService.CommitBatch("batch1", entries))
+	assert.Equal(t, "new a", string(readStored(t, fileService, "a.txt")))
+
+	fileService.RollbackBatch(entries)
+	assert.Equal(t, "old", string(readStored(t, fileService, "a.txt")))
+	assert.NoFileExists(t, filepath.Join(dir, "b.txt"))
+	versions, _ := fileService.ListVersions("a.txt")
+	if assert.Len(t, versions, 1) {
+		assert.Equal(t, 1, versions[0].Version)
+	}
+
+	// После окончательной фиксации сохранённое для отката содержимое удаляется
+	entries = []*services.BatchEntry{batchEntry(t, fileService, "a.txt", "newer")}
+	assert.NoError(t, fileService.CommitBatch("batch1", entries))
+	fileService.ReleaseBatch(entries)
+	leftovers, _ := filepath.Glob(filepath.Join(dir, ".processing", "*"))
+	assert.Empty(t, leftovers)
+}
+
+// Test: фиксация, прерванная после переноса части файлов, откатывается при запуске
+func TestRecoverBatches_RollsBackInterruptedCommit(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+	commitContent(t, fileService, "a.txt", "old a")
+	fileService.OnConflict = services.OnConflictOverwrite
+	commitContent(t, fileService, "b.txt", "old b")
+	fileService.OnConflict = ""
+
+	entries := []*services.BatchEntry{
+		batchEntry(t, fileService, "a.txt", "new a"),
+		batchEntry(t, fileService, "b.txt", "new b"),
+		batchEntry(t, fileService, "c.txt", "new c"),
+	}
+	assert.NoError(t, fileService.CommitBatch("batch1", entries))
+	journal := filepath.Join(dir, ".processing", "batch-batch1.journal")
+	// Сервер остановился до того, как фиксация была отмечена в журнале завершённой
+	data, err := os.ReadFile(journal)
+	assert.NoError(t, err)
+	data = bytes.Replace(data, []byte(`"state":"committed"`), []byte(`"state":"committing"`), 1)
+	assert.NoError(t, os.WriteFile(journal, data, 0644))
+
+	restarted := services.NewFileService(nil, dir)
+	recovered, err := restarted.RecoverBatches()
+	assert.NoError(t, err)
+	if assert.Len(t, recovered, 1) {
+		assert.Equal(t, "batch1", recovered[0].BatchID)
+		assert.False(t, recovered[0].Committed)
+	}
+	assert.Equal(t, "old a", string(readStored(t, restarted, "a.txt")))
+	assert.Equal(t, "old b", string(readStored(t, restarted, "b.txt")))
+	assert.NoFileExists(t, filepath.Join(dir, "c.txt"))
+	versions, _ := restarted.ListVersions("a.txt")
+	assert.Len(t, versions, 1)
+	leftovers, _ := filepath.Glob(filepath.Join(dir, ".processing", "*"))
+	assert.Empty(t, leftovers)
+
+	recovered, err = restarted.RecoverBatches()
+	assert.NoError(t, err)
+	assert.Empty(t, recovered)
+}
+
+// Test: при политике rename журнал знает имя, под которым файл пакета попал в хранилище
+func TestRecoverBatches_RollsBackRenamedEntry(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+	fileService.OnConflict = services.OnConflictRename
+	commitContent(t, fileService, "a.txt", "old a")
+
+	entries := []*services.BatchEntry{batchEntry(t, fileService, "a.txt", "new a")}
+	assert.NoError(t, fileService.CommitBatch("batch1", entries))
+	assert.Equal(t, "a(1).txt", entries[0].StoredName)
+	journal := filepath.Join(dir, ".processing", "batch-batch1.journal")
+	data, err := os.ReadFile(journal)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(journal, bytes.Replace(data, []byte(`"state":"committed"`), []byte(`"state":"committing"`), 1), 0644))
+
+	_, err = services.NewFileService(nil, dir).RecoverBatches()
+	assert.NoError(t, err)
+	assert.Equal(t, "old a", string(readStored(t, fileService, "a.txt")))
+	assert.NoFileExists(t, filepath.Join(dir, "a(1).txt"))
+}
+
+// Test: пакет, все файлы которого перенесены и доступны, после сбоя остаётся зафиксированным
+func TestRecoverBatches_CompletesCommittedBatch(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+	fileService.OnConflict = services.OnConflictOverwrite
+	commitContent(t, fileService, "a.txt", "old a")
+
+	entries := []*services.BatchEntry{
+		batchEntry(t, fileService, "a.txt", "new a"),
+		batchEntry(t, fileService, "b.txt", "new b"),
+	}
+	assert.NoError(t, fileService.CommitBatch("batch1", entries))
+
+	recovered, err := services.NewFileService(nil, dir).RecoverBatches()
+	assert.NoError(t, err)
+	if assert.Len(t, recovered, 1) {
+		assert.True(t, recovered[0].Committed)
+		assert.Equal(t, "b.txt", recovered[0].Entries[1].StoredName)
+	}
+	assert.Equal(t, "new a", string(readStored(t, fileService, "a.txt")))
+	assert.Equal(t, "new b", string(readStored(t, fileService, "b.txt")))
+	leftovers, _ := filepath.Glob(filepath.Join(dir, ".processing", "*"))
+	assert.Empty(t, leftovers)
+}
+
+// Test: если обработка отклоняет файл пакета, в хранилище не попадает ни один файл пакета
+// и содержимое под их именами не меняется даже при политике overwrite
+func TestPipeline_RunBatchRejectsBeforeCommit(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+	fileService.OnConflict = services.OnConflictOverwrite
+	commitContent(t, fileService, "a.txt", "old a")
+	commitContent(t, fileService, "b.txt", "old b")
+
+	pipeline, err := services.NewPipeline(fileService, config.PipelineConfig{OnFailure: "quarantine", Processors: []config.ProcessorConfig{
+		{Name: "scanner", Type: "command", Command: []string{"sh", "-c", `! grep -q infected "$1"`, "sh", "{path}"}},
+	}})
+	assert.NoError(t, err)
+	entries := []*services.BatchEntry{
+		batchEntry(t, fileService, "b.txt", "new b"),
+		batchEntry(t, fileService, "a.txt", "infected a"),
+		batchEntry(t, fileService, "c.txt", "new c"),
+	}
+
+	results, rejected, err := pipeline.RunBatch("batch1", entries)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rejected)
+	assert.Len(t, results, 2)
+	assert.Equal(t, services.FileStatusQuarantined, results[1].Status)
+	assert.Equal(t, "", entries[0].StoredName)
+
+	assert.Equal(t, "old a", string(readStored(t, fileService, "a.txt")))
+	assert.Equal(t, "old b", string(readStored(t, fileService, "b.txt")))
+	assert.NoFileExists(t, filepath.Join(dir, "c.txt"))
+	quarantined, _ := os.ReadFile(filepath.Join(dir, ".quarantine", "a.txt"))
+	assert.Equal(t, "infected a", string(quarantined))
+	assert.NoFileExists(t, filepath.Join(dir, ".processing", "batch-batch1.journal"))
+}
+
+// Test: пакет, прошедший обработку, переносится в хранилище целиком с состоянием available
+func TestPipeline_RunBatchCommitsAfterCheck(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+	fileService.OnConflict = services.OnConflictOverwrite
+	commitContent(t, fileService, "a.txt", "old a")
+
+	pipeline, err := services.NewPipeline(fileService, config.PipelineConfig{Processors: []config.ProcessorConfig{
+		{Name: "check", Type: "command", Command: []string{"true"}},
+	}})
+	assert.NoError(t, err)
+	entries := []*services.BatchEntry{
+		batchEntry(t, fileService, "a.txt", "new a"),
+		batchEntry(t, fileService, "b.txt", "new b"),
+	}
+
+	results, rejected, err := pipeline.RunBatch("batch1", entries)
+	assert.NoError(t, err)
+	assert.Equal(t, -1, rejected)
+	assert.Len(t, results, 2)
+	assert.Equal(t, "new a", string(readStored(t, fileService, "a.txt")))
+	assert.Equal(t, "new b", string(readStored(t, fileService, "b.txt")))
+	assert.Equal(t, services.FileStatusAvailable, entries[1].Meta.Status)
+	assert.Len(t, entries[1].Meta.Processing, 1)
+	leftovers, _ := filepath.Glob(filepath.Join(dir, ".processing", "*"))
+	assert.Empty(t, leftovers)
+}
+
+// Test: Check не меняет файл, отклонение вступает в силу только через Apply
+func TestPipeline_CheckThenApply(t *testing.T) {
+	dir := t.TempDir()
+	pipeline := newTestPipeline(t, dir, config.PipelineConfig{OnFailure: "quarantine", Processors: []config.ProcessorConfig{
+		{Type: "command", Command: []string{"false"}},
+	}})
+	commitContent(t, pipeline.FileService, "a.txt", "bad!")
+	file := services.ProcessedFile{Name: "a.txt", Path: filepath.Join(dir, "a.txt")}
+
+	result := pipeline.Check(&file)
+	assert.Equal(t, services.FileStatusRejected, result.Status)
+	assert.FileExists(t, file.Path)
+
+	result = pipeline.Apply(&file, result)
+	assert.Equal(t, services.FileStatusQuarantined, result.Status)
+	assert.NoFileExists(t, file.Path)
+}
+
+func newBatchRouter(mock *services.BatchServiceMock) *mux.Router {
+	handler := handlers.NewBatchHandler(mock)
+	router := mux.NewRouter()
+	router.HandleFunc("/batches", handler.CreateBatch).Methods("POST")
+	router.HandleFunc("/batches/{batch_id}", handler.GetBatch).Methods("GET")
+	router.HandleFunc("/batches/{batch_id}/commit", handler.CommitBatch).Methods("POST")
+	router.HandleFunc("/batches/{batch_id}", handler.AbortBatch).Methods("DELETE")
+	return router
+}
+
+func TestBatchHandler_CreateBatch(t *testing.T) {
+	var received services.BatchParams
+	router := newBatchRouter(&services.BatchServiceMock{
+		CreateBatchFunc: func(params services.BatchParams) (*services.Batch, error) {
+			received = params
+			return &services.Batch{ID: "batch123", Status: services.BatchStatusOpen}, nil
+		},
+	})
+
+	body := `{"namespace":"releases","files":[{"file_name":"a.csv","file_size":3,"file_hash":"h1"},{"file_name":"b.csv","file_size":5,"file_hash":"h2"}]}`
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/batches", bytes.NewBufferString(body)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "releases", received.Namespace)
+	assert.Len(t, received.Files, 2)
+	var response struct {
+		Batch services.Batch `json:"batch"`
+	}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "batch123", response.Batch.ID)
+
+	for _, body := range []string{`{"files":[]}`, `{"files":[{"file_name":"a.csv","file_size":3}]}`, `not json`} {
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", "/batches", bytes.NewBufferString(body)))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+}
+
+func TestBatchHandler_CreateBatchErrors(t *testing.T) {
+	body := `{"files":[{"file_name":"a.csv","file_size":3,"file_hash":"h1"},{"file_name":"a.csv","file_size":5,"file_hash":"h2"}]}`
+	for err, code := range map[error]int{
+		fmt.Errorf("%w: duplicate names", services.ErrBatchInvalid): http.StatusBadRequest,
+		services.ErrInsufficientStorage:                             http.StatusInsufficientStorage,
+		services.ErrFileExists:                                      http.StatusConflict,
+	} {
+		router := newBatchRouter(&services.BatchServiceMock{
+			CreateBatchFunc: func(params services.BatchParams) (*services.Batch, error) {
+				return nil, fmt.Errorf("file 2 (a.csv): %w", err)
+			},
+		})
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", "/batches", bytes.NewBufferString(body)))
+		assert.Equal(t, code, rr.Code, err.Error())
+	}
+}
+
+func TestBatchHandler_CommitBatch(t *testing.T) {
+	cases := []struct {
+		name   string
+		batch  *services.Batch
+		err    error
+		status int
+	}{
+		{"committed", &services.Batch{ID: "b1", Status: services.BatchStatusCommitted}, nil, http.StatusOK},
+		{"processing", &services.Batch{ID: "b1", Status: services.BatchStatusProcessing}, nil, http.StatusAccepted},
+		{"incomplete", &services.Batch{ID: "b1", Status: services.BatchStatusOpen}, fmt.Errorf("%w: a.csv", services.ErrBatchIncomplete), http.StatusConflict},
+		{"busy", &services.Batch{ID: "b1", Status: services.BatchStatusCommitting}, services.ErrBatchBusy, http.StatusConflict},
+		{"failed", &services.Batch{ID: "b1", Status: services.BatchStatusFailed, Error: "hash mismatch"}, fmt.Errorf("a.csv: file hash mismatch"), http.StatusUnprocessableEntity},
+		{"not found", nil, services.ErrBatchNotFound, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		router := newBatchRouter(&services.BatchServiceMock{
+			CommitBatchFunc: func(batchID string) (*services.Batch, error) {
+				assert.Equal(t, "b1", batchID)
+				return tc.batch, tc.err
+			},
+		})
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", "/batches/b1/commit", nil))
+		assert.Equal(t, tc.status, rr.Code, tc.name)
+	}
+}
+
+func TestBatchHandler_GetAndAbort(t *testing.T) {
+	router := newBatchRouter(&services.BatchServiceMock{
+		GetBatchFunc: func(batchID string) (*services.Batch, error) {
+			return &services.Batch{ID: batchID, Status: services.BatchStatusOpen, Files: []services.BatchFile{{FileName: "a.csv", UploadedSize: 2}}}, nil
+		},
+		AbortBatchFunc: func(batchID string) (*services.Batch, error) {
+			return &services.Batch{ID: batchID, Status: services.BatchStatusCommitted}, fmt.Errorf("%w: batch is committed", services.ErrBatchClosed)
+		},
+	})
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/batches/b1", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		Batch services.Batch `json:"batch"`
+	}
+	json.NewDecoder(rr.Body).Decode(&response)
+	if assert.Len(t, response.Batch.Files, 1) {
+		assert.Equal(t, int64(2), response.Batch.Files[0].UploadedSize)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/batches/b1", nil))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	rr = httptest.NewRecorder()
+	newBatchRouter(&services.BatchServiceMock{}).ServeHTTP(rr, httptest.NewRequest("GET", "/batches/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+// Test: сессию файла пакета нельзя завершить отдельно от пакета
+func TestCompleteUpload_BatchSession(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"completed": true,
+				"status":    "completed",
+				"file_name": "a.csv",
+				"batch_id":  "b1",
+			}, nil
+		},
+		FileService: &services.FileServiceMock{
+			CommitFileFunc: func(name, assembledPath string) (string, int, error) {
+				t.Fatal("batch file must not be committed on its own")
+				return "", 0, nil
+			},
+		},
+	}
+	handler := handlers.NewUploadChunkHandler(mockService)
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/complete/{session_id}", handler.CompleteUpload)
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/complete/session123", nil))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "Session belongs to a batch.", response["message"])
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"BASProject/config"
+	"BASProject/internal/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalculateChunkSize_DefaultTiers(t *testing.T) {
+	fileService := services.NewFileService(nil, t.TempDir())
+
+	assert.Equal(t, int64(4<<20), fileService.CalculateChunkSize(10<<20, 0))
+	assert.Equal(t, int64(8<<20), fileService.CalculateChunkSize(100<<20, 0))
+	assert.Equal(t, int64(16<<20), fileService.CalculateChunkSize(1<<30, 0))
+	// Размер потока неизвестен — используется default_size
+	assert.Equal(t, int64(4<<20), fileService.CalculateChunkSize(0, 0))
+}
+
+func TestCalculateChunkSize_PreferredIsClamped(t *testing.T) {
+	fileService := services.NewFileService(nil, t.TempDir())
+	fileService.Chunking = config.ChunkingConfig{
+		MinSize:     512 << 10,
+		MaxSize:     64 << 20,
+		DefaultSize: 4 << 20,
+	}
+
+	assert.Equal(t, int64(64<<20), fileService.CalculateChunkSize(10<<30, 64<<20))
+	assert.Equal(t, int64(512<<10), fileService.CalculateChunkSize(10<<20, 512<<10))
+	assert.Equal(t, int64(512<<10), fileService.CalculateChunkSize(10<<20, 1024))
+	assert.Equal(t, int64(64<<20), fileService.CalculateChunkSize(10<<20, 1<<30))
+}
+
+func TestParseByteSize(t *testing.T) {
+	cases := map[string]config.ByteSize{
+		"1024":  1024,
+		"512KB": 512 << 10,
+		"64 mb": 64 << 20,
+		"1GB":   1 << 30,
+		"100B":  100,
+	}
+	for input, expected := range cases {
+		size, err := config.ParseByteSize(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, size, input)
+	}
+	for _, input := range []string{"", "MB", "-1KB", "1.5MB", "ten"} {
+		_, err := config.ParseByteSize(input)
+		assert.Error(t, err, input)
+	}
+	assert.Equal(t, "64MB", config.ByteSize(64<<20).String())
+}
+
+func TestChunkingConfig_Validate(t *testing.T) {
+	assert.NoError(t, config.DefaultChunking().Validate())
+
+	invalid := config.DefaultChunking()
+	invalid.DefaultSize = invalid.MaxSize * 2
+	assert.Error(t, invalid.Validate())
+
+	unsorted := config.DefaultChunking()
+	unsorted.Tiers[0], unsorted.Tiers[1] = unsorted.Tiers[1], unsorted.Tiers[0]
+	assert.Error(t, unsorted.Validate())
+}
+
+func TestLoadConfig_Chunking(t *testing.T) {
+	cfg, err := config.LoadConfig("../config/config.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, config.ByteSize(256<<10), cfg.Chunking.MinSize)
+	assert.Equal(t, config.ByteSize(4<<20), cfg.Chunking.DefaultSize)
+	assert.Len(t, cfg.Chunking.Tiers, 3)
+	assert.Equal(t, config.ByteSize(0), cfg.Chunking.Tiers[2].MaxFileSize)
+}
@@ -3,18 +3,43 @@ package test
 import (
 	"BASProject/internal/handlers"
 	"BASProject/internal/services"
+	"bufio"
 	"bytes"
-	"context"
 	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
 
+// newChunkRequest собирает multipart-запрос так же, как это делает клиент.
+func newChunkRequest(t *testing.T, url, chunkID, checksum string, data []byte) *http.Request {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	writer.WriteField("chunk_id", chunkID)
+	writer.WriteField("checksum", checksum)
+	part, err := writer.CreateFormFile("chunk_data", "chunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	writer.Close()
+
+	req, err := http.NewRequest("POST", url, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
 func TestUploadChunkHandler_MissingSessionID(t *testing.T) {
 	handler := handlers.NewUploadChunkHandler(&services.SessionServiceMock{})
 	req, err := http.NewRequest("POST", "/upload/chunk", nil)
@@ -23,9 +48,7 @@ func TestUploadChunkHandler_MissingSessionID(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	router := mux.NewRouter()
-	router.HandleFunc("/upload/chunk/{session_id}", handler.UploadChunk)
-	router.ServeHTTP(rr, req)
+	handler.UploadChunk(rr, req)
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	var response map[string]interface{}
@@ -92,21 +115,31 @@ func TestUploadChunkHandler_ReadChunkDataError(t *testing.T) {
 
 func TestUploadChunkHandler_Timeout(t *testing.T) {
 	handler := handlers.NewUploadChunkHandler(&services.SessionServiceMock{})
-	req, err := http.NewRequest("POST", "/upload/chunk/session123", strings.NewReader("chunk data"))
+	handler.ChunkTimeout = 200 * time.Millisecond
+	router := mux.NewRouter()
+	router.HandleFunc("/upload/chunk/{session_id}", handler.UploadChunk)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
 	if err != nil {
 		t.Fatal(err)
 	}
-	req.Form = map[string][]string{"chunk_id": {"1"}, "checksum": {"1234"}}
-	req.ContentLength = int64(1024 * 1024 * 20) // Large chunk to trigger timeout
+	defer conn.Close()
 
-	rr := httptest.NewRecorder()
-	router := mux.NewRouter()
-	router.HandleFunc("/upload/chunk/{session_id}", handler.UploadChunk)
-	router.ServeHTTP(rr, req.WithContext(context.Background()))
+	// Клиент заявляет чанк целиком, но отправляет только его начало и замолкает
+	body := "--b\r\nContent-Disposition: form-data; name=\"chunk_data\"; filename=\"chunk\"\r\n\r\nchunk data"
+	fmt.Fprintf(conn, "POST /upload/chunk/session123 HTTP/1.1\r\nHost: localhost\r\nContent-Type: multipart/form-data; boundary=b\r\nContent-Length: %d\r\n\r\n%s", 64*1024, body)
 
-	assert.Equal(t, http.StatusGatewayTimeout, rr.Code)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
 	var response map[string]interface{}
-	json.NewDecoder(rr.Body).Decode(&response)
+	json.NewDecoder(resp.Body).Decode(&response)
 	assert.Contains(t, response["message"], "Timeout processing chunk")
 }
 
@@ -117,12 +150,7 @@ func TestUploadChunkHandler_ChecksumValidationFailed(t *testing.T) {
 		},
 	}
 	handler := handlers.NewUploadChunkHandler(mockService)
-	req, err := http.NewRequest("POST", "/upload/chunk/session123", bytes.NewReader([]byte("chunk data")))
-	if err != nil {
-		t.Fatal(err)
-	}
-	req.Form = map[string][]string{"chunk_id": {"1"}, "checksum": {"1234"}}
-	req.ContentLength = int64(len("chunk data"))
+	req := newChunkRequest(t, "/upload/chunk/session123", "1", "1234", []byte("chunk data"))
 
 	rr := httptest.NewRecorder()
 	router := mux.NewRouter()
@@ -143,12 +171,7 @@ func TestUploadChunkHandler_Success(t *testing.T) {
 		},
 	}
 	handler := handlers.NewUploadChunkHandler(mockService)
-	req, err := http.NewRequest("POST", "/upload/chunk/session123", bytes.NewReader([]byte("chunk data")))
-	if err != nil {
-		t.Fatal(err)
-	}
-	req.Form = map[string][]string{"chunk_id": {"1"}, "checksum": {"1234"}}
-	req.ContentLength = int64(len("chunk data"))
+	req := newChunkRequest(t, "/upload/chunk/session123", "1", "1234", []byte("chunk data"))
 
 	rr := httptest.NewRecorder()
 	router := mux.NewRouter()
@@ -172,20 +195,109 @@ func TestUploadChunkHandler_ChunkAlreadyExists(t *testing.T) {
 		},
 	}
 	handler := handlers.NewUploadChunkHandler(mockService)
-	req, err := http.NewRequest("POST", "/upload/chunk/session123", bytes.NewReader([]byte("chunk data")))
+	req := newChunkRequest(t, "/upload/chunk/session123", "1", "1234", []byte("chunk data"))
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/upload/chunk/{session_id}", handler.UploadChunk)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "Chunk already uploaded.", response["message"])
+}
+
+// newOffsetChunkRequest собирает multipart-запрос чанка, адресованного смещением.
+func newOffsetChunkRequest(t *testing.T, url, offset string, data []byte) *http.Request {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	writer.WriteField("offset", offset)
+	writer.WriteField("checksum", "1234")
+	part, err := writer.CreateFormFile("chunk_data", "chunk")
 	if err != nil {
 		t.Fatal(err)
 	}
-	req.Form = map[string][]string{"chunk_id": {"1"}, "checksum": {"1234"}}
-	req.ContentLength = int64(len("chunk data"))
+	part.Write(data)
+	writer.Close()
+
+	req, err := http.NewRequest("POST", url, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestUploadChunkHandler_OffsetSuccess(t *testing.T) {
+	var savedOffset int64
+	mockService := &services.SessionServiceMock{
+		FileService: &services.FileServiceMock{
+			SaveChunkAtFunc: func(sessionID string, offset int64, data []byte) error {
+				savedOffset = offset
+				return nil
+			},
+		},
+	}
+	handler := handlers.NewUploadChunkHandler(mockService)
+	req := newOffsetChunkRequest(t, "/upload/chunk/session123", "4096", []byte("chunk data"))
 
 	rr := httptest.NewRecorder()
 	router := mux.NewRouter()
 	router.HandleFunc("/upload/chunk/{session_id}", handler.UploadChunk)
 	router.ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int64(4096), savedOffset)
 	var response map[string]interface{}
 	json.NewDecoder(rr.Body).Decode(&response)
-	assert.Equal(t, "Chunk already uploaded.", response["message"])
+	assert.Equal(t, float64(4096+len("chunk data")), response["next_offset"])
+}
+
+func TestUploadChunkHandler_OffsetErrors(t *testing.T) {
+	cases := []struct {
+		err     error
+		code    int
+		message string
+	}{
+		{services.ErrChunkOverlap, http.StatusConflict, "Chunk overlaps an uploaded range."},
+		{services.ErrChunkAlreadyExists, http.StatusConflict, "Chunk already uploaded."},
+		{services.ErrChunkSizeInvalid, http.StatusBadRequest, "Invalid chunk size."},
+		{services.ErrChunkModeMismatch, http.StatusBadRequest, "Session expects chunks addressed by chunk_id."},
+		{services.ErrSessionNotFound, http.StatusNotFound, "Upload session not found."},
+	}
+	for _, tc := range cases {
+		mockService := &services.SessionServiceMock{
+			FileService: &services.FileServiceMock{
+				SaveChunkAtFunc: func(sessionID string, offset int64, data []byte) error { return tc.err },
+			},
+		}
+		handler := handlers.NewUploadChunkHandler(mockService)
+		req := newOffsetChunkRequest(t, "/upload/chunk/session123", "0", []byte("chunk data"))
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/upload/chunk/{session_id}", handler.UploadChunk)
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, tc.code, rr.Code, tc.err.Error())
+		var response map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&response)
+		assert.Equal(t, tc.message, response["message"])
+	}
+}
+
+func TestUploadChunkHandler_InvalidOffset(t *testing.T) {
+	handler := handlers.NewUploadChunkHandler(&services.SessionServiceMock{})
+	req := newOffsetChunkRequest(t, "/upload/chunk/session123", "-5", []byte("chunk data"))
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/upload/chunk/{session_id}", handler.UploadChunk)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "Invalid offset format.", response["message"])
 }
@@ -0,0 +1,177 @@
+package test
+
+import (
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// checkChunkGeometry проверяет свойства ValidateChunk для одного набора входных данных.
+func checkChunkGeometry(t *testing.T, chunkID int, length, chunkSize, fileSize int64) {
+	err := services.ValidateChunk(chunkID, length, chunkSize, fileSize)
+	if err != nil {
+		if !errors.Is(err, services.ErrChunkSizeInvalid) && !errors.Is(err, services.ErrChunkOutOfRange) {
+			t.Fatalf("chunk %d (%d bytes) of %d/%d: unexpected error %v", chunkID, length, fileSize, chunkSize, err)
+		}
+		// Ошибка сообщает ожидаемый диапазон номеров или ожидаемый размер
+		if errors.Is(err, services.ErrChunkOutOfRange) && !strings.Contains(err.Error(), "outside of 1..") {
+			t.Fatalf("out of range error without the expected range: %v", err)
+		}
+		if errors.Is(err, services.ErrChunkSizeInvalid) && chunkSize > 0 && !strings.Contains(err.Error(), "expected") && !strings.Contains(err.Error(), "file size") {
+			t.Fatalf("size error without the expected size: %v", err)
+		}
+		return
+	}
+
+	if chunkSize <= 0 || chunkID < 1 || length < 1 || length > chunkSize {
+		t.Fatalf("chunk %d (%d bytes) of %d/%d accepted", chunkID, length, fileSize, chunkSize)
+	}
+	if fileSize <= 0 {
+		return
+	}
+	// Принятый чанк лежит внутри файла, не последний чанк имеет размер ровно chunkSize
+	offset := int64(chunkID-1) * chunkSize
+	if offset/chunkSize != int64(chunkID-1) || offset >= fileSize || length > fileSize-offset {
+		t.Fatalf("chunk %d (%d bytes) of %d/%d lies outside of the file", chunkID, length, fileSize, chunkSize)
+	}
+	if end := offset + length; end != fileSize && length != chunkSize {
+		t.Fatalf("chunk %d (%d bytes) of %d/%d is short but not the last", chunkID, length, fileSize, chunkSize)
+	}
+}
+
+func FuzzValidateChunk(f *testing.F) {
+	for _, seed := range []struct {
+		chunkID                     int
+		length, chunkSize, fileSize int64
+	}{
+		{1, 4, 4, 10},
+		{3, 2, 4, 10},
+		{3, 4, 4, 10},
+		{0, 4, 4, 10},
+		{-1, 4, 4, 10},
+		{4, 4, 4, 10},
+		{2, 3, 4, 10},
+		{1, 10, 16, 10},
+		{1, 0, 4, 0},
+		{7, 4, 4, 0},
+		{1, 5, 4, 0},
+		{1, 1, 0, 10},
+		{math.MaxInt32, 1, 1, math.MaxInt64},
+		{math.MaxInt32, 1, math.MaxInt64, 0},
+		{2, math.MaxInt64 - math.MaxInt64/2, math.MaxInt64 / 2, math.MaxInt64},
+	} {
+		f.Add(seed.chunkID, seed.length, seed.chunkSize, seed.fileSize)
+	}
+	f.Fuzz(func(t *testing.T, chunkID int, length, chunkSize, fileSize int64) {
+		checkChunkGeometry(t, chunkID, length, chunkSize, fileSize)
+	})
+}
+
+// Test: принятые чанки в точности покрывают файл, любые соседние номера и размеры отклоняются
+func TestValidateChunk_TilesFile(t *testing.T) {
+	rng := rand.New(rand.NewSource(50))
+	for i := 0; i < 500; i++ {
+		chunkSize := rng.Int63n(64) + 1
+		fileSize := rng.Int63n(1024) + 1
+		totalChunks := int((fileSize + chunkSize - 1) / chunkSize)
+
+		var covered int64
+		for chunkID := 1; chunkID <= totalChunks; chunkID++ {
+			length, err := services.ChunkLength(chunkID, chunkSize, fileSize)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.NoError(t, services.ValidateChunk(chunkID, length, chunkSize, fileSize))
+			assert.ErrorIs(t, services.ValidateChunk(chunkID, length+1, chunkSize, fileSize), services.ErrChunkSizeInvalid)
+			assert.ErrorIs(t, services.ValidateChunk(chunkID, length-1, chunkSize, fileSize), services.ErrChunkSizeInvalid)
+			covered += length
+		}
+		assert.Equal(t, fileSize, covered, "file %d bytes, chunk %d bytes", fileSize, chunkSize)
+		assert.ErrorIs(t, services.ValidateChunk(0, chunkSize, chunkSize, fileSize), services.ErrChunkOutOfRange)
+		assert.ErrorIs(t, services.ValidateChunk(totalChunks+1, chunkSize, chunkSize, fileSize), services.ErrChunkOutOfRange)
+
+		for j := 0; j < 20; j++ {
+			checkChunkGeometry(t, rng.Intn(totalChunks+4)-2, rng.Int63n(chunkSize+3)-1, chunkSize, fileSize)
+			checkChunkGeometry(t, rng.Intn(totalChunks+4)-2, rng.Int63n(chunkSize+3)-1, chunkSize, 0)
+		}
+	}
+}
+
+// Test: сообщения об ошибках называют ожидаемый диапазон и размер
+func TestValidateChunk_Errors(t *testing.T) {
+	err := services.ValidateChunk(4, 4, 4, 10)
+	assert.ErrorIs(t, err, services.ErrChunkOutOfRange)
+	assert.Contains(t, err.Error(), "chunk 4 is outside of 1..3")
+
+	err = services.ValidateChunk(2, 3, 4, 10)
+	assert.ErrorIs(t, err, services.ErrChunkSizeInvalid)
+	assert.Contains(t, err.Error(), "chunk 2 has 3 bytes, expected 4")
+
+	err = services.ValidateChunk(3, 4, 4, 10)
+	assert.Contains(t, err.Error(), "chunk 3 has 4 bytes, expected 2")
+
+	// Размер отложенной сессии неизвестен: любой номер, размер до chunk_size
+	assert.NoError(t, services.ValidateChunk(100, 1, 4, 0))
+	err = services.ValidateChunk(1, 5, 4, 0)
+	assert.ErrorIs(t, err, services.ErrChunkSizeInvalid)
+	assert.Contains(t, err.Error(), "expected 1..4")
+	assert.ErrorIs(t, services.ValidateChunk(0, 4, 4, 0), services.ErrChunkOutOfRange)
+}
+
+// FuzzUploadChunkHandler_ChunkID отправляет обработчику произвольные chunk_id и размеры чанков
+// сессии с файлом 10 байт и чанками по 4 байта: принимаются только чанки 1..3 точного размера,
+// всё остальное отклоняется с 400, а не с 500.
+func FuzzUploadChunkHandler_ChunkID(f *testing.F) {
+	for _, seed := range []struct {
+		chunkID string
+		size    int
+	}{
+		{"1", 4}, {"3", 2}, {"0", 4}, {"-1", 4}, {"4", 4}, {"2", 3}, {"3", 4},
+		{"abc", 4}, {"", 4}, {"1.5", 4}, {"99999999999999999999", 4}, {"+2", 4}, {" 1", 4},
+	} {
+		f.Add(seed.chunkID, seed.size)
+	}
+	f.Fuzz(func(t *testing.T, chunkID string, size int) {
+		if size < 1 || size > 64 {
+			t.Skip()
+		}
+		mockService := &services.SessionServiceMock{
+			FileService: &services.FileServiceMock{
+				ValidateChecksumFunc: func(data []byte, checksum string) bool { return true },
+				SaveChunkFunc: func(sessionID string, chunkID int, data []byte) error {
+					return services.ValidateChunk(chunkID, int64(len(data)), 4, 10)
+				},
+			},
+		}
+		handler := handlers.NewUploadChunkHandler(mockService)
+		req := newChunkRequest(t, "/upload/chunk/session123", chunkID, "1234", bytes.Repeat([]byte("x"), size))
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/upload/chunk/{session_id}", handler.UploadChunk)
+		router.ServeHTTP(rr, req)
+
+		parsed, err := strconv.Atoi(chunkID)
+		valid := err == nil && services.ValidateChunk(parsed, int64(size), 4, 10) == nil
+		if valid {
+			assert.Equal(t, http.StatusOK, rr.Code, "chunk_id %q, %d bytes", chunkID, size)
+			return
+		}
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "chunk_id %q, %d bytes", chunkID, size)
+		var response map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&response)
+		assert.NotEmpty(t, response["details"], "chunk_id %q, %d bytes", chunkID, size)
+	})
+}
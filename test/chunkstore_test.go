@@ -0,0 +1,188 @@
+package test
+
+import (
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFileService_StoreAndLookupChunks(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+
+	data := []byte("shared chunk")
+	unknown := sha256Hex([]byte("unknown chunk"))
+
+	missing, err := fileService.MissingChunks([]string{sha256Hex(data), unknown})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{sha256Hex(data), unknown}, missing)
+
+	hash, created, err := fileService.StoreChunk(data)
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, sha256Hex(data), hash)
+
+	_, created, err = fileService.StoreChunk(data)
+	assert.NoError(t, err)
+	assert.False(t, created)
+
+	missing, err = fileService.MissingChunks([]string{hash, unknown})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{unknown}, missing)
+
+	// Хранилище чанков не видно как обычные файлы
+	os.WriteFile(filepath.Join(dir, "report.txt"), []byte("report"), 0644)
+	files, err := fileService.ListFiles()
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	_, err = fileService.OpenFile(".chunks/" + hash[:2] + "/" + hash)
+	assert.ErrorIs(t, err, services.ErrFileNotFound)
+}
+
+func TestFileService_MissingChunksRejectsInvalidHash(t *testing.T) {
+	fileService := services.NewFileService(nil, t.TempDir())
+
+	_, err := fileService.MissingChunks([]string{"../../etc/passwd"})
+	assert.ErrorIs(t, err, services.ErrChunkHashInvalid)
+}
+
+func TestLookupChunks_InvalidHash(t *testing.T) {
+	handler := handlers.NewChunkStoreHandler(&services.FileServiceMock{
+		MissingChunksFunc: func(hashes []string) ([]string, error) {
+			return nil, services.ErrChunkHashInvalid
+		},
+	})
+
+	req, err := http.NewRequest("POST", "/chunks/lookup", strings.NewReader(`{"hashes":["xyz"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.LookupChunks(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestLookupChunks_Success(t *testing.T) {
+	handler := handlers.NewChunkStoreHandler(&services.FileServiceMock{
+		MissingChunksFunc: func(hashes []string) ([]string, error) {
+			return hashes[1:], nil
+		},
+	})
+
+	req, err := http.NewRequest("POST", "/chunks/lookup", strings.NewReader(`{"hashes":["a","b"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.LookupChunks(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, []interface{}{"b"}, response["missing"])
+}
+
+func TestStoreChunk_Created(t *testing.T) {
+	data := []byte("chunk payload")
+	handler := handlers.NewChunkStoreHandler(services.NewFileService(nil, t.TempDir()))
+
+	req := newChunkRequest(t, "/chunks", "", sha256Hex(data), data)
+	rr := httptest.NewRecorder()
+	handler.StoreChunk(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	req = newChunkRequest(t, "/chunks", "", sha256Hex(data), data)
+	rr = httptest.NewRecorder()
+	handler.StoreChunk(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, sha256Hex(data), response["hash"])
+}
+
+func TestStoreChunk_ChecksumMismatch(t *testing.T) {
+	handler := handlers.NewChunkStoreHandler(services.NewFileService(nil, t.TempDir()))
+
+	req := newChunkRequest(t, "/chunks", "", sha256Hex([]byte("other")), []byte("chunk payload"))
+	rr := httptest.NewRecorder()
+	handler.StoreChunk(rr, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+}
+
+func TestLinkChunks_ReportsMissing(t *testing.T) {
+	stored := sha256Hex([]byte("stored"))
+	mockService := &services.SessionServiceMock{
+		FileService: &services.FileServiceMock{
+			LinkChunkAtFunc: func(sessionID string, offset int64, hash string) (int64, error) {
+				if hash == stored {
+					return 6, nil
+				}
+				return 0, services.ErrChunkNotStored
+			},
+		},
+	}
+	handler := handlers.NewUploadChunkHandler(mockService)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"chunks": []map[string]interface{}{
+			{"offset": 0, "hash": stored},
+			{"offset": 6, "hash": sha256Hex([]byte("lost"))},
+		},
+	})
+	req, err := http.NewRequest("POST", "/upload/session123/refs", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/upload/{session_id}/refs", handler.LinkChunks)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, float64(1), response["linked"])
+	assert.Equal(t, float64(6), response["linked_size"])
+	assert.Len(t, response["missing"], 1)
+}
+
+func TestLinkChunks_SessionNotFound(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		FileService: &services.FileServiceMock{
+			LinkChunkAtFunc: func(sessionID string, offset int64, hash string) (int64, error) {
+				return 0, services.ErrSessionNotFound
+			},
+		},
+	}
+	handler := handlers.NewUploadChunkHandler(mockService)
+
+	req, err := http.NewRequest("POST", "/upload/missing/refs", strings.NewReader(`{"chunks":[{"offset":0,"hash":"abc"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/upload/{session_id}/refs", handler.LinkChunks)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
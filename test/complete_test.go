@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/mux"
@@ -14,11 +15,7 @@ import (
 )
 
 func TestCompleteUpload_MissingSessionID(t *testing.T) {
-	mockService := &services.SessionServiceMock{
-		CreateSessionFunc: func(fileName string, fileSize int64, fileHash string) (int64, error) {
-			return 1024, nil
-		},
-	}
+	mockService := &services.SessionServiceMock{}
 
 	handler := handlers.NewUploadChunkHandler(mockService)
 	req, err := http.NewRequest("POST", "/complete", nil)
@@ -27,9 +24,7 @@ func TestCompleteUpload_MissingSessionID(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	router := mux.NewRouter()
-	router.HandleFunc("/complete/{session_id}", handler.CompleteUpload)
-	router.ServeHTTP(rr, req)
+	handler.CompleteUpload(rr, req)
 
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	var response map[string]interface{}
@@ -38,10 +33,18 @@ func TestCompleteUpload_MissingSessionID(t *testing.T) {
 }
 
 func TestCompleteUpload_IncompleteUpload(t *testing.T) {
+	var deletedSession string
 	mockService := &services.SessionServiceMock{
+		DeleteSessionFunc: func(sessionID string) error {
+			deletedSession = sessionID
+			return nil
+		},
+		FileService: &services.FileServiceMock{},
 		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
 			return map[string]interface{}{
 				"completed":      false,
+				"status":         "in_progress",
+				"file_name":      "testfile",
 				"pending_chunks": []int{2, 3},
 			}, nil
 		},
@@ -62,7 +65,8 @@ func TestCompleteUpload_IncompleteUpload(t *testing.T) {
 	var response map[string]interface{}
 	json.NewDecoder(rr.Body).Decode(&response)
 	assert.Equal(t, "File upload incomplete. Some chunks are still missing.", response["message"])
-	assert.Equal(t, []interface{}{2, 3}, response["details"].(map[string]interface{})["missing_chunks"])
+	assert.Equal(t, []interface{}{float64(2), float64(3)}, response["details"].(map[string]interface{})["missing_chunks"])
+	assert.Equal(t, "session123", deletedSession)
 }
 
 func TestCompleteUpload_AssembleChunksError(t *testing.T) {
@@ -70,6 +74,8 @@ func TestCompleteUpload_AssembleChunksError(t *testing.T) {
 		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
 			return map[string]interface{}{
 				"completed": true,
+				"status":    "completed",
+				"file_name": "complete_test.bin",
 				"file_size": int64(1024),
 			}, nil
 		},
@@ -102,10 +108,12 @@ func TestCompleteUpload_Success(t *testing.T) {
 		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
 			return map[string]interface{}{
 				"completed": true,
+				"status":    "completed",
+				"file_name": "complete_test.bin",
 				"file_size": int64(1024),
 			}, nil
 		},
-		UpdateProgressFunc: func(sessionID string, fileSize int64) error {
+		UpdateProgressFunc: func(sessionID string) error {
 			return nil
 		},
 		FileService: &services.FileServiceMock{
@@ -132,3 +140,141 @@ func TestCompleteUpload_Success(t *testing.T) {
 	assert.Equal(t, "success", response["status"])
 	assert.Equal(t, "File upload completed successfully.", response["message"])
 }
+
+func TestCompleteUpload_DeferredSizeMismatch(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		FinalizeSessionFunc: func(sessionID, fileHash string, fileSize int64) error {
+			return fmt.Errorf("%w: declared 10 bytes", services.ErrDeferredSizeInvalid)
+		},
+	}
+
+	handler := handlers.NewUploadChunkHandler(mockService)
+	req, err := http.NewRequest("POST", "/complete/session123", strings.NewReader(`{"file_hash":"abc","file_size":10}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/complete/{session_id}", handler.CompleteUpload)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "Uploaded chunks do not match the declared file size.", response["message"])
+}
+
+func TestCompleteUpload_DeferredHashMismatch(t *testing.T) {
+	var finalizedHash string
+	mockService := &services.SessionServiceMock{
+		FinalizeSessionFunc: func(sessionID, fileHash string, fileSize int64) error {
+			finalizedHash = fileHash
+			return nil
+		},
+		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"completed": true,
+				"status":    "completed",
+				"deferred":  true,
+				"file_name": "deferred_test.bin",
+			}, nil
+		},
+		FileService: &services.FileServiceMock{
+			FileChecksumFunc: func(filePath string) (string, error) {
+				return "other", nil
+			},
+		},
+	}
+
+	handler := handlers.NewUploadChunkHandler(mockService)
+	req, err := http.NewRequest("POST", "/complete/session123", strings.NewReader(`{"file_hash":"abc","file_size":10}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/complete/{session_id}", handler.CompleteUpload)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, "abc", finalizedHash)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "File hash mismatch.", response["message"])
+}
+
+func TestCompleteUpload_IndexesVerifiedContent(t *testing.T) {
+	var indexedHash string
+	mockService := &services.SessionServiceMock{
+		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"completed": true,
+				"status":    "completed",
+				"file_name": "indexed_test.bin",
+				"file_hash": "abc",
+			}, nil
+		},
+		FileService: &services.FileServiceMock{
+			FileChecksumFunc: func(filePath string) (string, error) {
+				return "abc", nil
+			},
+			IndexContentFunc: func(fileHash, filePath string) error {
+				indexedHash = fileHash
+				return nil
+			},
+		},
+	}
+
+	handler := handlers.NewUploadChunkHandler(mockService)
+	req, err := http.NewRequest("POST", "/complete/abc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/complete/{session_id}", handler.CompleteUpload)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "abc", indexedHash)
+}
+
+func TestCompleteUpload_HashMismatchNotIndexed(t *testing.T) {
+	indexed := false
+	mockService := &services.SessionServiceMock{
+		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"completed": true,
+				"status":    "completed",
+				"file_name": "mismatch_test.bin",
+				"file_hash": "abc",
+			}, nil
+		},
+		FileService: &services.FileServiceMock{
+			FileChecksumFunc: func(filePath string) (string, error) {
+				return "other", nil
+			},
+			IndexContentFunc: func(fileHash, filePath string) error {
+				indexed = true
+				return nil
+			},
+		},
+	}
+
+	handler := handlers.NewUploadChunkHandler(mockService)
+	req, err := http.NewRequest("POST", "/complete/abc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/complete/{session_id}", handler.CompleteUpload)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.False(t, indexed)
+}
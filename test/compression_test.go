@@ -0,0 +1,142 @@
+package test
+
+import (
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+// gzipRequest сжимает тело запроса и выставляет Content-Encoding: gzip.
+func gzipRequest(t *testing.T, req *http.Request) *http.Request {
+	return compressRequest(t, req, "gzip", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })
+}
+
+// zstdRequest сжимает тело запроса и выставляет Content-Encoding: zstd.
+func zstdRequest(t *testing.T, req *http.Request) *http.Request {
+	return compressRequest(t, req, "zstd", func(w io.Writer) io.WriteCloser {
+		encoder, err := zstd.NewWriter(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoder
+	})
+}
+
+func compressRequest(t *testing.T, req *http.Request, encoding string, newWriter func(io.Writer) io.WriteCloser) *http.Request {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	writer := newWriter(&buf)
+	writer.Write(body)
+	writer.Close()
+
+	compressed, err := http.NewRequest(req.Method, req.URL.String(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed.Header = req.Header.Clone()
+	compressed.Header.Set("Content-Encoding", encoding)
+	return compressed
+}
+
+func serveChunk(handler *handlers.UploadChunkHandler, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/upload/{session_id}/chunk", handler.UploadChunk)
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestUploadChunkHandler_GzipBody(t *testing.T) {
+	data := []byte(strings.Repeat("date,value\n2024-01-01,42\n", 1000))
+	var saved []byte
+	mockService := &services.SessionServiceMock{
+		FileService: &services.FileServiceMock{
+			ValidateChecksumFunc: func(chunk []byte, checksum string) bool {
+				return checksum == sha256Hex(chunk)
+			},
+			SaveChunkFunc: func(sessionID string, chunkID int, chunk []byte) error {
+				saved = chunk
+				return nil
+			},
+		},
+	}
+	handler := handlers.NewUploadChunkHandler(mockService)
+	req := gzipRequest(t, newChunkRequest(t, "/upload/session123/chunk", "1", sha256Hex(data), data))
+
+	rr := serveChunk(handler, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, data, saved)
+}
+
+func TestUploadChunkHandler_ZstdBody(t *testing.T) {
+	data := []byte(strings.Repeat("date,value\n2024-01-01,42\n", 1000))
+	var saved []byte
+	mockService := &services.SessionServiceMock{
+		FileService: &services.FileServiceMock{
+			ValidateChecksumFunc: func(chunk []byte, checksum string) bool {
+				return checksum == sha256Hex(chunk)
+			},
+			SaveChunkFunc: func(sessionID string, chunkID int, chunk []byte) error {
+				saved = chunk
+				return nil
+			},
+		},
+	}
+	handler := handlers.NewUploadChunkHandler(mockService)
+	req := zstdRequest(t, newChunkRequest(t, "/upload/session123/chunk", "1", sha256Hex(data), data))
+
+	rr := serveChunk(handler, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, data, saved)
+}
+
+func TestUploadChunkHandler_UnsupportedEncoding(t *testing.T) {
+	handler := handlers.NewUploadChunkHandler(&services.SessionServiceMock{})
+	req := newChunkRequest(t, "/upload/session123/chunk", "1", "1234", []byte("chunk data"))
+	req.Header.Set("Content-Encoding", "br")
+
+	rr := serveChunk(handler, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+	assert.Contains(t, rr.Body.String(), "gzip")
+}
+
+func TestUploadChunkHandler_CorruptGzip(t *testing.T) {
+	handler := handlers.NewUploadChunkHandler(&services.SessionServiceMock{})
+	req := newChunkRequest(t, "/upload/session123/chunk", "1", "1234", []byte("chunk data"))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	rr := serveChunk(handler, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestUploadChunkHandler_DecompressedTooLarge(t *testing.T) {
+	data := make([]byte, 4<<20)
+	handler := handlers.NewUploadChunkHandler(&services.SessionServiceMock{})
+	handler.MaxChunkSize = 1 << 20
+	req := gzipRequest(t, newChunkRequest(t, "/upload/session123/chunk", "1", sha256Hex(data), data))
+
+	rr := serveChunk(handler, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+
+	req = zstdRequest(t, newChunkRequest(t, "/upload/session123/chunk", "1", sha256Hex(data), data))
+	rr = serveChunk(handler, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+}
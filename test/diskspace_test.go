@@ -0,0 +1,157 @@
+package test
+
+import (
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var errNoSpace = fmt.Errorf("%w: session needs 400 bytes, 100 bytes are free", services.ErrInsufficientStorage)
+
+// Test: нехватка места при создании сессии — 507
+func TestStartSession_InsufficientStorage(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		CreateSessionFunc: func(params services.SessionParams) (*services.SessionInfo, error) {
+			return nil, errNoSpace
+		},
+	}
+	handler := handlers.NewStartHandler(mockService)
+
+	requestBody, _ := json.Marshal(map[string]interface{}{
+		"file_name": "huge.bin",
+		"file_size": 200,
+		"file_hash": "testhash",
+	})
+	req, err := http.NewRequest("POST", "/start", bytes.NewBuffer(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.StartSession(rr, req)
+
+	assert.Equal(t, http.StatusInsufficientStorage, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "Insufficient storage.", response["message"])
+}
+
+// Test: место закончилось во время загрузки чанка — 507
+func TestUploadChunkHandler_InsufficientStorage(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		FileService: &services.FileServiceMock{
+			ValidateChecksumFunc: func(data []byte, checksum string) bool { return true },
+			SaveChunkFunc: func(sessionID string, chunkID int, data []byte) error {
+				return errNoSpace
+			},
+		},
+	}
+	handler := handlers.NewUploadChunkHandler(mockService)
+	req := newChunkRequest(t, "/upload/chunk/session123", "3", "1234", []byte("chunk data"))
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/upload/chunk/{session_id}", handler.UploadChunk)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInsufficientStorage, rr.Code)
+}
+
+// Test: нехватка места при сборке не удаляет сессию и чанки
+func TestCompleteUpload_InsufficientStorageKeepsSession(t *testing.T) {
+	var deleted, released bool
+	mockService := &services.SessionServiceMock{
+		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"completed": true,
+				"status":    "completed",
+				"file_name": "diskspace_test.bin",
+				"file_size": int64(1024),
+			}, nil
+		},
+		DeleteSessionFunc: func(sessionID string) error {
+			deleted = true
+			return nil
+		},
+		ReleaseReservationFunc: func(sessionID string) error {
+			released = true
+			return nil
+		},
+		FileService: &services.FileServiceMock{
+			AssembleChunksFunc: func(sessionID, outputFilePath string) error {
+				return fmt.Errorf("failed to append chunk: %w", errNoSpace)
+			},
+			DeleteChunksFunc: func(sessionID string) error {
+				t.Fatal("chunks must be kept")
+				return nil
+			},
+		},
+	}
+
+	handler := handlers.NewUploadChunkHandler(mockService)
+	req, err := http.NewRequest("POST", "/complete/session123", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/complete/{session_id}", handler.CompleteUpload)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInsufficientStorage, rr.Code)
+	assert.False(t, deleted)
+	assert.False(t, released)
+}
+
+// Test: резерв снимается после успешной сборки
+func TestCompleteUpload_ReleasesReservation(t *testing.T) {
+	var released string
+	mockService := &services.SessionServiceMock{
+		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"completed": true,
+				"status":    "completed",
+				"file_name": "diskspace_test.bin",
+				"file_size": int64(1024),
+			}, nil
+		},
+		ReleaseReservationFunc: func(sessionID string) error {
+			released = sessionID
+			return nil
+		},
+		FileService: &services.FileServiceMock{},
+	}
+
+	handler := handlers.NewUploadChunkHandler(mockService)
+	req, err := http.NewRequest("POST", "/complete/session123", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/complete/{session_id}", handler.CompleteUpload)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "session123", released)
+}
+
+// Test: хранилище чанков не пишет сверх запаса свободного места
+func TestStoreChunk_InsufficientStorage(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+	fileService.MinFreeSpace = 1 << 62
+
+	_, _, err := fileService.StoreChunk([]byte("chunk data"))
+	assert.ErrorIs(t, err, services.ErrInsufficientStorage)
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"BASProject/internal/utils"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestEnvelope(t *testing.T) *utils.Envelope {
+	key := make([]byte, 32)
+	rand.Read(key)
+	envelope, err := utils.NewEnvelope(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return envelope
+}
+
+func encryptBytes(t *testing.T, envelope *utils.Envelope, data []byte) []byte {
+	var buf bytes.Buffer
+	writer, err := envelope.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(data)
+	writer.Close()
+	return buf.Bytes()
+}
+
+func TestEnvelope_RoundTrip(t *testing.T) {
+	envelope := newTestEnvelope(t)
+	for _, size := range []int{0, 1, 64 * 1024, 64*1024 + 1, 200 * 1024} {
+		data := make([]byte, size)
+		rand.Read(data)
+		encrypted := encryptBytes(t, envelope, data)
+		assert.True(t, utils.IsEncrypted(bytes.NewReader(encrypted)))
+
+		reader, err := envelope.NewReader(bytes.NewReader(encrypted), int64(len(encrypted)))
+		if !assert.NoError(t, err, size) {
+			continue
+		}
+		assert.Equal(t, int64(size), reader.Size())
+		decrypted, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, data, decrypted, size)
+
+		// Произвольный доступ через границу сегментов
+		if size > 64*1024+50 {
+			part := make([]byte, 100)
+			n, err := reader.ReadAt(part, 64*1024-50)
+			assert.NoError(t, err)
+			assert.Equal(t, data[64*1024-50:64*1024+50], part[:n])
+		}
+	}
+}
+
+func TestEnvelope_DetectsTampering(t *testing.T) {
+	envelope := newTestEnvelope(t)
+	data := make([]byte, 100*1024)
+	encrypted := encryptBytes(t, envelope, data)
+
+	tampered := append([]byte(nil), encrypted...)
+	tampered[len(tampered)-100] ^= 1
+	reader, err := envelope.NewReader(bytes.NewReader(tampered), int64(len(tampered)))
+	assert.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	assert.ErrorIs(t, err, utils.ErrCorruptedCipher)
+
+	// Отброшенный последний сегмент: предыдущий не помечен как последний
+	truncated := encrypted[:len(encrypted)-(100*1024-64*1024)-16]
+	reader, err = envelope.NewReader(bytes.NewReader(truncated), int64(len(truncated)))
+	assert.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	assert.ErrorIs(t, err, utils.ErrCorruptedCipher)
+}
+
+func TestEnvelope_UnknownKey(t *testing.T) {
+	encrypted := encryptBytes(t, newTestEnvelope(t), []byte("secret"))
+
+	_, err := newTestEnvelope(t).NewReader(bytes.NewReader(encrypted), int64(len(encrypted)))
+	assert.ErrorIs(t, err, utils.ErrUnknownKey)
+}
+
+func TestLoadKeyFile_Hex(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	path := filepath.Join(t.TempDir(), "master.key")
+	os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600)
+
+	loaded, err := utils.LoadKeyFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, key, loaded)
+
+	os.WriteFile(path, []byte("short"), 0600)
+	_, err = utils.LoadKeyFile(path)
+	assert.Error(t, err)
+}
+
+func TestFileService_EncryptedChunkStore(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+	fileService.Envelope = newTestEnvelope(t)
+
+	data := []byte("confidential chunk contents")
+	hash, _, err := fileService.StoreChunk(data)
+	assert.NoError(t, err)
+
+	onDisk, err := os.ReadFile(filepath.Join(dir, ".chunks", hash[:2], hash))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(onDisk), "confidential")
+
+	checksum, err := fileService.CalculateFileChecksum(filepath.Join(dir, ".chunks", hash[:2], hash))
+	assert.NoError(t, err)
+	assert.Equal(t, hash, checksum)
+}
+
+func TestDownloadFile_Encrypted(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+	fileService.Envelope = newTestEnvelope(t)
+	data := make([]byte, 70*1024)
+	rand.Read(data)
+	os.WriteFile(filepath.Join(dir, "secret.bin"), encryptBytes(t, fileService.Envelope, data), 0644)
+	os.WriteFile(filepath.Join(dir, "legacy.txt"), []byte("written before encryption"), 0644)
+
+	files, err := fileService.ListFiles()
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	assert.Equal(t, int64(len(data)), files[1].Size)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/files/{name:.+}", handlers.NewFilesHandler(fileService).DownloadFile)
+
+	req, _ := http.NewRequest("GET", "/files/secret.bin", nil)
+	req.Header.Set("Range", "bytes=65500-65599")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.Equal(t, data[65500:65600], rr.Body.Bytes())
+
+	req, _ = http.NewRequest("GET", "/files/legacy.txt", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, "written before encryption", rr.Body.String())
+}
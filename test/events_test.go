@@ -0,0 +1,146 @@
+package test
+
+import (
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// sseEvent — событие, прочитанное из потока text/event-stream.
+type sseEvent struct {
+	Name string
+	Data services.ProgressEvent
+}
+
+func readSSEEvent(t *testing.T, reader *bufio.Reader) (sseEvent, bool) {
+	var event sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return event, false
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && event.Name != "":
+			return event, true
+		case strings.HasPrefix(line, "event: "):
+			event.Name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.Data))
+		}
+	}
+}
+
+func newEventsServer(progress *services.ProgressService, status map[string]interface{}) *httptest.Server {
+	mockService := &services.SessionServiceMock{
+		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
+			if status == nil {
+				return nil, services.ErrSessionNotFound
+			}
+			return status, nil
+		},
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/upload/{session_id}/events", handlers.NewEventsHandler(mockService, progress).StreamEvents)
+	return httptest.NewServer(router)
+}
+
+func TestProgressService_LocalFanOut(t *testing.T) {
+	progress := services.NewProgressService(nil)
+	c, cancel := context.WithCancel(context.Background())
+	first, _ := progress.Subscribe(c, "abc")
+	second, _ := progress.Subscribe(c, "abc")
+	other, _ := progress.Subscribe(c, "other")
+
+	progress.Publish(services.ProgressEvent{Type: services.ProgressChunk, SessionID: "abc", ChunkID: 1})
+	assert.Equal(t, 1, (<-first).ChunkID)
+	assert.Equal(t, 1, (<-second).ChunkID)
+	select {
+	case <-other:
+		t.Fatal("event delivered to another session")
+	default:
+	}
+
+	cancel()
+	for range first {
+	}
+	_, open := <-second
+	assert.False(t, open)
+}
+
+func TestStreamEvents_ProgressAndCompletion(t *testing.T) {
+	progress := services.NewProgressService(nil)
+	server := newEventsServer(progress, map[string]interface{}{
+		"file_name":     "video.mp4",
+		"file_size":     int64(300),
+		"uploaded_size": int64(100),
+		"status":        "in_progress",
+	})
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/upload/abc/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	reader := bufio.NewReader(resp.Body)
+
+	event, ok := readSSEEvent(t, reader)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, services.ProgressSnapshot, event.Name)
+	assert.Equal(t, int64(100), event.Data.UploadedSize)
+	assert.Equal(t, int64(200), event.Data.RemainingSize)
+	assert.Equal(t, "video.mp4", event.Data.FileName)
+
+	progress.Publish(services.ProgressEvent{Type: services.ProgressChunk, SessionID: "abc", ChunkID: 2, Size: 100, UploadedSize: 200, FileSize: 300, RemainingSize: 100})
+	progress.Publish(services.ProgressEvent{Type: services.ProgressCompleted, SessionID: "abc", UploadedSize: 300, FileSize: 300, FileName: "video.mp4"})
+
+	event, ok = readSSEEvent(t, reader)
+	assert.True(t, ok)
+	assert.Equal(t, services.ProgressChunk, event.Name)
+	assert.Equal(t, 2, event.Data.ChunkID)
+	assert.Equal(t, int64(100), event.Data.RemainingSize)
+
+	event, ok = readSSEEvent(t, reader)
+	assert.True(t, ok)
+	assert.Equal(t, services.ProgressCompleted, event.Name)
+
+	// После завершающего события сервер закрывает поток
+	done := make(chan bool)
+	go func() {
+		_, ok := readSSEEvent(t, reader)
+		done <- ok
+	}()
+	select {
+	case ok := <-done:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream was not closed after the completion event")
+	}
+}
+
+func TestStreamEvents_SessionNotFound(t *testing.T) {
+	server := newEventsServer(services.NewProgressService(nil), nil)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/upload/missing/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
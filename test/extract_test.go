@@ -0,0 +1,312 @@
+package test
+
+import (
+	"BASProject/config"
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type archiveEntry struct {
+	name     string
+	body     string
+	typeflag byte
+}
+
+func writeZip(t *testing.T, path string, entries []archiveEntry) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		if entry.typeflag == tar.TypeSymlink {
+			header.SetMode(os.ModeSymlink | 0777)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entry.body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTarGz(t *testing.T, path string, entries []archiveEntry) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.body)), Typeflag: entry.typeflag}
+		if entry.typeflag != tar.TypeReg {
+			header.Size, header.Linkname = 0, "/etc/passwd"
+		}
+		if entry.typeflag == tar.TypeDir {
+			header.Linkname = ""
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			tw.Write([]byte(entry.body))
+		}
+	}
+	tw.Close()
+	gz.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateExtraction(t *testing.T) {
+	assert.NoError(t, services.ValidateExtraction("photos.zip", true, ""))
+	assert.NoError(t, services.ValidateExtraction("logs.TAR.GZ", true, "unpacked/logs"))
+	assert.NoError(t, services.ValidateExtraction("notes.txt", false, ""))
+	assert.ErrorIs(t, services.ValidateExtraction("notes.txt", true, ""), services.ErrNotArchive)
+	assert.ErrorIs(t, services.ValidateExtraction("a.zip", true, "../outside"), services.ErrInvalidExtractTo)
+	assert.ErrorIs(t, services.ValidateExtraction("a.zip", true, "/abs"), services.ErrInvalidExtractTo)
+	assert.ErrorIs(t, services.ValidateExtraction("a.zip", true, ".quarantine/x"), services.ErrInvalidExtractTo)
+	assert.ErrorIs(t, services.ValidateExtraction("a.zip", false, "dir"), services.ErrInvalidExtractTo)
+}
+
+func TestExtractArchive_Zip(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "photos.zip")
+	writeZip(t, archive, []archiveEntry{
+		{name: "readme.txt", body: "hello"},
+		{name: "album/", body: ""},
+		{name: "album/cat.jpg", body: "meow"},
+		{name: "../evil.txt", body: "zip slip"},
+		{name: "album\\..\\..\\evil2.txt", body: "zip slip"},
+		{name: "link", body: "/etc/passwd", typeflag: tar.TypeSymlink},
+	})
+	fileService := services.NewFileService(nil, dir)
+
+	result, err := fileService.ExtractArchive("photos.zip", archive, "", services.FileMeta{})
+	assert.NoError(t, err)
+	assert.Equal(t, services.ExtractionCompleted, result.Status)
+	assert.Equal(t, "photos", result.Directory)
+	assert.Equal(t, 2, result.Extracted)
+	assert.Equal(t, int64(9), result.TotalSize)
+	assert.Len(t, result.Skipped, 3)
+	assert.Equal(t, "../evil.txt", result.Skipped[0].Name)
+	assert.Contains(t, result.Skipped[0].Reason, "path traversal is not allowed")
+	assert.Contains(t, result.Skipped[1].Reason, "path traversal is not allowed")
+	assert.Equal(t, services.SkippedEntry{Name: "link", Reason: "unsupported entry type"}, result.Skipped[2])
+
+	content, err := os.ReadFile(filepath.Join(dir, "photos", "album", "cat.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, "meow", string(content))
+	assert.NoFileExists(t, filepath.Join(dir, "evil.txt"))
+	assert.NoFileExists(t, filepath.Join(filepath.Dir(dir), "evil.txt"))
+
+	// По умолчанию (политика version) файлы занятого каталога получают новые версии
+	result, err = fileService.ExtractArchive("photos.zip", archive, "", services.FileMeta{})
+	assert.NoError(t, err)
+	assert.Equal(t, "photos", result.Directory)
+	assert.Equal(t, 2, result.Extracted)
+	versions, err := fileService.ListVersions("photos/album/cat.jpg")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+}
+
+// Test: занятый каталог распаковки разрешается политикой пространства имён
+func TestExtractArchive_ConflictPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy    string
+		directory string
+		err       error
+	}{
+		{services.OnConflictReject, "", services.ErrFileExists},
+		{services.OnConflictRename, "photos(1)", nil},
+		{services.OnConflictOverwrite, "photos", nil},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			dir := t.TempDir()
+			archive := filepath.Join(dir, "photos.zip")
+			writeZip(t, archive, []archiveEntry{{name: "cat.jpg", body: "meow"}})
+			assert.NoError(t, os.MkdirAll(filepath.Join(dir, "photos"), 0755))
+			assert.NoError(t, os.WriteFile(filepath.Join(dir, "photos", "cat.jpg"), []byte("old"), 0644))
+			fileService := services.NewFileService(nil, dir)
+			fileService.OnConflict = tc.policy
+
+			result, err := fileService.ExtractArchive("photos.zip", archive, "", services.FileMeta{})
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				assert.Equal(t, services.ExtractionFailed, result.Status)
+				content, _ := os.ReadFile(filepath.Join(dir, "photos", "cat.jpg"))
+				assert.Equal(t, "old", string(content))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.directory, result.Directory)
+			content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(tc.directory), "cat.jpg"))
+			assert.NoError(t, err)
+			assert.Equal(t, "meow", string(content))
+		})
+	}
+}
+
+// Test: записи архива проверяются политикой типов каталога, в который они распаковываются
+func TestExtractArchive_TypePolicy(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "bundle.zip")
+	writeZip(t, archive, []archiveEntry{
+		{name: "cat.png", body: string(pngHeader)},
+		{name: "notes.txt", body: "hello"},
+		{name: "tool.exe", body: "MZ\x90\x00"},
+		{name: "renamed.png", body: "\x7fELF\x02\x01"},
+	})
+	fileService := services.NewFileService(nil, dir)
+	fileService.Namespaces = map[string]config.NamespaceConfig{"images": {Root: "images"}}
+	fileService.Policies = config.FilePoliciesConfig{
+		Default:    config.FileTypePolicy{DenyExtensions: []string{".exe"}, DenyMagic: []string{"7f454c46"}},
+		Namespaces: map[string]config.FileTypePolicy{"images": {AllowMIMETypes: []string{"image/*"}}},
+	}
+
+	result, err := fileService.ExtractArchive("bundle.zip", archive, "images/bundle", services.FileMeta{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Extracted)
+	assert.Len(t, result.Skipped, 3)
+	for _, skipped := range result.Skipped {
+		assert.Contains(t, skipped.Reason, "file type")
+	}
+	assert.FileExists(t, filepath.Join(dir, "images", "bundle", "cat.png"))
+	assert.NoFileExists(t, filepath.Join(dir, "images", "bundle", "notes.txt"))
+	assert.NoFileExists(t, filepath.Join(dir, "images", "bundle", "tool.exe"))
+	assert.NoFileExists(t, filepath.Join(dir, "images", "bundle", "renamed.png"))
+}
+
+func TestExtractArchive_TarGz(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "logs.tar.gz")
+	writeTarGz(t, archive, []archiveEntry{
+		{name: "./2024/app.log", body: "line 1\n", typeflag: tar.TypeReg},
+		{name: "/etc/cron.d/evil", body: "* * * * * root", typeflag: tar.TypeReg},
+		{name: "passwd", typeflag: tar.TypeSymlink},
+		{name: "hard", typeflag: tar.TypeLink},
+	})
+
+	result, err := services.NewFileService(nil, dir).ExtractArchive("logs.tar.gz", archive, "unpacked/logs", services.FileMeta{})
+	assert.NoError(t, err)
+	assert.Equal(t, "unpacked/logs", result.Directory)
+	assert.Equal(t, 1, result.Extracted)
+	assert.Len(t, result.Skipped, 3)
+	assert.FileExists(t, filepath.Join(dir, "unpacked", "logs", "2024", "app.log"))
+}
+
+func TestExtractArchive_Limits(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "many.zip")
+	writeZip(t, archive, []archiveEntry{{name: "a.txt", body: "a"}, {name: "b.txt", body: "b"}, {name: "c.txt", body: "0123456789"}})
+
+	for name, limits := range map[string]config.ExtractionConfig{
+		"entries":    {MaxEntries: 2},
+		"entry size": {MaxEntrySize: 5},
+		"total size": {MaxTotalSize: 8},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fileService := services.NewFileService(nil, dir)
+			fileService.Extraction = limits
+			result, err := fileService.ExtractArchive("many.zip", archive, "", services.FileMeta{})
+			assert.ErrorIs(t, err, services.ErrExtractionLimit)
+			assert.Equal(t, services.ExtractionFailed, result.Status)
+			// Распаковка атомарна: ничего не остаётся
+			assert.NoDirExists(t, filepath.Join(dir, "many"))
+			leftovers, _ := os.ReadDir(filepath.Join(dir, ".processing"))
+			assert.Empty(t, leftovers)
+		})
+	}
+}
+
+func TestExtractArchive_NotAnArchive(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "broken.zip")
+	assert.NoError(t, os.WriteFile(archive, []byte("not a zip"), 0644))
+
+	result, err := services.NewFileService(nil, dir).ExtractArchive("broken.zip", archive, "", services.FileMeta{})
+	assert.ErrorIs(t, err, services.ErrNotArchive)
+	assert.Equal(t, services.ExtractionFailed, result.Status)
+	assert.NotEmpty(t, result.Error)
+}
+
+// Test: extract разрешён только для архивов
+func TestStartSession_ExtractRequiresArchive(t *testing.T) {
+	handler := handlers.NewStartHandler(&services.SessionServiceMock{})
+	requestBody, _ := json.Marshal(map[string]interface{}{
+		"file_name": "notes.txt",
+		"file_size": 2048,
+		"file_hash": "testhash",
+		"extract":   true,
+	})
+	req, err := http.NewRequest("POST", "/start", bytes.NewBuffer(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.StartSession(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "Invalid extraction request.", response["message"])
+}
+
+// Test: после завершения архив распаковывается, итог возвращается в ответе
+func TestCompleteUpload_Extract(t *testing.T) {
+	var extractedName, extractedDir string
+	mockService := &services.SessionServiceMock{
+		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"completed":   true,
+				"status":      "completed",
+				"file_name":   "extract_test.zip",
+				"file_size":   int64(1024),
+				"extract":     true,
+				"extract_dir": "unpacked",
+			}, nil
+		},
+		FileService: &services.FileServiceMock{
+			ExtractArchiveFunc: func(name, archivePath, dir string, meta services.FileMeta) (*services.ExtractionResult, error) {
+				extractedName, extractedDir = name, dir
+				assert.Equal(t, "session123", meta.SessionID)
+				return &services.ExtractionResult{Archive: name, Directory: dir, Status: services.ExtractionCompleted, Extracted: 3}, nil
+			},
+		},
+	}
+	handler := handlers.NewUploadChunkHandler(mockService)
+
+	req, err := http.NewRequest("POST", "/complete/session123", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/complete/{session_id}", handler.CompleteUpload)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	os.Remove(filepath.Join(os.TempDir(), response["file_name"].(string)))
+	assert.Equal(t, response["file_name"], extractedName)
+	assert.Equal(t, "unpacked", extractedDir)
+	extraction := response["extraction"].(map[string]interface{})
+	assert.Equal(t, "completed", extraction["status"])
+	assert.Equal(t, float64(3), extraction["extracted"])
+}
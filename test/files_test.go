@@ -0,0 +1,105 @@
+package test
+
+import (
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListFiles_Success(t *testing.T) {
+	mockService := &services.FileServiceMock{
+		ListFilesFunc: func() ([]services.StoredFile, error) {
+			return []services.StoredFile{{Name: "report.pdf", Size: 42}}, nil
+		},
+	}
+	handler := handlers.NewFilesHandler(mockService)
+
+	req, err := http.NewRequest("GET", "/files", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ListFiles(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	files := response["files"].([]interface{})
+	assert.Len(t, files, 1)
+	assert.Equal(t, "report.pdf", files[0].(map[string]interface{})["name"])
+}
+
+func TestDownloadFile_NotFound(t *testing.T) {
+	handler := handlers.NewFilesHandler(&services.FileServiceMock{})
+
+	req, err := http.NewRequest("GET", "/files/missing.bin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/files/{name:.+}", handler.DownloadFile)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "File not found.", response["message"])
+}
+
+func TestDownloadFile_Success(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var requested string
+	handler := handlers.NewFilesHandler(&services.FileServiceMock{
+		OpenFileFunc: func(name string) (services.FileReader, error) {
+			requested = name
+			return services.NewFileService(nil, dir).OpenFile("hello.txt")
+		},
+	})
+
+	req, err := http.NewRequest("GET", "/files/docs/hello.txt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=6-")
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/files/{name:.+}", handler.DownloadFile)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, "docs/hello.txt", requested)
+	assert.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.Equal(t, "world", rr.Body.String())
+}
+
+func TestFileService_ListAndOpenFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(dir, "hash_1.part"), []byte("chunk"), 0644)
+	fileService := services.NewFileService(nil, dir)
+
+	files, err := fileService.ListFiles()
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "a.txt", files[0].Name)
+
+	file, err := fileService.OpenFile("a.txt")
+	assert.NoError(t, err)
+	file.Close()
+
+	for _, name := range []string{"../a.txt", "/etc/passwd", "hash_1.part", "."} {
+		_, err := fileService.OpenFile(name)
+		assert.ErrorIs(t, err, services.ErrFileNotFound, name)
+	}
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test для проверки без исправлений: GET возвращает отчёт
+func TestFsck_Report(t *testing.T) {
+	var repairRequested bool
+	mockService := &services.SessionServiceMock{
+		FsckFunc: func(repair bool) (*services.FsckReport, error) {
+			repairRequested = repair
+			return &services.FsckReport{
+				Sessions: 2,
+				Parts:    5,
+				Issues: []services.FsckIssue{
+					{SessionID: "abc", Kind: services.FsckMissingPart, Part: "abc_3.part", Detail: "chunk is marked as uploaded but its file is missing"},
+					{SessionID: "gone", Kind: services.FsckOrphanPart, Part: "gone_1.part", Detail: "chunk file belongs to no session"},
+				},
+			}, nil
+		},
+	}
+	handler := handlers.NewAdminHandler(mockService)
+
+	req := httptest.NewRequest("GET", "/admin/fsck", nil)
+	rr := httptest.NewRecorder()
+	handler.Fsck(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.False(t, repairRequested)
+	var response struct {
+		Report services.FsckReport `json:"report"`
+	}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, 2, response.Report.Sessions)
+	assert.Len(t, response.Report.Issues, 2)
+	assert.Equal(t, services.FsckMissingPart, response.Report.Issues[0].Kind)
+	assert.False(t, response.Report.Issues[0].Repaired)
+}
+
+// Test для исправления расхождений через POST
+func TestFsck_Repair(t *testing.T) {
+	var repairRequested bool
+	mockService := &services.SessionServiceMock{
+		FsckFunc: func(repair bool) (*services.FsckReport, error) {
+			repairRequested = repair
+			return &services.FsckReport{
+				Repair:   repair,
+				Issues:   []services.FsckIssue{{SessionID: "abc", Kind: services.FsckSizeMismatch, Repaired: true}},
+				Repaired: 1,
+			}, nil
+		},
+	}
+	handler := handlers.NewAdminHandler(mockService)
+
+	req := httptest.NewRequest("POST", "/admin/fsck?repair=true", nil)
+	rr := httptest.NewRecorder()
+	handler.Fsck(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, repairRequested)
+	var response struct {
+		Report services.FsckReport `json:"report"`
+	}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.True(t, response.Report.Repair)
+	assert.Equal(t, 1, response.Report.Repaired)
+}
+
+// Test: исправление через GET запрещено
+func TestFsck_RepairRequiresPost(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		FsckFunc: func(repair bool) (*services.FsckReport, error) {
+			t.Fatal("Fsck must not be called")
+			return nil, nil
+		},
+	}
+	handler := handlers.NewAdminHandler(mockService)
+
+	req := httptest.NewRequest("GET", "/admin/fsck?repair=true", nil)
+	rr := httptest.NewRecorder()
+	handler.Fsck(rr, req)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+// Test для неверного значения repair
+func TestFsck_InvalidRepairFlag(t *testing.T) {
+	handler := handlers.NewAdminHandler(&services.SessionServiceMock{})
+
+	req := httptest.NewRequest("POST", "/admin/fsck?repair=maybe", nil)
+	rr := httptest.NewRecorder()
+	handler.Fsck(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+// Test для ошибки проверки
+func TestFsck_ServiceError(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		FsckFunc: func(repair bool) (*services.FsckReport, error) {
+			return nil, errors.New("redis unavailable")
+		},
+	}
+	handler := handlers.NewAdminHandler(mockService)
+
+	req := httptest.NewRequest("GET", "/admin/fsck", nil)
+	rr := httptest.NewRecorder()
+	handler.Fsck(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
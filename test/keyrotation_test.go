@@ -0,0 +1,174 @@
+package test
+
+import (
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"BASProject/internal/utils"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestKeyring(t *testing.T, versions []utils.KeyVersion, active string) *utils.Envelope {
+	envelope, err := utils.NewKeyring(versions, active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return envelope
+}
+
+func randomKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
+
+func readStored(t *testing.T, fileService *services.FileService, name string) []byte {
+	file, err := fileService.OpenFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestKeyring_ActiveKeyDefaultsToLast(t *testing.T) {
+	envelope := newTestKeyring(t, []utils.KeyVersion{{ID: "2024", Key: randomKey()}, {ID: "2025", Key: randomKey()}}, "")
+	assert.Equal(t, "2025", envelope.ActiveKey())
+
+	_, err := utils.NewKeyring([]utils.KeyVersion{{ID: "2024", Key: randomKey()}}, "2025")
+	assert.Error(t, err)
+}
+
+func TestRewrapFile(t *testing.T) {
+	oldKey, newKey := randomKey(), randomKey()
+	for _, tc := range []struct {
+		name  string
+		oldID string
+		newID string
+	}{
+		{"same header length", "2024", "2025"},
+		{"different header length", "2024", "2025-q3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			data := make([]byte, 150*1024)
+			rand.Read(data)
+
+			oldEnvelope := newTestKeyring(t, []utils.KeyVersion{{ID: tc.oldID, Key: oldKey}}, "")
+			path := filepath.Join(dir, "video.bin")
+			assert.NoError(t, os.WriteFile(path, encryptBytes(t, oldEnvelope, data), 0644))
+			modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+			assert.NoError(t, os.Chtimes(path, modTime, modTime))
+			before, _ := os.ReadFile(path)
+			// Исходный файл не переписывается на месте: ссылка на него сохраняет прежний заголовок
+			original := filepath.Join(t.TempDir(), "original.bin")
+			assert.NoError(t, os.Link(path, original))
+
+			fileService := services.NewFileService(nil, dir)
+			fileService.Envelope = newTestKeyring(t, []utils.KeyVersion{{ID: tc.oldID, Key: oldKey}, {ID: tc.newID, Key: newKey}}, tc.newID)
+
+			changed, err := fileService.RewrapFile(path)
+			assert.NoError(t, err)
+			assert.True(t, changed)
+
+			// Содержимое не перешифровывается: меняется только заголовок
+			after, _ := os.ReadFile(path)
+			delta := len(tc.newID) - len(tc.oldID)
+			assert.Equal(t, len(before)+delta, len(after))
+			assert.Equal(t, before[len(before)-64*1024:], after[len(after)-64*1024:])
+			kept, _ := os.ReadFile(original)
+			assert.Equal(t, before, kept)
+
+			info, _ := os.Stat(path)
+			assert.True(t, info.ModTime().Equal(modTime))
+			assert.Equal(t, data, readStored(t, fileService, "video.bin"))
+
+			// Файл читается без старой версии ключа
+			fileService.Envelope = newTestKeyring(t, []utils.KeyVersion{{ID: tc.newID, Key: newKey}}, "")
+			assert.Equal(t, data, readStored(t, fileService, "video.bin"))
+
+			changed, err = fileService.RewrapFile(path)
+			assert.NoError(t, err)
+			assert.False(t, changed)
+		})
+	}
+}
+
+func TestRewrapFile_SkipsPlaintext(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "legacy.txt")
+	os.WriteFile(path, []byte("plain"), 0644)
+
+	fileService := services.NewFileService(nil, dir)
+	fileService.Envelope = newTestEnvelope(t)
+	changed, err := fileService.RewrapFile(path)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, []byte("plain"), data)
+}
+
+func TestKeyRotationService_RewrapsStorage(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := randomKey()
+	oldEnvelope := newTestKeyring(t, []utils.KeyVersion{{ID: "v1", Key: oldKey}}, "")
+	os.MkdirAll(filepath.Join(dir, ".chunks", "ab"), 0755)
+	os.WriteFile(filepath.Join(dir, "a.bin"), encryptBytes(t, oldEnvelope, []byte("first")), 0644)
+	os.WriteFile(filepath.Join(dir, ".chunks", "ab", "chunk"), encryptBytes(t, oldEnvelope, []byte("chunk")), 0644)
+	os.WriteFile(filepath.Join(dir, "legacy.txt"), []byte("plain"), 0644)
+
+	fileService := services.NewFileService(nil, dir)
+	fileService.Envelope = newTestKeyring(t, []utils.KeyVersion{{ID: "v1", Key: oldKey}, {ID: "v2", Key: randomKey()}}, "")
+	keyRotation := services.NewKeyRotationService(fileService)
+
+	progress, err := keyRotation.StartRewrap()
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", progress.ActiveKey)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for keyRotation.Progress().State == "running" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	progress = keyRotation.Progress()
+	assert.Equal(t, "completed", progress.State)
+	assert.Equal(t, 3, progress.Total)
+	assert.Equal(t, 2, progress.Rewrapped)
+	assert.Equal(t, 1, progress.Skipped)
+	assert.Equal(t, 0, progress.Failed)
+	assert.Equal(t, []byte("first"), readStored(t, fileService, "a.bin"))
+}
+
+func TestKeysHandler_EncryptionDisabled(t *testing.T) {
+	handler := handlers.NewKeysHandler(services.NewKeyRotationService(services.NewFileService(nil, t.TempDir())))
+
+	req := httptest.NewRequest("POST", "/admin/keys/rewrap", nil)
+	rr := httptest.NewRecorder()
+	handler.StartRewrap(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	req = httptest.NewRequest("GET", "/admin/keys/rewrap", nil)
+	rr = httptest.NewRecorder()
+	handler.RewrapStatus(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Progress services.RewrapProgress `json:"progress"`
+	}
+	assert.NoError(t, json.NewDecoder(bytes.NewReader(rr.Body.Bytes())).Decode(&response))
+	assert.Equal(t, "idle", response.Progress.State)
+}
@@ -0,0 +1,180 @@
+package test
+
+import (
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test: тип содержимого и метаданные передаются в сессию
+func TestStartSession_Metadata(t *testing.T) {
+	var received services.SessionParams
+	mockService := &services.SessionServiceMock{
+		CreateSessionFunc: func(params services.SessionParams) (*services.SessionInfo, error) {
+			received = params
+			return &services.SessionInfo{SessionID: "testhash", Status: "created", ChunkSize: 1024}, nil
+		},
+	}
+	handler := handlers.NewStartHandler(mockService)
+
+	requestBody, _ := json.Marshal(map[string]interface{}{
+		"file_name":    "report.pdf",
+		"file_size":    2048,
+		"file_hash":    "testhash",
+		"content_type": "application/pdf",
+		"metadata":     map[string]string{"project": "apollo", "retention-class": "long"},
+	})
+	req, err := http.NewRequest("POST", "/start", bytes.NewBuffer(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.StartSession(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/pdf", received.ContentType)
+	assert.Equal(t, map[string]string{"project": "apollo", "retention-class": "long"}, received.Metadata)
+}
+
+// Test: метаданные, нарушающие ограничения, отклоняются
+func TestStartSession_InvalidMetadata(t *testing.T) {
+	tooMany := map[string]string{}
+	for i := 0; i <= services.MaxMetadataKeys; i++ {
+		tooMany[fmt.Sprintf("key%d", i)] = "value"
+	}
+	cases := map[string]map[string]interface{}{
+		"bad key":        {"metadata": map[string]string{"bad key": "value"}},
+		"control chars":  {"metadata": map[string]string{"project": "line\r\nX-Injected: 1"}},
+		"long value":     {"metadata": map[string]string{"project": strings.Repeat("a", services.MaxMetadataValueLength+1)}},
+		"too many keys":  {"metadata": tooMany},
+		"bad media type": {"content_type": "not a type"},
+	}
+	for name, extra := range cases {
+		t.Run(name, func(t *testing.T) {
+			mockService := &services.SessionServiceMock{
+				CreateSessionFunc: func(params services.SessionParams) (*services.SessionInfo, error) {
+					t.Fatal("CreateSession must not be called")
+					return nil, nil
+				},
+			}
+			handler := handlers.NewStartHandler(mockService)
+
+			request := map[string]interface{}{"file_name": "testfile", "file_size": 2048, "file_hash": "testhash"}
+			for key, value := range extra {
+				request[key] = value
+			}
+			requestBody, _ := json.Marshal(request)
+			req, err := http.NewRequest("POST", "/start", bytes.NewBuffer(requestBody))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler.StartSession(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			var response map[string]interface{}
+			json.NewDecoder(rr.Body).Decode(&response)
+			assert.Equal(t, "Invalid content type or metadata.", response["message"])
+		})
+	}
+}
+
+// Test: метаданные сессии сохраняются за собранным файлом
+func TestCompleteUpload_CarriesMetadata(t *testing.T) {
+	var savedName string
+	var saved services.FileMeta
+	mockService := &services.SessionServiceMock{
+		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"completed":    true,
+				"status":       "completed",
+				"file_name":    "metadata_test.bin",
+				"file_size":    int64(1024),
+				"owner":        "alice",
+				"content_type": "application/octet-stream",
+				"metadata":     map[string]string{"project": "apollo"},
+			}, nil
+		},
+		FileService: &services.FileServiceMock{
+			SaveFileMetaFunc: func(name string, meta services.FileMeta) error {
+				savedName, saved = name, meta
+				return nil
+			},
+		},
+	}
+
+	handler := handlers.NewUploadChunkHandler(mockService)
+	req, err := http.NewRequest("POST", "/complete/session123", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/complete/{session_id}", handler.CompleteUpload)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "metadata_test.bin", savedName)
+	assert.Equal(t, "application/octet-stream", saved.ContentType)
+	assert.Equal(t, map[string]string{"project": "apollo"}, saved.Metadata)
+	assert.Equal(t, "session123", saved.SessionID)
+	assert.Equal(t, "alice", saved.Owner)
+}
+
+// Test: при скачивании тип содержимого и метаданные отдаются заголовками
+func TestDownloadFile_MetadataHeaders(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "data.bin"), []byte("payload"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	handler := handlers.NewFilesHandler(&services.FileServiceMock{
+		OpenFileFunc: func(name string) (services.FileReader, error) {
+			return services.NewFileService(nil, dir).OpenFile(name)
+		},
+		GetFileMetaFunc: func(name string) (*services.FileMeta, error) {
+			return &services.FileMeta{ContentType: "application/x-custom", Metadata: map[string]string{"project": "apollo"}}, nil
+		},
+	})
+
+	req, err := http.NewRequest("GET", "/files/data.bin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/files/{name:.+}", handler.DownloadFile)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/x-custom", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "apollo", rr.Header().Get("X-Meta-Project"))
+	assert.Equal(t, "payload", rr.Body.String())
+}
+
+// Test: запись, в которой есть только служебные поля, не считается пустой и не удаляется
+func TestFileMeta_Empty(t *testing.T) {
+	assert.True(t, services.FileMeta{}.Empty())
+	assert.True(t, services.FileMeta{Metadata: map[string]string{}}.Empty())
+	for _, meta := range []services.FileMeta{
+		{SessionID: "s1"},
+		{FileHash: "abc"},
+		{Owner: "alice"},
+		{Processing: []services.ProcessorOutcome{{Processor: "scanner", Status: "passed"}}},
+		{Location: ".quarantine/a.txt"},
+		{Thumbnails: []services.Thumbnail{{Width: 64}}},
+		{ExtractedFrom: "archive.zip"},
+	} {
+		assert.False(t, meta.Empty(), "%+v", meta)
+	}
+}
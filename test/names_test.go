@@ -0,0 +1,195 @@
+package test
+
+import (
+	"BASProject/config"
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	valid := map[string]string{
+		"report.pdf":                    "report.pdf",
+		"docs/2024/report.pdf":          "docs/2024/report.pdf",
+		"./docs//report.pdf":            "docs/report.pdf",
+		"docs\\sub\\report.pdf":         "docs/sub/report.pdf",
+		"фото/отчёт.txt":                "фото/отчёт.txt",
+		"фото/отче\u0308т.txt":          "фото/отчёт.txt",
+		"и\u0306ога.txt":                "йога.txt",
+		"cafe\u0301.txt":                "café.txt",
+		"nested/.hidden":                "nested/.hidden",
+		"console.log":                   "console.log",
+		"v1.2/build (final).tar.gz":     "v1.2/build (final).tar.gz",
+		"a/" + strings.Repeat("x", 255): "a/" + strings.Repeat("x", 255),
+	}
+	for name, expected := range valid {
+		key, err := services.SanitizeFileName(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, key, name)
+	}
+
+	invalid := map[string]string{
+		"":                             "name is empty",
+		"./":                           "name is empty",
+		"../../etc/x":                  "path traversal",
+		"docs/../../x":                 "path traversal",
+		"..\\..\\windows\\system.ini":  "path traversal",
+		"/etc/passwd":                  "absolute paths",
+		"\\\\server\\share\\x":         "absolute paths",
+		"C:\\Users\\me\\report.pdf":    "absolute paths",
+		"report\x00.pdf":               "control characters",
+		"line\nbreak.txt":              "control characters",
+		"evil\u202Efdp.exe":            "invisible formatting",
+		"zero\u200Bwidth.txt":          "invisible formatting",
+		"what?.txt":                    "not allowed",
+		"pipe|name":                    "not allowed",
+		"CON":                          "reserved device name",
+		"docs/nul.txt":                 "reserved device name",
+		"Com1.log":                     "reserved device name",
+		"trailing.":                    "ends with a dot",
+		"docs /x":                      "ends with a dot or space",
+		".chunks/abc":                  "reserved",
+		".quarantine":                  "reserved",
+		"session_1.part":               "reserved",
+		"bad\xff.txt":                  "UTF-8",
+		strings.Repeat("x", 256):       "longer than 255",
+		strings.Repeat("a/", 33) + "x": "directory levels",
+		strings.Repeat(strings.Repeat("x", 200)+"/", 6): "longer than 1024",
+	}
+	for name, reason := range invalid {
+		_, err := services.SanitizeFileName(name)
+		assert.ErrorIs(t, err, services.ErrInvalidFileName, name)
+		if err != nil {
+			assert.Contains(t, err.Error(), reason, name)
+		}
+	}
+}
+
+// Test: имена в разложенной форме (NFD) приводятся к составной для любой письменности
+func TestSanitizeFileName_NFC(t *testing.T) {
+	for decomposed, composed := range map[string]string{
+		"и\u0306е\u0308.txt":   "йё.txt",
+		"e\u0323\u0302/x":      "ệ/x",
+		"\u1100\u1161.doc":     "가.doc",
+		"か\u3099.png":          "が.png",
+		"A\u030a\u0301.txt":    "Ǻ.txt",
+		"plain/already ok.txt": "plain/already ok.txt",
+	} {
+		key, err := services.SanitizeFileName(decomposed)
+		assert.NoError(t, err, decomposed)
+		assert.Equal(t, composed, key, decomposed)
+	}
+}
+
+func TestResolveFileName_Namespaces(t *testing.T) {
+	namespaces := map[string]config.NamespaceConfig{
+		"images":  {Root: "assets/images"},
+		"backups": {},
+	}
+	assert.NoError(t, config.ValidateNamespaces(namespaces))
+	assert.Equal(t, "backups", namespaces["backups"].Root)
+
+	fileService := services.NewFileService(nil, t.TempDir())
+	fileService.Namespaces = namespaces
+	fileService.Policies = config.FilePoliciesConfig{Namespaces: map[string]config.FileTypePolicy{
+		"images": {AllowExtensions: []string{".png"}},
+	}}
+
+	key, err := fileService.ResolveFileName("images", "/ignored/../cat.png")
+	assert.ErrorIs(t, err, services.ErrInvalidFileName)
+	key, err = fileService.ResolveFileName("images", "albums/cat.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "assets/images/albums/cat.png", key)
+	assert.Equal(t, "images", fileService.NamespaceOf(key))
+
+	key, err = fileService.ResolveFileName("", "notes.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "notes.txt", key)
+	assert.Equal(t, "", fileService.NamespaceOf(key))
+
+	_, err = fileService.ResolveFileName("videos", "clip.mp4")
+	assert.ErrorIs(t, err, services.ErrUnknownNamespace)
+
+	// Политика типов выбирается по корню пространства имён
+	assert.NoError(t, fileService.CheckFileName("assets/images/cat.png", ""))
+	assert.ErrorIs(t, fileService.CheckFileName("assets/images/notes.txt", ""), services.ErrFileTypeRejected)
+}
+
+func TestValidateNamespaces_Invalid(t *testing.T) {
+	for _, namespaces := range []map[string]config.NamespaceConfig{
+		{"Images": {}},
+		{"images": {Root: "../outside"}},
+		{"images": {Root: "/abs"}},
+		{"images": {Root: ".chunks"}},
+		{"a": {Root: "shared"}, "b": {Root: "shared/"}},
+	} {
+		assert.Error(t, config.ValidateNamespaces(namespaces), namespaces)
+	}
+}
+
+// Test: недопустимое имя файла отклоняется при создании сессии
+func TestStartSession_InvalidFileName(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		CreateSessionFunc: func(params services.SessionParams) (*services.SessionInfo, error) {
+			_, err := services.NewFileService(nil, "").ResolveFileName(params.Namespace, params.FileName)
+			return nil, err
+		},
+	}
+	handler := handlers.NewStartHandler(mockService)
+
+	for _, request := range []map[string]interface{}{
+		{"file_name": "../../etc/x", "file_size": 10, "file_hash": "h"},
+		{"file_name": "ok.txt", "file_size": 10, "file_hash": "h", "namespace": "missing"},
+	} {
+		requestBody, _ := json.Marshal(request)
+		rr := httptest.NewRecorder()
+		handler.StartSession(rr, httptest.NewRequest("POST", "/start", bytes.NewBuffer(requestBody)))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		var response map[string]interface{}
+		json.NewDecoder(rr.Body).Decode(&response)
+		assert.Equal(t, "Invalid file name or namespace.", response["message"])
+	}
+}
+
+// Test: сессия со старым небезопасным именем не собирается за пределами хранилища
+func TestCompleteUpload_RejectsUnsafeStoredName(t *testing.T) {
+	var deleted, assembled bool
+	mockService := &services.SessionServiceMock{
+		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"completed": true,
+				"status":    "completed",
+				"file_name": "../../etc/x",
+				"file_size": int64(10),
+			}, nil
+		},
+		DeleteSessionFunc: func(sessionID string) error {
+			deleted = true
+			return nil
+		},
+		FileService: &services.FileServiceMock{
+			AssembleChunksFunc: func(sessionID, outputFilePath string) error {
+				assembled = true
+				return nil
+			},
+		},
+	}
+	handler := handlers.NewUploadChunkHandler(mockService)
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/complete/{session_id}", handler.CompleteUpload)
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/complete/session123", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.True(t, deleted)
+	assert.False(t, assembled)
+}
@@ -0,0 +1,206 @@
+package test
+
+import (
+	"BASProject/config"
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPipeline(t *testing.T, dir string, cfg config.PipelineConfig) *services.Pipeline {
+	pipeline, err := services.NewPipeline(services.NewFileService(nil, dir), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pipeline
+}
+
+func TestPipeline_UnknownProcessorType(t *testing.T) {
+	_, err := services.NewPipeline(services.NewFileService(nil, t.TempDir()), config.PipelineConfig{
+		Processors: []config.ProcessorConfig{{Type: "teleport"}},
+	})
+	assert.ErrorContains(t, err, "unknown processor type")
+
+	var disabled *services.Pipeline
+	assert.False(t, disabled.Enabled())
+}
+
+func TestPipeline_Passes(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("clean content"), 0644))
+
+	pipeline := newTestPipeline(t, dir, config.PipelineConfig{Processors: []config.ProcessorConfig{
+		{Name: "scanner", Type: "command", Command: []string{"sh", "-c", `grep -q clean "$1" && echo "$BAS_FILE_NAME OK"`, "sh", "{path}"}},
+		{Type: "file_type"},
+	}})
+	result := pipeline.Run(services.ProcessedFile{Name: "report.txt", Path: path})
+
+	assert.Equal(t, services.FileStatusAvailable, result.Status)
+	assert.Len(t, result.Outcomes, 2)
+	assert.Equal(t, "scanner", result.Outcomes[0].Processor)
+	assert.Equal(t, "passed", result.Outcomes[0].Status)
+	assert.Equal(t, "report.txt OK", result.Outcomes[0].Message)
+	assert.Equal(t, "file_type", result.Outcomes[1].Processor)
+	assert.FileExists(t, path)
+}
+
+func TestPipeline_QuarantinesOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "infected.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("EICAR"), 0644))
+
+	pipeline := newTestPipeline(t, dir, config.PipelineConfig{OnFailure: "quarantine", Processors: []config.ProcessorConfig{
+		{Name: "scanner", Type: "command", Command: []string{"sh", "-c", "echo FOUND; exit 1"}},
+		{Name: "never", Type: "command", Command: []string{"true"}},
+	}})
+	result := pipeline.Run(services.ProcessedFile{Name: "infected.txt", Path: path})
+
+	assert.Equal(t, services.FileStatusQuarantined, result.Status)
+	// Конвейер останавливается на первой неудаче
+	assert.Len(t, result.Outcomes, 1)
+	assert.Equal(t, "failed", result.Outcomes[0].Status)
+	assert.Contains(t, result.FailureMessage(), "scanner: exit status 1: FOUND")
+	assert.NoFileExists(t, path)
+	assert.FileExists(t, filepath.Join(dir, ".quarantine", "infected.txt"))
+
+	// Карантин не виден в списке файлов
+	files, err := services.NewFileService(nil, dir).ListFiles()
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestPipeline_DeleteOnTimeout(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "slow.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+
+	pipeline := newTestPipeline(t, dir, config.PipelineConfig{OnFailure: "delete", Processors: []config.ProcessorConfig{
+		{Name: "slow", Type: "command", Command: []string{"sleep", "5"}, Timeout: 100 * time.Millisecond},
+	}})
+	started := time.Now()
+	result := pipeline.Run(services.ProcessedFile{Name: "slow.txt", Path: path})
+
+	assert.Less(t, time.Since(started), 4*time.Second)
+	assert.Equal(t, services.FileStatusRejected, result.Status)
+	assert.Contains(t, result.Outcomes[0].Message, "timed out after 100ms")
+	assert.NoFileExists(t, path)
+}
+
+// Test: с конвейером завершение отвечает 202, а загрузка завершается после его прохождения
+func TestCompleteUpload_Pipeline(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		command string
+		indexed bool
+	}{
+		{"passed", "true", true},
+		{"failed", "false", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var indexed bool
+			mockService := &services.SessionServiceMock{
+				GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
+					return map[string]interface{}{
+						"completed": true,
+						"status":    "completed",
+						"file_name": "pipeline_test.txt",
+						"file_size": int64(4),
+						"file_hash": "hash",
+					}, nil
+				},
+				FileService: &services.FileServiceMock{
+					AssembleChunksFunc: func(sessionID, outputFilePath string) error {
+						return os.WriteFile(outputFilePath, []byte("data"), 0644)
+					},
+					FileChecksumFunc: func(filePath string) (string, error) { return "hash", nil },
+					IndexContentFunc: func(fileHash, filePath string) error {
+						indexed = true
+						return nil
+					},
+				},
+			}
+			handler := handlers.NewUploadChunkHandler(mockService)
+			handler.Pipeline = newTestPipeline(t, os.TempDir(), config.PipelineConfig{OnFailure: "delete", Processors: []config.ProcessorConfig{
+				{Type: "command", Command: []string{tc.command}},
+			}})
+
+			req, err := http.NewRequest("POST", "/complete/session123", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/complete/{session_id}", handler.CompleteUpload)
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusAccepted, rr.Code)
+			var response map[string]interface{}
+			json.NewDecoder(rr.Body).Decode(&response)
+			assert.Equal(t, "processing", response["status"])
+
+			handler.Pipeline.Wait()
+			assert.Equal(t, tc.indexed, indexed)
+			output := filepath.Join(os.TempDir(), response["file_name"].(string))
+			if tc.indexed {
+				assert.FileExists(t, output)
+				os.Remove(output)
+			} else {
+				assert.NoFileExists(t, output)
+			}
+		})
+	}
+}
+
+// Test: файл с Commit попадает в хранилище только после прохождения конвейера
+func TestPipeline_CommitsOnlyPassedFiles(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		command string
+		content string
+	}{
+		{"passed", "true", "new"},
+		{"failed", "false", "old"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fileService := services.NewFileService(nil, dir)
+			assert.NoError(t, os.WriteFile(filepath.Join(dir, "doc.txt"), []byte("old"), 0644))
+			staged := filepath.Join(t.TempDir(), "doc.txt.part")
+			assert.NoError(t, os.WriteFile(staged, []byte("new"), 0644))
+
+			pipeline, err := services.NewPipeline(fileService, config.PipelineConfig{OnFailure: "delete", Processors: []config.ProcessorConfig{
+				{Name: "check", Type: "command", Command: []string{"sh", "-c", `cat "$1" | grep -q new && ` + tc.command, "sh", "{path}"}},
+			}})
+			assert.NoError(t, err)
+			committed := false
+			result := pipeline.Run(services.ProcessedFile{Name: "doc.txt", Path: staged, Commit: func() (string, error) {
+				committed = true
+				name, _, err := fileService.CommitFile("doc.txt", staged)
+				return name, err
+			}})
+
+			assert.Equal(t, tc.name == "passed", committed)
+			data, err := os.ReadFile(filepath.Join(dir, "doc.txt"))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.content, string(data))
+			assert.NoFileExists(t, staged)
+			if tc.name == "failed" {
+				assert.Equal(t, services.FileStatusRejected, result.Status)
+				// Прежняя версия не архивировалась и не получила записи о неудаче
+				assert.NoDirExists(t, filepath.Join(dir, ".versions"))
+				meta, _ := fileService.GetFileMeta("doc.txt")
+				assert.True(t, meta == nil || meta.Status == "")
+			}
+		})
+	}
+}
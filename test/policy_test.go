@@ -0,0 +1,147 @@
+package test
+
+import (
+	"BASProject/config"
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func policyFileService(dir string) *services.FileService {
+	fileService := services.NewFileService(nil, dir)
+	fileService.Policies = config.FilePoliciesConfig{
+		Default: config.FileTypePolicy{
+			DenyExtensions: []string{".exe", "bat"},
+			DenyMIMETypes:  []string{"application/x-msdownload", "application/x-executable"},
+			DenyMagic:      []string{"7f454c46"},
+		},
+		Namespaces: map[string]config.FileTypePolicy{
+			"images": {AllowMIMETypes: []string{"image/*"}},
+		},
+	}
+	return fileService
+}
+
+func TestSniffContentType(t *testing.T) {
+	assert.Equal(t, "image/png", services.SniffContentType(pngHeader))
+	assert.Equal(t, "application/x-msdownload", services.SniffContentType([]byte("MZ\x90\x00\x03")))
+	assert.Equal(t, "application/x-executable", services.SniffContentType([]byte("\x7fELF\x02\x01")))
+	assert.Equal(t, "text/plain", services.SniffContentType([]byte("hello world")))
+}
+
+func TestCheckFileName(t *testing.T) {
+	fileService := policyFileService(t.TempDir())
+
+	assert.NoError(t, fileService.CheckFileName("report.pdf", "application/pdf"))
+	assert.ErrorIs(t, fileService.CheckFileName("setup.EXE", ""), services.ErrFileTypeRejected)
+	assert.ErrorIs(t, fileService.CheckFileName("run.bat", ""), services.ErrFileTypeRejected)
+	assert.ErrorIs(t, fileService.CheckFileName("tool.bin", "application/x-msdownload"), services.ErrFileTypeRejected)
+	// Политика пространства имён заменяет политику по умолчанию
+	assert.NoError(t, fileService.CheckFileName("images/photo.png", "image/png"))
+	assert.ErrorIs(t, fileService.CheckFileName("images/notes.txt", "text/plain"), services.ErrFileTypeRejected)
+}
+
+func TestCheckFileContent(t *testing.T) {
+	fileService := policyFileService(t.TempDir())
+
+	assert.NoError(t, fileService.CheckFileContent("photo.png", pngHeader))
+	assert.ErrorIs(t, fileService.CheckFileContent("innocent.txt", []byte("MZ\x90\x00")), services.ErrFileTypeRejected)
+	assert.ErrorIs(t, fileService.CheckFileContent("data.bin", []byte("\x7fELF\x02\x01\x01")), services.ErrFileTypeRejected)
+	assert.NoError(t, fileService.CheckFileContent("images/photo.png", pngHeader))
+	err := fileService.CheckFileContent("images/photo.png", []byte("just text"))
+	assert.ErrorIs(t, err, services.ErrFileTypeRejected)
+	assert.Contains(t, err.Error(), "namespace images")
+}
+
+func TestCheckAssembledFile(t *testing.T) {
+	dir := t.TempDir()
+	fileService := policyFileService(dir)
+	good := filepath.Join(dir, "photo.png")
+	bad := filepath.Join(dir, "photo2.png")
+	assert.NoError(t, os.WriteFile(good, pngHeader, 0644))
+	assert.NoError(t, os.WriteFile(bad, []byte("MZ renamed executable"), 0644))
+
+	assert.NoError(t, fileService.CheckAssembledFile("photo.png", good))
+	assert.ErrorIs(t, fileService.CheckAssembledFile("photo2.png", bad), services.ErrFileTypeRejected)
+}
+
+// Test: запрещённый тип отклоняется при создании сессии
+func TestStartSession_FileTypeRejected(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		CreateSessionFunc: func(params services.SessionParams) (*services.SessionInfo, error) {
+			return nil, policyFileService("").CheckFileName(params.FileName, params.ContentType)
+		},
+	}
+	handler := handlers.NewStartHandler(mockService)
+
+	requestBody, _ := json.Marshal(map[string]interface{}{
+		"file_name": "setup.exe",
+		"file_size": 2048,
+		"file_hash": "testhash",
+	})
+	req, err := http.NewRequest("POST", "/start", bytes.NewBuffer(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.StartSession(rr, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "File type is not allowed.", response["message"])
+	assert.Contains(t, response["details"], "extension \".exe\" is denied")
+}
+
+// Test: собранный файл запрещённого типа удаляется, сессия очищается
+func TestCompleteUpload_FileTypeRejected(t *testing.T) {
+	var deleted bool
+	var removedOutput string
+	mockService := &services.SessionServiceMock{
+		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"completed": true,
+				"status":    "completed",
+				"file_name": "policy_test.bin",
+				"file_size": int64(1024),
+			}, nil
+		},
+		DeleteSessionFunc: func(sessionID string) error {
+			deleted = true
+			return nil
+		},
+		FileService: &services.FileServiceMock{
+			CheckAssembledFunc: func(fileName, filePath string) error {
+				removedOutput = filePath
+				return errors.Join(services.ErrFileTypeRejected, errors.New("detected type application/x-executable is denied"))
+			},
+		},
+	}
+
+	handler := handlers.NewUploadChunkHandler(mockService)
+	req, err := http.NewRequest("POST", "/complete/session123", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/complete/{session_id}", handler.CompleteUpload)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+	assert.True(t, deleted)
+	_, statErr := os.Stat(removedOutput)
+	assert.True(t, os.IsNotExist(statErr))
+}
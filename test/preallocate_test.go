@@ -0,0 +1,134 @@
+package test
+
+import (
+	"BASProject/config"
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"BASProject/internal/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test: размер чанка, который записывается на своё место в выделенном файле
+func TestChunkLength(t *testing.T) {
+	for _, tc := range []struct {
+		chunkID             int
+		chunkSize, fileSize int64
+		expected            int64
+	}{
+		{1, 4, 10, 4},
+		{2, 4, 10, 4},
+		{3, 4, 10, 2},
+		{2, 5, 10, 5},
+		{1, 16, 10, 10},
+	} {
+		length, err := services.ChunkLength(tc.chunkID, tc.chunkSize, tc.fileSize)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, length, "chunk %d of %d/%d", tc.chunkID, tc.fileSize, tc.chunkSize)
+	}
+
+	for _, tc := range []struct {
+		chunkID             int
+		chunkSize, fileSize int64
+		err                 error
+	}{
+		{0, 4, 10, services.ErrChunkOutOfRange},
+		{4, 4, 10, services.ErrChunkOutOfRange},
+		{-1, 4, 10, services.ErrChunkOutOfRange},
+		{1, 0, 10, services.ErrChunkSizeInvalid},
+		{1, 4, 0, services.ErrChunkSizeInvalid},
+	} {
+		_, err := services.ChunkLength(tc.chunkID, tc.chunkSize, tc.fileSize)
+		assert.ErrorIs(t, err, tc.err, "chunk %d of %d/%d", tc.chunkID, tc.fileSize, tc.chunkSize)
+	}
+}
+
+func TestPreallocate(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "upload.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	_, err = utils.Preallocate(file, 3<<20)
+	assert.NoError(t, err)
+	info, err := file.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3<<20), info.Size())
+
+	// Чанки пишутся в выделенный файл не по порядку и не меняют его размер
+	file.WriteAt([]byte("tail"), 3<<20-4)
+	file.WriteAt([]byte("head"), 0)
+	info, _ = file.Stat()
+	assert.Equal(t, int64(3<<20), info.Size())
+}
+
+func TestLoadConfig_Assembly(t *testing.T) {
+	cfg, err := config.LoadConfig("../config/config.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, services.AssemblyParts, cfg.Storage.Assembly)
+
+	for value, valid := range map[string]bool{"preallocate": true, "copy": false} {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		os.WriteFile(path, []byte(fmt.Sprintf("storage:\n  assembly: %s\n", value)), 0644)
+		cfg, err := config.LoadConfig(path)
+		if valid {
+			assert.NoError(t, err)
+			assert.Equal(t, value, cfg.Storage.Assembly)
+		} else {
+			assert.Error(t, err, value)
+		}
+	}
+}
+
+// Test: чанк неверного размера для выделенного файла отклоняется с 400
+func TestUploadChunkHandler_ChunkSizeInvalid(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		FileService: &services.FileServiceMock{
+			ValidateChecksumFunc: func(data []byte, checksum string) bool { return true },
+			SaveChunkFunc: func(sessionID string, chunkID int, data []byte) error {
+				return fmt.Errorf("%w: chunk 1 has %d bytes, expected 4096", services.ErrChunkSizeInvalid, len(data))
+			},
+		},
+	}
+	handler := handlers.NewUploadChunkHandler(mockService)
+	req := newChunkRequest(t, "/upload/chunk/session123", "1", "1234", []byte("chunk data"))
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/upload/chunk/{session_id}", handler.UploadChunk)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "Invalid chunk size.", response["message"])
+}
+
+func TestUploadChunkHandler_SessionNotFound(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		FileService: &services.FileServiceMock{
+			ValidateChecksumFunc: func(data []byte, checksum string) bool { return true },
+			ChunkExistsFunc: func(sessionID string, chunkID int) (bool, error) {
+				return false, services.ErrSessionNotFound
+			},
+		},
+	}
+	handler := handlers.NewUploadChunkHandler(mockService)
+	req := newChunkRequest(t, "/upload/chunk/unknown", "1", "1234", []byte("chunk data"))
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/upload/chunk/{session_id}", handler.UploadChunk)
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -51,8 +51,8 @@ func TestStartSession_MissingParameters(t *testing.T) {
 // Test для успешного создания сессии
 func TestStartSession_Success(t *testing.T) {
 	mockService := &services.SessionServiceMock{
-		CreateSessionFunc: func(fileName string, fileSize int64, fileHash string) (int64, error) {
-			return 1024, nil
+		CreateSessionFunc: func(params services.SessionParams) (*services.SessionInfo, error) {
+			return &services.SessionInfo{SessionID: "test-session-id", ChunkSize: 1024}, nil
 		},
 	}
 	handler := handlers.NewStartHandler(mockService)
@@ -60,6 +60,7 @@ func TestStartSession_Success(t *testing.T) {
 	requestBody, _ := json.Marshal(map[string]interface{}{
 		"file_name": "testfile",
 		"file_size": 2048,
+		"file_hash": "testhash",
 	})
 	req, err := http.NewRequest("POST", "/start", bytes.NewBuffer(requestBody))
 	if err != nil {
@@ -78,8 +79,8 @@ func TestStartSession_Success(t *testing.T) {
 // Test для проверки ошибки от SessionService
 func TestStartSession_ServiceError(t *testing.T) {
 	mockService := &services.SessionServiceMock{
-		CreateSessionFunc: func(fileName string, fileSize int64, fileHash string) (int64, error) {
-			return 0, errors.New("service error")
+		CreateSessionFunc: func(params services.SessionParams) (*services.SessionInfo, error) {
+			return nil, errors.New("service error")
 		},
 	}
 	handler := handlers.NewStartHandler(mockService)
@@ -87,6 +88,7 @@ func TestStartSession_ServiceError(t *testing.T) {
 	requestBody, _ := json.Marshal(map[string]interface{}{
 		"file_name": "testfile",
 		"file_size": 2048,
+		"file_hash": "testhash",
 	})
 	req, err := http.NewRequest("POST", "/start", bytes.NewBuffer(requestBody))
 	if err != nil {
@@ -100,3 +102,222 @@ func TestStartSession_ServiceError(t *testing.T) {
 	json.NewDecoder(rr.Body).Decode(&response)
 	assert.Equal(t, "Internal server error.", response["message"])
 }
+
+// Test для отложенной сессии: хеш и размер не обязательны
+func TestStartSession_Deferred(t *testing.T) {
+	var received services.SessionParams
+	mockService := &services.SessionServiceMock{
+		CreateSessionFunc: func(params services.SessionParams) (*services.SessionInfo, error) {
+			received = params
+			return &services.SessionInfo{SessionID: "generated-id", ChunkSize: 1024, Deferred: true}, nil
+		},
+	}
+	handler := handlers.NewStartHandler(mockService)
+
+	requestBody, _ := json.Marshal(map[string]interface{}{
+		"file_name": "dump.sql",
+		"deferred":  true,
+	})
+	req, err := http.NewRequest("POST", "/start", bytes.NewBuffer(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.StartSession(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, received.Deferred)
+	assert.Equal(t, "dump.sql", received.FileName)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "generated-id", response["session_id"])
+	assert.Equal(t, true, response["deferred"])
+}
+
+// Test для согласования размера чанка, предложенного клиентом
+func TestStartSession_PreferredChunkSize(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		CreateSessionFunc: func(params services.SessionParams) (*services.SessionInfo, error) {
+			assert.Equal(t, int64(1<<30), params.PreferredChunkSize)
+			return &services.SessionInfo{SessionID: "testhash", ChunkSize: 64 << 20}, nil
+		},
+	}
+	handler := handlers.NewStartHandler(mockService)
+
+	requestBody, _ := json.Marshal(map[string]interface{}{
+		"file_name":            "testfile",
+		"file_size":            2048,
+		"file_hash":            "testhash",
+		"preferred_chunk_size": 1 << 30,
+	})
+	req, err := http.NewRequest("POST", "/start", bytes.NewBuffer(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.StartSession(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, float64(64<<20), response["chunk_size"])
+	assert.Equal(t, float64(1<<30), response["preferred_chunk_size"])
+}
+
+// Test для сессии с адресацией чанков по смещению
+func TestStartSession_OffsetMode(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		CreateSessionFunc: func(params services.SessionParams) (*services.SessionInfo, error) {
+			assert.Equal(t, services.ChunkModeOffset, params.ChunkMode)
+			return &services.SessionInfo{
+				SessionID:    "testhash",
+				ChunkSize:    4 << 20,
+				ChunkMode:    services.ChunkModeOffset,
+				MinChunkSize: 256 << 10,
+				MaxChunkSize: 64 << 20,
+			}, nil
+		},
+	}
+	handler := handlers.NewStartHandler(mockService)
+
+	requestBody, _ := json.Marshal(map[string]interface{}{
+		"file_name":  "testfile",
+		"file_size":  2048,
+		"file_hash":  "testhash",
+		"chunk_mode": "offset",
+	})
+	req, err := http.NewRequest("POST", "/start", bytes.NewBuffer(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.StartSession(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "offset", response["chunk_mode"])
+	assert.Equal(t, float64(256<<10), response["min_chunk_size"])
+	assert.Equal(t, float64(64<<20), response["max_chunk_size"])
+}
+
+// Test для неизвестного режима адресации чанков
+func TestStartSession_UnknownChunkMode(t *testing.T) {
+	handler := handlers.NewStartHandler(&services.SessionServiceMock{})
+
+	requestBody, _ := json.Marshal(map[string]interface{}{
+		"file_name":  "testfile",
+		"file_size":  2048,
+		"file_hash":  "testhash",
+		"chunk_mode": "random",
+	})
+	req, err := http.NewRequest("POST", "/start", bytes.NewBuffer(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.StartSession(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+// Test для мгновенной загрузки: содержимое с таким хешем уже хранится
+func TestStartSession_AlreadyPresent(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		CreateSessionFunc: func(params services.SessionParams) (*services.SessionInfo, error) {
+			return &services.SessionInfo{SessionID: params.FileHash, Status: "already_present", StoredName: "copy(1).bin"}, nil
+		},
+	}
+	handler := handlers.NewStartHandler(mockService)
+
+	requestBody, _ := json.Marshal(map[string]interface{}{
+		"file_name": "copy.bin",
+		"file_size": 2048,
+		"file_hash": "knownhash",
+	})
+	req, err := http.NewRequest("POST", "/start", bytes.NewBuffer(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.StartSession(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "already_present", response["status"])
+	assert.Equal(t, "knownhash", response["session_id"])
+	assert.Equal(t, "copy(1).bin", response["file_name"])
+	assert.NotContains(t, response, "chunk_size")
+}
+
+// Test: архив, загруженный мгновенно, распаковывается в каталог, разрешённый в пространстве имён
+func TestStartSession_AlreadyPresentExtractsToResolvedDir(t *testing.T) {
+	var extractDir string
+	mockService := &services.SessionServiceMock{
+		CreateSessionFunc: func(params services.SessionParams) (*services.SessionInfo, error) {
+			return &services.SessionInfo{SessionID: params.FileHash, Status: "already_present", StoredName: "team/site.zip", ExtractDir: "team/site"}, nil
+		},
+		FileService: &services.FileServiceMock{
+			ExtractArchiveFunc: func(name, archivePath, dir string, meta services.FileMeta) (*services.ExtractionResult, error) {
+				extractDir = dir
+				return &services.ExtractionResult{Directory: dir, Status: "completed"}, nil
+			},
+		},
+	}
+	handler := handlers.NewStartHandler(mockService)
+
+	requestBody, _ := json.Marshal(map[string]interface{}{
+		"file_name":   "site.zip",
+		"file_size":   2048,
+		"file_hash":   "knownhash",
+		"namespace":   "team",
+		"extract":     true,
+		"extract_dir": "site",
+	})
+	req, err := http.NewRequest("POST", "/start", bytes.NewBuffer(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.StartSession(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "team/site", extractDir)
+}
+
+// Test: ошибка распаковки мгновенно загруженного архива попадает в ответ
+func TestStartSession_AlreadyPresentReportsExtractionError(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		CreateSessionFunc: func(params services.SessionParams) (*services.SessionInfo, error) {
+			return &services.SessionInfo{SessionID: params.FileHash, Status: "already_present", StoredName: "site.zip"}, nil
+		},
+		FileService: &services.FileServiceMock{
+			ExtractArchiveFunc: func(name, archivePath, dir string, meta services.FileMeta) (*services.ExtractionResult, error) {
+				return nil, errors.New("archive is corrupt")
+			},
+		},
+	}
+	handler := handlers.NewStartHandler(mockService)
+
+	requestBody, _ := json.Marshal(map[string]interface{}{
+		"file_name": "site.zip",
+		"file_size": 2048,
+		"file_hash": "knownhash",
+		"extract":   true,
+	})
+	req, err := http.NewRequest("POST", "/start", bytes.NewBuffer(requestBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.StartSession(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		Extraction services.ExtractionResult `json:"extraction"`
+	}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, services.ExtractionFailed, response.Extraction.Status)
+	assert.Equal(t, "archive is corrupt", response.Extraction.Error)
+}
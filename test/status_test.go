@@ -111,3 +111,29 @@ func TestGetUploadStatus_Success(t *testing.T) {
 	assert.Equal(t, float64(5), response["uploaded_chunks"]) // JSON unmarshal возвращает числа как float64
 	assert.Equal(t, float64(8), response["total_chunks"])
 }
+
+// Test для списка сессий
+func TestListSessions_Success(t *testing.T) {
+	mockService := &services.SessionServiceMock{
+		ListSessionsFunc: func() ([]map[string]interface{}, error) {
+			return []map[string]interface{}{
+				{"session_id": "abc", "status": "in_progress"},
+			}, nil
+		},
+	}
+	handler := handlers.NewStatusHandler(mockService)
+
+	req, err := http.NewRequest("GET", "/upload/sessions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ListSessions(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	sessions := response["sessions"].([]interface{})
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, "abc", sessions[0].(map[string]interface{})["session_id"])
+}
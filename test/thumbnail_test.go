@@ -0,0 +1,148 @@
+package test
+
+import (
+	"BASProject/config"
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestImage(t *testing.T, path string, width, height int, encode func(*bytes.Buffer, image.Image) error) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func decodeDimensions(t *testing.T, path string) (int, int, string) {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	cfg, format, err := image.DecodeConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Width, cfg.Height, format
+}
+
+func TestThumbnailProcessor(t *testing.T) {
+	dir := t.TempDir()
+	pipeline := newTestPipeline(t, dir, config.PipelineConfig{Processors: []config.ProcessorConfig{
+		{Type: "thumbnail", Options: map[string]string{"sizes": "32, 100, 400"}},
+	}})
+
+	jpegPath := filepath.Join(dir, "photo.jpg")
+	writeTestImage(t, jpegPath, 300, 150, func(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) })
+	result := pipeline.Run(services.ProcessedFile{Name: "photo.jpg", Path: jpegPath})
+	assert.Equal(t, services.FileStatusAvailable, result.Status)
+	assert.Contains(t, result.Outcomes[0].Message, "generated 3 thumbnails from 300x150 jpeg")
+
+	width, height, format := decodeDimensions(t, filepath.Join(dir, ".thumbnails", "photo.jpg", "32.jpg"))
+	assert.Equal(t, []interface{}{32, 16, "jpeg"}, []interface{}{width, height, format})
+	width, height, _ = decodeDimensions(t, filepath.Join(dir, ".thumbnails", "photo.jpg", "100.jpg"))
+	assert.Equal(t, []int{100, 50}, []int{width, height})
+	// Изображение не увеличивается
+	width, height, _ = decodeDimensions(t, filepath.Join(dir, ".thumbnails", "photo.jpg", "400.jpg"))
+	assert.Equal(t, []int{300, 150}, []int{width, height})
+
+	// PNG сохраняется в PNG, вертикальное изображение вписывается по высоте
+	pngPath := filepath.Join(dir, "albums", "tall.png")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(pngPath), 0755))
+	writeTestImage(t, pngPath, 50, 200, func(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) })
+	pipeline.Run(services.ProcessedFile{Name: "albums/tall.png", Path: pngPath})
+	width, height, format = decodeDimensions(t, filepath.Join(dir, ".thumbnails", "albums", "tall.png", "100.png"))
+	assert.Equal(t, []interface{}{25, 100, "png"}, []interface{}{width, height, format})
+
+	// Миниатюры не попадают в список файлов
+	files, err := services.NewFileService(nil, dir).ListFiles()
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+}
+
+func TestThumbnailProcessor_SkipsNonImages(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("plain text"), 0644))
+	pipeline := newTestPipeline(t, dir, config.PipelineConfig{Processors: []config.ProcessorConfig{{Type: "thumbnail"}}})
+
+	result := pipeline.Run(services.ProcessedFile{Name: "notes.txt", Path: path})
+	assert.Equal(t, services.FileStatusAvailable, result.Status)
+	assert.Equal(t, "not an image, skipped", result.Outcomes[0].Message)
+	assert.NoDirExists(t, filepath.Join(dir, ".thumbnails"))
+
+	big := filepath.Join(dir, "big.png")
+	writeTestImage(t, big, 100, 100, func(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) })
+	pipeline = newTestPipeline(t, dir, config.PipelineConfig{Processors: []config.ProcessorConfig{
+		{Type: "thumbnail", Options: map[string]string{"max_pixels": "5000"}},
+	}})
+	result = pipeline.Run(services.ProcessedFile{Name: "big.png", Path: big})
+	assert.Contains(t, result.Outcomes[0].Message, "exceeds 5000 pixels")
+}
+
+func TestThumbnailProcessor_InvalidOptions(t *testing.T) {
+	for _, options := range []map[string]string{{"sizes": "0"}, {"sizes": "big"}, {"quality": "101"}, {"max_pixels": "-1"}} {
+		_, err := services.NewPipeline(services.NewFileService(nil, t.TempDir()), config.PipelineConfig{
+			Processors: []config.ProcessorConfig{{Type: "thumbnail", Options: options}},
+		})
+		assert.Error(t, err, options)
+	}
+}
+
+func TestThumbnailHandler(t *testing.T) {
+	dir := t.TempDir()
+	thumbPath := filepath.Join(dir, "thumb.png")
+	writeTestImage(t, thumbPath, 64, 32, func(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) })
+
+	var requested int
+	handler := handlers.NewFilesHandler(&services.FileServiceMock{
+		OpenThumbnailFunc: func(name string, size int) (services.FileReader, *services.Thumbnail, error) {
+			if name != "photos/cat.png" {
+				return nil, nil, services.ErrThumbnailNotFound
+			}
+			requested = size
+			reader, err := services.NewFileService(nil, dir).OpenFile("thumb.png")
+			return reader, &services.Thumbnail{Size: 64, Width: 64, Height: 32, ContentType: "image/png"}, err
+		},
+	})
+	router := mux.NewRouter()
+	router.HandleFunc("/thumbnails/{name:.+}", handler.Thumbnail)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/thumbnails/photos/cat.png?size=50", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 50, requested)
+	assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "64", rr.Header().Get("X-Thumbnail-Size"))
+	assert.Equal(t, "64x32", rr.Header().Get("X-Thumbnail-Dimensions"))
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/thumbnails/notes.txt", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/thumbnails/photos/cat.png?size=-5", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
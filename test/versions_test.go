@@ -0,0 +1,327 @@
+package test
+
+import (
+	"BASProject/config"
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// commitContent собирает «загрузку» с данным содержимым и переносит её в хранилище под именем name.
+func commitContent(t *testing.T, fileService *services.FileService, name, content string) (string, int, error) {
+	path, err := fileService.AssemblyPath(fmt.Sprintf("session-%d", len(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileService.CommitFile(name, path)
+}
+
+func readVersion(t *testing.T, fileService *services.FileService, name string, version int) string {
+	file, err := fileService.OpenVersion(name, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// Test: загрузка под занятым именем создаёт новую версию, а не report(1).pdf
+func TestCommitFile_CreatesVersions(t *testing.T) {
+	fileService := services.NewFileService(nil, t.TempDir())
+
+	for i, content := range []string{"one", "two!", "three"} {
+		name, version, err := commitContent(t, fileService, "docs/report.pdf", content)
+		assert.NoError(t, err)
+		assert.Equal(t, "docs/report.pdf", name)
+		assert.Equal(t, i+1, version)
+	}
+
+	versions, err := fileService.ListVersions("docs/report.pdf")
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 3) {
+		assert.Equal(t, 3, versions[0].Version)
+		assert.True(t, versions[0].Current)
+		assert.Equal(t, int64(5), versions[0].Size)
+		assert.Equal(t, 1, versions[2].Version)
+		assert.False(t, versions[2].Current)
+	}
+	assert.Equal(t, "one", readVersion(t, fileService, "docs/report.pdf", 1))
+	assert.Equal(t, "three", readVersion(t, fileService, "docs/report.pdf", 3))
+
+	// Прежние версии не попадают в список файлов
+	files, err := fileService.ListFiles()
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		assert.Equal(t, "docs/report.pdf", files[0].Name)
+		assert.Equal(t, 3, files[0].Version)
+	}
+	_, err = fileService.OpenFile(".versions/docs/report.pdf/1")
+	assert.ErrorIs(t, err, services.ErrFileNotFound)
+}
+
+// Test: версии файла a не пересекаются с версиями файлов a/1 и a/current
+func TestCommitFile_VersionPathsDoNotCollide(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+	for _, name := range []string{"a/1", "a/current"} {
+		for _, content := range []string{"nested", "nested 2"} {
+			_, _, err := commitContent(t, fileService, name, content)
+			assert.NoError(t, err)
+		}
+	}
+	assert.NoError(t, os.RemoveAll(filepath.Join(dir, "a")))
+
+	for i, content := range []string{"one", "two", "three"} {
+		name, version, err := commitContent(t, fileService, "a", content)
+		assert.NoError(t, err)
+		assert.Equal(t, "a", name)
+		assert.Equal(t, i+1, version)
+	}
+	versions, err := fileService.ListVersions("a")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+	assert.Equal(t, "one", readVersion(t, fileService, "a", 1))
+	assert.Equal(t, "two", readVersion(t, fileService, "a", 2))
+	assert.Equal(t, "nested", readVersion(t, fileService, "a/1", 1))
+}
+
+func TestCommitFile_Policies(t *testing.T) {
+	dir := t.TempDir()
+	fileService := services.NewFileService(nil, dir)
+	fileService.OnConflict = services.OnConflictOverwrite
+	fileService.Namespaces = map[string]config.NamespaceConfig{
+		"locked": {Root: "locked", OnConflict: services.OnConflictReject},
+		"legacy": {Root: "legacy", OnConflict: services.OnConflictRename},
+	}
+
+	// overwrite: содержимое заменяется без истории
+	commitContent(t, fileService, "a.txt", "old")
+	_, version, err := commitContent(t, fileService, "a.txt", "new!")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+	versions, _ := fileService.ListVersions("a.txt")
+	assert.Len(t, versions, 1)
+	assert.Equal(t, "new!", readVersion(t, fileService, "a.txt", 2))
+
+	// reject: занятое имя отклоняется и заранее, и при переносе
+	commitContent(t, fileService, "locked/a.txt", "old")
+	assert.ErrorIs(t, fileService.CheckConflict("locked/a.txt"), services.ErrFileExists)
+	assert.NoError(t, fileService.CheckConflict("locked/b.txt"))
+	_, _, err = commitContent(t, fileService, "locked/a.txt", "new!")
+	assert.ErrorIs(t, err, services.ErrFileExists)
+
+	// rename: прежнее поведение с суффиксом (n)
+	commitContent(t, fileService, "legacy/a.txt", "old")
+	name, version, err := commitContent(t, fileService, "legacy/a.txt", "new!")
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy/a(1).txt", name)
+	assert.Equal(t, 1, version)
+}
+
+// Test: параллельные загрузки под занятым именем при политике rename получают разные имена
+func TestCommitFile_RenameConcurrent(t *testing.T) {
+	fileService := services.NewFileService(nil, t.TempDir())
+	fileService.OnConflict = services.OnConflictRename
+	commitContent(t, fileService, "a.txt", "old")
+
+	paths := make([]string, 8)
+	for i := range paths {
+		path, err := fileService.AssemblyPath(fmt.Sprintf("rename-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("new %d", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths[i] = path
+	}
+	names := make([]string, len(paths))
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name, _, err := fileService.CommitFile("a.txt", path)
+			assert.NoError(t, err)
+			names[i] = name
+		}()
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for i, name := range names {
+		assert.False(t, seen[name], "%s stored twice", name)
+		seen[name] = true
+		assert.Equal(t, fmt.Sprintf("new %d", i), string(readStored(t, fileService, name)))
+	}
+	assert.Equal(t, "old", string(readStored(t, fileService, "a.txt")))
+}
+
+func TestPromoteAndDeleteVersions(t *testing.T) {
+	fileService := services.NewFileService(nil, t.TempDir())
+	commitContent(t, fileService, "a.txt", "one")
+	commitContent(t, fileService, "a.txt", "two!")
+
+	// Прежняя версия становится текущей, текущая сохраняется как прежняя
+	assert.NoError(t, fileService.PromoteVersion("a.txt", 1))
+	versions, err := fileService.ListVersions("a.txt")
+	assert.NoError(t, err)
+	if assert.Len(t, versions, 2) {
+		assert.Equal(t, 2, versions[0].Version)
+		assert.False(t, versions[0].Current)
+		assert.Equal(t, 1, versions[1].Version)
+		assert.True(t, versions[1].Current)
+	}
+	file, err := fileService.OpenFile("a.txt")
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(file)
+	file.Close()
+	assert.Equal(t, "one", string(data))
+
+	// Следующая загрузка получает номер после наибольшего
+	_, version, err := commitContent(t, fileService, "a.txt", "three")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, version)
+
+	assert.ErrorIs(t, fileService.PromoteVersion("a.txt", 7), services.ErrVersionNotFound)
+	assert.ErrorIs(t, fileService.DeleteVersion("a.txt", 7), services.ErrVersionNotFound)
+
+	// Удаление текущей версии возвращает новейшую прежнюю
+	assert.NoError(t, fileService.DeleteVersion("a.txt", 3))
+	assert.Equal(t, "two!", readVersion(t, fileService, "a.txt", 2))
+	versions, _ = fileService.ListVersions("a.txt")
+	if assert.Len(t, versions, 2) {
+		assert.True(t, versions[0].Current)
+		assert.Equal(t, 2, versions[0].Version)
+	}
+
+	// Удаление последних версий удаляет файл целиком
+	assert.NoError(t, fileService.DeleteVersion("a.txt", 1))
+	assert.NoError(t, fileService.DeleteVersion("a.txt", 2))
+	_, err = fileService.ListVersions("a.txt")
+	assert.ErrorIs(t, err, services.ErrFileNotFound)
+	assert.NoDirExists(t, filepath.Join(fileService.LocalPath, ".versions", "a.txt"))
+}
+
+// Test: отклонённая конвейером новая версия не лишает имя прежнего содержимого
+func TestPipeline_RestoresPreviousVersion(t *testing.T) {
+	dir := t.TempDir()
+	pipeline := newTestPipeline(t, dir, config.PipelineConfig{OnFailure: "quarantine", Processors: []config.ProcessorConfig{
+		{Type: "command", Command: []string{"false"}},
+	}})
+	fileService := pipeline.FileService
+	commitContent(t, fileService, "a.txt", "good")
+	commitContent(t, fileService, "a.txt", "bad!")
+
+	result := pipeline.Run(services.ProcessedFile{Name: "a.txt", Path: filepath.Join(dir, "a.txt")})
+	assert.Equal(t, services.FileStatusQuarantined, result.Status)
+	assert.Equal(t, 1, result.Restored)
+	assert.Equal(t, "good", readVersion(t, fileService, "a.txt", 1))
+}
+
+func TestFilesHandler_Versions(t *testing.T) {
+	fileService := services.NewFileService(nil, t.TempDir())
+	commitContent(t, fileService, "a.txt", "one")
+	commitContent(t, fileService, "a.txt", "two!")
+
+	handler := handlers.NewFilesHandler(fileService)
+	router := mux.NewRouter()
+	router.HandleFunc("/versions/{name:.+}/{version:[0-9]+}/promote", handler.PromoteVersion).Methods("POST")
+	router.HandleFunc("/versions/{name:.+}/{version:[0-9]+}", handler.DeleteVersion).Methods("DELETE")
+	router.HandleFunc("/versions/{name:.+}", handler.ListVersions).Methods("GET")
+	router.HandleFunc("/files/{name:.+}", handler.DownloadFile).Methods("GET")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/versions/a.txt", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		Versions []services.FileVersion `json:"versions"`
+	}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Len(t, response.Versions, 2)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/files/a.txt?version=1", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "one", rr.Body.String())
+	assert.Equal(t, "1", rr.Header().Get("X-File-Version"))
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/files/a.txt?version=9", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/files/a.txt?version=x", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/versions/a.txt/1/promote", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/files/a.txt", nil))
+	assert.Equal(t, "one", rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/versions/a.txt/2", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/versions/a.txt/2", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/versions/missing.txt", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+// Test: при политике reject занятое имя возвращает 409 при завершении загрузки
+func TestCompleteUpload_FileExists(t *testing.T) {
+	var deleted bool
+	mockService := &services.SessionServiceMock{
+		GetUploadStatusFunc: func(sessionID string) (map[string]interface{}, error) {
+			return map[string]interface{}{
+				"completed": true,
+				"status":    "completed",
+				"file_name": "taken.bin",
+				"file_size": int64(4),
+			}, nil
+		},
+		DeleteSessionFunc: func(sessionID string) error {
+			deleted = true
+			return nil
+		},
+		FileService: &services.FileServiceMock{
+			CommitFileFunc: func(name, assembledPath string) (string, int, error) {
+				return "", 0, fmt.Errorf("%w: %s", services.ErrFileExists, name)
+			},
+		},
+	}
+	handler := handlers.NewUploadChunkHandler(mockService)
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.HandleFunc("/complete/{session_id}", handler.CompleteUpload)
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/complete/session123", nil))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.True(t, deleted)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, "File already exists.", response["message"])
+}
@@ -0,0 +1,256 @@
+package test
+
+import (
+	"BASProject/config"
+	"BASProject/internal/handlers"
+	"BASProject/internal/services"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// webhookReceiver записывает полученные уведомления и отвечает статусами из statuses
+// (после их исчерпания — 200).
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	attempts int
+	requests []*http.Request
+	events   []services.WebhookEvent
+	bodies   [][]byte
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.attempts++
+	if len(rcv.statuses) > 0 {
+		status := rcv.statuses[0]
+		rcv.statuses = rcv.statuses[1:]
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+	}
+	var event services.WebhookEvent
+	json.Unmarshal(body, &event)
+	rcv.requests = append(rcv.requests, r)
+	rcv.events = append(rcv.events, event)
+	rcv.bodies = append(rcv.bodies, body)
+}
+
+func newWebhookService(t *testing.T, targets ...config.WebhookTarget) *services.WebhookService {
+	cfg := config.DefaultWebhooks()
+	cfg.Targets = targets
+	cfg.InitialBackoff = time.Millisecond
+	cfg.MaxBackoff = 5 * time.Millisecond
+	cfg.MaxAttempts = 3
+	cfg.ChunkBatchInterval = time.Hour
+	webhooks := services.NewWebhookService(nil, cfg)
+	t.Cleanup(webhooks.Close)
+	return webhooks
+}
+
+func waitForDeadLetters(t *testing.T, webhooks *services.WebhookService, count int) []services.DeadLetter {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		letters, err := webhooks.DeadLetters()
+		assert.NoError(t, err)
+		if len(letters) >= count || time.Now().After(deadline) {
+			return letters
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebhook_SignedDelivery(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	webhooks := newWebhookService(t, config.WebhookTarget{URL: server.URL, Secret: "s3cret"})
+	webhooks.Emit(services.EventSessionCreated, map[string]interface{}{"session_id": "abc"})
+	// Без явной подписки chunk.received не отправляется
+	webhooks.ChunkReceived("abc", 1, 100)
+	webhooks.Close()
+
+	if !assert.Len(t, receiver.events, 1) {
+		return
+	}
+	event := receiver.events[0]
+	assert.Equal(t, services.EventSessionCreated, event.Type)
+	assert.Equal(t, "abc", event.Data["session_id"])
+	assert.NotEmpty(t, event.ID)
+
+	req := receiver.requests[0]
+	assert.Equal(t, event.ID, req.Header.Get("X-Webhook-ID"))
+	assert.Equal(t, services.EventSessionCreated, req.Header.Get("X-Webhook-Event"))
+	expected := "sha256=" + services.SignWebhook("s3cret", req.Header.Get("X-Webhook-Timestamp"), receiver.bodies[0])
+	assert.Equal(t, expected, req.Header.Get("X-Webhook-Signature"))
+}
+
+func TestWebhook_EventFilter(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	webhooks := newWebhookService(t, config.WebhookTarget{URL: server.URL, Events: []string{services.EventUploadCompleted}})
+	webhooks.Emit(services.EventSessionCreated, map[string]interface{}{"session_id": "abc"})
+	webhooks.Emit(services.EventUploadCompleted, map[string]interface{}{"session_id": "abc"})
+	webhooks.Close()
+
+	if assert.Len(t, receiver.events, 1) {
+		assert.Equal(t, services.EventUploadCompleted, receiver.events[0].Type)
+	}
+	assert.Empty(t, receiver.requests[0].Header.Get("X-Webhook-Signature"))
+}
+
+func TestWebhook_RetriesWithBackoff(t *testing.T) {
+	receiver := &webhookReceiver{statuses: []int{http.StatusInternalServerError, http.StatusTooManyRequests}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	webhooks := newWebhookService(t, config.WebhookTarget{URL: server.URL})
+	webhooks.Emit(services.EventSessionDeleted, map[string]interface{}{"session_id": "abc"})
+	webhooks.Close()
+
+	assert.Equal(t, 3, receiver.attempts)
+	assert.Len(t, receiver.events, 1)
+	letters, _ := webhooks.DeadLetters()
+	assert.Empty(t, letters)
+}
+
+func TestWebhook_DeadLetterAndRedeliver(t *testing.T) {
+	receiver := &webhookReceiver{statuses: []int{500, 500, 500}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	webhooks := newWebhookService(t, config.WebhookTarget{URL: server.URL})
+	webhooks.Emit(services.EventUploadFailed, map[string]interface{}{"session_id": "abc"})
+
+	letters := waitForDeadLetters(t, webhooks, 1)
+	if !assert.Len(t, letters, 1) {
+		return
+	}
+	assert.Equal(t, server.URL, letters[0].Target)
+	assert.Equal(t, 3, letters[0].Attempts)
+	assert.Equal(t, services.EventUploadFailed, letters[0].Event.Type)
+
+	queued, err := webhooks.RedeliverDeadLetters()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, queued)
+	webhooks.Close()
+
+	if assert.Len(t, receiver.events, 1) {
+		assert.Equal(t, letters[0].Event.ID, receiver.events[0].ID)
+	}
+	letters, _ = webhooks.DeadLetters()
+	assert.Empty(t, letters)
+}
+
+func TestWebhook_PermanentFailureIsNotRetried(t *testing.T) {
+	receiver := &webhookReceiver{statuses: []int{http.StatusBadRequest}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	webhooks := newWebhookService(t, config.WebhookTarget{URL: server.URL})
+	webhooks.Emit(services.EventSessionCreated, map[string]interface{}{"session_id": "abc"})
+	webhooks.Close()
+
+	assert.Equal(t, 1, receiver.attempts)
+	letters, _ := webhooks.DeadLetters()
+	assert.Len(t, letters, 1)
+}
+
+func TestWebhook_ChunkEventsAreBatched(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	webhooks := newWebhookService(t, config.WebhookTarget{URL: server.URL, Events: []string{services.EventChunkReceived}})
+	webhooks.ChunkReceived("abc", 1, 100)
+	webhooks.ChunkReceived("abc", 2, 100)
+	webhooks.ChunkReceived("abc", 3, 50)
+	webhooks.Close()
+
+	if !assert.Len(t, receiver.events, 1) {
+		return
+	}
+	data := receiver.events[0].Data
+	assert.Equal(t, "abc", data["session_id"])
+	assert.Equal(t, float64(3), data["count"])
+	assert.Equal(t, float64(250), data["bytes"])
+	assert.Equal(t, []interface{}{float64(1), float64(2), float64(3)}, data["chunks"])
+}
+
+func TestWebhook_HandlersEmitLifecycleEvents(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	webhooks := newWebhookService(t, config.WebhookTarget{URL: server.URL})
+
+	mockService := &services.SessionServiceMock{
+		CreateSessionFunc: func(params services.SessionParams) (*services.SessionInfo, error) {
+			return &services.SessionInfo{SessionID: "test-session-id", Status: "created", ChunkSize: 1024}, nil
+		},
+		DeleteSessionFunc: func(sessionID string) error { return nil },
+	}
+	startHandler := handlers.NewStartHandler(mockService)
+	startHandler.Webhooks = webhooks
+	requestBody, _ := json.Marshal(map[string]interface{}{
+		"file_name": "testfile",
+		"file_size": 2048,
+		"file_hash": "testhash",
+	})
+	rr := httptest.NewRecorder()
+	startHandler.StartSession(rr, httptest.NewRequest("POST", "/upload/start", bytes.NewReader(requestBody)))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	deleteHandler := handlers.NewDeleteHandler(mockService)
+	deleteHandler.Webhooks = webhooks
+	req := mux.SetURLVars(httptest.NewRequest("DELETE", "/upload/test-session-id", nil), map[string]string{"session_id": "test-session-id"})
+	rr = httptest.NewRecorder()
+	deleteHandler.DeleteSession(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	webhooks.Close()
+	if assert.Len(t, receiver.events, 2) {
+		assert.Equal(t, services.EventSessionCreated, receiver.events[0].Type)
+		assert.Equal(t, "testfile", receiver.events[0].Data["file_name"])
+		assert.Equal(t, services.EventSessionDeleted, receiver.events[1].Type)
+	}
+}
+
+func TestWebhooksHandler_DeadLetters(t *testing.T) {
+	receiver := &webhookReceiver{statuses: []int{http.StatusNotFound}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+	webhooks := newWebhookService(t, config.WebhookTarget{URL: server.URL})
+	webhooks.Emit(services.EventSessionCreated, map[string]interface{}{"session_id": "abc"})
+	waitForDeadLetters(t, webhooks, 1)
+
+	handler := handlers.NewWebhooksHandler(webhooks)
+	rr := httptest.NewRecorder()
+	handler.ListDeadLetters(rr, httptest.NewRequest("GET", "/admin/webhooks/dead-letters", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, float64(1), response["count"])
+
+	rr = httptest.NewRecorder()
+	handler.RedeliverDeadLetters(rr, httptest.NewRequest("POST", "/admin/webhooks/dead-letters/redeliver", nil))
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	json.NewDecoder(rr.Body).Decode(&response)
+	assert.Equal(t, float64(1), response["queued"])
+	webhooks.Close()
+	assert.Len(t, receiver.events, 1)
+}